@@ -0,0 +1,345 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"zgo.at/goatcounter/cfg"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zvalidate"
+)
+
+// Kinds of alerts.
+const (
+	AlertSpike  = "spike"   // Pageviews above threshold× the baseline.
+	AlertDrop   = "drop"    // Pageviews below threshold% of the baseline.
+	AlertNoHits = "no_hits" // No hits for threshold hours.
+	AlertNewRef = "new_ref" // New referrer with at least threshold pageviews.
+	AlertGoal   = "goal"    // Goal reached at least threshold times.
+)
+
+// AlertKinds are all the alert kinds, with a description.
+var AlertKinds = [][2]string{
+	{AlertSpike, "Traffic spike: pageviews at least N× the usual"},
+	{AlertDrop, "Traffic drop: pageviews at most N% of the usual"},
+	{AlertNoHits, "No pageviews received for N hours"},
+	{AlertNewRef, "New referrer with at least N pageviews"},
+	{AlertGoal, "Goal path or event reached at least N times"},
+}
+
+const (
+	alertBaselineDays = 28 // Days to calculate the usual pageviews over.
+	alertMinBaseline  = 10 // Pageviews a day before spikes and drops are reported.
+
+	// Number of referrers to look up in one query, so we don't run in to the
+	// SQLite parameter limit of 999.
+	alertRefChunk = 500
+)
+
+// Alert is a rule to send an email when the traffic matches a condition.
+//
+// The spike, drop, new referrer, and goal alerts look at the last 24 hours;
+// spikes and drops are compared against the average pageviews a day in the
+// four weeks before that.
+type Alert struct {
+	ID        int64      `db:"id" json:"id"`
+	Site      int64      `db:"site" json:"-"`
+	Kind      string     `db:"kind" json:"kind"`
+	Threshold int        `db:"threshold" json:"threshold"`
+	Goal      string     `db:"goal" json:"goal"`         // Path or event name for the goal alert.
+	Cooldown  int        `db:"cooldown" json:"cooldown"` // Hours to wait before sending this alert again.
+	LastSent  *time.Time `db:"last_sent" json:"last_sent"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
+
+// Defaults sets fields to default values, unless they're already set.
+func (a *Alert) Defaults(ctx context.Context) {
+	if a.Site == 0 {
+		a.Site = MustGetSite(ctx).ID
+	}
+	a.Goal = strings.TrimSpace(a.Goal)
+	if a.Kind != AlertGoal {
+		a.Goal = ""
+	}
+	if a.Cooldown == 0 {
+		a.Cooldown = 24
+	}
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = Now()
+	}
+}
+
+// Validate the object.
+func (a *Alert) Validate(ctx context.Context) error {
+	v := zvalidate.New()
+
+	v.Required("site", a.Site)
+	v.Include("kind", a.Kind, []string{AlertSpike, AlertDrop, AlertNoHits, AlertNewRef, AlertGoal})
+	if a.Kind == AlertDrop {
+		v.Range("threshold", int64(a.Threshold), 1, 99)
+	} else {
+		v.Range("threshold", int64(a.Threshold), 1, 0)
+	}
+	v.Range("cooldown", int64(a.Cooldown), 1, 24*30)
+	v.Len("goal", a.Goal, 0, 2048)
+	if a.Kind == AlertGoal {
+		v.Required("goal", a.Goal)
+	}
+
+	return v.ErrorOrNil()
+}
+
+// Insert a new row.
+func (a *Alert) Insert(ctx context.Context) error {
+	if a.ID > 0 {
+		return errors.New("ID > 0")
+	}
+
+	a.Defaults(ctx)
+	err := a.Validate(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `insert into alerts (site, kind, threshold, goal, cooldown, created_at) values ($1, $2, $3, $4, $5, $6)`
+	args := []interface{}{a.Site, a.Kind, a.Threshold, a.Goal, a.Cooldown, a.CreatedAt.Format(zdb.Date)}
+	if cfg.PgSQL {
+		err = zdb.MustGet(ctx).GetContext(ctx, &a.ID, query+" returning id", args...)
+		return errors.Wrap(err, "Alert.Insert")
+	}
+
+	res, err := zdb.MustGet(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "Alert.Insert")
+	}
+	a.ID, err = res.LastInsertId()
+	return errors.Wrap(err, "Alert.Insert")
+}
+
+// Delete an alert.
+func (a *Alert) Delete(ctx context.Context, id int64) error {
+	_, err := zdb.MustGet(ctx).ExecContext(ctx,
+		`delete from alerts where site=$1 and id=$2`, MustGetSite(ctx).ID, id)
+	return errors.Wrap(err, "Alert.Delete")
+}
+
+// String describes the alert.
+func (a Alert) String() string {
+	switch a.Kind {
+	case AlertSpike:
+		return fmt.Sprintf("Traffic spike: pageviews at least %d× the usual", a.Threshold)
+	case AlertDrop:
+		return fmt.Sprintf("Traffic drop: pageviews at most %d%% of the usual", a.Threshold)
+	case AlertNoHits:
+		return fmt.Sprintf("No pageviews received for %d hours", a.Threshold)
+	case AlertNewRef:
+		return fmt.Sprintf("New referrer with at least %d pageviews", a.Threshold)
+	case AlertGoal:
+		return fmt.Sprintf("Goal %q reached at least %d times", a.Goal, a.Threshold)
+	}
+	return a.Kind
+}
+
+// Cooling reports if the alert was sent less than Cooldown hours before now.
+func (a Alert) Cooling(now time.Time) bool {
+	return a.LastSent != nil &&
+		a.LastSent.Add(time.Duration(a.Cooldown)*time.Hour).After(now)
+}
+
+// Check if the alert condition is met at now.
+//
+// The returned message is empty if it's not.
+func (a Alert) Check(ctx context.Context, now time.Time) (string, error) {
+	var (
+		db    = zdb.MustGet(ctx)
+		site  = MustGetSite(ctx)
+		since = now.Add(-24 * time.Hour)
+	)
+
+	switch a.Kind {
+	case AlertSpike, AlertDrop:
+		var count, baseline int
+		err := db.GetContext(ctx, &count, `/* Alert.Check: count */
+			select count(*) from hits
+			where site=$1 and bot=0 and event=0 and status=0 and created_at >= $2 and created_at < $3`,
+			site.ID, since.Format(zdb.Date), now.Format(zdb.Date))
+		if err != nil {
+			return "", errors.Wrap(err, "Alert.Check")
+		}
+		err = db.GetContext(ctx, &baseline, `/* Alert.Check: baseline */
+			select count(*) from hits
+			where site=$1 and bot=0 and event=0 and status=0 and created_at >= $2 and created_at < $3`,
+			site.ID, since.Add(-alertBaselineDays*24*time.Hour).Format(zdb.Date), since.Format(zdb.Date))
+		if err != nil {
+			return "", errors.Wrap(err, "Alert.Check")
+		}
+
+		avg := float64(baseline) / alertBaselineDays
+		if avg < alertMinBaseline {
+			return "", nil
+		}
+		if a.Kind == AlertSpike && float64(count) >= avg*float64(a.Threshold) {
+			return fmt.Sprintf("%d pageviews in the last 24 hours; that's %.1f× the usual %.0f a day.",
+				count, float64(count)/avg, avg), nil
+		}
+		if a.Kind == AlertDrop && float64(count) <= avg*float64(a.Threshold)/100 {
+			return fmt.Sprintf("%d pageviews in the last 24 hours; that's %.0f%% of the usual %.0f a day.",
+				count, float64(count)/avg*100, avg), nil
+		}
+		return "", nil
+
+	case AlertNoHits:
+		if !site.ReceivedData {
+			return "", nil
+		}
+		var n int
+		err := db.GetContext(ctx, &n, `/* Alert.Check: no hits */
+			select count(*) from hits where site=$1 and created_at >= $2`,
+			site.ID, now.Add(-time.Duration(a.Threshold)*time.Hour).Format(zdb.Date))
+		if err != nil {
+			return "", errors.Wrap(err, "Alert.Check")
+		}
+		if n > 0 {
+			return "", nil
+		}
+		return fmt.Sprintf("No pageviews were received in the last %d hours; "+
+			"check that the tracking code is still on your site.", a.Threshold), nil
+
+	case AlertNewRef:
+		var refs []struct {
+			Ref   string `db:"ref"`
+			Count int    `db:"count"`
+		}
+		err := db.SelectContext(ctx, &refs, `/* Alert.Check: new ref */
+			select ref, count(*) as count from hits
+			where site=$1 and bot=0 and created_at >= $2 and ref != '' and channel != 'internal'
+			group by ref
+			having count(*) >= $3
+			order by count desc, ref`,
+			site.ID, since.Format(zdb.Date), a.Threshold)
+		if err != nil {
+			return "", errors.Wrap(err, "Alert.Check")
+		}
+		if len(refs) == 0 {
+			return "", nil
+		}
+
+		names := make([]string, 0, len(refs))
+		for _, r := range refs {
+			names = append(names, r.Ref)
+		}
+		var seen []string
+		for i := 0; i < len(names); i += alertRefChunk {
+			j := i + alertRefChunk
+			if j > len(names) {
+				j = len(names)
+			}
+
+			query, args, err := sqlx.In(`/* Alert.Check: seen refs */
+				select distinct ref from ref_stats where site=? and day >= ? and day < ? and ref in (?)`,
+				site.ID, since.Add(-alertBaselineDays*24*time.Hour).Format("2006-01-02"),
+				since.Format("2006-01-02"), names[i:j])
+			if err != nil {
+				return "", errors.Wrap(err, "Alert.Check")
+			}
+			var s []string
+			err = db.SelectContext(ctx, &s, db.Rebind(query), args...)
+			if err != nil {
+				return "", errors.Wrap(err, "Alert.Check")
+			}
+			seen = append(seen, s...)
+		}
+		old := make(map[string]struct{}, len(seen))
+		for _, s := range seen {
+			old[s] = struct{}{}
+		}
+
+		var msg []string
+		for _, r := range refs {
+			if _, ok := old[r.Ref]; !ok {
+				msg = append(msg, fmt.Sprintf("%s: %d pageviews", r.Ref, r.Count))
+			}
+		}
+		if len(msg) == 0 {
+			return "", nil
+		}
+		return "New referrers in the last 24 hours:\n" + strings.Join(msg, "\n"), nil
+
+	case AlertGoal:
+		var n int
+		err := db.GetContext(ctx, &n, `/* Alert.Check: goal */
+			select count(*) from hits where site=$1 and bot=0 and path=$2 and created_at >= $3`,
+			site.ID, a.Goal, since.Format(zdb.Date))
+		if err != nil {
+			return "", errors.Wrap(err, "Alert.Check")
+		}
+		if n < a.Threshold {
+			return "", nil
+		}
+		return fmt.Sprintf("%q was reached %d times in the last 24 hours.", a.Goal, n), nil
+	}
+
+	return "", errors.Errorf("Alert.Check: unknown kind %q", a.Kind)
+}
+
+// Sent records that the alert was sent with the message.
+func (a *Alert) Sent(ctx context.Context, msg string, now time.Time) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		_, err := tx.ExecContext(ctx, `update alerts set last_sent=$1 where id=$2`,
+			now.Format(zdb.Date), a.ID)
+		if err != nil {
+			return errors.Wrap(err, "Alert.Sent")
+		}
+		_, err = tx.ExecContext(ctx,
+			`insert into alert_history (site, alert, message, sent_at) values ($1, $2, $3, $4)`,
+			a.Site, a.ID, msg, now.Format(zdb.Date))
+		if err != nil {
+			return errors.Wrap(err, "Alert.Sent")
+		}
+		a.LastSent = &now
+		return nil
+	})
+}
+
+// Alerts is a list of alerts.
+type Alerts []Alert
+
+// List all alerts for the current site.
+func (a *Alerts) List(ctx context.Context) error {
+	return errors.Wrap(zdb.MustGet(ctx).SelectContext(ctx, a,
+		`select * from alerts where site=$1 order by created_at, id`,
+		MustGetSite(ctx).ID), "Alerts.List")
+}
+
+// ListAll lists the alerts for all sites.
+func (a *Alerts) ListAll(ctx context.Context) error {
+	return errors.Wrap(zdb.MustGet(ctx).SelectContext(ctx, a,
+		`select * from alerts order by site, id`), "Alerts.ListAll")
+}
+
+// AlertSent is an alert that was sent.
+type AlertSent struct {
+	ID      int64     `db:"id" json:"id"`
+	Site    int64     `db:"site" json:"-"`
+	Alert   int64     `db:"alert" json:"alert"`
+	Message string    `db:"message" json:"message"`
+	SentAt  time.Time `db:"sent_at" json:"sent_at"`
+}
+
+// AlertHistory is a list of sent alerts.
+type AlertHistory []AlertSent
+
+// List the most recently sent alerts for the current site.
+func (h *AlertHistory) List(ctx context.Context, limit int) error {
+	return errors.Wrap(zdb.MustGet(ctx).SelectContext(ctx, h,
+		`select * from alert_history where site=$1 order by sent_at desc, id desc limit $2`,
+		MustGetSite(ctx).ID, limit), "AlertHistory.List")
+}
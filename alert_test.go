@@ -0,0 +1,151 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestAlertValidate(t *testing.T) {
+	tests := []struct {
+		in      Alert
+		wantErr string
+	}{
+		{Alert{Site: 1, Kind: AlertSpike, Threshold: 3, Cooldown: 24}, ""},
+		{Alert{Site: 1, Kind: "x", Threshold: 3, Cooldown: 24}, "kind"},
+		{Alert{Site: 1, Kind: AlertSpike, Threshold: 0, Cooldown: 24}, "threshold"},
+		{Alert{Site: 1, Kind: AlertDrop, Threshold: 100, Cooldown: 24}, "threshold"},
+		{Alert{Site: 1, Kind: AlertGoal, Threshold: 5, Cooldown: 24}, "goal"},
+		{Alert{Site: 1, Kind: AlertGoal, Threshold: 5, Goal: "/signup", Cooldown: 24}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in.String(), func(t *testing.T) {
+			err := tt.in.Validate(nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAlertCheck(t *testing.T) {
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+
+	// 20 pageviews a day for four weeks from example.org, and whatever the
+	// test adds in the last 24 hours.
+	setup := func(t *testing.T, recent ...Hit) (func(Alert) string, func()) {
+		ctx, clean := gctest.DB(t)
+
+		var hits []Hit
+		for d := 2; d <= 29; d++ {
+			for i := 0; i < 20; i++ {
+				hits = append(hits, Hit{Path: "/a", Ref: "example.org",
+					CreatedAt: now.Add(-time.Duration(d) * 24 * time.Hour)})
+			}
+		}
+		gctest.StoreHits(ctx, t, append(hits, recent...)...)
+
+		var site Site
+		err := site.ByID(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx = WithSite(ctx, &site)
+
+		return func(a Alert) string {
+			msg, err := a.Check(ctx, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return msg
+		}, clean
+	}
+
+	many := func(n int, h Hit) []Hit {
+		hits := make([]Hit, n)
+		for i := range hits {
+			hits[i] = h
+		}
+		return hits
+	}
+
+	t.Run("spike", func(t *testing.T) {
+		check, clean := setup(t, many(70, Hit{Path: "/a", CreatedAt: now.Add(-time.Hour)})...)
+		defer clean()
+
+		if msg := check(Alert{Kind: AlertSpike, Threshold: 4}); msg != "" {
+			t.Errorf("4×: %q", msg)
+		}
+		want := "70 pageviews in the last 24 hours; that's 3.5× the usual 20 a day."
+		if msg := check(Alert{Kind: AlertSpike, Threshold: 3}); msg != want {
+			t.Errorf("3×\nout:  %q\nwant: %q", msg, want)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		check, clean := setup(t, many(4, Hit{Path: "/a", CreatedAt: now.Add(-time.Hour)})...)
+		defer clean()
+
+		if msg := check(Alert{Kind: AlertDrop, Threshold: 10}); msg != "" {
+			t.Errorf("10%%: %q", msg)
+		}
+		want := "4 pageviews in the last 24 hours; that's 20% of the usual 20 a day."
+		if msg := check(Alert{Kind: AlertDrop, Threshold: 25}); msg != want {
+			t.Errorf("25%%\nout:  %q\nwant: %q", msg, want)
+		}
+	})
+
+	t.Run("no_hits", func(t *testing.T) {
+		check, clean := setup(t, Hit{Path: "/a", CreatedAt: now.Add(-5 * time.Hour)})
+		defer clean()
+
+		if msg := check(Alert{Kind: AlertNoHits, Threshold: 6}); msg != "" {
+			t.Errorf("6 hours: %q", msg)
+		}
+		if msg := check(Alert{Kind: AlertNoHits, Threshold: 4}); !strings.HasPrefix(msg, "No pageviews were received in the last 4 hours") {
+			t.Errorf("4 hours: %q", msg)
+		}
+	})
+
+	t.Run("new_ref", func(t *testing.T) {
+		recent := append(many(5, Hit{Path: "/a", Ref: "news.ycombinator.com", CreatedAt: now.Add(-time.Hour)}),
+			many(5, Hit{Path: "/a", Ref: "example.org", CreatedAt: now.Add(-time.Hour)})...)
+		check, clean := setup(t, recent...)
+		defer clean()
+
+		if msg := check(Alert{Kind: AlertNewRef, Threshold: 6}); msg != "" {
+			t.Errorf("6: %q", msg)
+		}
+		want := "New referrers in the last 24 hours:\nnews.ycombinator.com: 5 pageviews"
+		if msg := check(Alert{Kind: AlertNewRef, Threshold: 5}); msg != want {
+			t.Errorf("5\nout:  %q\nwant: %q", msg, want)
+		}
+	})
+
+	t.Run("goal", func(t *testing.T) {
+		check, clean := setup(t, many(3, Hit{Path: "signup", Event: true, CreatedAt: now.Add(-time.Hour)})...)
+		defer clean()
+
+		if msg := check(Alert{Kind: AlertGoal, Goal: "signup", Threshold: 4}); msg != "" {
+			t.Errorf("4: %q", msg)
+		}
+		want := `"signup" was reached 3 times in the last 24 hours.`
+		if msg := check(Alert{Kind: AlertGoal, Goal: "signup", Threshold: 3}); msg != want {
+			t.Errorf("3\nout:  %q\nwant: %q", msg, want)
+		}
+	})
+}
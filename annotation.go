@@ -0,0 +1,135 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"time"
+
+	"zgo.at/goatcounter/cfg"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zvalidate"
+)
+
+// Annotation is a note for a day, such as a deploy or the start of a campaign,
+// which is displayed as a marker on the charts.
+type Annotation struct {
+	ID   int64     `db:"id" json:"id"`
+	Site int64     `db:"site" json:"-"`
+	Day  time.Time `db:"day" json:"day"`
+	Text string    `db:"text" json:"text"`
+	URL  *string   `db:"url" json:"url,omitempty"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Defaults sets fields to default values, unless they're already set.
+func (a *Annotation) Defaults(ctx context.Context) {
+	if a.Site == 0 {
+		a.Site = MustGetSite(ctx).ID
+	}
+	if a.URL != nil && *a.URL == "" {
+		a.URL = nil
+	}
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = Now()
+	}
+}
+
+// Validate the object.
+func (a *Annotation) Validate(ctx context.Context) error {
+	v := zvalidate.New()
+
+	v.Required("site", a.Site)
+	v.Required("text", a.Text)
+	if a.Day.IsZero() {
+		v.Append("day", "must be set")
+	}
+	v.Len("text", a.Text, 0, 250)
+	if a.URL != nil {
+		v.URL("url", *a.URL)
+		v.Len("url", *a.URL, 0, 2048)
+	}
+
+	return v.ErrorOrNil()
+}
+
+// Insert a new row.
+func (a *Annotation) Insert(ctx context.Context) error {
+	if a.ID > 0 {
+		return errors.New("ID > 0")
+	}
+
+	a.Defaults(ctx)
+	err := a.Validate(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `insert into annotations (site, day, text, url, created_at) values ($1, $2, $3, $4, $5)`
+	args := []interface{}{a.Site, a.Day.Format("2006-01-02"), a.Text, a.URL, a.CreatedAt.Format(zdb.Date)}
+	if cfg.PgSQL {
+		err = zdb.MustGet(ctx).GetContext(ctx, &a.ID, query+" returning id", args...)
+		return errors.Wrap(err, "Annotation.Insert")
+	}
+
+	res, err := zdb.MustGet(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "Annotation.Insert")
+	}
+	a.ID, err = res.LastInsertId()
+	return errors.Wrap(err, "Annotation.Insert")
+}
+
+// Delete the annotation with this ID for the current site.
+func (a *Annotation) Delete(ctx context.Context, id int64) error {
+	_, err := zdb.MustGet(ctx).ExecContext(ctx,
+		`delete from annotations where site=$1 and id=$2`,
+		MustGetSite(ctx).ID, id)
+	return errors.Wrap(err, "Annotation.Delete")
+}
+
+// Annotations is a list of annotations.
+type Annotations []Annotation
+
+// List all annotations for the current site, newest first.
+func (a *Annotations) List(ctx context.Context) error {
+	return errors.Wrap(zdb.MustGet(ctx).SelectContext(ctx, a,
+		`select * from annotations where site=$1 order by day desc, id desc`,
+		MustGetSite(ctx).ID), "Annotations.List")
+}
+
+// ListRange lists all annotations for the current site between start and end,
+// in the site's timezone.
+func (a *Annotations) ListRange(ctx context.Context, start, end time.Time) error {
+	loc := MustGetSite(ctx).Settings.Timezone.Loc()
+	return errors.Wrap(zdb.MustGet(ctx).SelectContext(ctx, a,
+		`select * from annotations where site=$1 and day >= $2 and day <= $3 order by day, id`,
+		MustGetSite(ctx).ID, start.In(loc).Format("2006-01-02"), end.In(loc).Format("2006-01-02")),
+		"Annotations.ListRange")
+}
+
+// Apply the annotations to the stats with the same day.
+func (a Annotations) Apply(stats []Stat) {
+	if len(a) == 0 {
+		return
+	}
+
+	for i := range stats {
+		for _, ann := range a {
+			if ann.Day.Format("2006-01-02") == stats[i].Day {
+				stats[i].Annotations = append(stats[i].Annotations, ann)
+			}
+		}
+	}
+}
+
+// Annotate the stats of every path.
+func (h HitStats) Annotate(a Annotations) {
+	for i := range h {
+		a.Apply(h[i].Stats)
+	}
+}
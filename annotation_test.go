@@ -0,0 +1,95 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestAnnotations(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	for _, a := range []Annotation{
+		{Day: time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC), Text: "Deploy"},
+		{Day: time.Date(2020, 5, 3, 0, 0, 0, 0, time.UTC), Text: "Campaign"},
+		{Day: time.Date(2020, 5, 3, 0, 0, 0, 0, time.UTC), Text: "Outage"},
+		{Day: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), Text: "Out of range"},
+	} {
+		err := a.Insert(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var list Annotations
+	err := list.ListRange(ctx,
+		time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 5, 7, 23, 59, 59, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("len(list) = %d", len(list))
+	}
+
+	stats := []Stat{{Day: "2020-05-01"}, {Day: "2020-05-02"}, {Day: "2020-05-03"}}
+	list.Apply(stats)
+
+	var got string
+	for _, s := range stats {
+		got += fmt.Sprintf("%s %d|", s.Day, len(s.Annotations))
+	}
+	want := "2020-05-01 1|2020-05-02 0|2020-05-03 2|"
+	if got != want {
+		t.Errorf("\ngot:  %s\nwant: %s", got, want)
+	}
+
+	err = list[0].Delete(ctx, list[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all Annotations
+	err = all.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].Text != "Out of range" {
+		t.Errorf("wrong list after delete: %v", all)
+	}
+}
+
+func TestAnnotationValidate(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	tests := []struct {
+		in   Annotation
+		want string
+	}{
+		{Annotation{}, "day: must be set.\ntext: must be set.\n"},
+		{Annotation{Day: time.Now(), Text: "x", URL: strp("not a url")}, "url: must be a valid url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			err := tt.in.Insert(ctx)
+			if err == nil {
+				t.Fatal("err is nil")
+			}
+			if !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("\ngot:  %q\nwant: %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func strp(s string) *string { return &s }
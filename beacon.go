@@ -0,0 +1,304 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"zgo.at/zdb"
+	"zgo.at/zvalidate"
+)
+
+// Beacon is sent by count.js when a page is hidden or unloaded, and reports how
+// the visitor engaged with a page after the pageview was counted.
+//
+// A page can be hidden more than once if the visitor switches back to it; every
+// beacon has the values so far, and the beacons after the first also have the
+// values from the previous beacon in the Prev* fields. The stats for those are
+// replaced, rather than counting the page twice.
+//
+// Beacons aren't stored in the database as-is, they're only aggregated in the
+// *_stats tables.
+type Beacon struct {
+	Site    int64  `json:"-"`
+	Session *int64 `json:"-"`
+
+	Path       string   `json:"p,omitempty"`
+	Event      zdb.Bool `json:"e,omitempty"`
+	TimeOnPage int      `json:"tp,omitempty"` // Visible time on the page, in seconds.
+	Scroll     *int     `json:"sd"`           // Maximum scroll depth, in percent; only sent if enabled.
+
+	// Page load timings and Core Web Vitals, if enabled; see Vitals.
+	TTFB *int `json:"ttfb"`
+	Load *int `json:"ld"`
+	LCP  *int `json:"lcp"`
+	INP  *int `json:"inp"`
+	CLS  *int `json:"cls"`
+
+	// Values from the previous beacon for this page.
+	PrevTimeOnPage *int `json:"ptp"`
+	PrevScroll     *int `json:"psd"`
+	PrevTTFB       *int `json:"pttfb"`
+	PrevLoad       *int `json:"pld"`
+	PrevLCP        *int `json:"plcp"`
+	PrevINP        *int `json:"pinp"`
+	PrevCLS        *int `json:"pcls"`
+
+	CreatedAt time.Time `json:"-"`
+	Random    string    `json:"rnd"` // Browser cache buster.
+}
+
+// Defaults sets fields to default values, unless they're already set.
+func (b *Beacon) Defaults(ctx context.Context) {
+	b.Site = MustGetSite(ctx).ID
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = Now()
+	}
+
+	// Make sure the path is identical to what's stored for the pageview.
+	h := Hit{Path: b.Path, Event: b.Event}
+	h.cleanPath(ctx)
+	b.Path = h.Path
+	if !b.Event {
+		b.Path = "/" + strings.Trim(b.Path, "/")
+	}
+
+	if b.Scroll != nil {
+		d := ScrollDepth(*b.Scroll)
+		b.Scroll = &d
+	}
+	if b.PrevScroll != nil {
+		d := ScrollDepth(*b.PrevScroll)
+		b.PrevScroll = &d
+	}
+}
+
+// Validate the object.
+func (b *Beacon) Validate(ctx context.Context) error {
+	v := zvalidate.New()
+
+	v.Required("site", b.Site)
+	v.Required("path", b.Path)
+	v.UTF8("path", b.Path)
+	v.Len("path", b.Path, 0, 2048)
+	v.Range("tp", int64(b.TimeOnPage), 0, 86400)
+	if b.PrevTimeOnPage != nil {
+		v.Range("ptp", int64(*b.PrevTimeOnPage), 0, 86400)
+	}
+	if b.Scroll != nil {
+		v.Range("sd", int64(*b.Scroll), 0, 100)
+	}
+	if b.PrevScroll != nil {
+		v.Range("psd", int64(*b.PrevScroll), 0, 100)
+	}
+	for _, vv := range Vitals {
+		if val := vv.Value(*b); val != nil {
+			v.Range(vv.Name, int64(*val), 0, int64(vv.Max))
+		}
+		if val := vv.Prev(*b); val != nil {
+			v.Range("p"+vv.Name, int64(*val), 0, int64(vv.Max))
+		}
+	}
+
+	return v.ErrorOrNil()
+}
+
+// TimeBuckets are the upper bounds (in seconds) of the histogram buckets for
+// the time on page and session duration statistics. Anything longer than the
+// last value goes in an extra overflow bucket.
+var TimeBuckets = []int{5, 10, 30, 60, 120, 300, 600, 1800}
+
+// TimeBucket gets the histogram bucket index for the duration in seconds.
+func TimeBucket(secs int) int {
+	for i, b := range TimeBuckets {
+		if secs < b {
+			return i
+		}
+	}
+	return len(TimeBuckets)
+}
+
+// TimeBucketName gets a human-readable label for a histogram bucket.
+func TimeBucketName(i int) string {
+	if i == 0 {
+		return "< " + fmtDuration(TimeBuckets[0])
+	}
+	if i >= len(TimeBuckets) {
+		return "> " + fmtDuration(TimeBuckets[len(TimeBuckets)-1])
+	}
+	return fmtDuration(TimeBuckets[i-1]) + "–" + fmtDuration(TimeBuckets[i])
+}
+
+func fmtDuration(secs int) string {
+	switch {
+	case secs < 60:
+		return fmt.Sprintf("%ds", secs)
+	case secs < 3600:
+		if secs%60 == 0 {
+			return fmt.Sprintf("%dm", secs/60)
+		}
+		return fmt.Sprintf("%dm%ds", secs/60, secs%60)
+	default:
+		return fmt.Sprintf("%dh%dm", secs/3600, (secs%3600)/60)
+	}
+}
+
+// TimeStat is an aggregated time on page or session duration.
+type TimeStat struct {
+	Count int      `db:"count"` // Number of reported durations.
+	Total int      `db:"total"` // Total number of seconds.
+	Hist  zdb.Ints `db:"hist"`  // Histogram, as TimeBuckets.
+}
+
+// Record a single duration in seconds.
+func (t *TimeStat) Record(secs int) {
+	if len(t.Hist) == 0 {
+		t.Hist = make(zdb.Ints, len(TimeBuckets)+1)
+	}
+	t.Count++
+	t.Total += secs
+	t.Hist[TimeBucket(secs)]++
+}
+
+// Replace a previously recorded duration with secs seconds.
+//
+// This returns false and doesn't change anything if there is no recorded
+// duration in the histogram bucket for old, for example because the previous
+// beacon was on another day.
+func (t *TimeStat) Replace(old, secs int) bool {
+	if len(t.Hist) == 0 || t.Hist[TimeBucket(old)] == 0 {
+		return false
+	}
+	t.Total += secs - old
+	t.Hist[TimeBucket(old)]--
+	t.Hist[TimeBucket(secs)]++
+	return true
+}
+
+// Add the values of the other TimeStat to this one.
+func (t *TimeStat) Add(o TimeStat) {
+	if len(t.Hist) == 0 {
+		t.Hist = make(zdb.Ints, len(TimeBuckets)+1)
+	}
+	t.Count += o.Count
+	t.Total += o.Total
+	for i := range o.Hist {
+		if i < len(t.Hist) {
+			t.Hist[i] += o.Hist[i]
+		}
+	}
+}
+
+// Average duration in seconds.
+func (t TimeStat) Average() int {
+	if t.Count == 0 {
+		return 0
+	}
+	return t.Total / t.Count
+}
+
+// Median duration in seconds; this is an estimate, as we only store the
+// histogram.
+func (t TimeStat) Median() int {
+	return histPercentile(t.Hist, TimeBuckets, 50)
+}
+
+// histPercentile estimates the percentile p from a histogram with the given
+// bucket upper bounds: it finds the bucket the percentile falls in, and
+// interpolates linearly inside that bucket. The overflow bucket has no upper
+// bound, so anything in there is reported as the last bound.
+func histPercentile(hist zdb.Ints, buckets []int, p int) int {
+	var total int64
+	for _, n := range hist {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	want := float64(total) * float64(p) / 100
+	var seen float64
+	for i, n := range hist {
+		if n == 0 {
+			continue
+		}
+		if seen+float64(n) < want {
+			seen += float64(n)
+			continue
+		}
+		if i >= len(buckets) {
+			return buckets[len(buckets)-1]
+		}
+
+		lower := 0
+		if i > 0 {
+			lower = buckets[i-1]
+		}
+		return lower + int(float64(buckets[i]-lower)*(want-seen)/float64(n))
+	}
+	return 0
+}
+
+// String formats the average and median for display.
+func (t TimeStat) String() string {
+	return fmt.Sprintf("%s average, %s median", fmtDuration(t.Average()), fmtDuration(t.Median()))
+}
+
+// ScrollDepths are the scroll depth buckets, in percent.
+var ScrollDepths = []int{0, 25, 50, 75, 100}
+
+// ScrollDepth rounds the scroll depth percentage down to the nearest bucket.
+func ScrollDepth(pct int) int {
+	d := 0
+	for _, b := range ScrollDepths {
+		if pct >= b {
+			d = b
+		}
+	}
+	return d
+}
+
+// ScrollStat is the number of visitors who reached every ScrollDepths bucket;
+// every visitor is counted once, in the deepest bucket they reached.
+type ScrollStat []int
+
+// Total number of visitors.
+func (s ScrollStat) Total() int {
+	var t int
+	for _, n := range s {
+		t += n
+	}
+	return t
+}
+
+// Reached gets the percentage of visitors who scrolled to at least the
+// ScrollDepths bucket i.
+func (s ScrollStat) Reached(i int) int {
+	total := s.Total()
+	if total == 0 {
+		return 0
+	}
+	var n int
+	for _, c := range s[i:] {
+		n += c
+	}
+	return n * 100 / total
+}
+
+// String formats the percentage of visitors who reached every depth, skipping
+// the first bucket (which everyone reached).
+func (s ScrollStat) String() string {
+	if s.Total() == 0 {
+		return ""
+	}
+	r := make([]string, 0, len(ScrollDepths)-1)
+	for i := 1; i < len(ScrollDepths) && i < len(s); i++ {
+		r = append(r, fmt.Sprintf("%d%%: %d%%", ScrollDepths[i], s.Reached(i)))
+	}
+	return strings.Join(r, " · ")
+}
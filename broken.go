@@ -0,0 +1,87 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+)
+
+// BrokenStat is a path that was reported as a "not found" or error page, with
+// the referrers that linked to it.
+type BrokenStat struct {
+	Path   string
+	Status int
+	Count  int
+	Refs   []BrokenRef // Most common referrers.
+}
+
+// BrokenRef is a referrer to a broken page; Ref is empty for direct visits.
+type BrokenRef struct {
+	Ref   string
+	Count int
+}
+
+type BrokenStats []BrokenStat
+
+// maxBrokenRefs is the number of referrers listed for every path.
+const maxBrokenRefs = 5
+
+// List the broken pages for the given period, ordered by the number of
+// pageviews; only the first limit paths are listed. The returned int is the
+// total number of pageviews for error pages.
+func (b *BrokenStats) List(ctx context.Context, start, end time.Time, limit int) (int, error) {
+	var rows []struct {
+		Path   string `db:"path"`
+		Status int    `db:"status"`
+		Ref    string `db:"ref"`
+		Count  int    `db:"count"`
+	}
+	err := zdb.MustGet(ctx).SelectContext(ctx, &rows, `/* BrokenStats.List */
+		select path, status, ref, sum(count) as count
+		from broken_stats
+		where site=$1 and day >= $2 and day <= $3
+		group by path, status, ref
+		order by count desc, path, status, ref`,
+		MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, errors.Wrap(err, "BrokenStats.List")
+	}
+
+	var (
+		total int
+		idx   = make(map[string]int)
+	)
+	for _, r := range rows {
+		total += r.Count
+
+		k := fmt.Sprintf("%s\x00%d", r.Path, r.Status)
+		i, ok := idx[k]
+		if !ok {
+			i = len(*b)
+			idx[k] = i
+			*b = append(*b, BrokenStat{Path: r.Path, Status: r.Status})
+		}
+
+		s := &(*b)[i]
+		s.Count += r.Count
+		if len(s.Refs) < maxBrokenRefs {
+			s.Refs = append(s.Refs, BrokenRef{Ref: r.Ref, Count: r.Count})
+		}
+	}
+
+	// The rows are ordered by the count per referrer, not per path.
+	bb := *b
+	sort.SliceStable(bb, func(i, j int) bool { return bb[i].Count > bb[j].Count })
+	if len(bb) > limit {
+		*b = bb[:limit]
+	}
+	return total, nil
+}
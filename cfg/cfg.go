@@ -15,4 +15,8 @@ var (
 	Serve        bool
 	Port         string
 	LoginFrom    string
+
+	// Allow fetching sitemaps from loopback and private addresses, for
+	// self-hosted installations with a local or intranet mirror.
+	SitemapPrivate bool
 )
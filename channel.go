@@ -0,0 +1,268 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+)
+
+// Referrer channels.
+const (
+	ChannelDirect   = "direct"
+	ChannelSearch   = "search"
+	ChannelSocial   = "social"
+	ChannelEmail    = "email"
+	ChannelCampaign = "campaign"
+	ChannelInternal = "internal"
+	ChannelOther    = "other"
+)
+
+// Channels is a list of all channels, in display order.
+var Channels = []string{ChannelDirect, ChannelSearch, ChannelSocial,
+	ChannelEmail, ChannelCampaign, ChannelInternal, ChannelOther}
+
+// ChannelLabels are the display names for the channels.
+var ChannelLabels = map[string]string{
+	ChannelDirect:   "Direct",
+	ChannelSearch:   "Organic search",
+	ChannelSocial:   "Social",
+	ChannelEmail:    "Email",
+	ChannelCampaign: "Campaigns",
+	ChannelInternal: "Internal",
+	ChannelOther:    "Other",
+}
+
+// Channel rules, by lower-case host or referrer group. A rule for
+// "example.com" also matches all subdomains. These can be extended per-site
+// with the ChannelRules setting.
+var channelRules = map[string]string{
+	"google":              ChannelSearch,
+	"google.com":          ChannelSearch,
+	"bing.com":            ChannelSearch,
+	"duckduckgo.com":      ChannelSearch,
+	"search.yahoo.com":    ChannelSearch,
+	"yandex.ru":           ChannelSearch,
+	"yandex.com":          ChannelSearch,
+	"baidu.com":           ChannelSearch,
+	"ecosia.org":          ChannelSearch,
+	"startpage.com":       ChannelSearch,
+	"qwant.com":           ChannelSearch,
+	"search.brave.com":    ChannelSearch,
+	"naver.com":           ChannelSearch,
+	"seznam.cz":           ChannelSearch,
+	"ask.com":             ChannelSearch,
+	"hacker news":         ChannelSocial,
+	"lobste.rs":           ChannelSocial,
+	"reddit.com":          ChannelSocial,
+	"facebook.com":        ChannelSocial,
+	"t.co":                ChannelSocial,
+	"twitter.com":         ChannelSocial,
+	"linkedin.com":        ChannelSocial,
+	"lnkd.in":             ChannelSocial,
+	"instagram.com":       ChannelSocial,
+	"pinterest.com":       ChannelSocial,
+	"youtube.com":         ChannelSocial,
+	"tumblr.com":          ChannelSocial,
+	"vk.com":              ChannelSocial,
+	"weibo.com":           ChannelSocial,
+	"quora.com":           ChannelSocial,
+	"mastodon.social":     ChannelSocial,
+	"habr.com":            ChannelSocial,
+	"telegram messenger":  ChannelSocial,
+	"slack chat":          ChannelSocial,
+	"email":               ChannelEmail,
+	"outlook.live.com":    ChannelEmail,
+	"mail.yahoo.com":      ChannelEmail,
+	"mail.protonmail.com": ChannelEmail,
+	"mailchi.mp":          ChannelEmail,
+}
+
+// RefChannel gets the channel for a referrer.
+//
+// The ref should be cleaned by Hit.Defaults(), and medium is the utm_medium
+// parameter, which is used to classify campaigns as email or social.
+func RefChannel(site *Site, ref string, refScheme *string, medium string) string {
+	if refScheme != nil && *refScheme == *RefSchemeCampaign {
+		switch strings.ToLower(medium) {
+		case "email", "e-mail", "newsletter":
+			return ChannelEmail
+		case "social", "social-media", "social_media":
+			return ChannelSocial
+		}
+		return ChannelCampaign
+	}
+	if ref == "" {
+		return ChannelDirect
+	}
+
+	host := ref
+	if i := strings.Index(host, "/"); i > -1 {
+		host = host[:i]
+	}
+	host = strings.ToLower(host)
+
+	if site.LinkDomain != "" && strings.TrimPrefix(host, "www.") ==
+		strings.TrimPrefix(strings.ToLower(site.LinkDomain), "www.") {
+		return ChannelInternal
+	}
+
+	if c := matchChannel(channelRuleMap(site.Settings.ChannelRules), ref, host); c != "" {
+		return c
+	}
+	if c := matchChannel(channelRules, ref, host); c != "" {
+		return c
+	}
+	return ChannelOther
+}
+
+func matchChannel(rules map[string]string, ref, host string) string {
+	if len(rules) == 0 {
+		return ""
+	}
+	if c, ok := rules[strings.ToLower(ref)]; ok { // Group names, such as "Google".
+		return c
+	}
+	for h := host; h != ""; {
+		if c, ok := rules[h]; ok {
+			return c
+		}
+		i := strings.Index(h, ".")
+		if i == -1 {
+			break
+		}
+		h = h[i+1:]
+	}
+	return ""
+}
+
+// channelRuleMap gets the per-site rules as a host → channel map.
+func channelRuleMap(rules zdb.Strings) map[string]string {
+	m := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		host, channel := splitChannelRule(rule)
+		if host != "" {
+			m[host] = channel
+		}
+	}
+	return m
+}
+
+func splitChannelRule(rule string) (string, string) {
+	i := strings.Index(rule, "=")
+	if i == -1 {
+		return "", ""
+	}
+	return strings.ToLower(strings.TrimSpace(rule[:i])), strings.ToLower(strings.TrimSpace(rule[i+1:]))
+}
+
+// ChannelStat is the number of pageviews for a single channel, and the number
+// per day.
+type ChannelStat struct {
+	Channel     string
+	Count       int
+	CountUnique int
+	Max         int
+	Stats       []Stat
+}
+
+// Label gets the display name.
+func (c ChannelStat) Label() string {
+	if l, ok := ChannelLabels[c.Channel]; ok {
+		return l
+	}
+	return "(unknown)"
+}
+
+// Percentage of the total, formatted for display.
+func (c ChannelStat) Percentage(total int) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.0f%%", float64(c.Count)/float64(total)*100)
+}
+
+type ChannelStats []ChannelStat
+
+// List the channel statistics for the given time period, in the same order as
+// Channels. Channels without any pageviews are not included.
+func (c *ChannelStats) List(ctx context.Context, start, end time.Time) (int, error) {
+	var st []struct {
+		Channel     string    `db:"channel"`
+		Day         time.Time `db:"day"`
+		Count       int       `db:"count"`
+		CountUnique int       `db:"count_unique"`
+	}
+	err := zdb.MustGet(ctx).SelectContext(ctx, &st, `/* ChannelStats.List */
+		select
+			channel,
+			day,
+			sum(count) as count,
+			sum(count_unique) as count_unique
+		from ref_stats
+		where site=$1 and day >= $2 and day <= $3
+		group by channel, day
+		order by day asc
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, errors.Wrap(err, "ChannelStats.List")
+	}
+
+	var (
+		total   int
+		grouped = make(map[string]*ChannelStat)
+	)
+	for _, s := range st {
+		g, ok := grouped[s.Channel]
+		if !ok {
+			g = &ChannelStat{Channel: s.Channel, Stats: dailyStats(start, end)}
+			grouped[s.Channel] = g
+		}
+
+		g.Count += s.Count
+		g.CountUnique += s.CountUnique
+		total += s.Count
+		if d := addDaily(g.Stats, s.Day, s.Count, s.CountUnique); d > g.Max {
+			g.Max = d
+		}
+	}
+
+	for _, ch := range Channels {
+		if g, ok := grouped[ch]; ok {
+			*c = append(*c, *g)
+		}
+	}
+	if g, ok := grouped[""]; ok { // Not yet reindexed.
+		*c = append(*c, *g)
+	}
+	return total, nil
+}
+
+// dailyStats creates an empty Stat for every day in the period.
+func dailyStats(start, end time.Time) []Stat {
+	var st []Stat
+	for d := start; !d.After(end); d = d.Add(24 * time.Hour) {
+		st = append(st, Stat{Day: d.Format("2006-01-02")})
+	}
+	return st
+}
+
+// addDaily adds the counts to the Stat for day, returning the new daily count.
+func addDaily(st []Stat, day time.Time, count, countUnique int) int {
+	d := day.Format("2006-01-02")
+	for i := range st {
+		if st[i].Day == d {
+			st[i].Daily += count
+			st[i].DailyUnique += countUnique
+			return st[i].Daily
+		}
+	}
+	return 0
+}
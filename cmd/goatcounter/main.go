@@ -173,7 +173,8 @@ func connectDB(connect string, migrate []string, create bool) (*sqlx.DB, error)
 }
 
 var goMigrations = map[string]func(zdb.DB) error{
-	"2020-03-27-1-isbot": gomig.Migrate_20200327_1_isbot,
+	"2020-03-27-1-isbot":                gomig.Migrate_20200327_1_isbot,
+	"2020-06-08-1-content_groups_lines": gomig.Migrate_20200608_1_content_groups_lines,
 }
 
 func runGoMigrations(db zdb.DB) error {
@@ -57,8 +57,10 @@ Flags:
   -to            Reindex only statistics up to and including this day; as
                  year-month-day in UTC. The default is yesterday.
 
-  -table         Which tables to reindex: hit_stats, browser_stats,
-                 location_stats, ref_stats, size_stats, or all (default).
+  -table         Which tables to reindex: hit_stats, path_titles,
+                 browser_stats, system_stats, location_stats, language_stats,
+                 ref_stats, campaign_stats, size_stats, visitor_stats,
+                 search_stats, broken_stats, or all (default).
 
   -site          Only reindex this site ID. Default is to reindex all.
 `
@@ -80,8 +82,9 @@ func reindex() (int, error) {
 	v := zvalidate.New()
 	firstDay := v.Date("-since", *since, "2006-01-02")
 	lastDay := v.Date("-to", *to, "2006-01-02")
-	v.Include("-table", *table, []string{"hit_stats", "browser_stats",
-		"location_stats", "ref_stats", "size_stats", "all"})
+	v.Include("-table", *table, []string{"hit_stats", "path_titles", "browser_stats",
+		"system_stats", "location_stats", "language_stats", "ref_stats",
+		"campaign_stats", "size_stats", "visitor_stats", "search_stats", "broken_stats", "all"})
 	if v.HasErrors() {
 		return 1, v
 	}
@@ -206,18 +209,36 @@ func clearDay(db *sqlx.DB, table, day string, siteID int64) {
 		db.MustExecContext(ctx, `delete from hit_stats`+where)
 	case "browser_stats":
 		db.MustExecContext(ctx, `delete from browser_stats`+where)
+	case "system_stats":
+		db.MustExecContext(ctx, `delete from system_stats`+where)
 	case "location_stats":
 		db.MustExecContext(ctx, `delete from location_stats`+where)
+	case "language_stats":
+		db.MustExecContext(ctx, `delete from language_stats`+where)
 	case "ref_stats":
 		db.MustExecContext(ctx, `delete from ref_stats`+where)
+	case "campaign_stats":
+		db.MustExecContext(ctx, `delete from campaign_stats`+where)
 	case "size_stats":
 		db.MustExecContext(ctx, `delete from size_stats`+where)
+	case "visitor_stats":
+		db.MustExecContext(ctx, `delete from visitor_stats`+where)
+	case "search_stats":
+		db.MustExecContext(ctx, `delete from search_stats`+where)
+	case "broken_stats":
+		db.MustExecContext(ctx, `delete from broken_stats`+where)
 	case "all":
 		db.MustExecContext(ctx, `delete from hit_stats`+where)
 		db.MustExecContext(ctx, `delete from browser_stats`+where)
+		db.MustExecContext(ctx, `delete from system_stats`+where)
 		db.MustExecContext(ctx, `delete from location_stats`+where)
+		db.MustExecContext(ctx, `delete from language_stats`+where)
 		db.MustExecContext(ctx, `delete from ref_stats`+where)
+		db.MustExecContext(ctx, `delete from campaign_stats`+where)
 		db.MustExecContext(ctx, `delete from size_stats`+where)
+		db.MustExecContext(ctx, `delete from visitor_stats`+where)
+		db.MustExecContext(ctx, `delete from search_stats`+where)
+		db.MustExecContext(ctx, `delete from broken_stats`+where)
 	}
 }
 
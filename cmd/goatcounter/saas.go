@@ -68,6 +68,7 @@ func flagServeAndSaas(v *zvalidate.Validator) (string, bool, bool, string, strin
 	tls := CommandLine.String("tls", "", "")
 	errors := CommandLine.String("errors", "", "")
 	auth := CommandLine.String("auth", "email", "")
+	geodb := CommandLine.String("geodb", "", "")
 
 	err := CommandLine.Parse(os.Args[2:])
 	zlog.Config.SetDebug(*debug)
@@ -83,6 +84,11 @@ func flagServeAndSaas(v *zvalidate.Validator) (string, bool, bool, string, strin
 	}
 
 	flagErrors(*errors, v)
+	if *geodb != "" {
+		if err := handlers.SetGeoDB(*geodb); err != nil {
+			v.Append("-geodb", err.Error())
+		}
+	}
 	//v.Hostname("-smtp", zmail.SMTP)
 
 	return *dbConnect, dev, *automigrate, *listen, *tls, *auth, err
@@ -37,6 +37,12 @@ Flags:
 
   -port          Port your site is publicly accessible on. Only needed if it's
                  not 80 or 443.
+
+  -sitemap-private
+                 Allow the sitemap report to fetch sitemaps from loopback and
+                 private addresses, such as a local or intranet mirror. By
+                 default only public addresses can be fetched, as the URL is
+                 entered by users. Default: false.
 ` + serveAndSaasFlags
 
 const serveAndSaasFlags = `
@@ -106,6 +112,12 @@ const serveAndSaasFlags = `
 
   -automigrate   Automatically run all pending migrations on startup.
 
+  -geodb         GeoIP database to use instead of the embedded GeoLite2 Country
+                 database, in the MaxMind format. If this is a City database
+                 the region (e.g. US-CA) is recorded as well. The file is read
+                 on startup, so you can update it and restart without
+                 rebuilding GoatCounter. Default: not set.
+
 Environment:
 
   TMPDIR         Directory for temporary files; only used to store CSV exports
@@ -118,6 +130,7 @@ func serve() (int, error) {
 
 	CommandLine.StringVar(&cfg.Port, "port", "", "")
 	CommandLine.StringVar(&cfg.DomainStatic, "static", "", "")
+	CommandLine.BoolVar(&cfg.SitemapPrivate, "sitemap-private", false, "")
 	dbConnect, dev, automigrate, listen, tls, auth, err := flagServeAndSaas(&v)
 	if err != nil {
 		return 1, err
@@ -0,0 +1,216 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+)
+
+// Periods to compare the dashboard to.
+const (
+	ComparePrevious = "previous" // Previous period of the same length.
+	CompareYear     = "year"     // Same period last year.
+	CompareCustom   = "custom"   // Custom start and end date.
+)
+
+// CompareModes is a list of all compare modes.
+var CompareModes = []string{ComparePrevious, CompareYear, CompareCustom}
+
+// ComparePeriod gets the period to compare start and end to; this is only
+// useful for ComparePrevious and CompareYear.
+func ComparePeriod(mode string, start, end time.Time) (time.Time, time.Time) {
+	switch mode {
+	case ComparePrevious:
+		days := int(end.Sub(start).Round(24*time.Hour) / (24 * time.Hour))
+		return start.AddDate(0, 0, -days), end.AddDate(0, 0, -days)
+	case CompareYear:
+		return start.AddDate(-1, 0, 0), end.AddDate(-1, 0, 0)
+	}
+	return time.Time{}, time.Time{}
+}
+
+// Change is the count in the current period and the period it's compared to.
+type Change struct {
+	Count int
+	Prev  int
+}
+
+// Diff gets the absolute difference.
+func (c Change) Diff() int { return c.Count - c.Prev }
+
+// Percentage of the change, formatted for display.
+//
+// It's "new" if there was nothing in the previous period.
+func (c Change) Percentage() string {
+	switch {
+	case c.Prev == 0 && c.Count == 0:
+		return "0%"
+	case c.Prev == 0:
+		return "new"
+	}
+	p := fmt.Sprintf("%+.0f%%", float64(c.Count-c.Prev)/float64(c.Prev)*100)
+	if p == "+0%" || p == "-0%" {
+		return "0%"
+	}
+	return p
+}
+
+// MarshalJSON also includes the difference and the percentage.
+func (c Change) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Count      int    `json:"count"`
+		Prev       int    `json:"prev"`
+		Diff       int    `json:"diff"`
+		Percentage string `json:"change"`
+		Class      string `json:"class"`
+	}{c.Count, c.Prev, c.Diff(), c.Percentage(), c.Class()})
+}
+
+// Class gets the CSS class to use.
+func (c Change) Class() string {
+	switch {
+	case c.Count > c.Prev:
+		return "change-up"
+	case c.Count < c.Prev:
+		return "change-down"
+	}
+	return "change-none"
+}
+
+// Compare sets the change in visits for all rows, matched by name.
+//
+// This compares CountUnique, the same as HitStats.Compare() and the total.
+func (h Stats) Compare(prev Stats) {
+	counts := make(map[string]int, len(prev))
+	for _, p := range prev {
+		counts[p.Name] += p.CountUnique
+	}
+	for i := range h {
+		h[i].Change = &Change{Count: h[i].CountUnique, Prev: counts[h[i].Name]}
+	}
+}
+
+// CompareRefs sets the change compared to the same referrers in the given
+// period.
+//
+// This can't use ListRefs(), as that's limited to the top referrers, which may
+// be different ones.
+func (h Stats) CompareRefs(ctx context.Context, start, end time.Time) error {
+	if len(h) == 0 {
+		return nil
+	}
+
+	refs := make([]string, 0, len(h))
+	for _, r := range h {
+		refs = append(refs, r.Name)
+	}
+
+	db := zdb.MustGet(ctx)
+	query, args, err := sqlx.In(`/* Stats.CompareRefs */
+		select
+			ref as name,
+			sum(count) as count,
+			sum(count_unique) as count_unique
+		from ref_stats
+		where site=? and day>=? and day<=? and ref in (?)
+		group by ref`,
+		MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"), refs)
+	if err != nil {
+		return errors.Wrap(err, "Stats.CompareRefs")
+	}
+
+	var prev Stats
+	err = db.SelectContext(ctx, &prev, db.Rebind(query), args...)
+	if err != nil {
+		return errors.Wrap(err, "Stats.CompareRefs")
+	}
+
+	h.Compare(prev)
+	return nil
+}
+
+// Compare gets the stats for the same paths in the given period, and sets the
+// change in visits and the comparison for every day to draw in the chart.
+//
+// The total number of pageviews and visits in the period is returned.
+func (h HitStats) Compare(ctx context.Context, start, end time.Time, filter string) (int, int, error) {
+	site := MustGetSite(ctx)
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return 0, 0, err
+	}
+	where, whereArgs, err := f.where(ctx, start, end)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	total, totalUnique, err := hitTotals(ctx, start, end, where, whereArgs)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "HitStats.Compare")
+	}
+	if len(h) == 0 {
+		return total, totalUnique, nil
+	}
+
+	var (
+		paths = make([]string, 0, len(h))
+		prev  = make(HitStats, len(h))
+	)
+	for i := range h {
+		paths = append(paths, h[i].Path)
+		prev[i].Path, prev[i].Event = h[i].Path, h[i].Event
+	}
+
+	db := zdb.MustGet(ctx)
+	query, args, err := sqlx.In(`/* HitStats.Compare */
+		select path, event, title, day, stats, stats_unique, hll
+		from hit_stats
+		where
+			site=? and
+			day >= ? and
+			day <= ? and
+			path in (?)
+		order by day asc`,
+		site.ID, start.Format("2006-01-02"), end.Format("2006-01-02"), paths)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "HitStats.Compare")
+	}
+
+	var st []hitStatRow
+	err = db.SelectContext(ctx, &st, db.Rebind(query), args...)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "HitStats.Compare")
+	}
+
+	prev.addStats(st, start, end, site.Settings.Timezone.Offset())
+	for i := range h {
+		h[i].Change = &Change{Count: h[i].CountUnique, Prev: prev[i].CountUnique}
+
+		// Days are matched by position, so a custom range of a different
+		// length just has some days without a comparison.
+		for j := range h[i].Stats {
+			if j < len(prev[i].Stats) {
+				h[i].Stats[j].Compare = &prev[i].Stats[j]
+			}
+		}
+
+		// Make sure the comparison fits in the chart.
+		if prev[i].Max > h[i].Max {
+			h[i].Max = prev[i].Max
+		}
+		if prev[i].DailyMax > h[i].DailyMax {
+			h[i].DailyMax = prev[i].DailyMax
+		}
+	}
+
+	return total, totalUnique, nil
+}
@@ -0,0 +1,114 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestComparePeriod(t *testing.T) {
+	start := time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2020, 5, 7, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		mode, want string
+	}{
+		{ComparePrevious, "2020-04-24 2020-04-30"},
+		{CompareYear, "2019-05-01 2019-05-07"},
+		{CompareCustom, "0001-01-01 0001-01-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			s, e := ComparePeriod(tt.mode, start, end)
+			got := s.Format("2006-01-02") + " " + e.Format("2006-01-02")
+			if got != tt.want {
+				t.Errorf("\ngot:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChange(t *testing.T) {
+	tests := []struct {
+		in   Change
+		want string
+	}{
+		{Change{0, 0}, "0% change-none 0"},
+		{Change{5, 0}, "new change-up 5"},
+		{Change{109, 100}, "+9% change-up 9"},
+		{Change{50, 100}, "-50% change-down -50"},
+		{Change{1001, 1000}, "0% change-up 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v", tt.in), func(t *testing.T) {
+			got := fmt.Sprintf("%s %s %d", tt.in.Percentage(), tt.in.Class(), tt.in.Diff())
+			if got != tt.want {
+				t.Errorf("\ngot:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHitStatsCompare(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	lastWeek := now.Add(-7 * 24 * time.Hour)
+	s1, s2, s3 := int64(1), int64(2), int64(3)
+
+	gctest.StoreHits(ctx, t, []Hit{
+		{Site: site.ID, Session: &s1, CreatedAt: lastWeek, Path: "/a", Browser: "Firefox/69.0"},
+		{Site: site.ID, Session: &s2, CreatedAt: lastWeek, Path: "/a", Browser: "Firefox/69.0"},
+		{Site: site.ID, Session: &s3, CreatedAt: now, Path: "/a", Browser: "Firefox/69.0"},
+		{Site: site.ID, Session: &s3, CreatedAt: now, Path: "/b", Browser: "Firefox/69.0"},
+	}...)
+
+	start := time.Date(2019, 8, 25, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 8, 31, 23, 59, 59, 0, time.UTC)
+	cstart, cend := ComparePeriod(ComparePrevious, start, end)
+
+	var pages HitStats
+	_, _, _, _, _, err := pages.List(ctx, start, end, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, totalUnique, err := pages.Compare(ctx, cstart, cend, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var browsers, prev Stats
+	_, err = browsers.ListBrowsers(ctx, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = prev.ListBrowsers(ctx, cstart, cend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	browsers.Compare(prev)
+
+	got := fmt.Sprintf("%d %d", total, totalUnique)
+	for _, p := range pages {
+		got += fmt.Sprintf(" | %s %s %d", p.Path, p.Change.Percentage(), p.Stats[len(p.Stats)-1].Compare.Daily)
+	}
+	for _, b := range browsers {
+		got += fmt.Sprintf(" | %s %s", b.Name, b.Change.Percentage())
+	}
+
+	want := "2 2 | /b new 0 | /a -50% 2 | Firefox -50%"
+	if got != want {
+		t.Errorf("\ngot:  %s\nwant: %s", got, want)
+	}
+}
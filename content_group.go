@@ -0,0 +1,218 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"zgo.at/goatcounter/errors"
+	"zgo.at/utils/jsonutil"
+	"zgo.at/zdb"
+)
+
+// splitContentGroup splits a content group rule in the form "name=filter".
+func splitContentGroup(rule string) (string, string) {
+	i := strings.Index(rule, "=")
+	if i == -1 {
+		return "", ""
+	}
+	return strings.TrimSpace(rule[:i]), strings.TrimSpace(rule[i+1:])
+}
+
+// ContentGroupStat is the number of pageviews for a group of paths, and the
+// number per day.
+type ContentGroupStat struct {
+	Name        string
+	Filter      string // Filter query to list the paths in this group.
+	Count       int
+	CountUnique int
+	Max         int
+	Stats       []Stat
+}
+
+// Percentage of the total, formatted for display.
+func (c ContentGroupStat) Percentage(total int) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.0f%%", float64(c.Count)/float64(total)*100)
+}
+
+type ContentGroupStats []ContentGroupStat
+
+type contentGroupRow struct {
+	Path        string    `db:"path"`
+	Day         time.Time `db:"day"`
+	Stats       []byte    `db:"stats"`
+	StatsUnique []byte    `db:"stats_unique"`
+	HLL         *HLL      `db:"hll"`
+}
+
+// List the content groups from the site settings for the given time period,
+// in the order they're defined. If there are no groups the paths are rolled up
+// by their top-level directory instead, ordered by the number of pageviews.
+//
+// The returned int is the total number of pageviews; a page can be in more than
+// one group, so this may be more or less than the sum of all groups.
+func (c *ContentGroupStats) List(ctx context.Context, start, end time.Time) (int, error) {
+	var (
+		site   = MustGetSite(ctx)
+		db     = zdb.MustGet(ctx)
+		offset = site.Settings.Timezone.Offset()
+	)
+
+	var rows []contentGroupRow
+	err := db.SelectContext(ctx, &rows, `/* ContentGroupStats.List */
+		select path, day, stats, stats_unique, hll from hit_stats
+		where site=$1 and event=0 and day >= $2 and day <= $3
+		order by day asc`,
+		site.ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, errors.Wrap(err, "ContentGroupStats.List")
+	}
+
+	var total ContentGroupStat
+	total.add(rows, start, end, offset)
+
+	if len(site.Settings.ContentGroups) == 0 {
+		c.listTree(rows, start, end, offset)
+		return total.Count, nil
+	}
+
+	for _, rule := range site.Settings.ContentGroups {
+		name, query := splitContentGroup(rule)
+		f, err := ParseFilter(query)
+		if err != nil {
+			return 0, errors.Wrap(err, "ContentGroupStats.List")
+		}
+		where, args, err := f.where(ctx, start, end)
+		if err != nil {
+			return 0, errors.Wrap(err, "ContentGroupStats.List")
+		}
+
+		var rows []contentGroupRow
+		err = db.SelectContext(ctx, &rows, db.Rebind(`/* ContentGroupStats.List: group */
+			select path, day, stats, stats_unique, hll from hit_stats
+			where site=? and event=0 and day >= ? and day <= ? and `+where+`
+			order by day asc`),
+			append([]interface{}{site.ID, start.Format("2006-01-02"), end.Format("2006-01-02")}, args...)...)
+		if err != nil {
+			return 0, errors.Wrap(err, "ContentGroupStats.List")
+		}
+
+		g := ContentGroupStat{Name: name, Filter: query}
+		g.add(rows, start, end, offset)
+		*c = append(*c, g)
+	}
+	return total.Count, nil
+}
+
+// listTree rolls up the paths by their top-level directory; only the ten
+// directories with the most pageviews are listed.
+func (c *ContentGroupStats) listTree(rows []contentGroupRow, start, end time.Time, offset int) {
+	grouped := make(map[string][]contentGroupRow)
+	for _, r := range rows {
+		d := pathDir(r.Path)
+		grouped[d] = append(grouped[d], r)
+	}
+
+	for d, r := range grouped {
+		g := ContentGroupStat{Name: d, Filter: `path:"` + d + `"`}
+		if strings.HasSuffix(d, "/") && d != "/" {
+			g.Filter = "path:" + d + "*"
+		}
+		g.add(r, start, end, offset)
+		*c = append(*c, g)
+	}
+
+	cc := *c
+	sort.Slice(cc, func(i, j int) bool {
+		if cc[i].Count == cc[j].Count {
+			return cc[i].Name < cc[j].Name
+		}
+		return cc[i].Count > cc[j].Count
+	})
+	if len(cc) > 10 {
+		*c = cc[:10]
+	}
+}
+
+// pathDir gets the top-level directory for a path: "/blog/post" is "/blog/",
+// and "/about" is "/about".
+func pathDir(p string) string {
+	if len(p) < 2 {
+		return "/"
+	}
+	if i := strings.Index(p[1:], "/"); i > -1 {
+		return p[:i+2]
+	}
+	return p
+}
+
+// add the hit_stats rows to the group. The rows must be ordered by day.
+//
+// The rows are in UTC, so the hourly stats are shifted by the site's TZ offset
+// before they're summed up per day, just like HitStats.List().
+func (c *ContentGroupStat) add(rows []contentGroupRow, start, end time.Time, offset int) {
+	var (
+		st     []Stat
+		endFmt = end.Format("2006-01-02")
+	)
+	for d := start; ; d = d.Add(24 * time.Hour) {
+		st = append(st, Stat{Day: d.Format("2006-01-02"), Hourly: make([]int, 24), HourlyUnique: make([]int, 24)})
+		if st[len(st)-1].Day == endFmt {
+			break
+		}
+	}
+
+	unique := &HLL{}
+	for _, r := range rows {
+		var x, y []int
+		jsonutil.MustUnmarshal(r.Stats, &x)
+		jsonutil.MustUnmarshal(r.StatsUnique, &y)
+
+		d := r.Day.Format("2006-01-02")
+		for j := range st {
+			if st[j].Day == d {
+				for i := range x {
+					st[j].Hourly[i] += x[i]
+					st[j].HourlyUnique[i] += y[i]
+				}
+				break
+			}
+		}
+
+		if r.HLL == nil {
+			unique = nil
+		} else if unique != nil {
+			unique.Merge(*r.HLL)
+		}
+	}
+
+	c.Stats = applyOffset(offsetHours(offset), st)
+	for i := range c.Stats {
+		for j := range c.Stats[i].Hourly {
+			c.Stats[i].Daily += c.Stats[i].Hourly[j]
+			c.Stats[i].DailyUnique += c.Stats[i].HourlyUnique[j]
+		}
+		if c.Stats[i].Daily > c.Max {
+			c.Max = c.Stats[i].Daily
+		}
+		c.Count += c.Stats[i].Daily
+		c.CountUnique += c.Stats[i].DailyUnique
+	}
+
+	// Use the HLL sketches for the unique visitors if all rows have one.
+	if unique != nil && len(rows) > 0 {
+		c.CountUnique = unique.Count()
+		if c.CountUnique > c.Count {
+			c.CountUnique = c.Count
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+	"zgo.at/tz"
+	"zgo.at/zvalidate"
+)
+
+func TestContentGroups(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	gctest.StoreHits(ctx, t, []Hit{
+		{Path: "/", CreatedAt: now},
+		{Path: "/about", CreatedAt: now},
+		{Path: "/blog/1", Title: "Post", CreatedAt: now},
+		{Path: "/blog/1", Title: "Post", CreatedAt: now.Add(-24 * time.Hour)},
+		{Path: "/blog/2", Title: "Post", CreatedAt: now},
+		{Path: "/docs/x", Title: "Docs: x", CreatedAt: now},
+		{Path: "/event", Event: true, CreatedAt: now},
+	}...)
+
+	start := time.Date(2019, 8, 30, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 8, 31, 23, 59, 59, 0, time.UTC)
+
+	list := func(t *testing.T) string {
+		t.Helper()
+		var groups ContentGroupStats
+		total, err := groups.List(ctx, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := fmt.Sprintf("total=%d", total)
+		for _, g := range groups {
+			got += fmt.Sprintf(" | %s [%s] %d/%d max=%d", g.Name, g.Filter, g.Count, g.CountUnique, g.Max)
+			for _, s := range g.Stats {
+				got += fmt.Sprintf(" %d", s.Daily)
+			}
+		}
+		return got
+	}
+
+	t.Run("tree", func(t *testing.T) {
+		got := list(t)
+		want := `total=6 | /blog/ [path:/blog/*] 3/1 max=2 1 2 | / [path:"/"] 1/1 max=1 0 1 | ` +
+			`/about [path:"/about"] 1/1 max=1 0 1 | /docs/ [path:/docs/*] 1/1 max=1 0 1`
+		if got != want {
+			t.Errorf("\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+
+	t.Run("rules", func(t *testing.T) {
+		MustGetSite(ctx).Settings.ContentGroups = []string{
+			"Blog=/blog/*", "Docs=title:~^docs:", "Not blog=-/blog/*"}
+		defer func() { MustGetSite(ctx).Settings.ContentGroups = nil }()
+
+		got := list(t)
+		want := `total=6 | Blog [/blog/*] 3/1 max=2 1 2 | Docs [title:~^docs:] 1/1 max=1 0 1 | ` +
+			`Not blog [-/blog/*] 3/1 max=3 0 3`
+		if got != want {
+			t.Errorf("\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	// Rules are stored newline-separated, so filters can contain commas.
+	t.Run("commas", func(t *testing.T) {
+		var ss SiteSettings
+		err := ss.Scan(`{"content_groups": "Posts=~^/blog/[0-9]{1,3}$\r\n\nDocs=/docs/*"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		MustGetSite(ctx).Settings.ContentGroups = ss.ContentGroups
+		defer func() { MustGetSite(ctx).Settings.ContentGroups = nil }()
+
+		got := list(t)
+		want := `total=6 | Posts [~^/blog/[0-9]{1,3}$] 3/1 max=2 1 2 | Docs [/docs/*] 1/1 max=1 0 1`
+		if got != want {
+			t.Errorf("\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+}
+
+func TestContentGroupsTimezone(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := MustGetSite(ctx)
+	site.Settings.Timezone = tz.MustNew("", "Asia/Makassar") // UTC+8
+	loc := site.Settings.Timezone.Loc()
+
+	// 20:00 UTC is the next day in UTC+8.
+	gctest.StoreHits(ctx, t, Hit{Path: "/blog/1", CreatedAt: time.Date(2019, 8, 30, 20, 0, 0, 0, time.UTC)})
+
+	start := time.Date(2019, 8, 30, 0, 0, 0, 0, loc).UTC()
+	end := time.Date(2019, 8, 31, 23, 59, 59, 0, loc).UTC()
+
+	var groups ContentGroupStats
+	total, err := groups.List(ctx, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := fmt.Sprintf("total=%d", total)
+	for _, g := range groups {
+		got += fmt.Sprintf(" | %s %d max=%d", g.Name, g.Count, g.Max)
+		for _, s := range g.Stats {
+			got += fmt.Sprintf(" %s=%d", s.Day, s.Daily)
+		}
+	}
+	want := "total=1 | /blog/ 1 max=1 2019-08-30=0 2019-08-31=1"
+	if got != want {
+		t.Errorf("\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestContentGroupsValidate(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	tests := []struct {
+		in   []string
+		want string
+	}{
+		{[]string{"Blog=/blog/*", "Docs = path:/docs/* title:docs"}, ""},
+		{[]string{"Short=~^/p/[0-9]{1,3}$", `Docs=title:"Docs, x"`}, ""},
+		{[]string{"/blog/*"}, `"/blog/*" is not in the form name=filter`},
+		{[]string{"Blog="}, `"Blog=" is not in the form name=filter`},
+		{[]string{"Blog=~["}, `"Blog": filter: invalid regular expression`},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.in, ","), func(t *testing.T) {
+			site := *MustGetSite(ctx)
+			site.Settings.ContentGroups = tt.in
+
+			// The test site isn't valid for other reasons, so only look at
+			// the content_groups errors.
+			var got string
+			var v *zvalidate.Validator
+			if errors.As(site.Validate(ctx), &v) {
+				got = strings.Join(v.Errors["settings.content_groups"], "\n")
+			}
+			if !strings.HasPrefix(got, tt.want) || (tt.want == "" && got != "") {
+				t.Errorf("\ngot:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
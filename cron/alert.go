@@ -0,0 +1,89 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"net/mail"
+	"time"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zhttp/zmail"
+	"zgo.at/zlog"
+)
+
+// CheckAlerts checks the alert rules for all sites, and emails the site's user
+// for every alert that matches and isn't in its cooldown period.
+func CheckAlerts(ctx context.Context) error {
+	var alerts goatcounter.Alerts
+	err := alerts.ListAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		now  = goatcounter.Now()
+		l    = zlog.Module("cron-alerts")
+		site goatcounter.Site
+		user goatcounter.User
+	)
+	for _, a := range alerts {
+		if a.Cooling(now) {
+			continue
+		}
+
+		if site.ID != a.Site {
+			site, user = goatcounter.Site{}, goatcounter.User{}
+			err := site.ByID(ctx, a.Site)
+			if err == nil {
+				err = user.BySite(ctx, a.Site)
+			}
+			if err != nil {
+				l.Field("site", a.Site).Error(err)
+				site = goatcounter.Site{}
+				continue
+			}
+		}
+		if site.State != goatcounter.StateActive {
+			continue
+		}
+
+		a := a
+		err := sendAlert(goatcounter.WithSite(ctx, &site), &a, site, user, now)
+		if err != nil {
+			l.Fields(zlog.F{"site": a.Site, "alert": a.ID}).Error(err)
+		}
+	}
+	return nil
+}
+
+func sendAlert(ctx context.Context, a *goatcounter.Alert, site goatcounter.Site, user goatcounter.User, now time.Time) error {
+	msg, err := a.Check(ctx, now)
+	if err != nil || msg == "" {
+		return err
+	}
+
+	err = zmail.SendTemplate("GoatCounter alert: "+a.String(),
+		mail.Address{Name: "GoatCounter alerts", Address: "support@goatcounter.com"},
+		[]mail.Address{{Address: user.Email}},
+		"email_alert.gotxt", struct {
+			Site    goatcounter.Site
+			Alert   goatcounter.Alert
+			Message string
+		}{site, *a, msg})
+	if err != nil {
+		return errors.Wrap(err, "sendAlert")
+	}
+
+	err = a.Sent(ctx, msg, now)
+	if err != nil {
+		return err
+	}
+	return goatcounter.TriggerWebhooks(ctx, goatcounter.WebhookAlert, struct {
+		Alert   string `json:"alert"`
+		Message string `json:"message"`
+	}{a.String(), msg})
+}
@@ -0,0 +1,78 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	. "zgo.at/goatcounter/cron"
+	"zgo.at/goatcounter/gctest"
+	"zgo.at/goatcounter/pack"
+	"zgo.at/zhttp"
+	"zgo.at/zhttp/zmail"
+)
+
+func TestCheckAlerts(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	zhttp.TplPath = "../tpl"
+	pack.Templates = nil
+	zhttp.InitTpl(nil)
+	zmail.Print = false
+
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	goatcounter.Now = func() time.Time { return now }
+	defer func() { goatcounter.Now = func() time.Time { return time.Now().UTC() } }()
+
+	gctest.StoreHits(ctx, t, goatcounter.Hit{Path: "/a", CreatedAt: now.Add(-5 * time.Hour)})
+
+	u := goatcounter.User{Site: 1, Email: "alerts@example.com", Password: []byte("coconuts")}
+	err := u.Insert(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := goatcounter.Alert{Kind: goatcounter.AlertNoHits, Threshold: 2, Cooldown: 24}
+	err = a.Insert(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(wantSent int) {
+		t.Helper()
+		err := CheckAlerts(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var h goatcounter.AlertHistory
+		err = h.List(ctx, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(h) != wantSent {
+			t.Fatalf("sent %d alerts; want %d: %#v", len(h), wantSent, h)
+		}
+	}
+
+	check(1)
+
+	// Cooldown.
+	now = now.Add(23 * time.Hour)
+	check(1)
+	now = now.Add(2 * time.Hour)
+	check(2)
+
+	var alerts goatcounter.Alerts
+	err = alerts.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].LastSent == nil || !alerts[0].LastSent.Equal(now) {
+		t.Errorf("wrong last_sent: %#v", alerts)
+	}
+}
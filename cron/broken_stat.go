@@ -0,0 +1,90 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"fmt"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+)
+
+// Error pages are stored as a count per path, status, and referrer per day,
+// instead of in hit_stats:
+//
+//  site |    day     |   path    | status |        ref         | count
+// ------+------------+-----------+--------+--------------------+-------
+//     1 | 2019-11-30 | /old-post |    404 | news.example.com/x |     4
+//     1 | 2019-11-30 | /old-post |    404 |                    |     1
+func updateBrokenStats(ctx context.Context, hits []goatcounter.Hit) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		// Group by day + path + status + ref.
+		type gt struct {
+			count  int
+			day    string
+			path   string
+			status int
+			ref    string
+		}
+		grouped := map[string]gt{}
+		for _, h := range hits {
+			if h.Bot > 0 || h.Status == 0 {
+				continue
+			}
+
+			day := h.CreatedAt.Format("2006-01-02")
+			k := fmt.Sprintf("%s\x00%s\x00%d\x00%s", day, h.Path, h.Status, h.Ref)
+			v := grouped[k]
+			if v.count == 0 {
+				v.day = day
+				v.path = h.Path
+				v.status = h.Status
+				v.ref = h.Ref
+				var err error
+				v.count, err = existingBrokenStats(ctx, tx, h.Site, day, v.path, v.status, v.ref)
+				if err != nil {
+					return err
+				}
+			}
+
+			v.count += 1
+			grouped[k] = v
+		}
+
+		siteID := goatcounter.MustGetSite(ctx).ID
+		ins := bulk.NewInsert(ctx, "broken_stats", []string{"site", "day",
+			"path", "status", "ref", "count"})
+		for _, v := range grouped {
+			ins.Values(siteID, v.day, v.path, v.status, v.ref, v.count)
+		}
+		return errors.Wrap(ins.Finish(), "updateBrokenStats")
+	})
+}
+
+func existingBrokenStats(
+	txctx context.Context, tx zdb.DB, siteID int64,
+	day, path string, status int, ref string,
+) (int, error) {
+
+	var c []int
+	err := tx.SelectContext(txctx, &c, `/* existingBrokenStats */
+		select count from broken_stats
+		where site=$1 and day=$2 and path=$3 and status=$4 and ref=$5 limit 1`,
+		siteID, day, path, status, ref)
+	if err != nil {
+		return 0, errors.Wrap(err, "select")
+	}
+	if len(c) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(txctx, `delete from broken_stats where
+		site=$1 and day=$2 and path=$3 and status=$4 and ref=$5`,
+		siteID, day, path, status, ref)
+	return c[0], errors.Wrap(err, "delete")
+}
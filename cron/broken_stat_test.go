@@ -0,0 +1,58 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestBrokenStats(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+
+	gctest.StoreHits(ctx, t, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, Path: "/asd"},
+		{Site: site.ID, CreatedAt: now, Path: "/old", Status: 404, Ref: "https://example.com/a"},
+		{Site: site.ID, CreatedAt: now, Path: "/old", Status: 404, Ref: "https://example.com/a"},
+		{Site: site.ID, CreatedAt: now, Path: "/old", Status: 404},
+		{Site: site.ID, CreatedAt: now, Path: "/crash", Status: 500},
+	}...)
+
+	var stats goatcounter.BrokenStats
+	total, err := stats.List(ctx, now, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := fmt.Sprintf("total=%d", total)
+	for _, s := range stats {
+		got += fmt.Sprintf(" %s %d %d [", s.Path, s.Status, s.Count)
+		for _, r := range s.Refs {
+			got += fmt.Sprintf("%q:%d ", r.Ref, r.Count)
+		}
+		got += "]"
+	}
+	want := `total=4 /old 404 3 ["example.com/a":2 "":1 ] /crash 500 1 ["":1 ]`
+	if got != want {
+		t.Errorf("\ngot:  %s\nwant: %s", got, want)
+	}
+
+	var pages goatcounter.HitStats
+	_, _, _, _, _, err = pages.List(ctx, now.Add(-1*time.Hour), now.Add(1*time.Hour), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0].Path != "/asd" {
+		t.Errorf("error pages in hit_stats: %#v", pages)
+	}
+}
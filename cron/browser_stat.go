@@ -7,9 +7,7 @@ package cron
 import (
 	"context"
 	"fmt"
-	"strings"
 
-	"github.com/mssola/user_agent"
 	"zgo.at/goatcounter"
 	"zgo.at/goatcounter/errors"
 	"zgo.at/zdb"
@@ -23,6 +21,9 @@ import (
 //     1 | 2019-12-17 | Chrome  | 38      |    13
 //     1 | 2019-12-17 | Chrome  | 77      |     2
 //     1 | 2019-12-17 | Opera   | 9       |     1
+//
+// The hll column has a sketch of the sessions to get the unique count for
+// longer periods; see goatcounter.HLL.
 func updateBrowserStats(ctx context.Context, hits []goatcounter.Hit) error {
 	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
 		// Group by day + browser + event.
@@ -33,14 +34,15 @@ func updateBrowserStats(ctx context.Context, hits []goatcounter.Hit) error {
 			event       zdb.Bool
 			browser     string
 			version     string
+			hll         *goatcounter.HLL
 		}
 		grouped := map[string]gt{}
 		for _, h := range hits {
-			if h.Bot > 0 {
+			if h.Bot > 0 || h.Status != 0 {
 				continue
 			}
 
-			browser, version := getBrowser(h.Browser)
+			browser, version := goatcounter.ParseBrowser(h.Browser)
 			if browser == "" {
 				continue
 			}
@@ -54,7 +56,7 @@ func updateBrowserStats(ctx context.Context, hits []goatcounter.Hit) error {
 				v.version = version
 				v.event = h.Event
 				var err error
-				v.count, v.countUnique, err = existingBrowserStats(ctx, tx,
+				v.count, v.countUnique, v.hll, err = existingBrowserStats(ctx, tx,
 					h.Site, day, v.browser, v.version, v.event)
 				if err != nil {
 					return err
@@ -65,14 +67,19 @@ func updateBrowserStats(ctx context.Context, hits []goatcounter.Hit) error {
 			if h.FirstVisit {
 				v.countUnique += 1
 			}
+			if h.Session == nil { // The sketch would be incomplete.
+				v.hll = nil
+			} else if v.hll != nil {
+				v.hll.AddSession(*h.Session)
+			}
 			grouped[k] = v
 		}
 
 		siteID := goatcounter.MustGetSite(ctx).ID
 		ins := bulk.NewInsert(ctx, "browser_stats", []string{"site", "day",
-			"browser", "version", "count", "count_unique", "event"})
+			"browser", "version", "count", "count_unique", "hll", "event"})
 		for _, v := range grouped {
-			ins.Values(siteID, v.day, v.browser, v.version, v.count, v.countUnique, v.event)
+			ins.Values(siteID, v.day, v.browser, v.version, v.count, v.countUnique, v.hll, v.event)
 		}
 		return ins.Finish()
 	})
@@ -81,67 +88,27 @@ func updateBrowserStats(ctx context.Context, hits []goatcounter.Hit) error {
 func existingBrowserStats(
 	txctx context.Context, tx zdb.DB, siteID int64,
 	day, browser, version string, event zdb.Bool,
-) (int, int, error) {
+) (int, int, *goatcounter.HLL, error) {
 
 	var c []struct {
-		Count       int      `db:"count"`
-		CountUnique int      `db:"count_unique"`
-		Event       zdb.Bool `db:"event"`
+		Count       int              `db:"count"`
+		CountUnique int              `db:"count_unique"`
+		HLL         *goatcounter.HLL `db:"hll"`
+		Event       zdb.Bool         `db:"event"`
 	}
 	err := tx.SelectContext(txctx, &c, `/* existingBrowserStats */
-		select count, count_unique, event from browser_stats
+		select count, count_unique, hll, event from browser_stats
 		where site=$1 and day=$2 and browser=$3 and version=$4 limit 1`,
 		siteID, day, browser, version)
 	if err != nil {
-		return 0, 0, errors.Wrap(err, "select")
+		return 0, 0, nil, errors.Wrap(err, "select")
 	}
 	if len(c) == 0 {
-		return 0, 0, nil
+		return 0, 0, &goatcounter.HLL{}, nil
 	}
 
 	_, err = tx.ExecContext(txctx, `delete from browser_stats where
 		site=$1 and day=$2 and browser=$3 and version=$4 and event=$5`,
 		siteID, day, browser, version, event)
-	return c[0].Count, c[0].CountUnique, errors.Wrap(err, "delete")
-}
-
-func getBrowser(uaHeader string) (string, string) {
-	ua := user_agent.New(uaHeader)
-	browser, version := ua.Browser()
-
-	// A lot of this is wrong, so just skip for now.
-	if browser == "Android" {
-		return "", ""
-	}
-
-	if browser == "Chromium" {
-		browser = "Chrome"
-	}
-
-	// Correct some wrong data.
-	if browser == "Safari" && strings.Count(version, ".") == 3 {
-		browser = "Chrome"
-	}
-	// Note: Safari still shows Chrome and Firefox wrong.
-	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/User-Agent/Firefox
-	// https://developer.chrome.com/multidevice/user-agent#chrome_for_ios_user_agent
-
-	// The "build" and "patch" aren't interesting for us, and "minor" hasn't
-	// been non-0 since 2010.
-	// https://www.chromium.org/developers/version-numbers
-	if browser == "Chrome" || browser == "Opera" {
-		if i := strings.Index(version, "."); i > -1 {
-			version = version[:i]
-		}
-	}
-
-	// Don't include patch version.
-	if browser == "Safari" {
-		v := strings.Split(version, ".")
-		if len(v) > 2 {
-			version = v[0] + "." + v[1]
-		}
-	}
-
-	return browser, version
+	return c[0].Count, c[0].CountUnique, c[0].HLL, errors.Wrap(err, "delete")
 }
@@ -26,6 +26,7 @@ func TestBrowserStats(t *testing.T) {
 		{Site: site.ID, CreatedAt: now, Browser: "Chrome/77.0.123.666"},
 		{Site: site.ID, CreatedAt: now, Browser: "Firefox/69.0"},
 		{Site: site.ID, CreatedAt: now, Browser: "Firefox/69.0"},
+		{Site: site.ID, CreatedAt: now, Browser: "Firefox/69.0", Status: 404}, // Not counted.
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -37,7 +38,7 @@ func TestBrowserStats(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	want := `4 -> [{Firefox 3 1} {Chrome 1 0}]`
+	want := `4 -> [{Firefox 3 1 <nil>} {Chrome 1 0 <nil>}]`
 	out := fmt.Sprintf("%d -> %v", total, stats)
 	if want != out {
 		t.Errorf("\nwant: %s\nout:  %s", want, out)
@@ -59,7 +60,7 @@ func TestBrowserStats(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	want = `7 -> [{Firefox 6 2} {Chrome 1 0}]`
+	want = `7 -> [{Firefox 6 2 <nil>} {Chrome 1 0 <nil>}]`
 	out = fmt.Sprintf("%d -> %v", total, stats)
 	if want != out {
 		t.Errorf("\nwant: %s\nout:  %s", want, out)
@@ -72,7 +73,7 @@ func TestBrowserStats(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	want = `6 -> [{Firefox 69.0 4 1} {Firefox 68.0 1 1} {Firefox 70.0 1 0}]`
+	want = `6 -> [{Firefox 69.0 4 1 <nil>} {Firefox 68.0 1 1 <nil>} {Firefox 70.0 1 0 <nil>}]`
 	out = fmt.Sprintf("%d -> %v", total, stats)
 	if want != out {
 		t.Errorf("\nwant: %s\nout:  %s", want, out)
@@ -0,0 +1,102 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"fmt"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+)
+
+// Campaign stats are stored as a count per utm_source/utm_medium/utm_campaign
+// per day; utm_content and utm_term are only stored on the hit.
+//
+//  site |    day     | source  | medium | campaign    | count
+// ------+------------+---------+--------+-------------+-------
+//     1 | 2019-11-30 | twitter | social | spring-sale |     4
+//     1 | 2019-11-30 | news    | email  | spring-sale |    10
+//     1 | 2019-11-30 | news    | email  |             |     1
+func updateCampaignStats(ctx context.Context, hits []goatcounter.Hit) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		// Group by day + source + medium + campaign + event.
+		type gt struct {
+			count       int
+			countUnique int
+			day         string
+			event       zdb.Bool
+			source      string
+			medium      string
+			campaign    string
+		}
+		grouped := map[string]gt{}
+		for _, h := range hits {
+			if h.Bot > 0 || h.Status != 0 || (h.UTMSource == "" && h.UTMMedium == "" && h.UTMCampaign == "") {
+				continue
+			}
+
+			day := h.CreatedAt.Format("2006-01-02")
+			k := fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%t", day,
+				h.UTMSource, h.UTMMedium, h.UTMCampaign, h.Event)
+			v := grouped[k]
+			if v.count == 0 {
+				v.day = day
+				v.source = h.UTMSource
+				v.medium = h.UTMMedium
+				v.campaign = h.UTMCampaign
+				v.event = h.Event
+				var err error
+				v.count, v.countUnique, err = existingCampaignStats(ctx, tx,
+					h.Site, day, v.source, v.medium, v.campaign, v.event)
+				if err != nil {
+					return err
+				}
+			}
+
+			v.count += 1
+			if h.FirstVisit {
+				v.countUnique += 1
+			}
+			grouped[k] = v
+		}
+
+		siteID := goatcounter.MustGetSite(ctx).ID
+		ins := bulk.NewInsert(ctx, "campaign_stats", []string{"site", "day",
+			"source", "medium", "campaign", "count", "count_unique", "event"})
+		for _, v := range grouped {
+			ins.Values(siteID, v.day, v.source, v.medium, v.campaign, v.count, v.countUnique, v.event)
+		}
+		return ins.Finish()
+	})
+}
+
+func existingCampaignStats(
+	txctx context.Context, tx zdb.DB, siteID int64,
+	day, source, medium, campaign string, event zdb.Bool,
+) (int, int, error) {
+
+	var c []struct {
+		Count       int `db:"count"`
+		CountUnique int `db:"count_unique"`
+	}
+	err := tx.SelectContext(txctx, &c, `/* existingCampaignStats */
+		select count, count_unique from campaign_stats
+		where site=$1 and day=$2 and source=$3 and medium=$4 and campaign=$5 and event=$6 limit 1`,
+		siteID, day, source, medium, campaign, event)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "select")
+	}
+	if len(c) == 0 {
+		return 0, 0, nil
+	}
+
+	_, err = tx.ExecContext(txctx, `delete from campaign_stats where
+		site=$1 and day=$2 and source=$3 and medium=$4 and campaign=$5 and event=$6`,
+		siteID, day, source, medium, campaign, event)
+	return c[0].Count, c[0].CountUnique, errors.Wrap(err, "delete")
+}
@@ -0,0 +1,83 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	. "zgo.at/goatcounter/cron"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestCampaignStats(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+
+	err := UpdateStats(ctx, site.ID, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, UTMSource: "news", UTMMedium: "email", UTMCampaign: "sale", FirstVisit: true},
+		{Site: site.ID, CreatedAt: now, UTMSource: "news", UTMMedium: "email", UTMCampaign: "launch"},
+		{Site: site.ID, CreatedAt: now, UTMSource: "twitter", UTMMedium: "social", UTMCampaign: "sale"},
+		{Site: site.ID, CreatedAt: now, UTMSource: "twitter"},
+		{Site: site.ID, CreatedAt: now},
+		{Site: site.ID, CreatedAt: now, UTMSource: "news", UTMMedium: "email", UTMCampaign: "sale", Status: 404}, // Not counted.
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Update existing.
+	err = UpdateStats(ctx, site.ID, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, UTMSource: "news", UTMMedium: "email", UTMCampaign: "sale", FirstVisit: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pivot, name, want string
+	}{
+		{"source", "", `5 -> [{news 3 2 <nil>} {twitter 2 0 <nil>}]`},
+		{"medium", "", `5 -> [{email 3 2 <nil>} { 1 0 <nil>} {social 1 0 <nil>}]`},
+		{"campaign", "", `5 -> [{sale 3 2 <nil>} { 1 0 <nil>} {launch 1 0 <nil>}]`},
+		{"source", "news", `3 -> [{sale 2 2 <nil>} {launch 1 0 <nil>}]`},
+		{"campaign", "sale", `3 -> [{news 2 2 <nil>} {twitter 1 0 <nil>}]`},
+		{"medium", "email", `3 -> [{news 3 2 <nil>}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pivot+"-"+tt.name, func(t *testing.T) {
+			var (
+				stats goatcounter.Stats
+				total int
+				err   error
+			)
+			if tt.name == "" {
+				total, err = stats.ListCampaigns(ctx, tt.pivot, now, now)
+			} else {
+				total, err = stats.ListCampaign(ctx, tt.pivot, tt.name, now, now)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := fmt.Sprintf("%d -> %v", total, stats)
+			if out != tt.want {
+				t.Errorf("\nwant: %s\nout:  %s", tt.want, out)
+			}
+		})
+	}
+
+	var stats goatcounter.Stats
+	_, err = stats.ListCampaigns(ctx, "nonsense", now, now)
+	if err == nil {
+		t.Error("no error for invalid pivot")
+	}
+}
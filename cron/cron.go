@@ -25,10 +25,14 @@ var tasks = []task{
 	{persistAndStat, 10 * time.Second},
 	{DataRetention, 1 * time.Hour},
 	{renewACME, 2 * time.Hour},
-	{vacuumDeleted, 12 * time.Hour},
+	{VacuumDeleted, 12 * time.Hour},
 	{goatcounter.Salts.Refresh, 1 * time.Hour},
 	{clearSessions, 1 * time.Minute},
 	{oldExports, 1 * time.Hour},
+	{UpdateTrending, 10 * time.Minute},
+	{CheckAlerts, 15 * time.Minute},
+	{DeliverWebhooks, 1 * time.Minute},
+	{WebhookSummaries, 1 * time.Hour},
 }
 
 var (
@@ -0,0 +1,87 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/utils/stringutil"
+	"zgo.at/zdb"
+)
+
+// Record the variant every session saw, and mark the session as converted once
+// it reaches the goal:
+//
+//  site | experiment | session | variant |    day     | converted
+// ------+------------+---------+---------+------------+------------
+//     1 |          1 |      42 | blue    | 2019-12-17 | 2019-12-17
+//     1 |          1 |      43 | green   | 2019-12-17 | NULL
+//
+// Only the first variant a session saw is used, and only goals reached after
+// the exposure are counted.
+func updateExperiments(ctx context.Context, hits []goatcounter.Hit) error {
+	var exps goatcounter.Experiments
+	err := exps.List(ctx)
+	if err != nil {
+		return errors.Wrap(err, "updateExperiments")
+	}
+	if len(exps) == 0 {
+		return nil
+	}
+
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		siteID := goatcounter.MustGetSite(ctx).ID
+		for _, h := range hits {
+			if h.Bot > 0 || h.Session == nil {
+				continue
+			}
+
+			day := h.CreatedAt.Format("2006-01-02")
+			for _, e := range exps {
+				if h.Experiment == e.Name && stringutil.Contains(e.Variants, h.Variant) {
+					err := insertExposure(ctx, tx, siteID, e.ID, *h.Session, h.Variant, day)
+					if err != nil {
+						return err
+					}
+				}
+
+				if h.Path == e.Goal && h.Event == e.GoalEvent {
+					_, err := tx.ExecContext(ctx, `/* updateExperiments */
+						update experiment_sessions set converted=$1
+						where site=$2 and experiment=$3 and session=$4 and converted is null and day <= $1`,
+						day, siteID, e.ID, *h.Session)
+					if err != nil {
+						return errors.Wrap(err, "updateExperiments")
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func insertExposure(
+	txctx context.Context, tx zdb.DB, siteID, expID, session int64,
+	variant, day string,
+) error {
+	var n int
+	err := tx.GetContext(txctx, &n, `/* insertExposure */
+		select count(*) from experiment_sessions
+		where site=$1 and experiment=$2 and session=$3`,
+		siteID, expID, session)
+	if err != nil {
+		return errors.Wrap(err, "insertExposure")
+	}
+	if n > 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(txctx, `insert into experiment_sessions
+		(site, experiment, session, variant, day) values ($1, $2, $3, $4, $5)`,
+		siteID, expID, session, variant, day)
+	return errors.Wrap(err, "insertExposure")
+}
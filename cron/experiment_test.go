@@ -0,0 +1,66 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestExperiments(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	e := goatcounter.Experiment{Name: "button", Variants: []string{"blue", "green"},
+		Goal: "signup", GoalEvent: true}
+	err := e.Insert(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	site := goatcounter.MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	s1, s2, s3, s4 := int64(1), int64(2), int64(3), int64(4)
+
+	gctest.StoreHits(ctx, t, []goatcounter.Hit{
+		// Converts; the second variant is ignored.
+		{Site: site.ID, Session: &s1, CreatedAt: now, Path: "/", Experiment: "button", Variant: "blue"},
+		{Site: site.ID, Session: &s1, CreatedAt: now, Path: "/", Experiment: "button", Variant: "green"},
+		{Site: site.ID, Session: &s1, CreatedAt: now, Path: "signup", Event: true},
+
+		// Goal is reached before the exposure.
+		{Site: site.ID, Session: &s2, CreatedAt: now, Path: "signup", Event: true},
+		{Site: site.ID, Session: &s2, CreatedAt: now, Path: "/", Experiment: "button", Variant: "green"},
+
+		// Path instead of event, unknown variant, and a bot.
+		{Site: site.ID, Session: &s3, CreatedAt: now, Path: "/", Experiment: "button", Variant: "green"},
+		{Site: site.ID, Session: &s3, CreatedAt: now, Path: "signup"},
+		{Site: site.ID, Session: &s4, CreatedAt: now, Path: "/", Experiment: "button", Variant: "red"},
+		{Site: site.ID, Session: &s4, CreatedAt: now, Path: "/", Experiment: "button", Variant: "blue", Bot: 150},
+	}...)
+
+	// Conversion in a later batch.
+	gctest.StoreHits(ctx, t, []goatcounter.Hit{
+		{Site: site.ID, Session: &s2, CreatedAt: now.Add(24 * time.Hour), Path: "signup", Event: true},
+	}...)
+
+	var results goatcounter.ExperimentResults
+	err = results.List(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := fmt.Sprintf("%s %d/%d; %s %d/%d",
+		results[0].Name, results[0].Conversions, results[0].Exposures,
+		results[1].Name, results[1].Conversions, results[1].Exposures)
+	want := "blue 1/1; green 1/2"
+	if got != want {
+		t.Errorf("\ngot:  %s\nwant: %s", got, want)
+	}
+}
@@ -25,6 +25,9 @@ import (
 //   path       | /jquery.html
 //   title      | Why I'm still using jQuery in 2019
 //   stats      | [0,0,0,0,0,0,0,0,0,0,0,4,7,0,0,0,0,0,0,0,0,0,1,0]
+//
+// The sessions that visited the path are added to the HLL sketch in the hll
+// column, so we can get the number of unique visitors for any period.
 func updateHitStats(ctx context.Context, hits []goatcounter.Hit) error {
 	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
 		// Group by day + path + event.
@@ -35,10 +38,11 @@ func updateHitStats(ctx context.Context, hits []goatcounter.Hit) error {
 			event       zdb.Bool
 			path        string
 			title       string
+			hll         *goatcounter.HLL
 		}
 		grouped := map[string]gt{}
 		for _, h := range hits {
-			if h.Bot > 0 {
+			if h.Bot > 0 || h.Status != 0 { // Error pages are in broken_stats.
 				continue
 			}
 
@@ -50,7 +54,7 @@ func updateHitStats(ctx context.Context, hits []goatcounter.Hit) error {
 				v.path = h.Path
 				v.event = h.Event
 				var err error
-				v.count, v.countUnique, v.title, err = existingHitStats(ctx, tx,
+				v.count, v.countUnique, v.title, v.hll, err = existingHitStats(ctx, tx,
 					h.Site, day, v.path, v.event)
 				if err != nil {
 					return err
@@ -66,16 +70,21 @@ func updateHitStats(ctx context.Context, hits []goatcounter.Hit) error {
 			if h.FirstVisit {
 				v.countUnique[hour] += 1
 			}
+			if h.Session == nil { // The sketch would be incomplete.
+				v.hll = nil
+			} else if v.hll != nil {
+				v.hll.AddSession(*h.Session)
+			}
 			grouped[k] = v
 		}
 
 		siteID := goatcounter.MustGetSite(ctx).ID
 		ins := bulk.NewInsert(ctx, "hit_stats", []string{"site", "day", "path",
-			"event", "title", "stats", "stats_unique"})
+			"event", "title", "stats", "stats_unique", "hll"})
 		for _, v := range grouped {
 			ins.Values(siteID, v.day, v.path, v.event, v.title,
 				jsonutil.MustMarshal(v.count),
-				jsonutil.MustMarshal(v.countUnique))
+				jsonutil.MustMarshal(v.countUnique), v.hll)
 		}
 		return errors.Wrap(ins.Finish(), "updateHitStats")
 	})
@@ -84,30 +93,31 @@ func updateHitStats(ctx context.Context, hits []goatcounter.Hit) error {
 func existingHitStats(
 	txctx context.Context, tx zdb.DB, siteID int64,
 	day, path string, event zdb.Bool,
-) ([]int, []int, string, error) {
+) ([]int, []int, string, *goatcounter.HLL, error) {
 
 	var ex []struct {
-		Stats       []byte   `db:"stats"`
-		StatsUnique []byte   `db:"stats_unique"`
-		Title       string   `db:"title"`
-		Event       zdb.Bool `db:"event"`
+		Stats       []byte           `db:"stats"`
+		StatsUnique []byte           `db:"stats_unique"`
+		HLL         *goatcounter.HLL `db:"hll"`
+		Title       string           `db:"title"`
+		Event       zdb.Bool         `db:"event"`
 	}
 	err := tx.SelectContext(txctx, &ex, `/* existingHitStats */
-		select stats, stats_unique, title, event from hit_stats
+		select stats, stats_unique, hll, title, event from hit_stats
 		where site=$1 and day=$2 and path=$3 and event=$4 limit 1`,
 		siteID, day, path, event)
 	if err != nil {
-		return nil, nil, "", errors.Wrap(err, "existingHitStats")
+		return nil, nil, "", nil, errors.Wrap(err, "existingHitStats")
 	}
 	if len(ex) == 0 {
-		return make([]int, 24), make([]int, 24), "", nil
+		return make([]int, 24), make([]int, 24), "", &goatcounter.HLL{}, nil
 	}
 
 	_, err = tx.ExecContext(txctx, `delete from hit_stats where
 		site=$1 and day=$2 and path=$3 and event=$4`,
 		siteID, day, path, event)
 	if err != nil {
-		return nil, nil, "", errors.Wrap(err, "delete")
+		return nil, nil, "", nil, errors.Wrap(err, "delete")
 	}
 
 	var r, ru []int
@@ -116,5 +126,5 @@ func existingHitStats(
 		jsonutil.MustUnmarshal(ex[0].StatsUnique, &ru)
 	}
 
-	return r, ru, ex[0].Title, nil
+	return r, ru, ex[0].Title, ex[0].HLL, nil
 }
@@ -35,7 +35,7 @@ func TestHitStats(t *testing.T) {
 	}
 
 	gotT := fmt.Sprintf("%d %d %d %d %t", total, totalUnique, display, displayUnique, more)
-	wantT := "3 1 3 1 false"
+	wantT := "3 1 3 2 false"
 	if wantT != gotT {
 		t.Fatalf("wrong totals\ngot:  %s\nwant: %s", gotT, wantT)
 	}
@@ -43,15 +43,63 @@ func TestHitStats(t *testing.T) {
 		t.Fatalf("len(stats) is not 2: %d", len(stats))
 	}
 
-	want0 := `{"Count":2,"CountUnique":1,"Max":10,"DailyMax":10,"Path":"/asd","Event":false,"Title":"aSd","RefScheme":null,"Stats":[{"Day":"2019-08-31","Hourly":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,2,0,0,0,0,0,0,0,0,0],"HourlyUnique":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,1,0,0,0,0,0,0,0,0,0],"Daily":2,"DailyUnique":1}]}`
+	want0 := `{"Count":2,"CountUnique":1,"Max":10,"DailyMax":10,"Path":"/asd","Event":false,"Title":"aSd","RefScheme":null,"Stats":[{"Day":"2019-08-31","Hourly":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,2,0,0,0,0,0,0,0,0,0],"HourlyUnique":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,1,0,0,0,0,0,0,0,0,0],"Daily":2,"DailyUnique":1}],"TimeOnPage":null,"ScrollDepth":null}`
 	got0 := string(jsonutil.MustMarshal(stats[0]))
 	if got0 != want0 {
 		t.Errorf("first wrong\ngot:  %s\nwant: %s", got0, want0)
 	}
 
-	want1 := `{"Count":1,"CountUnique":0,"Max":10,"DailyMax":10,"Path":"/zxc","Event":false,"Title":"","RefScheme":null,"Stats":[{"Day":"2019-08-31","Hourly":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,1,0,0,0,0,0,0,0,0,0],"HourlyUnique":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0],"Daily":1,"DailyUnique":0}]}`
+	want1 := `{"Count":1,"CountUnique":1,"Max":10,"DailyMax":10,"Path":"/zxc","Event":false,"Title":"","RefScheme":null,"Stats":[{"Day":"2019-08-31","Hourly":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,1,0,0,0,0,0,0,0,0,0],"HourlyUnique":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0],"Daily":1,"DailyUnique":0}],"TimeOnPage":null,"ScrollDepth":null}`
 	got1 := string(jsonutil.MustMarshal(stats[1]))
 	if got1 != want1 {
 		t.Errorf("second wrong\ngot:  %s\nwant: %s", got1, want1)
 	}
 }
+
+func TestStatsUniqueRange(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	yesterday := now.Add(-24 * time.Hour)
+	s1, s2, s3 := int64(1), int64(2), int64(3)
+
+	// The same two sessions on both days, and a third session only today.
+	var hits []goatcounter.Hit
+	for _, d := range []time.Time{yesterday, now} {
+		for _, s := range []*int64{&s1, &s2} {
+			hits = append(hits, goatcounter.Hit{Site: site.ID, Session: s, CreatedAt: d,
+				Path: "/a", Ref: "example.com", Browser: "Firefox/69.0", Location: "NZ", FirstVisit: true})
+		}
+	}
+	hits = append(hits, goatcounter.Hit{Site: site.ID, Session: &s3, CreatedAt: now,
+		Path: "/a", Ref: "example.com", Browser: "Firefox/69.0", Location: "NZ", FirstVisit: true})
+
+	gctest.StoreHits(ctx, t, hits...)
+
+	var pages goatcounter.HitStats
+	_, _, _, _, _, err := pages.List(ctx, yesterday, now, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var browsers, locations, refs goatcounter.Stats
+	_, err = browsers.ListBrowsers(ctx, yesterday, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = locations.ListLocations(ctx, yesterday, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = refs.ListRefs(ctx, yesterday, now, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := fmt.Sprintf("%d %d | %v | %v | %v", pages[0].Count, pages[0].CountUnique, browsers, locations, refs)
+	want := "5 3 | [{Firefox 5 3 <nil>}] | [{New Zealand 5 3 <nil>}] | [{example.com 5 3 <nil>}]"
+	if out != want {
+		t.Errorf("\nout:  %s\nwant: %s", out, want)
+	}
+}
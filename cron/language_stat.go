@@ -0,0 +1,111 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+)
+
+// Language stats are stored as a count per language/region per day; the region
+// is empty if the browser only sent the language.
+//
+//  site |    day     | language | region | count
+// ------+------------+----------+--------+-------
+//     1 | 2019-11-30 | en       | US     |     5
+//     1 | 2019-11-30 | en       | GB     |     2
+//     1 | 2019-11-30 | nl       |        |     1
+func updateLanguageStats(ctx context.Context, hits []goatcounter.Hit) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		// Group by day + language + region + event.
+		type gt struct {
+			count       int
+			countUnique int
+			day         string
+			event       zdb.Bool
+			language    string
+			region      string
+		}
+		grouped := map[string]gt{}
+		for _, h := range hits {
+			if h.Bot > 0 || h.Status != 0 || h.Language == "" {
+				continue
+			}
+
+			language, region := getLanguage(h.Language)
+			day := h.CreatedAt.Format("2006-01-02")
+			k := fmt.Sprintf("%s%s%s%t", day, language, region, h.Event)
+			v := grouped[k]
+			if v.count == 0 {
+				v.day = day
+				v.language = language
+				v.region = region
+				v.event = h.Event
+				var err error
+				v.count, v.countUnique, err = existingLanguageStats(ctx, tx,
+					h.Site, day, v.language, v.region, v.event)
+				if err != nil {
+					return err
+				}
+			}
+
+			v.count += 1
+			if h.FirstVisit {
+				v.countUnique += 1
+			}
+			grouped[k] = v
+		}
+
+		siteID := goatcounter.MustGetSite(ctx).ID
+		ins := bulk.NewInsert(ctx, "language_stats", []string{"site", "day",
+			"language", "region", "count", "count_unique", "event"})
+		for _, v := range grouped {
+			ins.Values(siteID, v.day, v.language, v.region, v.count, v.countUnique, v.event)
+		}
+		return ins.Finish()
+	})
+}
+
+func existingLanguageStats(
+	txctx context.Context, tx zdb.DB, siteID int64,
+	day, language, region string, event zdb.Bool,
+) (int, int, error) {
+
+	var c []struct {
+		Count       int `db:"count"`
+		CountUnique int `db:"count_unique"`
+	}
+	err := tx.SelectContext(txctx, &c, `/* existingLanguageStats */
+		select count, count_unique from language_stats
+		where site=$1 and day=$2 and language=$3 and region=$4 and event=$5 limit 1`,
+		siteID, day, language, region, event)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "select")
+	}
+	if len(c) == 0 {
+		return 0, 0, nil
+	}
+
+	_, err = tx.ExecContext(txctx, `delete from language_stats where
+		site=$1 and day=$2 and language=$3 and region=$4 and event=$5`,
+		siteID, day, language, region, event)
+	return c[0].Count, c[0].CountUnique, errors.Wrap(err, "delete")
+}
+
+// getLanguage splits a language tag as stored in the hits table in the
+// language and region.
+func getLanguage(tag string) (string, string) {
+	i := strings.Index(tag, "-")
+	if i == -1 {
+		return tag, ""
+	}
+	return tag[:i], tag[i+1:]
+}
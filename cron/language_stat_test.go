@@ -0,0 +1,81 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	. "zgo.at/goatcounter/cron"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestLanguageStats(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+
+	err := UpdateStats(ctx, site.ID, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, Language: "en-US", FirstVisit: true},
+		{Site: site.ID, CreatedAt: now, Language: "en-GB"},
+		{Site: site.ID, CreatedAt: now, Language: "en"},
+		{Site: site.ID, CreatedAt: now, Language: "nl-NL", FirstVisit: true},
+		{Site: site.ID, CreatedAt: now, Language: ""},
+		{Site: site.ID, CreatedAt: now, Language: "nl-NL", Status: 404}, // Not counted.
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats goatcounter.Stats
+	total, err := stats.ListLanguages(ctx, now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `4 -> [{English 3 1 <nil>} {Dutch 1 1 <nil>}]`
+	out := fmt.Sprintf("%d -> %v", total, stats)
+	if want != out {
+		t.Errorf("\nwant: %s\nout:  %s", want, out)
+	}
+
+	// Update existing.
+	err = UpdateStats(ctx, site.ID, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, Language: "en-US", FirstVisit: true},
+		{Site: site.ID, CreatedAt: now, Language: "es-419"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats = goatcounter.Stats{}
+	total, err = stats.ListLanguages(ctx, now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = `6 -> [{English 4 2 <nil>} {Spanish 1 0 <nil>} {Dutch 1 1 <nil>}]`
+	out = fmt.Sprintf("%d -> %v", total, stats)
+	if want != out {
+		t.Errorf("\nwant: %s\nout:  %s", want, out)
+	}
+
+	// List just English.
+	stats = goatcounter.Stats{}
+	total, err = stats.ListLanguage(ctx, "English", now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = `4 -> [{English (United States) 2 2 <nil>} {English 1 0 <nil>} {English (United Kingdom) 1 0 <nil>}]`
+	out = fmt.Sprintf("%d -> %v", total, stats)
+	if want != out {
+		t.Errorf("\nwant: %s\nout:  %s", want, out)
+	}
+}
@@ -14,38 +14,51 @@ import (
 	"zgo.at/zdb/bulk"
 )
 
-// Location stats are stored as a simple day/location with a count.
-//  site |    day     | location | count
-// ------+------------+----------+-------
-//     1 | 2019-11-30 | ET       |     1
-//     1 | 2019-11-30 | GR       |     2
-//     1 | 2019-11-30 | MX       |     4
+// Location stats are stored as a simple day/location with a count. The region
+// is the ISO-3166-2 code if the GeoIP database has region information, and
+// empty otherwise.
+//  site |    day     | location | region | count
+// ------+------------+----------+--------+-------
+//     1 | 2019-11-30 | ET       |        |     1
+//     1 | 2019-11-30 | GR       |        |     2
+//     1 | 2019-11-30 | MX       | MX-JAL |     4
+//
+// hll is a sketch of the sessions; see goatcounter.HLL.
 func updateLocationStats(ctx context.Context, hits []goatcounter.Hit) error {
 	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
-		// Group by day + location + event.
+		// Group by day + location + region + event.
 		type gt struct {
 			count       int
 			countUnique int
 			day         string
 			event       zdb.Bool
 			location    string
+			region      string
+			hll         *goatcounter.HLL
 		}
 		grouped := map[string]gt{}
+		regions := map[string]string{}
 		for _, h := range hits {
-			if h.Bot > 0 {
+			if h.Bot > 0 || h.Status != 0 {
 				continue
 			}
 
+			location, region := h.Location, h.Region
+			if region != "" && h.RegionName != "" {
+				regions[region] = h.RegionName
+			}
+
 			day := h.CreatedAt.Format("2006-01-02")
-			k := fmt.Sprintf("%s%s%t", day, h.Location, h.Event)
+			k := fmt.Sprintf("%s%s%s%t", day, location, region, h.Event)
 			v := grouped[k]
 			if v.count == 0 {
 				v.day = day
-				v.location = h.Location
+				v.location = location
+				v.region = region
 				v.event = h.Event
 				var err error
-				v.count, v.countUnique, err = existingLocationStats(ctx, tx,
-					h.Site, day, v.location, v.event)
+				v.count, v.countUnique, v.hll, err = existingLocationStats(ctx, tx,
+					h.Site, day, v.location, v.region, v.event)
 				if err != nil {
 					return err
 				}
@@ -55,42 +68,62 @@ func updateLocationStats(ctx context.Context, hits []goatcounter.Hit) error {
 			if h.FirstVisit {
 				v.countUnique += 1
 			}
+			if h.Session == nil { // The sketch would be incomplete.
+				v.hll = nil
+			} else if v.hll != nil {
+				v.hll.AddSession(*h.Session)
+			}
 			grouped[k] = v
 		}
 
 		siteID := goatcounter.MustGetSite(ctx).ID
 		ins := bulk.NewInsert(ctx, "location_stats", []string{"site", "day",
-			"location", "count", "count_unique", "event"})
+			"location", "region", "count", "count_unique", "hll", "event"})
 		for _, v := range grouped {
-			ins.Values(siteID, v.day, v.location, v.count, v.countUnique, v.event)
+			ins.Values(siteID, v.day, v.location, v.region, v.count, v.countUnique, v.hll, v.event)
+		}
+		err := ins.Finish()
+		if err != nil {
+			return err
+		}
+
+		// Store the names, as we can't get them from the GeoIP database
+		// without an IP address.
+		for code, name := range regions {
+			_, err := tx.ExecContext(ctx, `insert into iso_3166_2 (name, alpha2)
+				values ($1, $2) on conflict do nothing`, name, code)
+			if err != nil {
+				return errors.Wrap(err, "updateLocationStats")
+			}
 		}
-		return ins.Finish()
+		return nil
 	})
 }
 
 func existingLocationStats(
 	txctx context.Context, tx zdb.DB, siteID int64,
-	day, location string, event zdb.Bool,
-) (int, int, error) {
+	day, location, region string, event zdb.Bool,
+) (int, int, *goatcounter.HLL, error) {
 
 	var c []struct {
-		Count       int      `db:"count"`
-		CountUnique int      `db:"count_unique"`
-		Event       zdb.Bool `db:"event"`
+		Count       int              `db:"count"`
+		CountUnique int              `db:"count_unique"`
+		HLL         *goatcounter.HLL `db:"hll"`
+		Event       zdb.Bool         `db:"event"`
 	}
 	err := tx.SelectContext(txctx, &c, `/* existingLocationStats */
-		select count, count_unique, event from location_stats
-		where site=$1 and day=$2 and location=$3 limit 1`,
-		siteID, day, location)
+		select count, count_unique, hll, event from location_stats
+		where site=$1 and day=$2 and location=$3 and region=$4 limit 1`,
+		siteID, day, location, region)
 	if err != nil {
-		return 0, 0, errors.Wrap(err, "select")
+		return 0, 0, nil, errors.Wrap(err, "select")
 	}
 	if len(c) == 0 {
-		return 0, 0, nil
+		return 0, 0, &goatcounter.HLL{}, nil
 	}
 
 	_, err = tx.ExecContext(txctx, `delete from location_stats where
-		site=$1 and day=$2 and location=$3 and event=$4`,
-		siteID, day, location, event)
-	return c[0].Count, c[0].CountUnique, errors.Wrap(err, "delete")
+		site=$1 and day=$2 and location=$3 and region=$4 and event=$5`,
+		siteID, day, location, region, event)
+	return c[0].Count, c[0].CountUnique, c[0].HLL, errors.Wrap(err, "delete")
 }
@@ -25,6 +25,7 @@ func TestLocationStats(t *testing.T) {
 		{Site: site.ID, CreatedAt: now, Location: "ID"},
 		{Site: site.ID, CreatedAt: now, Location: "ID"},
 		{Site: site.ID, CreatedAt: now, Location: "ET", FirstVisit: true},
+		{Site: site.ID, CreatedAt: now, Location: "ID", Status: 404}, // Not counted.
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -36,7 +37,7 @@ func TestLocationStats(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	want := `3 -> [{Indonesia 2 0} {Ethiopia 1 1}]`
+	want := `3 -> [{Indonesia 2 0 <nil>} {Ethiopia 1 1 <nil>}]`
 	out := fmt.Sprintf("%d -> %v", total, stats)
 	if want != out {
 		t.Errorf("\nwant: %s\nout:  %s", want, out)
@@ -62,7 +63,42 @@ func TestLocationStats(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	want = `10 -> [{Ethiopia 5 3} {Indonesia 4 0} {New Zealand 1 0}]`
+	want = `10 -> [{Ethiopia 5 3 <nil>} {Indonesia 4 0 <nil>} {New Zealand 1 0 <nil>}]`
+	out = fmt.Sprintf("%d -> %v", total, stats)
+	if want != out {
+		t.Errorf("\nwant: %s\nout:  %s", want, out)
+	}
+
+	// Regions.
+	err = UpdateStats(ctx, site.ID, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, Location: "NZ", Region: "NZ-WGN", RegionName: "Wellington"},
+		{Site: site.ID, CreatedAt: now, Location: "NZ", Region: "NZ-WGN", RegionName: "Wellington", FirstVisit: true},
+		{Site: site.ID, CreatedAt: now, Location: "NZ", Region: "NZ-AUK", RegionName: "Auckland"},
+		{Site: site.ID, CreatedAt: now, Location: "NZ", Region: "NZ-CAN"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats = goatcounter.Stats{}
+	total, err = stats.ListLocations(ctx, now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = `14 -> [{Ethiopia 5 3 <nil>} {New Zealand 5 1 <nil>} {Indonesia 4 0 <nil>}]`
+	out = fmt.Sprintf("%d -> %v", total, stats)
+	if want != out {
+		t.Errorf("\nwant: %s\nout:  %s", want, out)
+	}
+
+	stats = goatcounter.Stats{}
+	total, err = stats.ListLocation(ctx, "New Zealand", now, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = `5 -> [{Wellington 2 1 <nil>} { 1 0 <nil>} {Auckland 1 0 <nil>} {NZ-CAN 1 0 <nil>}]`
 	out = fmt.Sprintf("%d -> %v", total, stats)
 	if want != out {
 		t.Errorf("\nwant: %s\nout:  %s", want, out)
@@ -0,0 +1,99 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"time"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+)
+
+// Every distinct title of a path is stored with the first and last day it was
+// seen, as hit_stats only has the latest title for every day:
+//
+//  site | path  |     title     | first_seen | last_seen
+// ------+-------+---------------+------------+------------
+//     1 | /post | Draft title   | 2019-12-01 | 2019-12-03
+//     1 | /post | Better title  | 2019-12-03 | 2019-12-17
+func updatePathTitles(ctx context.Context, hits []goatcounter.Hit) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		// Group by path + title.
+		type gt struct {
+			path      string
+			title     string
+			firstSeen string
+			lastSeen  string
+		}
+		grouped := map[string]gt{}
+		for _, h := range hits {
+			if h.Bot > 0 || h.Status != 0 || h.Title == "" {
+				continue
+			}
+
+			day := h.CreatedAt.Format("2006-01-02")
+			k := h.Path + "\x00" + h.Title
+			v, ok := grouped[k]
+			if !ok {
+				v.path = h.Path
+				v.title = h.Title
+				var err error
+				v.firstSeen, v.lastSeen, err = existingPathTitles(ctx, tx, h.Site, v.path, v.title)
+				if err != nil {
+					return err
+				}
+			}
+
+			if v.firstSeen == "" || day < v.firstSeen {
+				v.firstSeen = day
+			}
+			if day > v.lastSeen {
+				v.lastSeen = day
+			}
+			grouped[k] = v
+		}
+
+		siteID := goatcounter.MustGetSite(ctx).ID
+		ins := bulk.NewInsert(ctx, "path_titles", []string{"site", "path",
+			"title", "first_seen", "last_seen"})
+		for _, v := range grouped {
+			ins.Values(siteID, v.path, v.title, v.firstSeen, v.lastSeen)
+		}
+		return errors.Wrap(ins.Finish(), "updatePathTitles")
+	})
+}
+
+func existingPathTitles(
+	txctx context.Context, tx zdb.DB, siteID int64,
+	path, title string,
+) (string, string, error) {
+
+	var ex []struct {
+		FirstSeen time.Time `db:"first_seen"`
+		LastSeen  time.Time `db:"last_seen"`
+	}
+	err := tx.SelectContext(txctx, &ex, `/* existingPathTitles */
+		select first_seen, last_seen from path_titles
+		where site=$1 and path=$2 and title=$3 limit 1`,
+		siteID, path, title)
+	if err != nil {
+		return "", "", errors.Wrap(err, "existingPathTitles")
+	}
+	if len(ex) == 0 {
+		return "", "", nil
+	}
+
+	_, err = tx.ExecContext(txctx, `delete from path_titles where
+		site=$1 and path=$2 and title=$3`,
+		siteID, path, title)
+	if err != nil {
+		return "", "", errors.Wrap(err, "delete")
+	}
+
+	return ex[0].FirstSeen.Format("2006-01-02"), ex[0].LastSeen.Format("2006-01-02"), nil
+}
@@ -0,0 +1,64 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestPathTitles(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	day := func(d int) time.Time { return time.Date(2019, 8, d, 14, 42, 0, 0, time.UTC) }
+
+	gctest.StoreHits(ctx, t, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: day(1), Path: "/post", Title: "Draft title"},
+		{Site: site.ID, CreatedAt: day(3), Path: "/post", Title: "Draft title"},
+		{Site: site.ID, CreatedAt: day(3), Path: "/post", Title: "Better title"},
+		{Site: site.ID, CreatedAt: day(4), Path: "/post", Title: ""},
+		{Site: site.ID, CreatedAt: day(4), Path: "/other", Title: "Other"},
+	}...)
+	// Stored in a separate run, so the existing rows are updated.
+	gctest.StoreHits(ctx, t, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: day(17), Path: "/post", Title: "Better title"},
+	}...)
+
+	var titles goatcounter.PathTitles
+	err := titles.List(ctx, "/post")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	for _, tt := range titles {
+		got += fmt.Sprintf("%s %s %s\n", tt.Title,
+			tt.FirstSeen.Format("2006-01-02"), tt.LastSeen.Format("2006-01-02"))
+	}
+	want := "Better title 2019-08-03 2019-08-17\nDraft title 2019-08-01 2019-08-03\n"
+	if got != want {
+		t.Errorf("\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Filter on the old title.
+	for _, f := range []string{"draft", `title:"draft title"`, "title:~^draft"} {
+		t.Run(f, func(t *testing.T) {
+			var stats goatcounter.HitStats
+			_, _, _, _, _, err := stats.List(ctx, day(1), day(31), f, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stats) != 1 || stats[0].Path != "/post" {
+				t.Errorf("wrong stats: %v", stats)
+			}
+		})
+	}
+}
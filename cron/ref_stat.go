@@ -14,38 +14,50 @@ import (
 	"zgo.at/zdb/bulk"
 )
 
-// Ref stats are stored as a simple day/location with a count.
-//  site |    day     | ref      | count
-// ------+------------+----------+-------
-//     1 | 2019-11-30 | https:// |     1
-//     1 | 2019-11-30 | t.co/..  |     2
-//     1 | 2019-11-30 | ....     |     4
+// Ref stats are stored as a simple day/location with a count, and the channel
+// the ref belongs to.
+//  site |    day     | ref      | channel | count
+// ------+------------+----------+---------+-------
+//     1 | 2019-11-30 |          | direct  |     1
+//     1 | 2019-11-30 | t.co/..  | social  |     2
+//     1 | 2019-11-30 | ....     | other   |     4
+//
+// hll is a sketch of the sessions; see goatcounter.HLL.
 func updateRefStats(ctx context.Context, hits []goatcounter.Hit) error {
 	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
-		// Group by day + ref + event.
+		// Group by day + ref + channel + event.
 		type gt struct {
 			count       int
 			countUnique int
 			day         string
 			event       zdb.Bool
 			ref         string
+			channel     string
+			hll         *goatcounter.HLL
 		}
+		site := goatcounter.MustGetSite(ctx)
 		grouped := map[string]gt{}
 		for _, h := range hits {
-			if h.Bot > 0 {
+			if h.Bot > 0 || h.Status != 0 { // Referrers to error pages are in broken_stats.
 				continue
 			}
 
+			channel := h.Channel
+			if channel == "" { // Hits from before channels were stored.
+				channel = goatcounter.RefChannel(site, h.Ref, h.RefScheme, h.UTMMedium)
+			}
+
 			day := h.CreatedAt.Format("2006-01-02")
-			k := fmt.Sprintf("%s%s%t", day, h.Ref, h.Event)
+			k := fmt.Sprintf("%s%s%s%t", day, h.Ref, channel, h.Event)
 			v := grouped[k]
 			if v.count == 0 {
 				v.day = day
 				v.ref = h.Ref
+				v.channel = channel
 				v.event = h.Event
 				var err error
-				v.count, v.countUnique, err = existingRefStats(ctx, tx, h.Site,
-					day, v.ref, v.event)
+				v.count, v.countUnique, v.hll, err = existingRefStats(ctx, tx, h.Site,
+					day, v.ref, v.channel, v.event)
 				if err != nil {
 					return err
 				}
@@ -55,14 +67,18 @@ func updateRefStats(ctx context.Context, hits []goatcounter.Hit) error {
 			if h.FirstVisit {
 				v.countUnique += 1
 			}
+			if h.Session == nil { // The sketch would be incomplete.
+				v.hll = nil
+			} else if v.hll != nil {
+				v.hll.AddSession(*h.Session)
+			}
 			grouped[k] = v
 		}
 
-		siteID := goatcounter.MustGetSite(ctx).ID
 		ins := bulk.NewInsert(ctx, "ref_stats", []string{"site", "day", "ref",
-			"count", "count_unique", "event"})
+			"channel", "count", "count_unique", "hll", "event"})
 		for _, v := range grouped {
-			ins.Values(siteID, v.day, v.ref, v.count, v.countUnique, v.event)
+			ins.Values(site.ID, v.day, v.ref, v.channel, v.count, v.countUnique, v.hll, v.event)
 		}
 		return ins.Finish()
 	})
@@ -70,27 +86,28 @@ func updateRefStats(ctx context.Context, hits []goatcounter.Hit) error {
 
 func existingRefStats(
 	txctx context.Context, tx zdb.DB, siteID int64,
-	day, ref string, event zdb.Bool,
-) (int, int, error) {
+	day, ref, channel string, event zdb.Bool,
+) (int, int, *goatcounter.HLL, error) {
 
 	var c []struct {
-		Count       int      `db:"count"`
-		CountUnique int      `db:"count_unique"`
-		Event       zdb.Bool `db:"event"`
+		Count       int              `db:"count"`
+		CountUnique int              `db:"count_unique"`
+		HLL         *goatcounter.HLL `db:"hll"`
+		Event       zdb.Bool         `db:"event"`
 	}
 	err := tx.SelectContext(txctx, &c, `/* existingRefStats */
-		select count, count_unique, event from ref_stats
-		where site=$1 and day=$2 and ref=$3 limit 1`,
-		siteID, day, ref)
+		select count, count_unique, hll, event from ref_stats
+		where site=$1 and day=$2 and ref=$3 and channel=$4 limit 1`,
+		siteID, day, ref, channel)
 	if err != nil {
-		return 0, 0, errors.Wrap(err, "select")
+		return 0, 0, nil, errors.Wrap(err, "select")
 	}
 	if len(c) == 0 {
-		return 0, 0, nil
+		return 0, 0, &goatcounter.HLL{}, nil
 	}
 
 	_, err = tx.ExecContext(txctx, `delete from ref_stats where
-		site=$1 and day=$2 and ref=$3 and event=$4`,
-		siteID, day, ref, event)
-	return c[0].Count, c[0].CountUnique, errors.Wrap(err, "delete")
+		site=$1 and day=$2 and ref=$3 and channel=$4 and event=$5`,
+		siteID, day, ref, channel, event)
+	return c[0].Count, c[0].CountUnique, c[0].HLL, errors.Wrap(err, "delete")
 }
@@ -0,0 +1,57 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	. "zgo.at/goatcounter/cron"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestChannelStats(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	c := goatcounter.RefSchemeCampaign
+
+	err := UpdateStats(ctx, site.ID, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, Ref: "", Channel: "direct", FirstVisit: true},
+		{Site: site.ID, CreatedAt: now, Ref: "Google", Channel: "search", FirstVisit: true},
+		{Site: site.ID, CreatedAt: now, Ref: "Google", Channel: "search", Status: 404}, // Not counted.
+		{Site: site.ID, CreatedAt: now.Add(-24 * time.Hour), Ref: "Google", Channel: "search"},
+		{Site: site.ID, CreatedAt: now.Add(-24 * time.Hour), Ref: "t.co/asd", Channel: "social"},
+
+		// No channel stored; should get it from the ref.
+		{Site: site.ID, CreatedAt: now, Ref: "Hacker News"},
+		{Site: site.ID, CreatedAt: now, Ref: "sale", RefScheme: c},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats goatcounter.ChannelStats
+	total, err := stats.List(ctx, now.Add(-48*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := fmt.Sprintf("%d", total)
+	for _, s := range stats {
+		out += fmt.Sprintf(" | %s %d %d %d", s.Channel, s.Count, s.CountUnique, s.Max)
+		for _, d := range s.Stats {
+			out += fmt.Sprintf(" %d", d.Daily)
+		}
+	}
+	want := "6 | direct 1 1 1 0 0 1 | search 2 1 1 0 1 1 | social 2 0 1 0 1 1 | campaign 1 0 1 0 0 1"
+	if out != want {
+		t.Errorf("\nout:  %s\nwant: %s", out, want)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"fmt"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+)
+
+// Scroll stats are stored as a day/path/depth with a count; the depth is one
+// of goatcounter.ScrollDepths.
+//
+//  site |    day     | path | depth | count
+// ------+------------+------+-------+-------
+//     1 | 2019-11-30 | /    |     0 |     2
+//     1 | 2019-11-30 | /    |    75 |     1
+//     1 | 2019-11-30 | /foo |   100 |     4
+//
+// A beacon with PrevScroll moves the visitor from the previous depth to the new
+// one, the same as the time on page stats.
+func updateScrollStats(ctx context.Context, beacons []goatcounter.Beacon) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		// Group by day + path + depth + event.
+		type gt struct {
+			count int
+			day   string
+			event zdb.Bool
+			path  string
+			depth int
+		}
+		grouped := map[string]gt{}
+		get := func(b goatcounter.Beacon, depth int) (string, gt, error) {
+			day := b.CreatedAt.Format("2006-01-02")
+			k := fmt.Sprintf("%s%s%d%t", day, b.Path, depth, b.Event)
+			v, ok := grouped[k]
+			if ok {
+				return k, v, nil
+			}
+
+			v.day = day
+			v.path = b.Path
+			v.depth = depth
+			v.event = b.Event
+			var err error
+			v.count, err = existingScrollStats(ctx, tx, b.Site, day, v.path, v.depth, v.event)
+			return k, v, err
+		}
+
+		for _, b := range beacons {
+			if b.Scroll == nil {
+				continue
+			}
+
+			// Move the visitor from the previous depth, but only if it's in
+			// the stats for this day.
+			if b.PrevScroll != nil {
+				k, v, err := get(b, *b.PrevScroll)
+				if err != nil {
+					return err
+				}
+				grouped[k] = v
+				if v.count == 0 {
+					continue
+				}
+				v.count -= 1
+				grouped[k] = v
+			}
+
+			k, v, err := get(b, *b.Scroll)
+			if err != nil {
+				return err
+			}
+			v.count += 1
+			grouped[k] = v
+		}
+
+		siteID := goatcounter.MustGetSite(ctx).ID
+		ins := bulk.NewInsert(ctx, "scroll_stats", []string{"site", "day", "path",
+			"depth", "event", "count"})
+		for _, v := range grouped {
+			if v.count == 0 {
+				continue
+			}
+			ins.Values(siteID, v.day, v.path, v.depth, v.event, v.count)
+		}
+		return ins.Finish()
+	})
+}
+
+func existingScrollStats(
+	txctx context.Context, tx zdb.DB, siteID int64,
+	day, path string, depth int, event zdb.Bool,
+) (int, error) {
+
+	var c []int
+	err := tx.SelectContext(txctx, &c, `/* existingScrollStats */
+		select count from scroll_stats
+		where site=$1 and day=$2 and path=$3 and depth=$4 and event=$5 limit 1`,
+		siteID, day, path, depth, event)
+	if err != nil {
+		return 0, errors.Wrap(err, "select")
+	}
+	if len(c) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(txctx, `delete from scroll_stats where
+		site=$1 and day=$2 and path=$3 and depth=$4 and event=$5`,
+		siteID, day, path, depth, event)
+	return c[0], errors.Wrap(err, "delete")
+}
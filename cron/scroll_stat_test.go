@@ -0,0 +1,69 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	. "zgo.at/goatcounter/cron"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestScrollStats(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	depth := func(d int) *int { return &d }
+
+	gctest.StoreHits(ctx, t, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, Path: "/asd"},
+		{Site: site.ID, CreatedAt: now, Path: "/zxc"},
+	}...)
+
+	err := UpdateBeaconStats(ctx, site.ID, []goatcounter.Beacon{
+		{Site: site.ID, CreatedAt: now, Path: "/asd", Scroll: depth(100)},
+		{Site: site.ID, CreatedAt: now, Path: "/asd", Scroll: depth(50)},
+		{Site: site.ID, CreatedAt: now, Path: "/zxc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Update existing.
+	err = UpdateBeaconStats(ctx, site.ID, []goatcounter.Beacon{
+		{Site: site.ID, CreatedAt: now, Path: "/asd", Scroll: depth(0)},
+		{Site: site.ID, CreatedAt: now, Path: "/asd", Scroll: depth(100)},
+		{Site: site.ID, CreatedAt: now, Path: "/asd", Scroll: depth(75), PrevScroll: depth(50)},
+
+		// Previous depth isn't in the stats; don't add a row.
+		{Site: site.ID, CreatedAt: now, Path: "/zxc", Scroll: depth(100), PrevScroll: depth(50)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats goatcounter.HitStats
+	_, _, _, _, _, err = stats.List(ctx, now.Add(-1*time.Hour), now.Add(1*time.Hour), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for _, s := range stats {
+		got[s.Path] = fmt.Sprintf("%#v %s", []int(s.ScrollDepth), s.ScrollDepth)
+	}
+	want := map[string]string{
+		"/asd": "[]int{1, 0, 0, 1, 2} 25%: 75% · 50%: 75% · 75%: 75% · 100%: 50%",
+		"/zxc": "[]int(nil) ",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("\ngot:  %v\nwant: %v", got, want)
+	}
+}
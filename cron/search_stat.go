@@ -0,0 +1,164 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"time"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+)
+
+// Search stats are stored as a count per term per day, with the number of
+// searches that weren't followed by a pageview in the same session:
+//
+//  site |    day     |   term    | count | no_pageview
+// ------+------------+-----------+-------+-------------
+//     1 | 2019-11-30 | install   |    12 |           2
+//     1 | 2019-11-30 | api token |     3 |           3
+//
+// Every search is counted as "no pageview" until the next pageview in the
+// session that isn't a search arrives.
+func updateSearchStats(ctx context.Context, hits []goatcounter.Hit) error {
+	if goatcounter.MustGetSite(ctx).Settings.SearchPage == "" {
+		return nil
+	}
+
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		// Group by day + term.
+		type gt struct {
+			day        string
+			term       string
+			count      int
+			noPageview int
+		}
+		grouped := map[string]*gt{}
+		get := func(siteID int64, day, term string) (*gt, error) {
+			k := day + "\x00" + term
+			v, ok := grouped[k]
+			if !ok {
+				v = &gt{day: day, term: term}
+				var err error
+				v.count, v.noPageview, err = existingSearchStats(ctx, tx, siteID, day, term)
+				if err != nil {
+					return nil, err
+				}
+				grouped[k] = v
+			}
+			return v, nil
+		}
+
+		// The previous pageview for every session.
+		prev := map[int64]*searchHit{}
+
+		for _, h := range hits {
+			if h.Bot > 0 || h.Event {
+				continue
+			}
+
+			if h.Session != nil {
+				p, ok := prev[*h.Session]
+				if !ok {
+					var err error
+					p, err = previousSearch(ctx, tx, h.Site, *h.Session, h.CreatedAt)
+					if err != nil {
+						return err
+					}
+				}
+
+				// The previous search was followed by this pageview.
+				if p != nil && p.term != "" && h.SearchTerm == "" {
+					v, err := get(h.Site, p.day, p.term)
+					if err != nil {
+						return err
+					}
+					if v.noPageview > 0 {
+						v.noPageview--
+					}
+				}
+
+				prev[*h.Session] = &searchHit{term: h.SearchTerm, day: h.CreatedAt.Format("2006-01-02")}
+			}
+
+			if h.SearchTerm != "" {
+				v, err := get(h.Site, h.CreatedAt.Format("2006-01-02"), h.SearchTerm)
+				if err != nil {
+					return err
+				}
+				v.count++
+				v.noPageview++
+			}
+		}
+
+		siteID := goatcounter.MustGetSite(ctx).ID
+		ins := bulk.NewInsert(ctx, "search_stats", []string{"site", "day",
+			"term", "count", "no_pageview"})
+		for _, v := range grouped {
+			if v.count == 0 {
+				continue
+			}
+			ins.Values(siteID, v.day, v.term, v.count, v.noPageview)
+		}
+		return errors.Wrap(ins.Finish(), "updateSearchStats")
+	})
+}
+
+type searchHit struct {
+	term string // Empty if it's not a search.
+	day  string
+}
+
+// previousSearch gets the pageview before the given time for the session, or
+// nil if there isn't one.
+func previousSearch(
+	txctx context.Context, tx zdb.DB, siteID, session int64, before time.Time,
+) (*searchHit, error) {
+
+	var p struct {
+		SearchTerm string    `db:"search_term"`
+		CreatedAt  time.Time `db:"created_at"`
+	}
+	err := tx.GetContext(txctx, &p, `/* previousSearch */
+		select search_term, created_at from hits
+		where site=$1 and session=$2 and bot=0 and event=0 and created_at < $3
+		order by created_at desc limit 1`,
+		siteID, session, before.Format(zdb.Date))
+	if err != nil {
+		if zdb.ErrNoRows(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "previousSearch")
+	}
+	return &searchHit{term: p.SearchTerm, day: p.CreatedAt.Format("2006-01-02")}, nil
+}
+
+func existingSearchStats(
+	txctx context.Context, tx zdb.DB, siteID int64,
+	day, term string,
+) (int, int, error) {
+
+	var s []struct {
+		Count      int `db:"count"`
+		NoPageview int `db:"no_pageview"`
+	}
+	err := tx.SelectContext(txctx, &s, `/* existingSearchStats */
+		select count, no_pageview from search_stats
+		where site=$1 and day=$2 and term=$3 limit 1`,
+		siteID, day, term)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "select")
+	}
+	if len(s) == 0 {
+		return 0, 0, nil
+	}
+
+	_, err = tx.ExecContext(txctx, `delete from search_stats where
+		site=$1 and day=$2 and term=$3`,
+		siteID, day, term)
+	return s[0].Count, s[0].NoPageview, errors.Wrap(err, "delete")
+}
@@ -0,0 +1,64 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+	"zgo.at/zdb"
+)
+
+func TestSearchStats(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	site.Settings.SearchPage = "/search?q="
+	_, err := zdb.MustGet(ctx).ExecContext(ctx, `update sites set settings=$1 where id=$2`,
+		site.Settings, site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	s1, s2, s3 := int64(1), int64(2), int64(3)
+
+	gctest.StoreHits(ctx, t, []goatcounter.Hit{
+		// Refined search, and then found something.
+		{Site: site.ID, Session: &s1, CreatedAt: now, Path: "/search?q=instal"},
+		{Site: site.ID, Session: &s1, CreatedAt: now.Add(1 * time.Second), Path: "/search?q=Install"},
+		{Site: site.ID, Session: &s1, CreatedAt: now.Add(2 * time.Second), Path: "/docs/install"},
+
+		// Nothing found.
+		{Site: site.ID, Session: &s2, CreatedAt: now, Path: "/search?q=install"},
+
+		// Event doesn't count as a pageview.
+		{Site: site.ID, Session: &s3, CreatedAt: now, Path: "/search?q=api"},
+		{Site: site.ID, Session: &s3, CreatedAt: now.Add(time.Second), Path: "click", Event: true},
+	}...)
+
+	// Pageview in a later batch.
+	gctest.StoreHits(ctx, t, goatcounter.Hit{Site: site.ID, Session: &s2,
+		CreatedAt: now.Add(time.Minute), Path: "/docs/install"})
+
+	var stats goatcounter.SearchStats
+	total, err := stats.List(ctx, now, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := fmt.Sprintf("total=%d", total)
+	for _, s := range stats {
+		got += fmt.Sprintf(" %s %d/%d", s.Term, s.Count, s.NoPageview)
+	}
+	want := "total=4 install 2/0 api 1/1 instal 1/1"
+	if got != want {
+		t.Errorf("\ngot:  %s\nwant: %s", got, want)
+	}
+}
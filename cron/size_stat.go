@@ -32,7 +32,7 @@ func updateSizeStats(ctx context.Context, hits []goatcounter.Hit) error {
 		}
 		grouped := map[string]gt{}
 		for _, h := range hits {
-			if h.Bot > 0 {
+			if h.Bot > 0 || h.Status != 0 {
 				continue
 			}
 
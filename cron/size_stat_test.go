@@ -26,6 +26,7 @@ func TestSizeStats(t *testing.T) {
 		{Site: site.ID, CreatedAt: now, Size: []float64{1920, 1080, 1}, FirstVisit: true},
 		{Site: site.ID, CreatedAt: now, Size: []float64{1920, 1080, 1}},
 		{Site: site.ID, CreatedAt: now, Size: []float64{1024, 768, 1}},
+		{Site: site.ID, CreatedAt: now, Size: []float64{1024, 768, 1}, Status: 404}, // Not counted.
 		{Site: site.ID, CreatedAt: now, Size: []float64{}},
 		{Site: site.ID, CreatedAt: now, Size: nil},
 	})
@@ -39,12 +40,12 @@ func TestSizeStats(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	want := `5 -> [{Phones 0 0}
-{Large phones, small tablets 1 0}
-{Tablets and small laptops 0 0}
-{Computer monitors 2 1}
-{Computer monitors larger than HD 0 0}
-{(unknown) 2 0}]`
+	want := `5 -> [{Phones 0 0 <nil>}
+{Large phones, small tablets 1 0 <nil>}
+{Tablets and small laptops 0 0 <nil>}
+{Computer monitors 2 1 <nil>}
+{Computer monitors larger than HD 0 0 <nil>}
+{(unknown) 2 0 <nil>}]`
 	out := strings.ReplaceAll(fmt.Sprintf("%d -> %v", total, stats), "} ", "}\n")
 	if want != out {
 		t.Errorf("\nwant:\n%s\nout:\n%s", want, out)
@@ -69,12 +70,12 @@ func TestSizeStats(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	want = `11 -> [{Phones 1 0}
-{Large phones, small tablets 3 0}
-{Tablets and small laptops 0 0}
-{Computer monitors 4 2}
-{Computer monitors larger than HD 0 0}
-{(unknown) 3 1}]`
+	want = `11 -> [{Phones 1 0 <nil>}
+{Large phones, small tablets 3 0 <nil>}
+{Tablets and small laptops 0 0 <nil>}
+{Computer monitors 4 2 <nil>}
+{Computer monitors larger than HD 0 0 <nil>}
+{(unknown) 3 1 <nil>}]`
 	out = strings.ReplaceAll(fmt.Sprintf("%d -> %v", total, stats), "} ", "}\n")
 	if want != out {
 		t.Errorf("\nwant: %s\nout:  %s", want, out)
@@ -0,0 +1,105 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"fmt"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+)
+
+// Systems are stored as a count per system/version/device per day:
+//
+//  site |    day     | system  | version | device  | count
+// ------+------------+---------+---------+---------+------
+//     1 | 2019-12-17 | Windows | 10      | Desktop |    13
+//     1 | 2019-12-17 | iOS     | 13      | Mobile  |     2
+//     1 | 2019-12-17 | iOS     | 12      | Tablet  |     1
+func updateSystemStats(ctx context.Context, hits []goatcounter.Hit) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		// Group by day + system + device + event.
+		type gt struct {
+			count       int
+			countUnique int
+			day         string
+			event       zdb.Bool
+			system      string
+			version     string
+			device      string
+		}
+		grouped := map[string]gt{}
+		for _, h := range hits {
+			if h.Bot > 0 || h.Status != 0 {
+				continue
+			}
+
+			system, version, device := goatcounter.ParseSystem(h.Browser)
+			if system == "" {
+				continue
+			}
+
+			day := h.CreatedAt.Format("2006-01-02")
+			k := fmt.Sprintf("%s%s%s%s%t", day, system, version, device, h.Event)
+			v := grouped[k]
+			if v.count == 0 {
+				v.day = day
+				v.system = system
+				v.version = version
+				v.device = device
+				v.event = h.Event
+				var err error
+				v.count, v.countUnique, err = existingSystemStats(ctx, tx,
+					h.Site, day, v.system, v.version, v.device, v.event)
+				if err != nil {
+					return err
+				}
+			}
+
+			v.count += 1
+			if h.FirstVisit {
+				v.countUnique += 1
+			}
+			grouped[k] = v
+		}
+
+		siteID := goatcounter.MustGetSite(ctx).ID
+		ins := bulk.NewInsert(ctx, "system_stats", []string{"site", "day",
+			"system", "version", "device", "count", "count_unique", "event"})
+		for _, v := range grouped {
+			ins.Values(siteID, v.day, v.system, v.version, v.device, v.count, v.countUnique, v.event)
+		}
+		return ins.Finish()
+	})
+}
+
+func existingSystemStats(
+	txctx context.Context, tx zdb.DB, siteID int64,
+	day, system, version, device string, event zdb.Bool,
+) (int, int, error) {
+
+	var c []struct {
+		Count       int `db:"count"`
+		CountUnique int `db:"count_unique"`
+	}
+	err := tx.SelectContext(txctx, &c, `/* existingSystemStats */
+		select count, count_unique from system_stats
+		where site=$1 and day=$2 and system=$3 and version=$4 and device=$5 and event=$6 limit 1`,
+		siteID, day, system, version, device, event)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "select")
+	}
+	if len(c) == 0 {
+		return 0, 0, nil
+	}
+
+	_, err = tx.ExecContext(txctx, `delete from system_stats where
+		site=$1 and day=$2 and system=$3 and version=$4 and device=$5 and event=$6`,
+		siteID, day, system, version, device, event)
+	return c[0].Count, c[0].CountUnique, errors.Wrap(err, "delete")
+}
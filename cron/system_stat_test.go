@@ -0,0 +1,84 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	. "zgo.at/goatcounter/cron"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestSystemStats(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+
+	var (
+		win     = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:72.0) Gecko/20100101 Firefox/72.0"
+		mac     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_3) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0.5 Safari/605.1.15"
+		iphone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 13_3 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0.4 Mobile/15E148 Safari/604.1"
+		ipad    = "Mozilla/5.0 (iPad; CPU OS 12_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.1.2 Mobile/15E148 Safari/604.1"
+		android = "Mozilla/5.0 (Linux; Android 9; SM-T510) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/79.0.3945.136 Safari/537.36"
+		ps4     = "Mozilla/5.0 (PlayStation 4 7.02) AppleWebKit/605.1.15 (KHTML, like Gecko)"
+	)
+
+	err := UpdateStats(ctx, site.ID, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, Browser: win, FirstVisit: true},
+		{Site: site.ID, CreatedAt: now, Browser: win},
+		{Site: site.ID, CreatedAt: now, Browser: win, Status: 404}, // Not counted.
+		{Site: site.ID, CreatedAt: now, Browser: mac, FirstVisit: true},
+		{Site: site.ID, CreatedAt: now, Browser: iphone, FirstVisit: true},
+		{Site: site.ID, CreatedAt: now, Browser: ipad},
+		{Site: site.ID, CreatedAt: now, Browser: android},
+		{Site: site.ID, CreatedAt: now, Browser: ps4},
+		{Site: site.ID, CreatedAt: now, Browser: "nonsense"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Update existing.
+	err = UpdateStats(ctx, site.ID, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, Browser: iphone},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		list func(*goatcounter.Stats) (int, error)
+		want string
+	}{
+		{func(s *goatcounter.Stats) (int, error) { return s.ListSystems(ctx, now, now) },
+			`8 -> [{iOS 3 1 <nil>} {Windows 2 1 <nil>} {Android 1 0 <nil>} {PlayStation 1 0 <nil>} {macOS 1 1 <nil>}]`},
+		{func(s *goatcounter.Stats) (int, error) { return s.ListSystem(ctx, "ios", now, now) },
+			`3 -> [{iOS 13 2 1 <nil>} {iOS 12 1 0 <nil>}]`},
+		{func(s *goatcounter.Stats) (int, error) { return s.ListDevices(ctx, now, now) },
+			`8 -> [{Desktop 3 2 <nil>} {Mobile 2 1 <nil>} {Tablet 2 0 <nil>} {Console 1 0 <nil>}]`},
+		{func(s *goatcounter.Stats) (int, error) { return s.ListDevice(ctx, "tablet", now, now) },
+			`2 -> [{Android 1 0 <nil>} {iOS 1 0 <nil>}]`},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			var stats goatcounter.Stats
+			total, err := tt.list(&stats)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := fmt.Sprintf("%d -> %v", total, stats)
+			if out != tt.want {
+				t.Errorf("\nwant: %s\nout:  %s", tt.want, out)
+			}
+		})
+	}
+}
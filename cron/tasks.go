@@ -13,7 +13,6 @@ import (
 
 	"zgo.at/goatcounter"
 	"zgo.at/goatcounter/acme"
-	"zgo.at/goatcounter/cfg"
 	"zgo.at/goatcounter/errors"
 	"zgo.at/zdb"
 	"zgo.at/zlog"
@@ -107,6 +106,21 @@ func persistAndStat(ctx context.Context) error {
 	if len(hits) > 100 {
 		l.Since("stats").FieldsSince().Printf("persisted %d hits", len(hits))
 	}
+
+	groupedBeacons := make(map[int64][]goatcounter.Beacon)
+	for _, b := range goatcounter.Memstore.Beacons(ctx) {
+		groupedBeacons[b.Site] = append(groupedBeacons[b.Site], b)
+	}
+	for siteID, beacons := range groupedBeacons {
+		err := UpdateBeaconStats(ctx, siteID, beacons)
+		if err != nil {
+			l.Fields(zlog.F{
+				"site":    siteID,
+				"beacons": beacons,
+			}).Error(err)
+		}
+	}
+
 	return err
 }
 
@@ -122,22 +136,54 @@ func UpdateStats(ctx context.Context, siteID int64, hits []goatcounter.Hit) erro
 	if err != nil {
 		return errors.Wrapf(err, "hit_stat: site %d", siteID)
 	}
+	err = updatePathTitles(ctx, hits)
+	if err != nil {
+		return errors.Wrapf(err, "path_title: site %d", siteID)
+	}
 	err = updateBrowserStats(ctx, hits)
 	if err != nil {
 		return errors.Wrapf(err, "browser_stat: site %d", siteID)
 	}
+	err = updateSystemStats(ctx, hits)
+	if err != nil {
+		return errors.Wrapf(err, "system_stat: site %d", siteID)
+	}
 	err = updateLocationStats(ctx, hits)
 	if err != nil {
 		return errors.Wrapf(err, "location_stat: site %d", siteID)
 	}
+	err = updateLanguageStats(ctx, hits)
+	if err != nil {
+		return errors.Wrapf(err, "language_stat: site %d", siteID)
+	}
 	err = updateRefStats(ctx, hits)
 	if err != nil {
 		return errors.Wrapf(err, "ref_stat: site %d", siteID)
 	}
+	err = updateCampaignStats(ctx, hits)
+	if err != nil {
+		return errors.Wrapf(err, "campaign_stat: site %d", siteID)
+	}
 	err = updateSizeStats(ctx, hits)
 	if err != nil {
 		return errors.Wrapf(err, "size_stat: site %d", siteID)
 	}
+	err = updateVisitorStats(ctx, hits)
+	if err != nil {
+		return errors.Wrapf(err, "visitor_stat: site %d", siteID)
+	}
+	err = updateExperiments(ctx, hits)
+	if err != nil {
+		return errors.Wrapf(err, "experiments: site %d", siteID)
+	}
+	err = updateSearchStats(ctx, hits)
+	if err != nil {
+		return errors.Wrapf(err, "search_stat: site %d", siteID)
+	}
+	err = updateBrokenStats(ctx, hits)
+	if err != nil {
+		return errors.Wrapf(err, "broken_stat: site %d", siteID)
+	}
 
 	if !site.ReceivedData {
 		_, err = zdb.MustGet(ctx).ExecContext(ctx,
@@ -149,6 +195,31 @@ func UpdateStats(ctx context.Context, siteID int64, hits []goatcounter.Hit) erro
 	return nil
 }
 
+// UpdateBeaconStats updates the statistics that are collected from the
+// beacons count.js sends when a page is hidden.
+func UpdateBeaconStats(ctx context.Context, siteID int64, beacons []goatcounter.Beacon) error {
+	var site goatcounter.Site
+	err := site.ByID(ctx, siteID)
+	if err != nil {
+		return err
+	}
+	ctx = goatcounter.WithSite(ctx, &site)
+
+	err = updateTimeStats(ctx, beacons)
+	if err != nil {
+		return errors.Wrapf(err, "time_stat: site %d", siteID)
+	}
+	err = updateScrollStats(ctx, beacons)
+	if err != nil {
+		return errors.Wrapf(err, "scroll_stat: site %d", siteID)
+	}
+	err = updateVitalsStats(ctx, beacons)
+	if err != nil {
+		return errors.Wrapf(err, "vitals_stat: site %d", siteID)
+	}
+	return nil
+}
+
 func ReindexStats(ctx context.Context, hits []goatcounter.Hit, table string) error {
 	grouped := make(map[int64][]goatcounter.Hit)
 	for _, h := range hits {
@@ -171,14 +242,28 @@ func ReindexStats(ctx context.Context, hits []goatcounter.Hit, table string) err
 			err = UpdateStats(ctx, siteID, hits)
 		case "hit_stats":
 			err = updateHitStats(ctx, hits)
+		case "path_titles":
+			err = updatePathTitles(ctx, hits)
 		case "browser_stats":
 			err = updateBrowserStats(ctx, hits)
+		case "system_stats":
+			err = updateSystemStats(ctx, hits)
 		case "location_stats":
 			err = updateLocationStats(ctx, hits)
+		case "language_stats":
+			err = updateLanguageStats(ctx, hits)
 		case "ref_stats":
 			err = updateRefStats(ctx, hits)
+		case "campaign_stats":
+			err = updateCampaignStats(ctx, hits)
 		case "size_stats":
 			err = updateSizeStats(ctx, hits)
+		case "visitor_stats":
+			err = updateVisitorStats(ctx, hits)
+		case "search_stats":
+			err = updateSearchStats(ctx, hits)
+		case "broken_stats":
+			err = updateBrokenStats(ctx, hits)
 		}
 		if err != nil {
 			return err
@@ -218,18 +303,20 @@ func renewACME(ctx context.Context) error {
 	return nil
 }
 
-func vacuumDeleted(ctx context.Context) error {
+// VacuumDeleted permanently removes sites that were soft-deleted more than a
+// week ago, and all their data.
+func VacuumDeleted(ctx context.Context) error {
 	var sites goatcounter.Sites
 	err := sites.OldSoftDeleted(ctx)
 	if err != nil {
-		return errors.Errorf("vacuumDeleted: %w", err)
+		return errors.Errorf("VacuumDeleted: %w", err)
 	}
 
 	for _, s := range sites {
 		zlog.Module("vacuum").Printf("vacuum site %s/%d", s.Code, s.ID)
 
 		err := zdb.TX(ctx, func(ctx context.Context, db zdb.DB) error {
-			for _, t := range []string{"browser_stats", "hit_stats", "sessions", "hits", "location_stats", "ref_stats", "size_stats", "users"} {
+			for _, t := range []string{"browser_stats", "system_stats", "hit_stats", "path_titles", "sessions", "hits", "location_stats", "language_stats", "ref_stats", "campaign_stats", "size_stats", "visitor_stats", "time_stats", "session_stats", "scroll_stats", "vitals_stats", "search_stats", "broken_stats", "trending", "alerts", "alert_history", "webhook_deliveries", "webhooks", "experiment_sessions", "experiments", "annotations", "users"} {
 				_, err := db.ExecContext(ctx, fmt.Sprintf(`delete from %s where site=%d`, t, s.ID))
 				if err != nil {
 					return errors.Errorf("%s: %w", t, err)
@@ -239,19 +326,33 @@ func vacuumDeleted(ctx context.Context) error {
 			return err
 		})
 		if err != nil {
-			return errors.Errorf("vacuumDeleted: %w", err)
+			return errors.Errorf("VacuumDeleted: %w", err)
 		}
 	}
 	return nil
 }
 
+// clearSessions removes sessions that haven't been seen for an hour, adding
+// their duration to the session_stats first.
 func clearSessions(ctx context.Context) error {
-	query := `delete from sessions where last_seen < `
-	if cfg.PgSQL {
-		query += `now() - interval '1 hour'`
-	} else {
-		query += `datetime(datetime(), '-1 hours')`
+	cutoff := goatcounter.Now().Add(-1 * time.Hour).Format(zdb.Date)
+
+	var sessions []goatcounter.Session
+	err := zdb.MustGet(ctx).SelectContext(ctx, &sessions,
+		`select * from sessions where last_seen < $1`, cutoff)
+	if err != nil {
+		return errors.Errorf("cron.clearSessions: %w", err)
 	}
-	_, err := zdb.MustGet(ctx).ExecContext(ctx, query)
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	err = updateSessionStats(ctx, sessions)
+	if err != nil {
+		return errors.Errorf("cron.clearSessions: session_stat: %w", err)
+	}
+
+	_, err = zdb.MustGet(ctx).ExecContext(ctx,
+		`delete from sessions where last_seen < $1`, cutoff)
 	return err
 }
@@ -12,6 +12,7 @@ import (
 	"zgo.at/goatcounter"
 	. "zgo.at/goatcounter/cron"
 	"zgo.at/goatcounter/gctest"
+	"zgo.at/zdb"
 )
 
 func TestDataRetention(t *testing.T) {
@@ -64,3 +65,54 @@ func TestDataRetention(t *testing.T) {
 		t.Errorf("\ngot:  %s\nwant: %s", out, want)
 	}
 }
+
+func TestVacuumDeleted(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.Site{Code: "bbbb", Plan: goatcounter.PlanPersonal}
+	err := site.Insert(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := site.ID
+	sctx := goatcounter.WithSite(ctx, &site)
+
+	gctest.StoreHits(sctx, t, goatcounter.Hit{Site: id, Path: "/a"})
+	a := goatcounter.Annotation{Day: goatcounter.Now(), Text: "Deploy"}
+	err = a.Insert(sctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = site.Delete(sctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = zdb.MustGet(ctx).ExecContext(ctx,
+		`update sites set updated_at='2019-01-01 00:00:00' where id=$1`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = VacuumDeleted(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tbl := range []string{"sites", "hits", "annotations"} {
+		col := "site"
+		if tbl == "sites" {
+			col = "id"
+		}
+		var n int
+		err := zdb.MustGet(ctx).GetContext(ctx, &n,
+			fmt.Sprintf(`select count(*) from %s where %s=$1`, tbl, col), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("%d rows left in %s", n, tbl)
+		}
+	}
+}
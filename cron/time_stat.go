@@ -0,0 +1,167 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"fmt"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+)
+
+// Time on page stats are stored as a day/path with the number of reported
+// times, the total time in seconds, and a histogram as goatcounter.TimeBuckets.
+//
+// A beacon with PrevTimeOnPage replaces the time from the previous beacon for
+// that page. This never adds a new row: if the previous time isn't in the stats
+// for that day (e.g. because it was reported on the day before) it's ignored.
+//
+//  site |    day     | path | count | total |       hist
+// ------+------------+------+-------+-------+------------------
+//     1 | 2019-11-30 | /    |     3 |    95 | 1,0,1,1,0,0,0,0,0
+//     1 | 2019-11-30 | /foo |     1 |     4 | 1,0,0,0,0,0,0,0,0
+func updateTimeStats(ctx context.Context, beacons []goatcounter.Beacon) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		// Group by day + path + event.
+		type gt struct {
+			goatcounter.TimeStat
+			day   string
+			event zdb.Bool
+			path  string
+		}
+		grouped := map[string]gt{}
+		for _, b := range beacons {
+			replace := b.PrevTimeOnPage != nil && *b.PrevTimeOnPage > 0
+			if b.TimeOnPage == 0 && !replace {
+				continue
+			}
+
+			day := b.CreatedAt.Format("2006-01-02")
+			k := fmt.Sprintf("%s%s%t", day, b.Path, b.Event)
+			v, ok := grouped[k]
+			if !ok {
+				v.day = day
+				v.path = b.Path
+				v.event = b.Event
+				var err error
+				v.TimeStat, err = existingTimeStats(ctx, tx, b.Site, day, v.path, v.event)
+				if err != nil {
+					return err
+				}
+			}
+
+			if replace {
+				v.Replace(*b.PrevTimeOnPage, b.TimeOnPage)
+			} else {
+				v.Record(b.TimeOnPage)
+			}
+			grouped[k] = v
+		}
+
+		siteID := goatcounter.MustGetSite(ctx).ID
+		ins := bulk.NewInsert(ctx, "time_stats", []string{"site", "day", "path",
+			"event", "count", "total", "hist"})
+		for _, v := range grouped {
+			if v.Count == 0 {
+				continue
+			}
+			ins.Values(siteID, v.day, v.path, v.event, v.Count, v.Total, v.Hist)
+		}
+		return ins.Finish()
+	})
+}
+
+func existingTimeStats(
+	txctx context.Context, tx zdb.DB, siteID int64,
+	day, path string, event zdb.Bool,
+) (goatcounter.TimeStat, error) {
+
+	var t []goatcounter.TimeStat
+	err := tx.SelectContext(txctx, &t, `/* existingTimeStats */
+		select count, total, hist from time_stats
+		where site=$1 and day=$2 and path=$3 and event=$4 limit 1`,
+		siteID, day, path, event)
+	if err != nil {
+		return goatcounter.TimeStat{}, errors.Wrap(err, "select")
+	}
+	if len(t) == 0 {
+		return goatcounter.TimeStat{}, nil
+	}
+
+	_, err = tx.ExecContext(txctx, `delete from time_stats where
+		site=$1 and day=$2 and path=$3 and event=$4`,
+		siteID, day, path, event)
+	return t[0], errors.Wrap(err, "delete")
+}
+
+// Session duration stats are stored per day as a histogram, the same as the
+// time on page stats.
+//
+//  site |    day     | count | total |       hist
+// ------+------------+-------+-------+------------------
+//     1 | 2019-11-30 |     3 |   195 | 1,0,0,1,0,1,0,0,0
+func updateSessionStats(ctx context.Context, sessions []goatcounter.Session) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		// Group by site + day.
+		type gt struct {
+			goatcounter.TimeStat
+			site int64
+			day  string
+		}
+		grouped := map[string]gt{}
+		for _, s := range sessions {
+			day := s.CreatedAt.Format("2006-01-02")
+			k := fmt.Sprintf("%d%s", s.Site, day)
+			v, ok := grouped[k]
+			if !ok {
+				v.site = s.Site
+				v.day = day
+				var err error
+				v.TimeStat, err = existingSessionStats(ctx, tx, s.Site, day)
+				if err != nil {
+					return err
+				}
+			}
+
+			d := int(s.LastSeen.Sub(s.CreatedAt).Seconds())
+			if d < 0 {
+				d = 0
+			}
+			v.Record(d)
+			grouped[k] = v
+		}
+
+		ins := bulk.NewInsert(ctx, "session_stats", []string{"site", "day",
+			"count", "total", "hist"})
+		for _, v := range grouped {
+			ins.Values(v.site, v.day, v.Count, v.Total, v.Hist)
+		}
+		return ins.Finish()
+	})
+}
+
+func existingSessionStats(
+	txctx context.Context, tx zdb.DB, siteID int64, day string,
+) (goatcounter.TimeStat, error) {
+
+	var t []goatcounter.TimeStat
+	err := tx.SelectContext(txctx, &t, `/* existingSessionStats */
+		select count, total, hist from session_stats
+		where site=$1 and day=$2 limit 1`,
+		siteID, day)
+	if err != nil {
+		return goatcounter.TimeStat{}, errors.Wrap(err, "select")
+	}
+	if len(t) == 0 {
+		return goatcounter.TimeStat{}, nil
+	}
+
+	_, err = tx.ExecContext(txctx, `delete from session_stats where site=$1 and day=$2`,
+		siteID, day)
+	return t[0], errors.Wrap(err, "delete")
+}
@@ -0,0 +1,121 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	. "zgo.at/goatcounter/cron"
+	"zgo.at/goatcounter/gctest"
+	"zgo.at/zdb"
+)
+
+func TestTimeStats(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	secs := func(s int) *int { return &s }
+
+	gctest.StoreHits(ctx, t, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, Path: "/asd"},
+		{Site: site.ID, CreatedAt: now, Path: "/zxc"},
+	}...)
+
+	err := UpdateBeaconStats(ctx, site.ID, []goatcounter.Beacon{
+		{Site: site.ID, CreatedAt: now, Path: "/asd", TimeOnPage: 4},
+		{Site: site.ID, CreatedAt: now, Path: "/asd", TimeOnPage: 40},
+		{Site: site.ID, CreatedAt: now, Path: "/zxc", TimeOnPage: 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Update existing.
+	err = UpdateBeaconStats(ctx, site.ID, []goatcounter.Beacon{
+		{Site: site.ID, CreatedAt: now, Path: "/asd", TimeOnPage: 3000},
+		{Site: site.ID, CreatedAt: now, Path: "/asd", TimeOnPage: 70, PrevTimeOnPage: secs(4)},
+		{Site: site.ID, CreatedAt: now, Path: "/asd", TimeOnPage: 80, PrevTimeOnPage: secs(70)},
+
+		// Previous time isn't in the stats; don't add a row.
+		{Site: site.ID, CreatedAt: now, Path: "/zxc", TimeOnPage: 20, PrevTimeOnPage: secs(10)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats goatcounter.HitStats
+	_, _, _, _, _, err = stats.List(ctx, now.Add(-1*time.Hour), now.Add(1*time.Hour), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for _, s := range stats {
+		got[s.Path] = fmt.Sprintf("%v", s.TimeOnPage)
+		if s.TimeOnPage != nil {
+			got[s.Path] = fmt.Sprintf("%d %d %v", s.TimeOnPage.Count, s.TimeOnPage.Total, s.TimeOnPage.Hist)
+		}
+	}
+	want := map[string]string{
+		"/asd": "3 3120 0, 0, 0, 1, 1, 0, 0, 0, 1",
+		"/zxc": "<nil>",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("\ngot:  %v\nwant: %v", got, want)
+	}
+}
+
+func TestSessionStats(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	now := goatcounter.Now()
+
+	for i, s := range []struct {
+		created, seen time.Duration
+	}{
+		{-3 * time.Hour, -3 * time.Hour},                // Single pageview.
+		{-3 * time.Hour, -3*time.Hour + 90*time.Second}, // 90s
+		{-3 * time.Hour, -3*time.Hour + 20*time.Minute}, // 20m
+		{-10 * time.Minute, -5 * time.Minute},           // Still active.
+	} {
+		_, err := zdb.MustGet(ctx).ExecContext(ctx, `insert into sessions
+			(site, hash, created_at, last_seen) values ($1, $2, $3, $4)`,
+			site.ID, []byte(fmt.Sprintf("hash%d", i)),
+			now.Add(s.created).Format(zdb.Date), now.Add(s.seen).Format(zdb.Date))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	RunOnce(zdb.MustGet(ctx))
+
+	var stats goatcounter.Stats
+	total, err := stats.ListSessionDurations(ctx, now.Add(-4*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := fmt.Sprintf("%d %d %v", total.Count, total.Total, total.Hist)
+	want := "3 1290 1, 0, 0, 0, 1, 0, 0, 1, 0"
+	if got != want {
+		t.Errorf("\ngot:  %s\nwant: %s", got, want)
+	}
+
+	var n int
+	err = zdb.MustGet(ctx).GetContext(ctx, &n, `select count(*) from sessions`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("sessions not removed: %d", n)
+	}
+}
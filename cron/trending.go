@@ -0,0 +1,211 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+	"zgo.at/zlog"
+)
+
+const (
+	trendingDays     = 28                 // Days in the baseline.
+	trendingMinCount = 10                 // Minimum pageviews in the last 24 hours.
+	trendingMinZ     = 3.0                // Minimum standard score.
+	trendingMinAge   = 7 * 24 * time.Hour // Sites need some history for a baseline.
+
+	// Number of names to get the baseline for in one query, so we don't run
+	// in to the SQLite parameter limit of 999.
+	trendingChunk = 500
+)
+
+// UpdateTrending finds the paths and referrers that are growing unusually fast
+// for all sites.
+func UpdateTrending(ctx context.Context) error {
+	var sites goatcounter.Sites
+	err := sites.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := goatcounter.Now()
+	for _, s := range sites {
+		if !s.ReceivedData || s.CreatedAt.After(now.Add(-trendingMinAge)) {
+			continue
+		}
+
+		s := s
+		err := updateSiteTrending(goatcounter.WithSite(ctx, &s), now)
+		if err != nil {
+			zlog.Module("cron").Field("site", s.ID).Error(err)
+		}
+	}
+	return nil
+}
+
+// updateSiteTrending compares the pageviews for every path and referrer in the
+// 24 hours before now against their daily pageviews in the four weeks before
+// that:
+//
+//   z = (count - mean) / stddev
+//
+// The standard deviation is at least the square root of the mean (as it would
+// be for a Poisson distribution), so that a path with a flat baseline doesn't
+// trend on a handful of extra pageviews.
+func updateSiteTrending(ctx context.Context, now time.Time) error {
+	var (
+		site  = goatcounter.MustGetSite(ctx)
+		db    = zdb.MustGet(ctx)
+		since = now.Add(-24 * time.Hour)
+		last  = since.Truncate(24 * time.Hour)
+		first = last.Add(-trendingDays * 24 * time.Hour)
+	)
+
+	type row struct {
+		Name  string    `db:"name"`
+		Day   time.Time `db:"day"`
+		Count int       `db:"count"`
+		Stats []byte    `db:"stats"`
+	}
+
+	var trends goatcounter.Trends
+	for _, kind := range []string{goatcounter.TrendPath, goatcounter.TrendRef} {
+		var current []row
+		query := `/* updateSiteTrending: paths */
+			select path as name, count(*) as count from hits
+			where site=$1 and bot=0 and event=0 and status=0 and created_at >= $2
+			group by path
+			having count(*) >= $3`
+		if kind == goatcounter.TrendRef {
+			query = `/* updateSiteTrending: refs */
+				select ref as name, count(*) as count from hits
+				where site=$1 and bot=0 and event=0 and status=0 and created_at >= $2 and
+					ref != '' and channel != 'internal'
+				group by ref
+				having count(*) >= $3`
+		}
+		err := db.SelectContext(ctx, &current, query, site.ID, since.Format(zdb.Date), trendingMinCount)
+		if err != nil {
+			return errors.Wrap(err, "updateSiteTrending")
+		}
+		if len(current) == 0 {
+			continue
+		}
+
+		names := make([]string, 0, len(current))
+		for _, c := range current {
+			names = append(names, c.Name)
+		}
+		query = `/* updateSiteTrending: hit_stats */
+			select path as name, day, stats from hit_stats
+			where site=? and event=0 and day >= ? and day < ? and path in (?)`
+		if kind == goatcounter.TrendRef {
+			query = `/* updateSiteTrending: ref_stats */
+				select ref as name, day, sum(count) as count from ref_stats
+				where site=? and event=0 and day >= ? and day < ? and ref in (?)
+				group by ref, day`
+		}
+		var baseline []row
+		for i := 0; i < len(names); i += trendingChunk {
+			j := i + trendingChunk
+			if j > len(names) {
+				j = len(names)
+			}
+
+			q, args, err := sqlx.In(query, site.ID,
+				first.Format("2006-01-02"), last.Format("2006-01-02"), names[i:j])
+			if err != nil {
+				return errors.Wrap(err, "updateSiteTrending")
+			}
+			var b []row
+			err = db.SelectContext(ctx, &b, db.Rebind(q), args...)
+			if err != nil {
+				return errors.Wrap(err, "updateSiteTrending")
+			}
+			baseline = append(baseline, b...)
+		}
+
+		daily := make(map[string][]float64, len(current))
+		for _, c := range current {
+			daily[c.Name] = make([]float64, trendingDays)
+		}
+		for _, b := range baseline {
+			i := int(b.Day.Sub(first).Hours() / 24)
+			if i < 0 || i >= trendingDays {
+				continue
+			}
+
+			n := b.Count
+			if b.Stats != nil {
+				var hourly []int
+				err := json.Unmarshal(b.Stats, &hourly)
+				if err != nil {
+					return errors.Wrapf(err, "updateSiteTrending: stats for %q", b.Name)
+				}
+				for _, h := range hourly {
+					n += h
+				}
+			}
+			daily[b.Name][i] += float64(n)
+		}
+
+		for _, c := range current {
+			mean, stddev := meanStddev(daily[c.Name])
+			z := (float64(c.Count) - mean) / math.Max(stddev, math.Sqrt(math.Max(mean, 1)))
+			if z < trendingMinZ {
+				continue
+			}
+			trends = append(trends, goatcounter.Trend{
+				Site:      site.ID,
+				Kind:      kind,
+				Name:      c.Name,
+				Count:     c.Count,
+				Baseline:  mean,
+				ZScore:    z,
+				UpdatedAt: now,
+			})
+		}
+	}
+
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		_, err := tx.ExecContext(ctx, `delete from trending where site=$1`, site.ID)
+		if err != nil {
+			return errors.Wrap(err, "updateSiteTrending: delete")
+		}
+		if len(trends) == 0 {
+			return nil
+		}
+
+		ins := bulk.NewInsert(ctx, "trending", []string{"site", "kind", "name",
+			"count", "baseline", "zscore", "updated_at"})
+		for _, t := range trends {
+			ins.Values(t.Site, t.Kind, t.Name, t.Count, t.Baseline, t.ZScore,
+				t.UpdatedAt.Format(zdb.Date))
+		}
+		return ins.Finish()
+	})
+}
+
+func meanStddev(n []float64) (float64, float64) {
+	var sum float64
+	for _, v := range n {
+		sum += v
+	}
+	mean := sum / float64(len(n))
+
+	var sq float64
+	for _, v := range n {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(n)))
+}
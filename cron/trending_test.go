@@ -0,0 +1,96 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	. "zgo.at/goatcounter/cron"
+	"zgo.at/goatcounter/gctest"
+	"zgo.at/zdb"
+)
+
+func TestTrending(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	goatcounter.Now = func() time.Time { return now }
+	defer func() { goatcounter.Now = func() time.Time { return time.Now().UTC() } }()
+
+	_, err := zdb.MustGet(ctx).ExecContext(ctx,
+		`update sites set created_at='2019-01-01 00:00:00' where id=1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hits []goatcounter.Hit
+	add := func(path, ref string, at time.Time, n int) {
+		for i := 0; i < n; i++ {
+			hits = append(hits, goatcounter.Hit{Path: path, Ref: ref, CreatedAt: at})
+		}
+	}
+
+	// Four weeks of baseline.
+	for d := 2; d <= 29; d++ {
+		day := now.Add(-time.Duration(d) * 24 * time.Hour)
+		add("/steady", "", day, 10)
+		add("/spike", "", day, 1)
+		if d%2 == 0 {
+			add("/busy", "example.org", day, 20)
+		} else {
+			add("/busy", "example.org", day, 5)
+		}
+	}
+
+	// Last 24 hours.
+	add("/steady", "", now.Add(-time.Hour), 12)
+	add("/spike", "news.ycombinator.com", now.Add(-time.Hour), 30)
+	add("/new", "", now.Add(-2*time.Hour), 12)
+	add("/busy", "example.org", now.Add(-3*time.Hour), 25)
+	add("/quiet", "", now.Add(-time.Hour), 5)
+	add("/old", "", now.Add(-30*time.Hour), 20) // Before the last 24 hours.
+
+	gctest.StoreHits(ctx, t, hits...)
+
+	err = UpdateTrending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var trends goatcounter.Trends
+	err = trends.List(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := ""
+	for _, tr := range trends {
+		got += fmt.Sprintf("%s %s %d %.1f %.1f\n", tr.Kind, tr.Name, tr.Count, tr.Baseline, tr.ZScore)
+	}
+	want := "ref news.ycombinator.com 30 0.0 30.0\n" +
+		"path /spike 30 1.0 29.0\n" +
+		"path /new 12 0.0 12.0\n"
+	if got != want {
+		t.Errorf("\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Running it again replaces the previous trends.
+	err = UpdateTrending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again goatcounter.Trends
+	err = again.List(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 3 {
+		t.Errorf("len(again) = %d", len(again))
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+)
+
+// Visitor stats are stored as a count per last visit bucket per day. count.js
+// only sends the bucket with the first pageview of the day, so every visitor
+// is counted once per day.
+//
+//  site |    day     | last_visit | count
+// ------+------------+------------+-------
+//     1 | 2019-11-30 | new        |    42
+//     1 | 2019-11-30 | 1d         |     5
+//     1 | 2019-11-30 | 30d        |     2
+func updateVisitorStats(ctx context.Context, hits []goatcounter.Hit) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		// Group by day + last_visit.
+		type gt struct {
+			count     int
+			day       string
+			lastVisit string
+		}
+		grouped := map[string]gt{}
+		for _, h := range hits {
+			if h.Bot > 0 || h.Status != 0 || h.Event || h.LastVisit == "" {
+				continue
+			}
+
+			day := h.CreatedAt.Format("2006-01-02")
+			k := day + h.LastVisit
+			v := grouped[k]
+			if v.count == 0 {
+				v.day = day
+				v.lastVisit = h.LastVisit
+				var err error
+				v.count, err = existingVisitorStats(ctx, tx, h.Site, day, v.lastVisit)
+				if err != nil {
+					return err
+				}
+			}
+
+			v.count += 1
+			grouped[k] = v
+		}
+
+		siteID := goatcounter.MustGetSite(ctx).ID
+		ins := bulk.NewInsert(ctx, "visitor_stats", []string{"site", "day",
+			"last_visit", "count"})
+		for _, v := range grouped {
+			ins.Values(siteID, v.day, v.lastVisit, v.count)
+		}
+		return ins.Finish()
+	})
+}
+
+func existingVisitorStats(
+	txctx context.Context, tx zdb.DB, siteID int64,
+	day, lastVisit string,
+) (int, error) {
+
+	var c []int
+	err := tx.SelectContext(txctx, &c, `/* existingVisitorStats */
+		select count from visitor_stats
+		where site=$1 and day=$2 and last_visit=$3 limit 1`,
+		siteID, day, lastVisit)
+	if err != nil {
+		return 0, errors.Wrap(err, "select")
+	}
+	if len(c) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(txctx, `delete from visitor_stats where
+		site=$1 and day=$2 and last_visit=$3`,
+		siteID, day, lastVisit)
+	return c[0], errors.Wrap(err, "delete")
+}
@@ -0,0 +1,66 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	. "zgo.at/goatcounter/cron"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestVisitorStats(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	yesterday := now.Add(-24 * time.Hour)
+
+	err := UpdateStats(ctx, site.ID, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, LastVisit: "new"},
+		{Site: site.ID, CreatedAt: now, LastVisit: "new"},
+		{Site: site.ID, CreatedAt: now, LastVisit: "1d"},
+		{Site: site.ID, CreatedAt: yesterday, LastVisit: "new"},
+		{Site: site.ID, CreatedAt: yesterday, LastVisit: "older"},
+
+		// Not counted.
+		{Site: site.ID, CreatedAt: now},
+		{Site: site.ID, CreatedAt: now, LastVisit: "new", Status: 404},
+		{Site: site.ID, CreatedAt: now, LastVisit: "7d", Bot: 150},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Update existing.
+	err = UpdateStats(ctx, site.ID, []goatcounter.Hit{
+		{Site: site.ID, CreatedAt: now, LastVisit: "1d"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats goatcounter.VisitorStats
+	total, err := stats.List(ctx, yesterday, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := fmt.Sprintf("%d %s", total, stats.Returning())
+	for _, s := range stats {
+		out += fmt.Sprintf(" | %s %d %d", s.LastVisit, s.Count, s.Max)
+		for _, d := range s.Stats {
+			out += fmt.Sprintf(" %d", d.Daily)
+		}
+	}
+	want := "6 50% | new 3 2 1 2 | 1d 2 2 0 2 | older 1 1 1 0"
+	if out != want {
+		t.Errorf("\nout:  %s\nwant: %s", out, want)
+	}
+}
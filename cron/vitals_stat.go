@@ -0,0 +1,104 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"fmt"
+
+	"zgo.at/goatcounter"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+)
+
+// Vitals stats are stored as a day/path/name with a histogram; the buckets are
+// different for every metric in goatcounter.Vitals.
+//
+//  site |    day     | path | name | count |            hist
+// ------+------------+------+------+-------+-----------------------------
+//     1 | 2019-11-30 | /    | lcp  |     3 | 0,0,1,0,0,2,0,0,0,0,0,0,0,0,0,0
+//     1 | 2019-11-30 | /    | cls  |     3 | 3,0,0,0,0,0,0,0,0,0,0,0,0,0
+//
+// Values with a previous value in the beacon replace that value, the same as
+// the time on page stats.
+func updateVitalsStats(ctx context.Context, beacons []goatcounter.Beacon) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		// Group by day + path + name.
+		type gt struct {
+			goatcounter.VitalStat
+			day  string
+			path string
+		}
+		grouped := map[string]gt{}
+		for _, b := range beacons {
+			if b.Event {
+				continue
+			}
+
+			day := b.CreatedAt.Format("2006-01-02")
+			for _, vital := range goatcounter.Vitals {
+				val := vital.Value(b)
+				if val == nil {
+					continue
+				}
+
+				k := fmt.Sprintf("%s%s%s", day, b.Path, vital.Name)
+				v, ok := grouped[k]
+				if !ok {
+					v.day = day
+					v.path = b.Path
+					var err error
+					v.VitalStat, err = existingVitalsStats(ctx, tx, b.Site, day, v.path, vital.Name)
+					if err != nil {
+						return err
+					}
+					v.Name = vital.Name
+				}
+
+				if prev := vital.Prev(b); prev != nil {
+					v.Replace(*prev, *val)
+				} else {
+					v.Record(*val)
+				}
+				grouped[k] = v
+			}
+		}
+
+		siteID := goatcounter.MustGetSite(ctx).ID
+		ins := bulk.NewInsert(ctx, "vitals_stats", []string{"site", "day", "path",
+			"name", "count", "hist"})
+		for _, v := range grouped {
+			if v.Count == 0 {
+				continue
+			}
+			ins.Values(siteID, v.day, v.path, v.Name, v.Count, v.Hist)
+		}
+		return ins.Finish()
+	})
+}
+
+func existingVitalsStats(
+	txctx context.Context, tx zdb.DB, siteID int64,
+	day, path, name string,
+) (goatcounter.VitalStat, error) {
+
+	var v []goatcounter.VitalStat
+	err := tx.SelectContext(txctx, &v, `/* existingVitalsStats */
+		select name, count, hist from vitals_stats
+		where site=$1 and day=$2 and path=$3 and name=$4 limit 1`,
+		siteID, day, path, name)
+	if err != nil {
+		return goatcounter.VitalStat{}, errors.Wrap(err, "select")
+	}
+	if len(v) == 0 {
+		return goatcounter.VitalStat{}, nil
+	}
+
+	_, err = tx.ExecContext(txctx, `delete from vitals_stats where
+		site=$1 and day=$2 and path=$3 and name=$4`,
+		siteID, day, path, name)
+	return v[0], errors.Wrap(err, "delete")
+}
@@ -0,0 +1,78 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	. "zgo.at/goatcounter/cron"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestVitalsStats(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := goatcounter.MustGetSite(ctx)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	n := func(v int) *int { return &v }
+
+	err := UpdateBeaconStats(ctx, site.ID, []goatcounter.Beacon{
+		{Site: site.ID, CreatedAt: now, Path: "/asd", LCP: n(1200), CLS: n(0)},
+		{Site: site.ID, CreatedAt: now, Path: "/asd", LCP: n(1800), CLS: n(120)},
+		{Site: site.ID, CreatedAt: now, Path: "/zxc", LCP: n(4000), TTFB: n(150)},
+		{Site: site.ID, CreatedAt: now, Path: "/zxc"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Update existing.
+	err = UpdateBeaconStats(ctx, site.ID, []goatcounter.Beacon{
+		{Site: site.ID, CreatedAt: now, Path: "/asd", LCP: n(1300)},
+		{Site: site.ID, CreatedAt: now, Path: "/asd", CLS: n(300), PrevCLS: n(120)},
+
+		// Previous value isn't in the stats; don't add a row.
+		{Site: site.ID, CreatedAt: now, Path: "/zxc", CLS: n(50), PrevCLS: n(10)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, want string
+	}{
+		{"", `
+ttfb 1 150ms 175ms 195ms
+lcp 4 1.5s 2.0s 4.8s
+cls 2 0.01 0.35 0.39`},
+		{"/asd", `
+lcp 3 1.4s 1.6s 1.9s
+cls 2 0.01 0.35 0.39`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var stats goatcounter.VitalStats
+			err := stats.List(ctx, now, now, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got string
+			for _, s := range stats {
+				got += fmt.Sprintf("\n%s %d %s %s %s", s.Name, s.Count,
+					s.FormatPercentile(50), s.FormatPercentile(75), s.FormatPercentile(95))
+			}
+			if got != tt.want {
+				t.Errorf("\ngot:  %s\nwant: %s", strings.TrimSpace(got), strings.TrimSpace(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron
+
+import (
+	"context"
+	"time"
+
+	"zgo.at/goatcounter"
+	"zgo.at/utils/stringutil"
+	"zgo.at/zlog"
+)
+
+// DeliverWebhooks sends all webhook deliveries that are due.
+func DeliverWebhooks(ctx context.Context) error {
+	var due goatcounter.WebhookDeliveries
+	err := due.ListDue(ctx, goatcounter.Now())
+	if err != nil {
+		return err
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	var hooks goatcounter.Webhooks
+	err = hooks.ListAll(ctx)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int64]goatcounter.Webhook, len(hooks))
+	for _, w := range hooks {
+		byID[w.ID] = w
+	}
+
+	l := zlog.Module("cron-webhooks")
+	for _, d := range due {
+		w, ok := byID[d.Webhook]
+		if !ok {
+			continue
+		}
+
+		d := d
+		err := d.Deliver(ctx, w, goatcounter.Now())
+		if err != nil {
+			l.Fields(zlog.F{"site": d.Site, "delivery": d.ID}).Error(err)
+		}
+	}
+	return nil
+}
+
+// WebhookSummaries queues the daily summary and top referrer webhooks for the
+// previous day, for all sites that haven't had them yet.
+func WebhookSummaries(ctx context.Context) error {
+	var hooks goatcounter.Webhooks
+	err := hooks.ListAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		l         = zlog.Module("cron-webhooks")
+		yesterday = goatcounter.Now().UTC().Add(-24 * time.Hour)
+		day       = yesterday.Format("2006-01-02")
+		bySite    = make(map[int64][]goatcounter.Webhook)
+		sites     []int64
+	)
+	for _, w := range hooks {
+		if w.LastSummary != nil && *w.LastSummary >= day {
+			continue
+		}
+		if _, ok := bySite[w.Site]; !ok {
+			sites = append(sites, w.Site)
+		}
+		bySite[w.Site] = append(bySite[w.Site], w)
+	}
+
+	for _, siteID := range sites {
+		var site goatcounter.Site
+		err := site.ByID(ctx, siteID)
+		if err != nil {
+			l.Field("site", siteID).Error(err)
+			continue
+		}
+		if site.State != goatcounter.StateActive {
+			continue
+		}
+
+		err = webhookSummary(goatcounter.WithSite(ctx, &site), bySite[siteID], yesterday)
+		if err != nil {
+			l.Field("site", siteID).Error(err)
+		}
+	}
+	return nil
+}
+
+// webhookSummary queues the summary webhooks for one site; TriggerWebhooks
+// sends to all of the site's webhooks, so this is done once per site.
+func webhookSummary(ctx context.Context, hooks []goatcounter.Webhook, day time.Time) error {
+	var summary, topRef bool
+	for _, w := range hooks {
+		summary = summary || stringutil.Contains(w.Events, goatcounter.WebhookSummary)
+		topRef = topRef || stringutil.Contains(w.Events, goatcounter.WebhookTopRef)
+	}
+
+	if summary {
+		var s goatcounter.DailySummary
+		err := s.Summarize(ctx, day)
+		if err != nil {
+			return err
+		}
+		err = goatcounter.TriggerWebhooks(ctx, goatcounter.WebhookSummary, s)
+		if err != nil {
+			return err
+		}
+	}
+	if topRef {
+		ref, changed, err := goatcounter.TopRefChanged(ctx, day)
+		if err != nil {
+			return err
+		}
+		if changed {
+			err = goatcounter.TriggerWebhooks(ctx, goatcounter.WebhookTopRef, struct {
+				Day string                   `json:"day"`
+				Ref goatcounter.SummaryCount `json:"ref"`
+			}{day.Format("2006-01-02"), ref})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, w := range hooks {
+		w := w
+		err := w.SummaryDone(ctx, day.Format("2006-01-02"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package cron_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"zgo.at/goatcounter"
+	. "zgo.at/goatcounter/cron"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestWebhooks(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	goatcounter.Now = func() time.Time { return now }
+	defer func() { goatcounter.Now = func() time.Time { return time.Now().UTC() } }()
+	defer func(f func(net.IP) bool) { goatcounter.PublicIP = f }(goatcounter.PublicIP)
+	goatcounter.PublicIP = func(net.IP) bool { return true }
+
+	var (
+		hook goatcounter.Webhook
+		got  []goatcounter.WebhookPayload
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if s := r.Header.Get(goatcounter.WebhookSignatureHeader); s != hook.Sign(body) {
+			http.Error(w, "wrong signature: "+s, 400)
+			return
+		}
+		var p goatcounter.WebhookPayload
+		err := json.Unmarshal(body, &p)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		got = append(got, p)
+	}))
+	defer srv.Close()
+
+	hook = goatcounter.Webhook{URL: srv.URL, Events: []string{goatcounter.WebhookSummary, goatcounter.WebhookTopRef}}
+	err := hook.Insert(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hits from the day the webhook was created; the summary is sent the next
+	// day.
+	gctest.StoreHits(ctx, t, []goatcounter.Hit{
+		{Path: "/a", Ref: "https://example.org", CreatedAt: now},
+		{Path: "/a", CreatedAt: now},
+		{Path: "/b", CreatedAt: now},
+	}...)
+
+	run := func() {
+		t.Helper()
+		err := WebhookSummaries(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = DeliverWebhooks(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run()
+	if len(got) != 0 {
+		t.Fatalf("sent payloads on the first day: %#v", got)
+	}
+
+	now = now.Add(24 * time.Hour)
+	run()
+	run() // Should only send once.
+	if len(got) != 2 {
+		t.Fatalf("len(got) = %d: %#v", len(got), got)
+	}
+
+	if got[0].Event != goatcounter.WebhookSummary {
+		t.Errorf("wrong event: %q", got[0].Event)
+	}
+	summary := got[0].Data.(map[string]interface{})
+	if summary["day"] != "2019-08-31" || summary["pageviews"] != 3.0 {
+		t.Errorf("wrong summary: %#v", summary)
+	}
+	if got[1].Event != goatcounter.WebhookTopRef {
+		t.Errorf("wrong event: %q", got[1].Event)
+	}
+
+	var d goatcounter.WebhookDeliveries
+	err = d.List(goatcounter.WithSite(ctx, &goatcounter.Site{ID: 1}), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d) != 2 || d[0].State != goatcounter.DeliveryDelivered || d[1].State != goatcounter.DeliveryDelivered {
+		t.Errorf("wrong deliveries: %#v", d)
+	}
+}
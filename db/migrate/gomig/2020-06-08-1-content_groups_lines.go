@@ -0,0 +1,54 @@
+package gomig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"zgo.at/zdb"
+)
+
+// Content groups used to be stored comma-separated, and are now stored
+// newline-separated so that the filters can contain commas.
+func Migrate_20200608_1_content_groups_lines(db zdb.DB) error {
+	ctx := context.Background()
+
+	var sites []struct {
+		ID       int64  `db:"id"`
+		Settings []byte `db:"settings"`
+	}
+	err := db.SelectContext(ctx, &sites, `select id, settings from sites`)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sites {
+		var settings map[string]json.RawMessage
+		err := json.Unmarshal(s.Settings, &settings)
+		if err != nil {
+			return fmt.Errorf("site %d: %w", s.ID, err)
+		}
+
+		var groups string
+		if json.Unmarshal(settings["content_groups"], &groups) != nil || !strings.Contains(groups, ",") {
+			continue
+		}
+		settings["content_groups"], err = json.Marshal(strings.Join(strings.Split(groups, ","), "\n"))
+		if err != nil {
+			return fmt.Errorf("site %d: %w", s.ID, err)
+		}
+
+		j, err := json.Marshal(settings)
+		if err != nil {
+			return fmt.Errorf("site %d: %w", s.ID, err)
+		}
+		_, err = db.ExecContext(ctx, `update sites set settings=$1 where id=$2`, string(j), s.ID)
+		if err != nil {
+			return fmt.Errorf("update sites: %w", err)
+		}
+	}
+
+	db.ExecContext(ctx, `insert into version values ('2020-06-08-1-content_groups_lines')`)
+	return nil
+}
@@ -0,0 +1,16 @@
+begin;
+	create table scroll_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		event          integer        default 0,
+		path           varchar        not null,
+		depth          int            not null,
+		count          int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "scroll_stats#site#day" on scroll_stats(site, day);
+
+	insert into version values ('2020-05-21-1-scroll_stats');
+commit;
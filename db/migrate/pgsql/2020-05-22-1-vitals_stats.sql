@@ -0,0 +1,16 @@
+begin;
+	create table vitals_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		path           varchar        not null,
+		name           varchar        not null,
+		count          int            not null,
+		hist           varchar        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "vitals_stats#site#day" on vitals_stats(site, day);
+
+	insert into version values ('2020-05-22-1-vitals_stats');
+commit;
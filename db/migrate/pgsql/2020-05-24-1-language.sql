@@ -0,0 +1,20 @@
+begin;
+	alter table hits add column language varchar not null default '';
+
+	create table language_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		event          integer        default 0,
+		language       varchar        not null,
+		region         varchar        not null,
+		count          int            not null,
+		count_unique   int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "language_stats#site#day"          on language_stats(site, day);
+	create index "language_stats#site#day#language" on language_stats(site, day, language);
+
+	insert into version values ('2020-05-24-1-language');
+commit;
@@ -0,0 +1,12 @@
+begin;
+	alter table location_stats add column region varchar not null default '';
+
+	-- Filled from the GeoIP database as regions are seen.
+	create table iso_3166_2 (
+		name   varchar        not null,
+		alpha2 varchar        not null
+	);
+	create unique index "iso_3166_2#alpha2" on iso_3166_2(alpha2);
+
+	insert into version values ('2020-05-25-1-regions');
+commit;
@@ -0,0 +1,9 @@
+begin;
+	alter table hits add column channel varchar not null default '';
+	alter table ref_stats add column channel varchar not null default '';
+
+	-- Other channels need a "goatcounter reindex".
+	update ref_stats set channel='direct' where ref='';
+
+	insert into version values ('2020-05-27-1-channel');
+commit;
@@ -0,0 +1,16 @@
+begin;
+	alter table hits add column last_visit varchar not null default '';
+
+	create table visitor_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		last_visit     varchar        not null,
+		count          int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "visitor_stats#site#day" on visitor_stats(site, day);
+
+	insert into version values ('2020-05-28-1-visitor_stats');
+commit;
@@ -0,0 +1,17 @@
+begin;
+	create table annotations (
+		id             serial         primary key,
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		text           varchar        not null                 check(length(text) > 0),
+		url            varchar        null,
+
+		created_at     timestamp      not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "annotations#site#day" on annotations(site, day);
+
+	insert into version values ('2020-05-30-1-annotations');
+commit;
@@ -0,0 +1,18 @@
+begin;
+	alter table hits add column status integer not null default 0;
+
+	create table broken_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		path           varchar        not null,
+		status         integer        not null,
+		ref            varchar        not null,
+		count          integer        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "broken_stats#site#day#path#status#ref" on broken_stats(site, day, path, status, ref);
+
+	insert into version values ('2020-06-03-1-broken_stats');
+commit;
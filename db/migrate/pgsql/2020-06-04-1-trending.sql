@@ -0,0 +1,17 @@
+begin;
+	create table trending (
+		site           integer        not null                 check(site > 0),
+
+		kind           varchar        not null                 check(kind in ('path', 'ref')),
+		name           varchar        not null,
+		count          integer        not null,
+		baseline       float          not null,
+		zscore         float          not null,
+		updated_at     timestamp      not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "trending#site#kind#name" on trending(site, kind, name);
+
+	insert into version values ('2020-06-04-1-trending');
+commit;
@@ -0,0 +1,31 @@
+begin;
+	create table alerts (
+		id             serial         primary key,
+		site           integer        not null                 check(site > 0),
+
+		kind           varchar        not null                 check(kind in ('spike', 'drop', 'no_hits', 'new_ref', 'goal')),
+		threshold      integer        not null                 check(threshold > 0),
+		goal           varchar        not null default '',
+		cooldown       integer        not null default 24,
+		last_sent      timestamp      null,
+
+		created_at     timestamp      not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "alerts#site" on alerts(site);
+
+	create table alert_history (
+		id             serial         primary key,
+		site           integer        not null                 check(site > 0),
+		alert          integer        not null,
+
+		message        varchar        not null,
+		sent_at        timestamp      not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "alert_history#site#sent_at" on alert_history(site, sent_at);
+
+	insert into version values ('2020-06-05-1-alerts');
+commit;
@@ -0,0 +1,8 @@
+begin;
+	alter table hits add column region varchar not null default '';
+
+	-- The region code was stored in the location column.
+	update hits set region=location, location=substr(location, 1, 2) where location like '__-%';
+
+	insert into version values ('2020-06-07-1-hits_region');
+commit;
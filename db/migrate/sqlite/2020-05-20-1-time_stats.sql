@@ -0,0 +1,29 @@
+begin;
+	create table time_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		event          integer        default 0,
+		path           varchar        not null,
+		count          int            not null,
+		total          int            not null,
+		hist           varchar        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "time_stats#site#day" on time_stats(site, day);
+
+	create table session_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		count          int            not null,
+		total          int            not null,
+		hist           varchar        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "session_stats#site#day" on session_stats(site, day);
+
+	insert into version values ('2020-05-20-1-time_stats');
+commit;
@@ -0,0 +1,24 @@
+begin;
+	alter table hits add column utm_source varchar not null default '';
+	alter table hits add column utm_medium varchar not null default '';
+	alter table hits add column utm_campaign varchar not null default '';
+	alter table hits add column utm_content varchar not null default '';
+	alter table hits add column utm_term varchar not null default '';
+
+	create table campaign_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		event          integer        default 0,
+		source         varchar        not null,
+		medium         varchar        not null,
+		campaign       varchar        not null,
+		count          int            not null,
+		count_unique   int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "campaign_stats#site#day" on campaign_stats(site, day);
+
+	insert into version values ('2020-05-26-1-campaign_stats');
+commit;
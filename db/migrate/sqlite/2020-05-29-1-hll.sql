@@ -0,0 +1,11 @@
+begin;
+	alter table hit_stats      add column hll blob null;
+	alter table ref_stats      add column hll blob null;
+	alter table browser_stats  add column hll blob null;
+	alter table location_stats add column hll blob null;
+
+	-- Existing rows need a "goatcounter reindex" to get correct unique counts
+	-- for ranges longer than a day.
+
+	insert into version values ('2020-05-29-1-hll');
+commit;
@@ -0,0 +1,15 @@
+begin;
+	create table path_titles (
+		site           integer        not null                 check(site > 0),
+
+		path           varchar        not null,
+		title          varchar        not null,
+		first_seen     date           not null                 check(first_seen = strftime('%Y-%m-%d', first_seen)),
+		last_seen      date           not null                 check(last_seen = strftime('%Y-%m-%d', last_seen)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "path_titles#site#path#title" on path_titles(site, path, title);
+
+	insert into version values ('2020-05-31-1-path_titles');
+commit;
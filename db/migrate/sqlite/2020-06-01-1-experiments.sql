@@ -0,0 +1,35 @@
+begin;
+	alter table hits add column experiment varchar not null default '';
+	alter table hits add column variant varchar not null default '';
+
+	create table experiments (
+		id             integer        primary key autoincrement,
+		site           integer        not null                 check(site > 0),
+
+		name           varchar        not null                 check(length(name) > 0),
+		variants       varchar        not null,
+		goal           varchar        not null,
+		goal_event     int            not null default 0,
+
+		created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "experiments#site#name" on experiments(site, name);
+
+	create table experiment_sessions (
+		site           integer        not null                 check(site > 0),
+		experiment     integer        not null,
+		session        integer        not null,
+
+		variant        varchar        not null,
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		converted      date           null                     check(converted = strftime('%Y-%m-%d', converted)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict,
+		foreign key (experiment) references experiments(id) on delete restrict on update restrict
+	);
+	create unique index "experiment_sessions#site#experiment#session" on experiment_sessions(site, experiment, session);
+
+	insert into version values ('2020-06-01-1-experiments');
+commit;
@@ -0,0 +1,17 @@
+begin;
+	alter table hits add column search_term varchar not null default '';
+
+	create table search_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		term           varchar        not null,
+		count          integer        not null,
+		no_pageview    integer        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "search_stats#site#day#term" on search_stats(site, day, term);
+
+	insert into version values ('2020-06-02-1-search_stats');
+commit;
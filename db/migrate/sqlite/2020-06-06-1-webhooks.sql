@@ -0,0 +1,39 @@
+begin;
+	create table webhooks (
+		id             integer        primary key autoincrement,
+		site           integer        not null                 check(site > 0),
+
+		url            varchar        not null,
+		secret         varchar        not null,
+		events         varchar        not null,
+		last_summary   date           null                     check(last_summary = strftime('%Y-%m-%d', last_summary)),
+
+		created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "webhooks#site" on webhooks(site);
+
+	create table webhook_deliveries (
+		id             integer        primary key autoincrement,
+		site           integer        not null                 check(site > 0),
+		webhook        integer        not null,
+
+		event          varchar        not null,
+		payload        varchar        not null,
+		state          varchar        not null default 'pending' check(state in ('pending', 'delivered', 'failed')),
+		attempts       integer        not null default 0,
+		response_code  integer        not null default 0,
+		error          varchar        not null default '',
+		next_attempt   timestamp      not null                 check(next_attempt = strftime('%Y-%m-%d %H:%M:%S', next_attempt)),
+
+		created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict,
+		foreign key (webhook) references webhooks(id) on delete restrict on update restrict
+	);
+	create index "webhook_deliveries#state#next_attempt" on webhook_deliveries(state, next_attempt);
+	create index "webhook_deliveries#site#created_at"    on webhook_deliveries(site, created_at);
+
+	insert into version values ('2020-06-06-1-webhooks');
+commit;
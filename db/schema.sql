@@ -58,6 +58,19 @@ create table hits (
 	browser        varchar        not null,
 	size           varchar        not null default '',
 	location       varchar        not null default '',
+	region         varchar        not null default '',
+	language       varchar        not null default '',
+	utm_source     varchar        not null default '',
+	utm_medium     varchar        not null default '',
+	utm_campaign   varchar        not null default '',
+	utm_content    varchar        not null default '',
+	utm_term       varchar        not null default '',
+	channel        varchar        not null default '',
+	last_visit     varchar        not null default '',
+	experiment     varchar        not null default '',
+	variant        varchar        not null default '',
+	search_term    varchar        not null default '',
+	status         integer        not null default 0,
 	first_visit    int            default 0,
 
 	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at))
@@ -98,6 +111,7 @@ create table hit_stats (
 	title          varchar        not null default '',
 	stats          varchar        not null,
 	stats_unique   varchar        not null,
+	hll            blob           null,
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
@@ -112,39 +126,107 @@ create table browser_stats (
 	version        varchar        not null,
 	count          int            not null,
 	count_unique   int            not null,
+	hll            blob           null,
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
 create index "browser_stats#site#day"         on browser_stats(site, day);
 create index "browser_stats#site#day#browser" on browser_stats(site, day, browser);
 
+create table system_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	system         varchar        not null,
+	version        varchar        not null,
+	device         varchar        not null,
+	count          int            not null,
+	count_unique   int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "system_stats#site#day"        on system_stats(site, day);
+create index "system_stats#site#day#system" on system_stats(site, day, system);
+
+create table language_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	language       varchar        not null,
+	region         varchar        not null,
+	count          int            not null,
+	count_unique   int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "language_stats#site#day"          on language_stats(site, day);
+create index "language_stats#site#day#language" on language_stats(site, day, language);
+
 create table location_stats (
 	site           integer        not null                 check(site > 0),
 
 	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
 	event          integer        default 0,
 	location       varchar        not null,
+	region         varchar        not null default '',
 	count          int            not null,
 	count_unique   int            not null,
+	hll            blob           null,
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
 create index "location_stats#site#day"          on location_stats(site, day);
 create index "location_stats#site#day#location" on location_stats(site, day, location);
 
+create table iso_3166_2 (
+	name   varchar        not null,
+	alpha2 varchar        not null
+);
+create unique index "iso_3166_2#alpha2" on iso_3166_2(alpha2);
+
 create table ref_stats (
 	site           integer        not null                 check(site > 0),
 
 	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
 	event          integer        default 0,
 	ref            varchar        not null,
+	channel        varchar        not null default '',
 	count          int            not null,
 	count_unique   int            not null,
+	hll            blob           null,
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
 create index "ref_stats#site#day" on ref_stats(site, day);
 
+create table campaign_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	source         varchar        not null,
+	medium         varchar        not null,
+	campaign       varchar        not null,
+	count          int            not null,
+	count_unique   int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "campaign_stats#site#day" on campaign_stats(site, day);
+
+create table visitor_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	last_visit     varchar        not null,
+	count          int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "visitor_stats#site#day" on visitor_stats(site, day);
+
 create table size_stats (
 	site           integer        not null                 check(site > 0),
 
@@ -159,6 +241,216 @@ create table size_stats (
 create index "size_stats#site#day"       on size_stats(site, day);
 create index "size_stats#site#day#width" on size_stats(site, day, width);
 
+create table time_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	path           varchar        not null,
+	count          int            not null,
+	total          int            not null,
+	hist           varchar        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "time_stats#site#day" on time_stats(site, day);
+
+create table session_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	count          int            not null,
+	total          int            not null,
+	hist           varchar        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "session_stats#site#day" on session_stats(site, day);
+
+create table scroll_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	path           varchar        not null,
+	depth          int            not null,
+	count          int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "scroll_stats#site#day" on scroll_stats(site, day);
+
+create table vitals_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	path           varchar        not null,
+	name           varchar        not null,
+	count          int            not null,
+	hist           varchar        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "vitals_stats#site#day" on vitals_stats(site, day);
+
+create table annotations (
+	id             integer        primary key autoincrement,
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	text           varchar        not null                 check(length(text) > 0),
+	url            varchar        null,
+
+	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "annotations#site#day" on annotations(site, day);
+
+create table path_titles (
+	site           integer        not null                 check(site > 0),
+
+	path           varchar        not null,
+	title          varchar        not null,
+	first_seen     date           not null                 check(first_seen = strftime('%Y-%m-%d', first_seen)),
+	last_seen      date           not null                 check(last_seen = strftime('%Y-%m-%d', last_seen)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create unique index "path_titles#site#path#title" on path_titles(site, path, title);
+
+create table experiments (
+	id             integer        primary key autoincrement,
+	site           integer        not null                 check(site > 0),
+
+	name           varchar        not null                 check(length(name) > 0),
+	variants       varchar        not null,
+	goal           varchar        not null,
+	goal_event     int            not null default 0,
+
+	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create unique index "experiments#site#name" on experiments(site, name);
+
+create table experiment_sessions (
+	site           integer        not null                 check(site > 0),
+	experiment     integer        not null,
+	session        integer        not null,
+
+	variant        varchar        not null,
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	converted      date           null                     check(converted = strftime('%Y-%m-%d', converted)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict,
+	foreign key (experiment) references experiments(id) on delete restrict on update restrict
+);
+create unique index "experiment_sessions#site#experiment#session" on experiment_sessions(site, experiment, session);
+
+create table search_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	term           varchar        not null,
+	count          integer        not null,
+	no_pageview    integer        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create unique index "search_stats#site#day#term" on search_stats(site, day, term);
+
+create table broken_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	path           varchar        not null,
+	status         integer        not null,
+	ref            varchar        not null,
+	count          integer        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create unique index "broken_stats#site#day#path#status#ref" on broken_stats(site, day, path, status, ref);
+
+create table trending (
+	site           integer        not null                 check(site > 0),
+
+	kind           varchar        not null                 check(kind in ('path', 'ref')),
+	name           varchar        not null,
+	count          integer        not null,
+	baseline       float          not null,
+	zscore         float          not null,
+	updated_at     timestamp      not null                 check(updated_at = strftime('%Y-%m-%d %H:%M:%S', updated_at)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create unique index "trending#site#kind#name" on trending(site, kind, name);
+
+create table alerts (
+	id             integer        primary key autoincrement,
+	site           integer        not null                 check(site > 0),
+
+	kind           varchar        not null                 check(kind in ('spike', 'drop', 'no_hits', 'new_ref', 'goal')),
+	threshold      integer        not null                 check(threshold > 0),
+	goal           varchar        not null default '',
+	cooldown       integer        not null default 24,
+	last_sent      timestamp      null                     check(last_sent = strftime('%Y-%m-%d %H:%M:%S', last_sent)),
+
+	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "alerts#site" on alerts(site);
+
+create table alert_history (
+	id             integer        primary key autoincrement,
+	site           integer        not null                 check(site > 0),
+	alert          integer        not null,
+
+	message        varchar        not null,
+	sent_at        timestamp      not null                 check(sent_at = strftime('%Y-%m-%d %H:%M:%S', sent_at)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "alert_history#site#sent_at" on alert_history(site, sent_at);
+
+create table webhooks (
+	id             integer        primary key autoincrement,
+	site           integer        not null                 check(site > 0),
+
+	url            varchar        not null,
+	secret         varchar        not null,
+	events         varchar        not null,
+	last_summary   date           null                     check(last_summary = strftime('%Y-%m-%d', last_summary)),
+
+	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "webhooks#site" on webhooks(site);
+
+create table webhook_deliveries (
+	id             integer        primary key autoincrement,
+	site           integer        not null                 check(site > 0),
+	webhook        integer        not null,
+
+	event          varchar        not null,
+	payload        varchar        not null,
+	state          varchar        not null default 'pending' check(state in ('pending', 'delivered', 'failed')),
+	attempts       integer        not null default 0,
+	response_code  integer        not null default 0,
+	error          varchar        not null default '',
+	next_attempt   timestamp      not null                 check(next_attempt = strftime('%Y-%m-%d %H:%M:%S', next_attempt)),
+
+	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict,
+	foreign key (webhook) references webhooks(id) on delete restrict on update restrict
+);
+create index "webhook_deliveries#state#next_attempt" on webhook_deliveries(state, next_attempt);
+create index "webhook_deliveries#site#created_at"    on webhook_deliveries(site, created_at);
+
 create table iso_3166_1 (
 	name   varchar,
 	alpha2 varchar
@@ -501,4 +793,24 @@ insert into version values
 	('2020-04-27-1-usage-flags'),
 	('2020-04-28-1-fix'),
 	('2020-05-13-1-unique-path'),
-	('2020-05-17-1-rm-user-name');
+	('2020-05-17-1-rm-user-name'),
+	('2020-05-20-1-time_stats'),
+	('2020-05-21-1-scroll_stats'),
+	('2020-05-22-1-vitals_stats'),
+	('2020-05-23-1-system_stats'),
+	('2020-05-24-1-language'),
+	('2020-05-25-1-regions'),
+	('2020-05-26-1-campaign_stats'),
+	('2020-05-27-1-channel'),
+	('2020-05-28-1-visitor_stats'),
+	('2020-05-29-1-hll'),
+	('2020-05-30-1-annotations'),
+	('2020-05-31-1-path_titles'),
+	('2020-06-01-1-experiments'),
+	('2020-06-02-1-search_stats'),
+	('2020-06-03-1-broken_stats'),
+	('2020-06-04-1-trending'),
+	('2020-06-05-1-alerts'),
+	('2020-06-06-1-webhooks'),
+	('2020-06-07-1-hits_region'),
+	('2020-06-08-1-content_groups_lines');
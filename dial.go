@@ -0,0 +1,83 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var privateNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, c := range []string{
+		"0.0.0.0/8",      // "This" network.
+		"10.0.0.0/8",     // RFC 1918
+		"100.64.0.0/10",  // Carrier-grade NAT
+		"127.0.0.0/8",    // Loopback
+		"169.254.0.0/16", // Link-local, including cloud metadata (169.254.169.254)
+		"172.16.0.0/12",  // RFC 1918
+		"192.168.0.0/16", // RFC 1918
+		"::/128",         // Unspecified
+		"::1/128",        // Loopback
+		"fc00::/7",       // Unique local
+		"fe80::/10",      // Link-local
+	} {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// PublicIP reports if the IP address is a public address that we can connect
+// to on behalf of a user; can be overwritten in tests.
+var PublicIP = func(ip net.IP) bool {
+	if ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// newPublicClient creates a HTTP client for fetching user-provided URLs.
+//
+// It refuses to connect to loopback, private, and link-local addresses. This is
+// checked after the DNS lookup on every connection (including redirects), so a
+// hostname that resolves to e.g. 127.0.0.1 won't work either.
+func newPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !PublicIP(ip) {
+				return fmt.Errorf("connecting to %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// Don't use a proxy: the proxy would do the DNS lookup and connect,
+			// bypassing the checks.
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
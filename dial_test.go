@@ -0,0 +1,43 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"net"
+	"testing"
+
+	. "zgo.at/goatcounter"
+)
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := PublicIP(net.ParseIP(tt.in))
+			if got != tt.want {
+				t.Errorf("got %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
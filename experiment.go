@@ -0,0 +1,296 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"zgo.at/goatcounter/cfg"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+	"zgo.at/zvalidate"
+)
+
+// Experiment is an A/B test: every session is shown one of the variants (as
+// reported by count.js), and we count how many of those sessions reach the
+// goal afterwards.
+type Experiment struct {
+	ID       int64       `db:"id" json:"id"`
+	Site     int64       `db:"site" json:"-"`
+	Name     string      `db:"name" json:"name"`
+	Variants zdb.Strings `db:"variants" json:"variants"` // The first variant is the control.
+
+	// Goal is the path or event name to count as a conversion.
+	Goal      string   `db:"goal" json:"goal"`
+	GoalEvent zdb.Bool `db:"goal_event" json:"goal_event"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Defaults sets fields to default values, unless they're already set.
+func (e *Experiment) Defaults(ctx context.Context) {
+	if e.Site == 0 {
+		e.Site = MustGetSite(ctx).ID
+	}
+	e.Name = strings.TrimSpace(e.Name)
+	e.Goal = strings.TrimSpace(e.Goal)
+	for i := range e.Variants {
+		e.Variants[i] = strings.TrimSpace(e.Variants[i])
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = Now()
+	}
+}
+
+// Validate the object.
+func (e *Experiment) Validate(ctx context.Context) error {
+	v := zvalidate.New()
+
+	v.Required("site", e.Site)
+	v.Required("name", e.Name)
+	v.Required("goal", e.Goal)
+	v.Len("name", e.Name, 0, 250)
+	v.Len("goal", e.Goal, 0, 2048)
+
+	if len(e.Variants) < 2 {
+		v.Append("variants", "must have at least two variants")
+	}
+	seen := make(map[string]struct{})
+	for _, vv := range e.Variants {
+		if vv == "" {
+			v.Append("variants", "can't be blank")
+			continue
+		}
+		v.Len("variants", vv, 0, 250)
+		if _, ok := seen[vv]; ok {
+			v.Append("variants", "duplicate variant "+vv)
+		}
+		seen[vv] = struct{}{}
+	}
+
+	if e.ID == 0 && e.Name != "" {
+		var exists bool
+		err := zdb.MustGet(ctx).GetContext(ctx, &exists,
+			`select 1 from experiments where site=$1 and name=$2`, e.Site, e.Name)
+		if err == nil && exists {
+			v.Append("name", "already exists")
+		}
+	}
+
+	return v.ErrorOrNil()
+}
+
+// Insert a new row.
+func (e *Experiment) Insert(ctx context.Context) error {
+	if e.ID > 0 {
+		return errors.New("ID > 0")
+	}
+
+	e.Defaults(ctx)
+	err := e.Validate(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `insert into experiments (site, name, variants, goal, goal_event, created_at) values ($1, $2, $3, $4, $5, $6)`
+	args := []interface{}{e.Site, e.Name, e.Variants, e.Goal, e.GoalEvent, e.CreatedAt.Format(zdb.Date)}
+	if cfg.PgSQL {
+		err = zdb.MustGet(ctx).GetContext(ctx, &e.ID, query+" returning id", args...)
+		return errors.Wrap(err, "Experiment.Insert")
+	}
+
+	res, err := zdb.MustGet(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "Experiment.Insert")
+	}
+	e.ID, err = res.LastInsertId()
+	return errors.Wrap(err, "Experiment.Insert")
+}
+
+// ByID gets an experiment by ID for the current site.
+func (e *Experiment) ByID(ctx context.Context, id int64) error {
+	return errors.Wrap(zdb.MustGet(ctx).GetContext(ctx, e,
+		`select * from experiments where site=$1 and id=$2`,
+		MustGetSite(ctx).ID, id), "Experiment.ByID")
+}
+
+// Delete the experiment with this ID for the current site, including all the
+// collected data.
+func (e *Experiment) Delete(ctx context.Context, id int64) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		site := MustGetSite(ctx).ID
+		_, err := tx.ExecContext(ctx,
+			`delete from experiment_sessions where site=$1 and experiment=$2`, site, id)
+		if err != nil {
+			return errors.Wrap(err, "Experiment.Delete")
+		}
+		_, err = tx.ExecContext(ctx,
+			`delete from experiments where site=$1 and id=$2`, site, id)
+		return errors.Wrap(err, "Experiment.Delete")
+	})
+}
+
+// Experiments is a list of experiments.
+type Experiments []Experiment
+
+// List all experiments for the current site, newest first.
+func (e *Experiments) List(ctx context.Context) error {
+	return errors.Wrap(zdb.MustGet(ctx).SelectContext(ctx, e,
+		`select * from experiments where site=$1 order by created_at desc, id desc`,
+		MustGetSite(ctx).ID), "Experiments.List")
+}
+
+// ExperimentDay is the number of exposures and conversions for a variant on a
+// single day; conversions are counted on the day of the exposure.
+type ExperimentDay struct {
+	Day         string
+	Exposures   int
+	Conversions int
+}
+
+// ExperimentVariant is the result for a single variant of an experiment.
+type ExperimentVariant struct {
+	Name        string
+	Control     bool
+	Exposures   int // Number of sessions that saw this variant.
+	Conversions int // Number of those sessions that reached the goal.
+	Days        []ExperimentDay
+
+	// Compared to the control; these are zero for the control itself.
+	Change float64 // Relative change in conversion rate, in percent.
+	PValue float64 // Two-tailed p-value of the two-proportion z-test.
+}
+
+// Rate gets the conversion rate, in percent.
+func (v ExperimentVariant) Rate() float64 {
+	if v.Exposures == 0 {
+		return 0
+	}
+	return float64(v.Conversions) / float64(v.Exposures) * 100
+}
+
+// Interval gets the 95% confidence interval for the conversion rate as the
+// lower and upper bound, in percent.
+//
+// This uses the Wilson score interval, which still gives sensible results for
+// small numbers and rates close to 0 or 100%.
+func (v ExperimentVariant) Interval() [2]float64 {
+	if v.Exposures == 0 {
+		return [2]float64{0, 0}
+	}
+
+	const z = 1.96
+	var (
+		n      = float64(v.Exposures)
+		p      = float64(v.Conversions) / n
+		d      = 1 + z*z/n
+		center = (p + z*z/(2*n)) / d
+		margin = z * math.Sqrt(p*(1-p)/n+z*z/(4*n*n)) / d
+	)
+	return [2]float64{math.Max(0, center-margin) * 100, math.Min(1, center+margin) * 100}
+}
+
+// Significant reports if the difference with the control is statistically
+// significant at the 95% level.
+func (v ExperimentVariant) Significant() bool {
+	return !v.Control && v.Exposures > 0 && v.PValue < 0.05
+}
+
+// ExperimentResults are the results for all variants of an experiment.
+type ExperimentResults []ExperimentVariant
+
+// List the results for the experiment, in the order the variants are defined.
+// Exposures for variants that are no longer in the experiment are ignored.
+func (r *ExperimentResults) List(ctx context.Context, e Experiment) error {
+	var rows []struct {
+		Variant     string    `db:"variant"`
+		Day         time.Time `db:"day"`
+		Exposures   int       `db:"exposures"`
+		Conversions int       `db:"conversions"`
+	}
+	err := zdb.MustGet(ctx).SelectContext(ctx, &rows, `/* ExperimentResults.List */
+		select variant, day, count(*) as exposures, count(converted) as conversions
+		from experiment_sessions
+		where site=$1 and experiment=$2
+		group by variant, day
+		order by day asc`,
+		MustGetSite(ctx).ID, e.ID)
+	if err != nil {
+		return errors.Wrap(err, "ExperimentResults.List")
+	}
+
+	var days []ExperimentDay
+	if len(rows) > 0 {
+		days = experimentDays(rows[0].Day, rows[len(rows)-1].Day)
+	}
+
+	idx := make(map[string]int)
+	*r = make(ExperimentResults, len(e.Variants))
+	for i, name := range e.Variants {
+		idx[name] = i
+		(*r)[i] = ExperimentVariant{Name: name, Control: i == 0,
+			Days: append([]ExperimentDay(nil), days...)}
+	}
+
+	for _, row := range rows {
+		i, ok := idx[row.Variant]
+		if !ok {
+			continue
+		}
+		v := &(*r)[i]
+		v.Exposures += row.Exposures
+		v.Conversions += row.Conversions
+
+		d := int(row.Day.Sub(rows[0].Day).Hours() / 24)
+		v.Days[d].Exposures += row.Exposures
+		v.Days[d].Conversions += row.Conversions
+	}
+
+	if len(*r) > 0 {
+		control := (*r)[0]
+		for i := range (*r)[1:] {
+			v := &(*r)[i+1]
+			v.PValue = zTest(control.Conversions, control.Exposures, v.Conversions, v.Exposures)
+			if control.Rate() > 0 {
+				v.Change = (v.Rate() - control.Rate()) / control.Rate() * 100
+			}
+		}
+	}
+	return nil
+}
+
+// experimentDays gets an ExperimentDay for every day between start and end.
+func experimentDays(start, end time.Time) []ExperimentDay {
+	var days []ExperimentDay
+	for d := start; !d.After(end); d = d.Add(24 * time.Hour) {
+		days = append(days, ExperimentDay{Day: d.Format("2006-01-02")})
+	}
+	return days
+}
+
+// zTest gets the two-tailed p-value for the difference between two proportions
+// (c1 out of n1 and c2 out of n2), using the pooled two-proportion z-test.
+//
+// It returns 1 if there isn't enough data to say anything.
+func zTest(c1, n1, c2, n2 int) float64 {
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	var (
+		p1 = float64(c1) / float64(n1)
+		p2 = float64(c2) / float64(n2)
+		p  = float64(c1+c2) / float64(n1+n2)
+		se = math.Sqrt(p * (1 - p) * (1/float64(n1) + 1/float64(n2)))
+	)
+	if se == 0 {
+		return 1
+	}
+	z := (p2 - p1) / se
+	return math.Erfc(math.Abs(z) / math.Sqrt2)
+}
@@ -0,0 +1,114 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestExperimentResults(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	e := Experiment{Name: "button", Variants: []string{"blue", "green"}, Goal: "/signup"}
+	err := e.Insert(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 out of 100 sessions convert for blue, and 25 out of 100 for green;
+	// half of them on the next day.
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	var (
+		hits []Hit
+		sess int64
+	)
+	add := func(variant string, n, conv int) {
+		for i := 0; i < n; i++ {
+			sess++
+			s := sess
+			day := now
+			if i%2 == 1 {
+				day = now.Add(24 * time.Hour)
+			}
+			hits = append(hits, Hit{Path: "/", Experiment: "button", Variant: variant,
+				Session: &s, CreatedAt: day})
+			if i < conv {
+				hits = append(hits, Hit{Path: "/signup", Session: &s, CreatedAt: day.Add(time.Minute)})
+			}
+		}
+	}
+	add("blue", 100, 10)
+	add("green", 100, 25)
+	gctest.StoreHits(ctx, t, hits...)
+
+	var results ExperimentResults
+	err = results.List(ctx, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, v := range results {
+		i := v.Interval()
+		line := fmt.Sprintf("%s %d/%d rate=%.2f interval=%.2f-%.2f change=%.1f p=%.4f significant=%t",
+			v.Name, v.Conversions, v.Exposures, v.Rate(), i[0], i[1], v.Change, v.PValue, v.Significant())
+		for _, d := range v.Days {
+			line += fmt.Sprintf(" %s:%d/%d", d.Day, d.Conversions, d.Exposures)
+		}
+		got = append(got, line)
+	}
+	want := []string{
+		"blue 10/100 rate=10.00 interval=5.52-17.44 change=0.0 p=0.0000 significant=false 2019-08-31:5/50 2019-09-01:5/50",
+		"green 25/100 rate=25.00 interval=17.55-34.30 change=150.0 p=0.0052 significant=true 2019-08-31:13/50 2019-09-01:12/50",
+	}
+	if g := strings.Join(got, "\n"); g != strings.Join(want, "\n") {
+		t.Errorf("\ngot:\n%s\nwant:\n%s", g, strings.Join(want, "\n"))
+	}
+}
+
+func TestExperimentValidate(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	err := (&Experiment{Name: "exists", Variants: []string{"a", "b"}, Goal: "/x"}).Insert(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		in   Experiment
+		want string
+	}{
+		{Experiment{Name: "x", Variants: []string{"a", " b "}, Goal: "/x"}, ""},
+		{Experiment{Name: "x", Variants: []string{"a"}, Goal: "/x"}, "variants: must have at least two variants"},
+		{Experiment{Name: "x", Variants: []string{"a", "a"}, Goal: "/x"}, "variants: duplicate variant a"},
+		{Experiment{Name: "x", Variants: []string{"a", " "}, Goal: "/x"}, "variants: can't be blank"},
+		{Experiment{Name: "x", Variants: []string{"a", "b"}}, "goal: must be set"},
+		{Experiment{Name: "exists", Variants: []string{"a", "b"}, Goal: "/x"}, "name: already exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			tt.in.Defaults(ctx)
+			err := tt.in.Validate(ctx)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("\ngot:  %v\nwant: %s", err, tt.want)
+			}
+		})
+	}
+}
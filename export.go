@@ -117,6 +117,14 @@ func Export(ctx context.Context, fp *os.File) {
 		return
 	}
 
+	err = TriggerWebhooks(ctx, WebhookExport, struct {
+		URL  string `json:"url"`
+		Size string `json:"size"`
+	}{site.URL() + "/download-export", size})
+	if err != nil {
+		l.Error(err)
+	}
+
 	user := GetUser(ctx)
 	err = zmail.SendTemplate("GoatCounter export ready",
 		mail.Address{Name: "GoatCounter export", Address: "support@goatcounter.com"},
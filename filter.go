@@ -0,0 +1,299 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"zgo.at/goatcounter/errors"
+	"zgo.at/guru"
+	"zgo.at/zdb"
+)
+
+// Filter is a parsed filter query for the list of paths.
+//
+// A query is a list of terms separated by spaces; a path is shown if it matches
+// any of the terms, and doesn't match any of the negated terms:
+//
+//   blog                Path or title contains "blog".
+//   "/about"            Path or title is exactly "/about".
+//   /blog/*             Path or title matches the pattern; * matches anything.
+//   ~^/blog/[0-9]+$     Path or title matches the regular expression.
+//   -/admin             Exclude paths or titles containing "/admin".
+//   title:"Hello world" Only match the title; "path:" only matches the path.
+//   ref:reddit          Paths with visits from a referrer containing "reddit".
+//
+// Everything is matched case-insensitive. Titles also match on all previous
+// titles a path had.
+type Filter struct {
+	terms []filterTerm
+}
+
+type filterTerm struct {
+	field  string // "path", "title", "ref", or "" for path or title.
+	negate bool
+	match  int
+	value  string         // Lower-cased value.
+	re     *regexp.Regexp // For matchGlob and matchRegexp.
+}
+
+const (
+	matchContains = iota
+	matchExact
+	matchGlob
+	matchRegexp
+)
+
+// Regular expressions are matched in Go against the list of paths, as SQLite
+// doesn't have a regexp function. Limit the number of matches so we don't run
+// in to the SQLite parameter limit of 999.
+const maxRegexpPaths = 500
+
+// ParseFilter parses a filter query.
+func ParseFilter(q string) (Filter, error) {
+	var (
+		f       Filter
+		tokens  []string
+		tok     strings.Builder
+		inQuote bool
+	)
+	for _, c := range q {
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+			tok.WriteRune(c)
+		case unicode.IsSpace(c) && !inQuote:
+			if tok.Len() > 0 {
+				tokens = append(tokens, tok.String())
+				tok.Reset()
+			}
+		default:
+			tok.WriteRune(c)
+		}
+	}
+	if inQuote {
+		return Filter{}, guru.New(400, "filter: unterminated quote")
+	}
+	if tok.Len() > 0 {
+		tokens = append(tokens, tok.String())
+	}
+
+	for _, tok := range tokens {
+		var t filterTerm
+		if len(tok) > 1 && tok[0] == '-' {
+			t.negate, tok = true, tok[1:]
+		}
+		for _, field := range []string{"path", "title", "ref"} {
+			if strings.HasPrefix(tok, field+":") {
+				t.field, tok = field, tok[len(field)+1:]
+				break
+			}
+		}
+
+		switch {
+		case len(tok) >= 2 && tok[0] == '"' && tok[len(tok)-1] == '"':
+			t.match, t.value = matchExact, strings.ToLower(tok[1:len(tok)-1])
+		case strings.HasPrefix(tok, "~"):
+			if t.field == "ref" {
+				return Filter{}, guru.New(400, "filter: regular expressions aren't supported for ref:")
+			}
+			re, err := regexp.Compile("(?i)" + tok[1:])
+			if err != nil {
+				return Filter{}, guru.Errorf(400, "filter: invalid regular expression %q: %s", tok[1:], err)
+			}
+			t.match, t.value, t.re = matchRegexp, tok[1:], re
+		case strings.Contains(tok, "*"):
+			t.match, t.value = matchGlob, strings.ToLower(tok)
+			t.re = regexp.MustCompile("(?i)^" +
+				strings.ReplaceAll(regexp.QuoteMeta(tok), `\*`, ".*") + "$")
+		default:
+			t.match, t.value = matchContains, strings.ToLower(tok)
+		}
+		if t.value == "" || strings.Trim(t.value, "*") == "" && t.match == matchGlob {
+			return Filter{}, guru.Errorf(400, "filter: empty term in %q", q)
+		}
+
+		f.terms = append(f.terms, t)
+	}
+	return f, nil
+}
+
+// IsZero reports if there's nothing to filter on.
+func (f Filter) IsZero() bool { return len(f.terms) == 0 }
+
+// escapeLike escapes the special characters in a "like" pattern; it should be
+// used with "escape '\'".
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// where gets the SQL condition for the filter, with ? placeholders. It returns
+// an empty string if there is nothing to filter on.
+//
+// The condition only uses the path and title columns, and can be used for
+// both the hits and hit_stats tables.
+func (f Filter) where(ctx context.Context, start, end time.Time) (string, []interface{}, error) {
+	if f.IsZero() {
+		return "", nil, nil
+	}
+
+	var (
+		pos, neg []string
+		args     []interface{}
+	)
+	for _, t := range f.terms {
+		var (
+			cond string
+			cols = []string{"path", "title"}
+		)
+		if t.field == "path" || t.field == "title" {
+			cols = []string{t.field}
+		}
+
+		switch {
+		case t.match == matchRegexp:
+			paths, err := t.regexpPaths(ctx, start, end)
+			if err != nil {
+				return "", nil, err
+			}
+			if len(paths) == 0 {
+				cond = "1=0"
+				break
+			}
+			cond = "path in (" + strings.TrimRight(strings.Repeat("?, ", len(paths)), ", ") + ")"
+			for _, p := range paths {
+				args = append(args, p)
+			}
+
+		case t.field == "ref":
+			cond = `path in (select path from hits where site=? and created_at >= ? and created_at <= ? and `
+			args = append(args, MustGetSite(ctx).ID, start, end)
+			if t.match == matchExact {
+				cond += `lower(ref) = ?)`
+				args = append(args, t.value)
+			} else {
+				cond += `lower(ref) like ? escape '\')`
+				args = append(args, t.like())
+			}
+
+		default:
+			c := make([]string, 0, len(cols))
+			for _, col := range cols {
+				if t.match == matchExact {
+					c = append(c, "lower("+col+") = ?")
+					args = append(args, t.value)
+				} else {
+					c = append(c, "lower("+col+`) like ? escape '\'`)
+					args = append(args, t.like())
+				}
+			}
+
+			// Also match on the previous titles.
+			if t.field != "path" {
+				if t.match == matchExact {
+					c = append(c, "path in (select path from path_titles where site=? and lower(title) = ?)")
+					args = append(args, MustGetSite(ctx).ID, t.value)
+				} else {
+					c = append(c, `path in (select path from path_titles where site=? and lower(title) like ? escape '\')`)
+					args = append(args, MustGetSite(ctx).ID, t.like())
+				}
+			}
+			cond = strings.Join(c, " or ")
+		}
+
+		if t.negate {
+			neg = append(neg, "not ("+cond+")")
+		} else {
+			pos = append(pos, "("+cond+")")
+		}
+	}
+
+	var where []string
+	if len(pos) > 0 {
+		where = append(where, "("+strings.Join(pos, " or ")+")")
+	}
+	where = append(where, neg...)
+	return "(" + strings.Join(where, " and ") + ")", args, nil
+}
+
+// like gets the "like" pattern for contains and glob matches.
+func (t filterTerm) like() string {
+	if t.match == matchGlob {
+		return strings.ReplaceAll(escapeLike(t.value), "*", "%")
+	}
+	return "%" + escapeLike(t.value) + "%"
+}
+
+// regexpPaths gets all paths in the time range that match the regexp.
+func (t filterTerm) regexpPaths(ctx context.Context, start, end time.Time) ([]string, error) {
+	var rows []struct {
+		Path  string `db:"path"`
+		Title string `db:"title"`
+	}
+	db := zdb.MustGet(ctx)
+	err := db.SelectContext(ctx, &rows, db.Rebind(`/* Filter.regexpPaths */
+		select path, title from hit_stats
+		where site=? and day >= ? and day <= ?
+		group by path, title
+		union
+		select path, title from path_titles where site=?`),
+		MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"), MustGetSite(ctx).ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Filter.regexpPaths")
+	}
+
+	var (
+		paths []string
+		seen  = make(map[string]struct{})
+	)
+	for _, r := range rows {
+		if _, ok := seen[r.Path]; ok || !t.matchString(r.Path, r.Title) {
+			continue
+		}
+		seen[r.Path] = struct{}{}
+		paths = append(paths, r.Path)
+	}
+	if len(paths) > maxRegexpPaths {
+		return nil, guru.Errorf(400, "filter: the regular expression %q matches more than %d paths",
+			t.value, maxRegexpPaths)
+	}
+	return paths, nil
+}
+
+// matchString reports if the term matches the path or title; the negation is
+// not applied.
+func (t filterTerm) matchString(path, title string) bool {
+	var s []string
+	switch t.field {
+	case "path":
+		s = []string{path}
+	case "title":
+		s = []string{title}
+	default:
+		s = []string{path, title}
+	}
+
+	for _, v := range s {
+		switch t.match {
+		case matchExact:
+			if strings.ToLower(v) == t.value {
+				return true
+			}
+		case matchGlob, matchRegexp:
+			if t.re.MatchString(v) {
+				return true
+			}
+		default:
+			if strings.Contains(strings.ToLower(v), t.value) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	. "zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestFilter(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	gctest.StoreHits(ctx, t, []Hit{
+		{Path: "/", Title: "Home", CreatedAt: now},
+		{Path: "/about", Title: "About us", CreatedAt: now},
+		{Path: "/about/team", Title: "The team", CreatedAt: now},
+		{Path: "/blog/1", Title: "Hello world", Ref: "https://www.reddit.com/r/golang", CreatedAt: now},
+		{Path: "/blog/2", Title: "Second post", CreatedAt: now},
+		{Path: "/blog/draft", Title: "Draft", CreatedAt: now},
+		{Path: "/admin/blog", Title: "Admin", CreatedAt: now},
+		{Path: "/100%_done", Title: "Done", CreatedAt: now},
+	}...)
+
+	start := time.Date(2019, 8, 31, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 8, 31, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		filter, want string
+	}{
+		{"", "/ /100%_done /about /about/team /admin/blog /blog/1 /blog/2 /blog/draft"},
+		{"blog", "/admin/blog /blog/1 /blog/2 /blog/draft"},
+		{"BLOG -/admin", "/blog/1 /blog/2 /blog/draft"},
+		{"/about/* /blog/*", "/about/team /blog/1 /blog/2 /blog/draft"},
+		{`"/about"`, "/about"},
+		{`title:"hello world"`, "/blog/1"},
+		{"title:team path:/blog/2", "/about/team /blog/2"},
+		{"path:home", ""},
+		{"~^/blog/[0-9]+$", "/blog/1 /blog/2"},
+		{"~^/blog/ -~[0-9]", "/blog/draft"},
+		{"ref:reddit", "/blog/1"},
+		{"-ref:reddit -/a* -/1*", "/ /blog/2 /blog/draft"},
+		{"%_", "/100%_done"},
+		{"~nomatch", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			var pages HitStats
+			total, _, _, _, _, err := pages.List(ctx, start, end, tt.filter, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := paths(pages)
+			if got != tt.want {
+				t.Errorf("List\ngot:  %s\nwant: %s", got, tt.want)
+			}
+			if n := len(strings.Fields(tt.want)); total != n {
+				t.Errorf("total: got %d; want %d", total, n)
+			}
+
+			// Should give the same results with a segment.
+			var seg HitStats
+			_, _, _, _, _, err = seg.ListSegment(ctx, Segment{Event: "false"}, start, end, tt.filter, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = paths(seg)
+			if got != tt.want {
+				t.Errorf("ListSegment\ngot:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		in, wantErr string
+	}{
+		{"", ""},
+		{`-/admin path:/blog/* title:"a b" ~^/x$`, ""},
+		{`"/about`, "filter: unterminated quote"},
+		{"~[", "filter: invalid regular expression"},
+		{"ref:~x", "filter: regular expressions aren't supported for ref:"},
+		{`path:""`, "filter: empty term"},
+		{"/a **", "filter: empty term"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			_, err := ParseFilter(tt.in)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("\ngot:  %v\nwant: %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func paths(h HitStats) string {
+	p := make([]string, 0, len(h))
+	for _, s := range h {
+		p = append(p, s.Path)
+	}
+	sort.Strings(p)
+	return strings.Join(p, " ")
+}
@@ -0,0 +1,86 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"time"
+)
+
+// Groupings for the charts, in addition to the hourly and daily view.
+const (
+	GroupWeek  = "week"
+	GroupMonth = "month"
+)
+
+// GroupStats adds up the daily stats per week or month.
+//
+// The Day of the grouped stats is the first day of the week or month, the
+// first and last group may be partial if the period doesn't start or end at
+// the start or end of a week or month. The days should already be in the
+// site's timezone.
+//
+// The returned int is the highest count in the new stats.
+func GroupStats(stats []Stat, group string, sundayStartsWeek bool) ([]Stat, int) {
+	var (
+		grouped []Stat
+		max     int
+	)
+	for _, s := range stats {
+		day, err := time.Parse("2006-01-02", s.Day)
+		if err != nil {
+			continue
+		}
+		start := groupStart(day, group, sundayStartsWeek).Format("2006-01-02")
+
+		if len(grouped) == 0 || grouped[len(grouped)-1].Day != start {
+			grouped = append(grouped, Stat{Day: start})
+		}
+		g := &grouped[len(grouped)-1]
+		g.Daily += s.Daily
+		g.DailyUnique += s.DailyUnique
+		g.Annotations = append(g.Annotations, s.Annotations...)
+		if s.Compare != nil {
+			if g.Compare == nil {
+				g.Compare = &Stat{Day: s.Compare.Day}
+			}
+			g.Compare.Daily += s.Compare.Daily
+			g.Compare.DailyUnique += s.Compare.DailyUnique
+		}
+	}
+
+	for _, g := range grouped {
+		if g.Daily > max {
+			max = g.Daily
+		}
+		if g.Compare != nil && g.Compare.Daily > max {
+			max = g.Compare.Daily
+		}
+	}
+	return grouped, max
+}
+
+func groupStart(day time.Time, group string, sundayStartsWeek bool) time.Time {
+	switch group {
+	case GroupWeek:
+		wd := int(day.Weekday())
+		if !sundayStartsWeek {
+			wd = (wd + 6) % 7 // Monday is 0.
+		}
+		return day.AddDate(0, 0, -wd)
+	case GroupMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	}
+	return day
+}
+
+// Group the stats of every path per week or month.
+func (h HitStats) Group(group string, sundayStartsWeek bool) {
+	for i := range h {
+		h[i].Stats, h[i].DailyMax = GroupStats(h[i].Stats, group, sundayStartsWeek)
+		if h[i].DailyMax < 10 {
+			h[i].DailyMax = 10
+		}
+	}
+}
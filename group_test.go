@@ -0,0 +1,57 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "zgo.at/goatcounter"
+)
+
+func TestGroupStats(t *testing.T) {
+	// 2020-04-26 is a Sunday.
+	var stats []Stat
+	for _, d := range []string{"2020-04-25", "2020-04-26", "2020-04-27",
+		"2020-04-28", "2020-04-29", "2020-04-30", "2020-05-01", "2020-05-02",
+		"2020-05-03", "2020-05-04"} {
+		stats = append(stats, Stat{Day: d, Daily: 2, DailyUnique: 1})
+	}
+	stats[9].Compare = &Stat{Day: "2020-04-20", Daily: 30}
+
+	tests := []struct {
+		group   string
+		sunday  bool
+		wantMax int
+		want    string
+	}{
+		{GroupWeek, false, 30, "2020-04-20 4 2 | 2020-04-27 14 7 | 2020-05-04 2 1 30"},
+		{GroupWeek, true, 30, "2020-04-19 2 1 | 2020-04-26 14 7 | 2020-05-03 4 2 30"},
+		{GroupMonth, false, 30, "2020-04-01 12 6 | 2020-05-01 8 4 30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s-%t", tt.group, tt.sunday), func(t *testing.T) {
+			got, max := GroupStats(stats, tt.group, tt.sunday)
+
+			var out string
+			for i, g := range got {
+				if i > 0 {
+					out += " | "
+				}
+				out += fmt.Sprintf("%s %d %d", g.Day, g.Daily, g.DailyUnique)
+				if g.Compare != nil {
+					out += fmt.Sprintf(" %d", g.Compare.Daily)
+				}
+			}
+			if out != tt.want {
+				t.Errorf("\ngot:  %s\nwant: %s", out, tt.want)
+			}
+			if max != tt.wantMax {
+				t.Errorf("max: got %d, want %d", max, tt.wantMax)
+			}
+		})
+	}
+}
@@ -46,6 +46,10 @@ type backend struct{}
 // Always use the daily view if the number of days is larger than this.
 const DailyView = 90
 
+// Group the charts by week by default if the number of days is larger than
+// this.
+const WeeklyView = 365
+
 func (h backend) Mount(r chi.Router, db zdb.DB) {
 	r.Use(
 		middleware.RealIP,
@@ -139,10 +143,17 @@ func (h backend) Mount(r chi.Router, db zdb.DB) {
 			ap.Get("/refs", zhttp.Wrap(h.refs))
 			ap.Get("/pages", zhttp.Wrap(h.pages))
 			ap.Get("/browsers", zhttp.Wrap(h.browsers))
+			ap.Get("/systems", zhttp.Wrap(h.systems))
+			ap.Get("/devices", zhttp.Wrap(h.devices))
+			ap.Get("/languages", zhttp.Wrap(h.languages))
 			ap.Get("/sizes", zhttp.Wrap(h.sizes))
 			ap.Get("/locations", zhttp.Wrap(h.locations))
+			ap.Get("/regions", zhttp.Wrap(h.regions))
+			ap.Get("/campaigns", zhttp.Wrap(h.campaigns))
+			ap.Get("/campaign", zhttp.Wrap(h.campaign))
 			ap.Get("/toprefs", zhttp.Wrap(h.topRefs))
 			ap.Get("/pages-by-ref", zhttp.Wrap(h.pagesByRef))
+			ap.Get("/heatmap", zhttp.Wrap(h.heatmap))
 		}
 		{
 			af := a.With(loggedIn)
@@ -161,6 +172,18 @@ func (h backend) Mount(r chi.Router, db zdb.DB) {
 				Message: "you can request only one export a day",
 			})).Post("/start-export", zhttp.Wrap(h.startExport))
 			af.Get("/download-export", zhttp.Wrap(h.downloadExport))
+			af.Get("/annotations", zhttp.Wrap(h.annotations))
+			af.Post("/annotations", zhttp.Wrap(h.addAnnotation))
+			af.Post("/annotations/{id}/delete", zhttp.Wrap(h.deleteAnnotation))
+			af.Get("/experiments/{id}", zhttp.Wrap(h.experiment))
+			af.Post("/experiments", zhttp.Wrap(h.addExperiment))
+			af.Post("/experiments/{id}/delete", zhttp.Wrap(h.deleteExperiment))
+			af.Post("/alerts", zhttp.Wrap(h.addAlert))
+			af.Post("/alerts/{id}/delete", zhttp.Wrap(h.deleteAlert))
+			af.Post("/webhooks", zhttp.Wrap(h.addWebhook))
+			af.Post("/webhooks/{id}/delete", zhttp.Wrap(h.deleteWebhook))
+			af.Get("/sitemap", zhttp.Wrap(h.sitemap))
+			af.Post("/sitemap", zhttp.Wrap(h.sitemap))
 			af.Post("/add", zhttp.Wrap(h.addSubsite))
 			af.Get("/remove/{id}", zhttp.Wrap(h.removeSubsiteConfirm))
 			af.Post("/remove/{id}", zhttp.Wrap(h.removeSubsite))
@@ -178,17 +201,50 @@ var gif = []byte{0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x1, 0x0, 0x1, 0x0, 0x80,
 	0x1, 0x0, 0x2c, 0x0, 0x0, 0x0, 0x0, 0x1, 0x0, 0x1, 0x0, 0x0, 0x2, 0x2, 0x4c,
 	0x1, 0x0, 0x3b}
 
-var geodb = func() *geoip2.Reader {
-	g, err := geoip2.FromBytes(pack.GeoDB)
+var (
+	geodb = func() *geoip2.Reader {
+		g, err := geoip2.FromBytes(pack.GeoDB)
+		if err != nil {
+			panic(err)
+		}
+		return g
+	}()
+	geoRegions = false
+)
+
+// SetGeoDB uses the MaxMind database at path instead of the embedded GeoLite2
+// Country database.
+//
+// This should be called before starting the server.
+func SetGeoDB(path string) error {
+	g, err := geoip2.Open(path)
 	if err != nil {
-		panic(err)
+		return errors.Wrap(err, "SetGeoDB")
+	}
+
+	_, err = g.City(net.ParseIP("127.0.0.1"))
+	geodb, geoRegions = g, err == nil
+	return nil
+}
+
+// geo gets the ISO-3166-1 country code, and the ISO-3166-2 region code (e.g.
+// "US-CA") and region name if the database has region information.
+func geo(ip string) (country, region, regionName string) {
+	addr := net.ParseIP(ip)
+	if geoRegions {
+		loc, _ := geodb.City(addr)
+		if loc == nil || loc.Country.IsoCode == "" {
+			return "", "", ""
+		}
+		if len(loc.Subdivisions) == 0 || loc.Subdivisions[0].IsoCode == "" {
+			return loc.Country.IsoCode, "", ""
+		}
+		return loc.Country.IsoCode, loc.Country.IsoCode + "-" + loc.Subdivisions[0].IsoCode,
+			loc.Subdivisions[0].Names["en"]
 	}
-	return g
-}()
 
-func geo(ip string) string {
-	loc, _ := geodb.Country(net.ParseIP(ip))
-	return loc.Country.IsoCode
+	loc, _ := geodb.Country(addr)
+	return loc.Country.IsoCode, "", ""
 }
 
 func (h backend) status() func(w http.ResponseWriter, r *http.Request) error {
@@ -221,12 +277,17 @@ func (h backend) count(w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
+	if _, ok := r.URL.Query()["tp"]; ok {
+		return h.countBeacon(w, r, bot)
+	}
+
 	hit := goatcounter.Hit{
 		Site:      site.ID,
 		Browser:   r.UserAgent(),
-		Location:  geo(r.RemoteAddr),
+		Language:  goatcounter.ParseAcceptLanguage(r.Header.Get("Accept-Language")),
 		CreatedAt: goatcounter.Now(),
 	}
+	hit.Location, hit.Region, hit.RegionName = geo(r.RemoteAddr)
 
 	err := formam.NewDecoder(&formam.DecoderOptions{TagName: "json"}).Decode(r.URL.Query(), &hit)
 	if err != nil {
@@ -279,6 +340,47 @@ func (h backend) count(w http.ResponseWriter, r *http.Request) error {
 	return zhttp.Bytes(w, gif)
 }
 
+// countBeacon records the beacon count.js sends when a page is hidden.
+func (h backend) countBeacon(w http.ResponseWriter, r *http.Request, bot uint8) error {
+	if isbot.Is(bot) {
+		return zhttp.Bytes(w, gif)
+	}
+
+	b := goatcounter.Beacon{
+		Site:      goatcounter.MustGetSite(r.Context()).ID,
+		CreatedAt: goatcounter.Now(),
+	}
+	err := formam.NewDecoder(&formam.DecoderOptions{TagName: "json"}).Decode(r.URL.Query(), &b)
+	if err != nil {
+		w.Header().Add("X-Goatcounter", fmt.Sprintf("error decoding parameters: %s", err))
+		w.WriteHeader(400)
+		return zhttp.Bytes(w, gif)
+	}
+
+	// Only record beacons for an existing session; this also updates the
+	// session's last_seen to include the time spent on the page.
+	var sess goatcounter.Session
+	found, err := sess.Seen(r.Context(), r.UserAgent(), zhttp.RemovePort(r.RemoteAddr))
+	if err != nil {
+		zlog.Error(err)
+	}
+	if !found {
+		w.WriteHeader(http.StatusAccepted)
+		return zhttp.Bytes(w, gif)
+	}
+	b.Session = &sess.ID
+
+	err = b.Validate(r.Context())
+	if err != nil {
+		w.Header().Add("X-Goatcounter", fmt.Sprintf("not valid: %s", err))
+		w.WriteHeader(400)
+		return zhttp.Bytes(w, gif)
+	}
+
+	goatcounter.Memstore.AppendBeacon(b)
+	return zhttp.Bytes(w, gif)
+}
+
 const day = 24 * time.Hour
 
 func (h backend) index(w http.ResponseWriter, r *http.Request) error {
@@ -302,8 +404,39 @@ func (h backend) index(w http.ResponseWriter, r *http.Request) error {
 		end = time.Date(y, m, d, 23, 59, 59, 9, now.Location()).UTC().Round(time.Second)
 	}
 
+	compare, cstart, cend, err := getCompare(r, site, start, end)
+	if err != nil {
+		zhttp.FlashError(w, err.Error())
+	}
+
+	seg, err := getSegment(r)
+	if err != nil {
+		zhttp.FlashError(w, err.Error())
+	}
+	if !seg.IsZero() {
+		if compare != "" {
+			zhttp.FlashError(w, "Comparing to another period isn't supported when filtering on a segment")
+			compare = ""
+		}
+		if err := seg.CheckPeriod(start, end); err != nil {
+			zhttp.FlashError(w, err.Error())
+			seg = goatcounter.Segment{}
+		}
+	}
+
 	filter := r.URL.Query().Get("filter")
+	if _, err := goatcounter.ParseFilter(filter); err != nil {
+		zhttp.FlashError(w, err.Error())
+		filter = ""
+	}
 	daily, forcedDaily := getDaily(r, start, end)
+	group, err := getGroup(r, start, end)
+	if err != nil {
+		zhttp.FlashError(w, err.Error())
+	}
+	if group != "" {
+		daily = true
+	}
 
 	startl := zlog.Module("dashboard")
 	l := zlog.Module("dashboard").Field("site", site.ID)
@@ -314,6 +447,7 @@ func (h backend) index(w http.ResponseWriter, r *http.Request) error {
 		total, totalDisplay             int
 		totalUnique, totalUniqueDisplay int
 		morePages                       bool
+		totalChange                     *goatcounter.Change
 		pagesErr                        error
 	)
 	wg.Add(1)
@@ -321,49 +455,263 @@ func (h backend) index(w http.ResponseWriter, r *http.Request) error {
 		defer zlog.Recover()
 		defer wg.Done()
 
+		if !seg.IsZero() {
+			total, totalUnique, totalDisplay, totalUniqueDisplay, morePages, pagesErr = pages.ListSegment(r.Context(), seg, start, end, filter, nil)
+			return
+		}
 		total, totalUnique, totalDisplay, totalUniqueDisplay, morePages, pagesErr = pages.List(r.Context(), start, end, filter, nil)
 		//l = l.Since("pages.List")
+		if pagesErr != nil || compare == "" {
+			return
+		}
+
+		var prevUnique int
+		_, prevUnique, pagesErr = pages.Compare(r.Context(), cstart, cend, filter)
+		totalChange = &goatcounter.Change{Count: totalUnique, Prev: prevUnique}
+		//l = l.Since("pages.Compare")
 	}()
 
 	var browsers goatcounter.Stats
-	totalBrowsers, err := browsers.ListBrowsers(r.Context(), start, end)
+	var totalBrowsers int
+	if seg.IsZero() {
+		totalBrowsers, err = browsers.ListBrowsers(r.Context(), start, end)
+	} else {
+		totalBrowsers, _, err = browsers.ListSegment(r.Context(), seg, start, end, goatcounter.DimensionBrowsers, 0, 0)
+	}
 	if err != nil {
 		return err
 	}
+	if compare != "" {
+		var prev goatcounter.Stats
+		_, err := prev.ListBrowsers(r.Context(), cstart, cend)
+		if err != nil {
+			return err
+		}
+		browsers.Compare(prev)
+	}
 	l = l.Since("browsers.List")
 
+	var systems goatcounter.Stats
+	var totalSystems int
+	if seg.IsZero() {
+		totalSystems, err = systems.ListSystems(r.Context(), start, end)
+	} else {
+		totalSystems, _, err = systems.ListSegment(r.Context(), seg, start, end, goatcounter.DimensionSystems, 0, 0)
+	}
+	if err != nil {
+		return err
+	}
+	l = l.Since("systems.List")
+
+	var devices goatcounter.Stats
+	var totalDevices int
+	if seg.IsZero() {
+		totalDevices, err = devices.ListDevices(r.Context(), start, end)
+	} else {
+		totalDevices, _, err = devices.ListSegment(r.Context(), seg, start, end, goatcounter.DimensionDevices, 0, 0)
+	}
+	if err != nil {
+		return err
+	}
+	l = l.Since("devices.List")
+
+	var languages goatcounter.Stats
+	var totalLanguages int
+	if seg.IsZero() {
+		totalLanguages, err = languages.ListLanguages(r.Context(), start, end)
+		if err != nil {
+			return err
+		}
+	}
+	l = l.Since("languages.List")
+
+	var campaigns goatcounter.Stats
+	var totalCampaigns int
+	if seg.IsZero() {
+		totalCampaigns, err = campaigns.ListCampaigns(r.Context(), "source", start, end)
+		if err != nil {
+			return err
+		}
+	}
+	l = l.Since("campaigns.List")
+
+	var searches goatcounter.SearchStats
+	var totalSearches int
+	if seg.IsZero() && site.Settings.SearchPage != "" {
+		totalSearches, err = searches.List(r.Context(), start, end, 10)
+		if err != nil {
+			return err
+		}
+	}
+	l = l.Since("searches.List")
+
+	var broken goatcounter.BrokenStats
+	var totalBroken int
+	if seg.IsZero() {
+		totalBroken, err = broken.List(r.Context(), start, end, 10)
+		if err != nil {
+			return err
+		}
+	}
+	l = l.Since("broken.List")
+
+	var trends goatcounter.Trends
+	err = trends.List(r.Context(), 5)
+	if err != nil {
+		return err
+	}
+	l = l.Since("trends.List")
+
+	var channels goatcounter.ChannelStats
+	var totalChannels int
+	if seg.IsZero() {
+		totalChannels, err = channels.List(r.Context(), start, end)
+		if err != nil {
+			return err
+		}
+	}
+	l = l.Since("channels.List")
+
+	var contentGroups goatcounter.ContentGroupStats
+	var totalContentGroups int
+	if seg.IsZero() {
+		totalContentGroups, err = contentGroups.List(r.Context(), start, end)
+		if err != nil {
+			return err
+		}
+	}
+	l = l.Since("contentGroups.List")
+
+	var visitors goatcounter.VisitorStats
+	var totalVisitors int
+	if seg.IsZero() {
+		totalVisitors, err = visitors.List(r.Context(), start, end)
+		if err != nil {
+			return err
+		}
+	}
+	l = l.Since("visitors.List")
+
 	var sizeStat goatcounter.Stats
-	totalSize, err := sizeStat.ListSizes(r.Context(), start, end)
+	var totalSize int
+	if seg.IsZero() {
+		totalSize, err = sizeStat.ListSizes(r.Context(), start, end)
+	} else {
+		totalSize, _, err = sizeStat.ListSegment(r.Context(), seg, start, end, goatcounter.DimensionSizes, 0, 0)
+	}
 	if err != nil {
 		return err
 	}
 	l = l.Since("sizeStat.ListSizes")
 
 	var locStat goatcounter.Stats
-	totalLoc, err := locStat.ListLocations(r.Context(), start, end)
+	var totalLoc int
+	if seg.IsZero() {
+		totalLoc, err = locStat.ListLocations(r.Context(), start, end)
+	} else {
+		totalLoc, _, err = locStat.ListSegment(r.Context(), seg, start, end, goatcounter.DimensionLocations, 0, 0)
+	}
 	if err != nil {
 		return err
 	}
+	if compare != "" {
+		var prev goatcounter.Stats
+		_, err := prev.ListLocations(r.Context(), cstart, cend)
+		if err != nil {
+			return err
+		}
+		locStat.Compare(prev)
+	}
 	showMoreLoc := len(locStat) > 0 && float32(locStat[len(locStat)-1].Count)/float32(totalLoc)*100 < 3.0
 	l = l.Since("locStat.List")
 
 	var topRefs goatcounter.Stats
-	totalTopRefs, showMoreRefs, err := topRefs.ListRefs(r.Context(), start, end, 10, 0)
+	var (
+		totalTopRefs int
+		showMoreRefs bool
+	)
+	if seg.IsZero() {
+		totalTopRefs, showMoreRefs, err = topRefs.ListRefs(r.Context(), start, end, 10, 0)
+	} else {
+		totalTopRefs, showMoreRefs, err = topRefs.ListSegment(r.Context(), seg, start, end, goatcounter.DimensionRefs, 10, 0)
+	}
 	if err != nil {
 		return err
 	}
+	if compare != "" {
+		err := topRefs.CompareRefs(r.Context(), cstart, cend)
+		if err != nil {
+			return err
+		}
+	}
 	l = l.Since("topRefs.List")
 
+	var sessionStat goatcounter.Stats
+	var sessionTime goatcounter.TimeStat
+	if seg.IsZero() {
+		sessionTime, err = sessionStat.ListSessionDurations(r.Context(), start, end)
+		if err != nil {
+			return err
+		}
+	}
+	l = l.Since("sessionStat.ListSessionDurations")
+
+	var vitals goatcounter.VitalStats
+	if seg.IsZero() {
+		err = vitals.List(r.Context(), start, end, "")
+		if err != nil {
+			return err
+		}
+	}
+	l = l.Since("vitals.List")
+
+	var heatmap goatcounter.Heatmap
+	if seg.IsZero() {
+		err = heatmap.List(r.Context(), start, end, "")
+		if err != nil {
+			return err
+		}
+	} else {
+		err = heatmap.ListSegment(r.Context(), seg, start, end)
+		if err != nil {
+			return err
+		}
+	}
+	l = l.Since("heatmap.List")
+
+	var annotations goatcounter.Annotations
+	err = annotations.ListRange(r.Context(), start, end)
+	if err != nil {
+		return err
+	}
+	for i := range channels {
+		annotations.Apply(channels[i].Stats)
+	}
+	for i := range contentGroups {
+		annotations.Apply(contentGroups[i].Stats)
+	}
+	for i := range visitors {
+		annotations.Apply(visitors[i].Stats)
+	}
+	l = l.Since("annotations.ListRange")
+
 	// Add refers.
 	sr := r.URL.Query().Get("showrefs")
 	var refs goatcounter.HitStats
 	var moreRefs bool
+	var titles goatcounter.PathTitles
 	if sr != "" {
 		moreRefs, err = refs.ListRefs(r.Context(), sr, start, end, 0)
 		if err != nil {
 			return err
 		}
 		l = l.Since("refs.ListRefs")
+
+		err = titles.List(r.Context(), sr)
+		if err != nil {
+			return err
+		}
+		l = l.Since("titles.List")
 	}
 
 	subs, err := site.ListSubs(r.Context())
@@ -383,6 +731,21 @@ func (h backend) index(w http.ResponseWriter, r *http.Request) error {
 	if pagesErr != nil {
 		return pagesErr
 	}
+	pages.Annotate(annotations)
+
+	if group != "" {
+		sunday := site.Settings.SundayStartsWeek
+		pages.Group(group, sunday)
+		for i := range channels {
+			channels[i].Stats, channels[i].Max = goatcounter.GroupStats(channels[i].Stats, group, sunday)
+		}
+		for i := range contentGroups {
+			contentGroups[i].Stats, contentGroups[i].Max = goatcounter.GroupStats(contentGroups[i].Stats, group, sunday)
+		}
+		for i := range visitors {
+			visitors[i].Stats, visitors[i].Max = goatcounter.GroupStats(visitors[i].Stats, group, sunday)
+		}
+	}
 
 	l = startl.Since("get data")
 
@@ -395,33 +758,69 @@ func (h backend) index(w http.ResponseWriter, r *http.Request) error {
 		SelectedPeriod     string
 		PeriodStart        time.Time
 		PeriodEnd          time.Time
+		Compare            string
+		CompareStart       time.Time
+		CompareEnd         time.Time
 		Filter             string
+		Segment            goatcounter.Segment
 		Pages              goatcounter.HitStats
 		MorePages          bool
 		Refs               goatcounter.HitStats
 		MoreRefs           bool
+		Titles             goatcounter.PathTitles
 		TotalHits          int
 		TotalUniqueHits    int
 		TotalHitsDisplay   int
 		TotalUniqueDisplay int
+		TotalChange        *goatcounter.Change
 		Browsers           goatcounter.Stats
 		TotalBrowsers      int
+		Systems            goatcounter.Stats
+		TotalSystems       int
+		Devices            goatcounter.Stats
+		TotalDevices       int
+		Languages          goatcounter.Stats
+		TotalLanguages     int
 		SubSites           []string
 		SizeStat           goatcounter.Stats
 		TotalSize          int
 		LocationStat       goatcounter.Stats
 		TotalLocation      int
 		ShowMoreLocations  bool
+		GeoRegions         bool
 		TopRefs            goatcounter.Stats
 		TotalTopRefs       int
 		ShowMoreRefs       bool
+		Campaigns          goatcounter.Stats
+		TotalCampaigns     int
+		Searches           goatcounter.SearchStats
+		TotalSearches      int
+		Broken             goatcounter.BrokenStats
+		TotalBroken        int
+		Trends             goatcounter.Trends
+		Channels           goatcounter.ChannelStats
+		TotalChannels      int
+		ContentGroups      goatcounter.ContentGroupStats
+		TotalContentGroups int
+		Visitors           goatcounter.VisitorStats
+		TotalVisitors      int
+		SessionStat        goatcounter.Stats
+		SessionTime        goatcounter.TimeStat
+		Vitals             goatcounter.VitalStats
+		Heatmap            goatcounter.Heatmap
 		Daily              bool
 		ForcedDaily        bool
+		Group              string
+		GroupParam         string
 	}{newGlobals(w, r), cd, sr, r.URL.Query().Get("hl-period"), start, end,
-		filter, pages, morePages, refs, moreRefs, total, totalUnique,
-		totalDisplay, totalUniqueDisplay, browsers, totalBrowsers, subs,
-		sizeStat, totalSize, locStat, totalLoc, showMoreLoc, topRefs,
-		totalTopRefs, showMoreRefs, daily, forcedDaily})
+		compare, cstart, cend, filter, seg, pages, morePages, refs, moreRefs, titles, total,
+		totalUnique, totalDisplay, totalUniqueDisplay, totalChange, browsers, totalBrowsers, systems,
+		totalSystems, devices, totalDevices, languages, totalLanguages, subs,
+		sizeStat, totalSize, locStat, totalLoc, showMoreLoc, geoRegions,
+		topRefs, totalTopRefs, showMoreRefs, campaigns, totalCampaigns, searches, totalSearches,
+		broken, totalBroken, trends,
+		channels, totalChannels, contentGroups, totalContentGroups, visitors, totalVisitors, sessionStat, sessionTime, vitals, heatmap, daily, forcedDaily, group,
+		r.URL.Query().Get("group")})
 	l.Since("zhttp.Template")
 	return x
 }
@@ -432,15 +831,28 @@ func (h backend) topRefs(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	var refs goatcounter.Stats
-	o, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
-	total, hasMore, err := refs.ListRefs(r.Context(), start, end, 10, int(o))
+	seg, err := getSegment(r)
+	if err != nil {
+		return err
+	}
+
+	var (
+		refs    goatcounter.Stats
+		total   int
+		hasMore bool
+		o, _    = strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	)
+	if seg.IsZero() {
+		total, hasMore, err = refs.ListRefs(r.Context(), start, end, 10, int(o))
+	} else {
+		total, hasMore, err = refs.ListSegment(r.Context(), seg, start, end, goatcounter.DimensionRefs, 10, int(o))
+	}
 	if err != nil {
 		return err
 	}
 
 	t, _ := strconv.ParseInt(r.URL.Query().Get("total"), 10, 64)
-	tpl := goatcounter.HorizontalChart(r.Context(), refs, total, int(t), 0, true, false)
+	tpl := goatcounter.HorizontalChart(r.Context(), refs, total, int(t), 0, seg.IsZero(), false)
 
 	return zhttp.JSON(w, map[string]interface{}{
 		"html":     string(tpl),
@@ -482,15 +894,35 @@ func (h backend) refs(w http.ResponseWriter, r *http.Request) error {
 		offset = int(o2)
 	}
 
+	path := r.URL.Query().Get("showrefs")
 	var refs goatcounter.HitStats
-	more, err := refs.ListRefs(r.Context(), r.URL.Query().Get("showrefs"), start, end, offset)
+	more, err := refs.ListRefs(r.Context(), path, start, end, offset)
 	if err != nil {
 		return err
 	}
 
+	// Only show the titles and page speed on the first page; "load more" only
+	// adds rows.
+	var (
+		titles goatcounter.PathTitles
+		vitals goatcounter.VitalStats
+	)
+	if offset == 0 {
+		err = titles.List(r.Context(), path)
+		if err != nil {
+			return err
+		}
+		err = vitals.List(r.Context(), start, end, path)
+		if err != nil {
+			return err
+		}
+	}
+
 	tpl, err := zhttp.ExecuteTpl("_backend_refs.gohtml", map[string]interface{}{
-		"Refs": refs,
-		"Site": goatcounter.MustGetSite(r.Context()),
+		"Refs":   refs,
+		"Titles": titles,
+		"Vitals": vitals,
+		"Site":   goatcounter.MustGetSite(r.Context()),
 	})
 	if err != nil {
 		return err
@@ -522,110 +954,313 @@ func (h backend) browsers(w http.ResponseWriter, r *http.Request) error {
 	})
 }
 
-func (h backend) sizes(w http.ResponseWriter, r *http.Request) error {
+func (h backend) systems(w http.ResponseWriter, r *http.Request) error {
 	start, end, err := getPeriod(w, r, goatcounter.MustGetSite(r.Context()))
 	if err != nil {
 		return err
 	}
 
-	var sizeStat goatcounter.Stats
-	total, err := sizeStat.ListSize(r.Context(), r.URL.Query().Get("name"), start, end)
+	var systems goatcounter.Stats
+	total, err := systems.ListSystem(r.Context(), r.URL.Query().Get("name"), start, end)
 	if err != nil {
 		return err
 	}
 
 	t, _ := strconv.ParseInt(r.URL.Query().Get("total"), 10, 64)
-	tpl := goatcounter.HorizontalChart(r.Context(), sizeStat, total, int(t), .2, true, false)
+	tpl := goatcounter.HorizontalChart(r.Context(), systems, total, int(t), .2, true, false)
 
 	return zhttp.JSON(w, map[string]interface{}{
 		"html": string(tpl),
 	})
 }
 
-func (h backend) locations(w http.ResponseWriter, r *http.Request) error {
+func (h backend) devices(w http.ResponseWriter, r *http.Request) error {
 	start, end, err := getPeriod(w, r, goatcounter.MustGetSite(r.Context()))
 	if err != nil {
 		return err
 	}
 
-	var locStat goatcounter.Stats
-	total, err := locStat.ListLocations(r.Context(), start, end)
+	var devices goatcounter.Stats
+	total, err := devices.ListDevice(r.Context(), r.URL.Query().Get("name"), start, end)
 	if err != nil {
 		return err
 	}
 
-	tpl := goatcounter.HorizontalChart(r.Context(), locStat, total, total, 0, false, true)
+	t, _ := strconv.ParseInt(r.URL.Query().Get("total"), 10, 64)
+	tpl := goatcounter.HorizontalChart(r.Context(), devices, total, int(t), .2, true, false)
+
 	return zhttp.JSON(w, map[string]interface{}{
 		"html": string(tpl),
 	})
 }
 
-func (h backend) pages(w http.ResponseWriter, r *http.Request) error {
-	site := goatcounter.MustGetSite(r.Context())
-
-	start, end, err := getPeriod(w, r, site)
+func (h backend) languages(w http.ResponseWriter, r *http.Request) error {
+	start, end, err := getPeriod(w, r, goatcounter.MustGetSite(r.Context()))
 	if err != nil {
 		return err
 	}
-	daily, forcedDaily := getDaily(r, start, end)
 
-	var pages goatcounter.HitStats
-	totalHits, totalUnique, totalDisplay, totalUniqueDisplay, more, err := pages.List(r.Context(), start, end,
-		r.URL.Query().Get("filter"), strings.Split(r.URL.Query().Get("exclude"), ","))
+	var languages goatcounter.Stats
+	total, err := languages.ListLanguage(r.Context(), r.URL.Query().Get("name"), start, end)
 	if err != nil {
 		return err
 	}
 
-	tpl, err := zhttp.ExecuteTpl("_backend_pages.gohtml", struct {
-		Context     context.Context
-		Pages       goatcounter.HitStats
-		Site        *goatcounter.Site
-		PeriodStart time.Time
-		PeriodEnd   time.Time
-		Daily       bool
-		ForcedDaily bool
+	t, _ := strconv.ParseInt(r.URL.Query().Get("total"), 10, 64)
+	tpl := goatcounter.HorizontalChart(r.Context(), languages, total, int(t), .2, true, false)
 
-		// Dummy values so template won't error out.
-		Refs     bool
-		ShowRefs string
-	}{r.Context(), pages, goatcounter.MustGetSite(r.Context()), start, end,
-		daily, forcedDaily, false, ""})
+	return zhttp.JSON(w, map[string]interface{}{
+		"html": string(tpl),
+	})
+}
+
+func (h backend) sizes(w http.ResponseWriter, r *http.Request) error {
+	start, end, err := getPeriod(w, r, goatcounter.MustGetSite(r.Context()))
 	if err != nil {
 		return err
 	}
 
-	paths := make([]string, len(pages))
-	for i := range pages {
-		paths[i] = pages[i].Path
+	var sizeStat goatcounter.Stats
+	total, err := sizeStat.ListSize(r.Context(), r.URL.Query().Get("name"), start, end)
+	if err != nil {
+		return err
 	}
 
+	t, _ := strconv.ParseInt(r.URL.Query().Get("total"), 10, 64)
+	tpl := goatcounter.HorizontalChart(r.Context(), sizeStat, total, int(t), .2, true, false)
+
 	return zhttp.JSON(w, map[string]interface{}{
-		"rows":                 string(tpl),
-		"paths":                paths,
-		"total_hits":           totalHits,
-		"total_display":        totalDisplay,
-		"total_unique":         totalUnique,
-		"total_unique_display": totalUniqueDisplay,
-		"more":                 more,
+		"html": string(tpl),
 	})
 }
 
-func (h backend) updates(w http.ResponseWriter, r *http.Request) error {
-	u := goatcounter.GetUser(r.Context())
+func (h backend) locations(w http.ResponseWriter, r *http.Request) error {
+	start, end, err := getPeriod(w, r, goatcounter.MustGetSite(r.Context()))
+	if err != nil {
+		return err
+	}
 
-	var up goatcounter.Updates
-	err := up.List(r.Context(), u.SeenUpdatesAt)
+	seg, err := getSegment(r)
 	if err != nil {
 		return err
 	}
 
-	seenat := u.SeenUpdatesAt
-	err = u.SeenUpdates(r.Context())
+	var (
+		locStat goatcounter.Stats
+		total   int
+	)
+	if seg.IsZero() {
+		total, err = locStat.ListLocations(r.Context(), start, end)
+	} else {
+		total, _, err = locStat.ListSegment(r.Context(), seg, start, end, goatcounter.DimensionLocations, 0, 0)
+	}
 	if err != nil {
-		zlog.Field("user", fmt.Sprintf("%d", u.ID)).Error(err)
+		return err
 	}
 
-	return zhttp.Template(w, "backend_updates.gohtml", struct {
+	tpl := goatcounter.HorizontalChart(r.Context(), locStat, total, total, 0, geoRegions && seg.IsZero(), true)
+	return zhttp.JSON(w, map[string]interface{}{
+		"html": string(tpl),
+	})
+}
+
+func (h backend) regions(w http.ResponseWriter, r *http.Request) error {
+	start, end, err := getPeriod(w, r, goatcounter.MustGetSite(r.Context()))
+	if err != nil {
+		return err
+	}
+
+	var regions goatcounter.Stats
+	total, err := regions.ListLocation(r.Context(), r.URL.Query().Get("name"), start, end)
+	if err != nil {
+		return err
+	}
+
+	t, _ := strconv.ParseInt(r.URL.Query().Get("total"), 10, 64)
+	tpl := goatcounter.HorizontalChart(r.Context(), regions, total, int(t), .2, false, false)
+
+	return zhttp.JSON(w, map[string]interface{}{
+		"html": string(tpl),
+	})
+}
+
+func (h backend) campaigns(w http.ResponseWriter, r *http.Request) error {
+	start, end, err := getPeriod(w, r, goatcounter.MustGetSite(r.Context()))
+	if err != nil {
+		return err
+	}
+
+	var campaigns goatcounter.Stats
+	total, err := campaigns.ListCampaigns(r.Context(), r.URL.Query().Get("pivot"), start, end)
+	if err != nil {
+		return err
+	}
+
+	tpl := goatcounter.HorizontalChart(r.Context(), campaigns, total, 0, 0, true, true)
+
+	return zhttp.JSON(w, map[string]interface{}{
+		"html": string(tpl),
+	})
+}
+
+func (h backend) campaign(w http.ResponseWriter, r *http.Request) error {
+	start, end, err := getPeriod(w, r, goatcounter.MustGetSite(r.Context()))
+	if err != nil {
+		return err
+	}
+
+	var campaigns goatcounter.Stats
+	total, err := campaigns.ListCampaign(r.Context(), r.URL.Query().Get("pivot"),
+		r.URL.Query().Get("name"), start, end)
+	if err != nil {
+		return err
+	}
+
+	t, _ := strconv.ParseInt(r.URL.Query().Get("total"), 10, 64)
+	tpl := goatcounter.HorizontalChart(r.Context(), campaigns, total, int(t), .2, false, false)
+
+	return zhttp.JSON(w, map[string]interface{}{
+		"html": string(tpl),
+	})
+}
+
+func (h backend) pages(w http.ResponseWriter, r *http.Request) error {
+	site := goatcounter.MustGetSite(r.Context())
+
+	start, end, err := getPeriod(w, r, site)
+	if err != nil {
+		return err
+	}
+	daily, forcedDaily := getDaily(r, start, end)
+	group, err := getGroup(r, start, end)
+	if err != nil {
+		return err
+	}
+	if group != "" {
+		daily = true
+	}
+	compare, cstart, cend, err := getCompare(r, site, start, end)
+	if err != nil {
+		return err
+	}
+	seg, err := getSegment(r)
+	if err != nil {
+		return err
+	}
+
+	var (
+		pages                                                    goatcounter.HitStats
+		totalHits, totalUnique, totalDisplay, totalUniqueDisplay int
+		more                                                     bool
+		filter                                                   = r.URL.Query().Get("filter")
+		exclude                                                  = strings.Split(r.URL.Query().Get("exclude"), ",")
+	)
+	if seg.IsZero() {
+		totalHits, totalUnique, totalDisplay, totalUniqueDisplay, more, err = pages.List(r.Context(), start, end, filter, exclude)
+	} else {
+		totalHits, totalUnique, totalDisplay, totalUniqueDisplay, more, err = pages.ListSegment(r.Context(), seg, start, end, filter, exclude)
+	}
+	if err != nil {
+		return err
+	}
+	var totalChange *goatcounter.Change
+	if compare != "" && seg.IsZero() {
+		_, prevUnique, err := pages.Compare(r.Context(), cstart, cend, r.URL.Query().Get("filter"))
+		if err != nil {
+			return err
+		}
+		totalChange = &goatcounter.Change{Count: totalUnique, Prev: prevUnique}
+	}
+	var annotations goatcounter.Annotations
+	err = annotations.ListRange(r.Context(), start, end)
+	if err != nil {
+		return err
+	}
+	pages.Annotate(annotations)
+	if group != "" {
+		pages.Group(group, site.Settings.SundayStartsWeek)
+	}
+
+	tpl, err := zhttp.ExecuteTpl("_backend_pages.gohtml", struct {
+		Context     context.Context
+		Pages       goatcounter.HitStats
+		Site        *goatcounter.Site
+		PeriodStart time.Time
+		PeriodEnd   time.Time
+		Daily       bool
+		ForcedDaily bool
+
+		// Dummy values so template won't error out.
+		Refs     bool
+		ShowRefs string
+	}{r.Context(), pages, goatcounter.MustGetSite(r.Context()), start, end,
+		daily, forcedDaily, false, ""})
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, len(pages))
+	for i := range pages {
+		paths[i] = pages[i].Path
+	}
+
+	j := map[string]interface{}{
+		"rows":                 string(tpl),
+		"paths":                paths,
+		"total_hits":           totalHits,
+		"total_display":        totalDisplay,
+		"total_unique":         totalUnique,
+		"total_unique_display": totalUniqueDisplay,
+		"more":                 more,
+		"annotations":          annotations,
+	}
+	if totalChange != nil {
+		j["total_change"] = totalChange.Percentage()
+		j["total_change_class"] = totalChange.Class()
+
+		// Change in visits for every path, in the same order as paths.
+		changes := make([]*goatcounter.Change, len(pages))
+		for i := range pages {
+			changes[i] = pages[i].Change
+		}
+		j["changes"] = changes
+	}
+	return zhttp.JSON(w, j)
+}
+
+func (h backend) heatmap(w http.ResponseWriter, r *http.Request) error {
+	start, end, err := getPeriod(w, r, goatcounter.MustGetSite(r.Context()))
+	if err != nil {
+		return err
+	}
+
+	var heatmap goatcounter.Heatmap
+	err = heatmap.List(r.Context(), start, end, r.URL.Query().Get("path"))
+	if err != nil {
+		return err
+	}
+
+	return zhttp.JSON(w, map[string]interface{}{
+		"html": string(goatcounter.HeatmapChart(r.Context(), heatmap)),
+	})
+}
+
+func (h backend) updates(w http.ResponseWriter, r *http.Request) error {
+	u := goatcounter.GetUser(r.Context())
+
+	var up goatcounter.Updates
+	err := up.List(r.Context(), u.SeenUpdatesAt)
+	if err != nil {
+		return err
+	}
+
+	seenat := u.SeenUpdatesAt
+	err = u.SeenUpdates(r.Context())
+	if err != nil {
+		zlog.Field("user", fmt.Sprintf("%d", u.ID)).Error(err)
+	}
+
+	return zhttp.Template(w, "backend_updates.gohtml", struct {
 		Globals
 		Updates goatcounter.Updates
 		SeenAt  time.Time
@@ -643,6 +1278,40 @@ func (h backend) settingsTpl(w http.ResponseWriter, r *http.Request, verr *zvali
 		return err
 	}
 
+	var annotations goatcounter.Annotations
+	err = annotations.List(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var experiments goatcounter.Experiments
+	err = experiments.List(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var alerts goatcounter.Alerts
+	err = alerts.List(r.Context())
+	if err != nil {
+		return err
+	}
+	var alertHistory goatcounter.AlertHistory
+	err = alertHistory.List(r.Context(), 20)
+	if err != nil {
+		return err
+	}
+
+	var webhooks goatcounter.Webhooks
+	err = webhooks.List(r.Context())
+	if err != nil {
+		return err
+	}
+	var deliveries goatcounter.WebhookDeliveries
+	err = deliveries.List(r.Context(), 20)
+	if err != nil {
+		return err
+	}
+
 	del := map[string]interface{}{
 		"ContactMe": r.URL.Query().Get("contact_me") == "true",
 		"Reason":    r.URL.Query().Get("reason"),
@@ -650,11 +1319,20 @@ func (h backend) settingsTpl(w http.ResponseWriter, r *http.Request, verr *zvali
 
 	return zhttp.Template(w, "backend_settings.gohtml", struct {
 		Globals
-		SubSites  goatcounter.Sites
-		Validate  *zvalidate.Validator
-		Timezones []*tz.Zone
-		Delete    map[string]interface{}
-	}{newGlobals(w, r), sites, verr, tz.Zones, del})
+		SubSites      goatcounter.Sites
+		Annotations   goatcounter.Annotations
+		Experiments   goatcounter.Experiments
+		Alerts        goatcounter.Alerts
+		AlertKinds    [][2]string
+		AlertHistory  goatcounter.AlertHistory
+		Webhooks      goatcounter.Webhooks
+		WebhookEvents [][2]string
+		Deliveries    goatcounter.WebhookDeliveries
+		Validate      *zvalidate.Validator
+		Timezones     []*tz.Zone
+		Delete        map[string]interface{}
+	}{newGlobals(w, r), sites, annotations, experiments, alerts, goatcounter.AlertKinds,
+		alertHistory, webhooks, goatcounter.WebhookEvents, deliveries, verr, tz.Zones, del})
 }
 
 func (h backend) code(w http.ResponseWriter, r *http.Request) error {
@@ -730,6 +1408,7 @@ func (h backend) saveSettings(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	site := goatcounter.MustGetSite(txctx)
+	oldSettings := site.Settings.String()
 	site.Settings = args.Settings
 	site.LinkDomain = args.LinkDomain
 	if args.Cname != "" && !site.PlanCustomDomain(txctx) {
@@ -768,6 +1447,15 @@ func (h backend) saveSettings(w http.ResponseWriter, r *http.Request) error {
 		sendEmailVerify(site, user)
 	}
 
+	// Compare the JSON, as that's what's stored and sent; this also takes
+	// the defaults set in site.Update() in to account.
+	if site.Settings.String() != oldSettings {
+		err = goatcounter.TriggerWebhooks(r.Context(), goatcounter.WebhookSettings, site.Settings)
+		if err != nil {
+			zlog.Field("site", site.ID).Error(err)
+		}
+	}
+
 	if makecert {
 		go func() {
 			defer zlog.Recover()
@@ -903,6 +1591,311 @@ func (h backend) addSubsite(w http.ResponseWriter, r *http.Request) error {
 	return zhttp.SeeOther(w, "/settings#tab-additional-sites")
 }
 
+func (h backend) annotations(w http.ResponseWriter, r *http.Request) error {
+	var annotations goatcounter.Annotations
+	err := annotations.List(r.Context())
+	if err != nil {
+		return err
+	}
+	return zhttp.JSON(w, annotations)
+}
+
+func (h backend) addAnnotation(w http.ResponseWriter, r *http.Request) error {
+	args := struct {
+		Day  string `json:"day"`
+		Text string `json:"text"`
+		URL  string `json:"url"`
+	}{}
+	ct, err := zhttp.Decode(r, &args)
+	if err != nil {
+		return err
+	}
+
+	a := goatcounter.Annotation{Text: strings.TrimSpace(args.Text), URL: &args.URL}
+	a.Day, err = time.Parse("2006-01-02", strings.TrimSpace(args.Day))
+	if err != nil {
+		err = guru.Errorf(400, "invalid date: %q", args.Day)
+	} else {
+		err = a.Insert(r.Context())
+	}
+
+	if ct == zhttp.ContentJSON {
+		if err != nil {
+			return err
+		}
+		return zhttp.JSON(w, a)
+	}
+	if err != nil {
+		zhttp.FlashError(w, err.Error())
+		return zhttp.SeeOther(w, "/settings#tab-annotations")
+	}
+	zhttp.Flash(w, "Annotation ‘%s’ added.", a.Text)
+	return zhttp.SeeOther(w, "/settings#tab-annotations")
+}
+
+func (h backend) deleteAnnotation(w http.ResponseWriter, r *http.Request) error {
+	v := zvalidate.New()
+	id := v.Integer("id", chi.URLParam(r, "id"))
+	if v.HasErrors() {
+		return v
+	}
+
+	var a goatcounter.Annotation
+	err := a.Delete(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	zhttp.Flash(w, "Annotation removed.")
+	return zhttp.SeeOther(w, "/settings#tab-annotations")
+}
+
+func (h backend) experiment(w http.ResponseWriter, r *http.Request) error {
+	v := zvalidate.New()
+	id := v.Integer("id", chi.URLParam(r, "id"))
+	if v.HasErrors() {
+		return v
+	}
+
+	var e goatcounter.Experiment
+	err := e.ByID(r.Context(), id)
+	if err != nil {
+		if zdb.ErrNoRows(err) {
+			return guru.New(404, "no such experiment")
+		}
+		return err
+	}
+
+	var results goatcounter.ExperimentResults
+	err = results.List(r.Context(), e)
+	if err != nil {
+		return err
+	}
+
+	return zhttp.Template(w, "backend_experiment.gohtml", struct {
+		Globals
+		Experiment goatcounter.Experiment
+		Results    goatcounter.ExperimentResults
+	}{newGlobals(w, r), e, results})
+}
+
+func (h backend) addExperiment(w http.ResponseWriter, r *http.Request) error {
+	args := struct {
+		Name      string `json:"name"`
+		Variants  string `json:"variants"`
+		Goal      string `json:"goal"`
+		GoalEvent bool   `json:"goal_event"`
+	}{}
+	ct, err := zhttp.Decode(r, &args)
+	if err != nil {
+		return err
+	}
+
+	e := goatcounter.Experiment{
+		Name:      args.Name,
+		Variants:  strings.Split(args.Variants, ","),
+		Goal:      args.Goal,
+		GoalEvent: zdb.Bool(args.GoalEvent),
+	}
+	err = e.Insert(r.Context())
+	if ct == zhttp.ContentJSON {
+		if err != nil {
+			return err
+		}
+		return zhttp.JSON(w, e)
+	}
+	if err != nil {
+		zhttp.FlashError(w, err.Error())
+		return zhttp.SeeOther(w, "/settings#tab-experiments")
+	}
+
+	zhttp.Flash(w, "Experiment ‘%s’ added.", e.Name)
+	return zhttp.SeeOther(w, "/settings#tab-experiments")
+}
+
+func (h backend) deleteExperiment(w http.ResponseWriter, r *http.Request) error {
+	v := zvalidate.New()
+	id := v.Integer("id", chi.URLParam(r, "id"))
+	if v.HasErrors() {
+		return v
+	}
+
+	var e goatcounter.Experiment
+	err := e.Delete(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	zhttp.Flash(w, "Experiment removed.")
+	return zhttp.SeeOther(w, "/settings#tab-experiments")
+}
+
+func (h backend) sitemap(w http.ResponseWriter, r *http.Request) error {
+	site := goatcounter.MustGetSite(r.Context())
+	args := struct {
+		PeriodStart string `json:"period-start"`
+		PeriodEnd   string `json:"period-end"`
+		URL         string `json:"url"`
+		Threshold   int    `json:"threshold"`
+	}{}
+	_, err := zhttp.Decode(r, &args)
+	if err != nil {
+		return err
+	}
+	if args.PeriodStart == "" || args.PeriodEnd == "" {
+		now := goatcounter.Now().In(site.Settings.Timezone.Loc())
+		args.PeriodStart = now.Add(-30 * 24 * time.Hour).Format("2006-01-02")
+		args.PeriodEnd = now.Format("2006-01-02")
+	}
+
+	tplArgs := struct {
+		Globals
+		PeriodStart string
+		PeriodEnd   string
+		URL         string
+		Threshold   int
+		Report      *goatcounter.SitemapReport
+		Error       string
+		Private     bool
+	}{newGlobals(w, r), args.PeriodStart, args.PeriodEnd, args.URL, args.Threshold, nil, "", cfg.SitemapPrivate}
+	if r.Method != http.MethodPost {
+		return zhttp.Template(w, "backend_sitemap.gohtml", tplArgs)
+	}
+
+	err = func() error {
+		start, err := time.ParseInLocation("2006-01-02", args.PeriodStart, site.Settings.Timezone.Loc())
+		if err != nil {
+			return guru.Errorf(400, "Invalid start date: %q", args.PeriodStart)
+		}
+		end, err := time.ParseInLocation("2006-01-02 15:04:05", args.PeriodEnd+" 23:59:59", site.Settings.Timezone.Loc())
+		if err != nil {
+			return guru.Errorf(400, "Invalid end date: %q", args.PeriodEnd)
+		}
+
+		var paths []string
+		file, _, err := r.FormFile("sitemap")
+		switch {
+		case err == nil:
+			defer file.Close()
+			paths, err = goatcounter.ParseSitemap(file)
+		case args.URL != "":
+			paths, err = goatcounter.FetchSitemap(r.Context(), args.URL)
+		default:
+			err = guru.New(400, "upload a sitemap or enter the URL to one")
+		}
+		if err != nil {
+			return err
+		}
+
+		var report goatcounter.SitemapReport
+		err = report.Compare(r.Context(), paths, start.UTC(), end.UTC(), args.Threshold)
+		tplArgs.Report = &report
+		return err
+	}()
+	if err != nil {
+		if c := guru.Code(err); c < 400 || c > 499 {
+			return err
+		}
+		tplArgs.Error = err.Error()
+	}
+	return zhttp.Template(w, "backend_sitemap.gohtml", tplArgs)
+}
+
+func (h backend) addAlert(w http.ResponseWriter, r *http.Request) error {
+	args := struct {
+		Kind      string `json:"kind"`
+		Threshold int    `json:"threshold"`
+		Goal      string `json:"goal"`
+		Cooldown  int    `json:"cooldown"`
+	}{}
+	ct, err := zhttp.Decode(r, &args)
+	if err != nil {
+		return err
+	}
+
+	a := goatcounter.Alert{
+		Kind:      args.Kind,
+		Threshold: args.Threshold,
+		Goal:      args.Goal,
+		Cooldown:  args.Cooldown,
+	}
+	err = a.Insert(r.Context())
+	if ct == zhttp.ContentJSON {
+		if err != nil {
+			return err
+		}
+		return zhttp.JSON(w, a)
+	}
+	if err != nil {
+		zhttp.FlashError(w, err.Error())
+		return zhttp.SeeOther(w, "/settings#tab-alerts")
+	}
+
+	zhttp.Flash(w, "Alert added.")
+	return zhttp.SeeOther(w, "/settings#tab-alerts")
+}
+
+func (h backend) deleteAlert(w http.ResponseWriter, r *http.Request) error {
+	v := zvalidate.New()
+	id := v.Integer("id", chi.URLParam(r, "id"))
+	if v.HasErrors() {
+		return v
+	}
+
+	var a goatcounter.Alert
+	err := a.Delete(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	zhttp.Flash(w, "Alert removed.")
+	return zhttp.SeeOther(w, "/settings#tab-alerts")
+}
+
+func (h backend) addWebhook(w http.ResponseWriter, r *http.Request) error {
+	args := struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}{}
+	ct, err := zhttp.Decode(r, &args)
+	if err != nil {
+		return err
+	}
+
+	hook := goatcounter.Webhook{URL: args.URL, Events: args.Events}
+	err = hook.Insert(r.Context())
+	if ct == zhttp.ContentJSON {
+		if err != nil {
+			return err
+		}
+		return zhttp.JSON(w, hook)
+	}
+	if err != nil {
+		zhttp.FlashError(w, err.Error())
+		return zhttp.SeeOther(w, "/settings#tab-webhooks")
+	}
+
+	zhttp.Flash(w, "Webhook added.")
+	return zhttp.SeeOther(w, "/settings#tab-webhooks")
+}
+
+func (h backend) deleteWebhook(w http.ResponseWriter, r *http.Request) error {
+	v := zvalidate.New()
+	id := v.Integer("id", chi.URLParam(r, "id"))
+	if v.HasErrors() {
+		return v
+	}
+
+	var hook goatcounter.Webhook
+	err := hook.Delete(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	zhttp.Flash(w, "Webhook removed.")
+	return zhttp.SeeOther(w, "/settings#tab-webhooks")
+}
+
 func (h backend) purgeConfirm(w http.ResponseWriter, r *http.Request) error {
 	path := strings.TrimSpace(r.URL.Query().Get("path"))
 	var list goatcounter.HitStats
@@ -1051,3 +2044,70 @@ func getDaily(r *http.Request, start, end time.Time) (daily bool, forced bool) {
 	d := strings.ToLower(r.URL.Query().Get("daily"))
 	return d == "on" || d == "true", false
 }
+
+// getGroup gets how to group the charts; this is empty for the hourly or daily
+// view.
+func getGroup(r *http.Request, start, end time.Time) (string, error) {
+	switch g := r.URL.Query().Get("group"); g {
+	case "":
+		if end.Sub(start).Hours()/24 >= WeeklyView {
+			return goatcounter.GroupWeek, nil
+		}
+		return "", nil
+	case "day":
+		return "", nil
+	case goatcounter.GroupWeek, goatcounter.GroupMonth:
+		return g, nil
+	default:
+		return "", guru.Errorf(400, "Invalid group: %q", g)
+	}
+}
+
+// getCompare gets the period to compare the dashboard to; the mode is empty if
+// there is nothing to compare to.
+func getCompare(r *http.Request, site *goatcounter.Site, start, end time.Time) (string, time.Time, time.Time, error) {
+	mode := r.URL.Query().Get("compare")
+	switch mode {
+	case "":
+		return "", time.Time{}, time.Time{}, nil
+	case goatcounter.ComparePrevious, goatcounter.CompareYear:
+		cstart, cend := goatcounter.ComparePeriod(mode, start, end)
+		return mode, cstart, cend, nil
+	case goatcounter.CompareCustom:
+		// Don't need to check the site creation date like getPeriod(), as
+		// there just won't be any data.
+		d := r.URL.Query().Get("compare-start")
+		cstart, err := time.ParseInLocation("2006-01-02", d, site.Settings.Timezone.Loc())
+		if err != nil {
+			return "", time.Time{}, time.Time{}, guru.Errorf(400, "Invalid compare start date: %q", d)
+		}
+		d = r.URL.Query().Get("compare-end")
+		cend, err := time.ParseInLocation("2006-01-02 15:04:05", d+" 23:59:59", site.Settings.Timezone.Loc())
+		if err != nil {
+			return "", time.Time{}, time.Time{}, guru.Errorf(400, "Invalid compare end date: %q", d)
+		}
+		if cend.Before(cstart) {
+			return "", time.Time{}, time.Time{}, guru.New(400, "Compare end date is before the start date")
+		}
+		return mode, cstart.UTC(), cend.UTC(), nil
+	default:
+		return "", time.Time{}, time.Time{}, guru.Errorf(400, "Invalid compare mode: %q", mode)
+	}
+}
+
+func getSegment(r *http.Request) (goatcounter.Segment, error) {
+	q := r.URL.Query()
+	seg := goatcounter.Segment{
+		Path:     strings.TrimSpace(q.Get("segment-path")),
+		Ref:      strings.TrimSpace(q.Get("segment-ref")),
+		Browser:  strings.TrimSpace(q.Get("segment-browser")),
+		Location: strings.TrimSpace(q.Get("segment-location")),
+		Size:     q.Get("segment-size"),
+		Event:    q.Get("segment-event"),
+	}
+	err := seg.Validate()
+	if err != nil {
+		return goatcounter.Segment{}, guru.New(400, strings.TrimSpace(err.Error()))
+	}
+	return seg, nil
+}
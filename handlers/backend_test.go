@@ -5,8 +5,10 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -24,6 +26,7 @@ import (
 	"zgo.at/goatcounter/gctest"
 	"zgo.at/isbot"
 	"zgo.at/tz"
+	"zgo.at/utils/jsonutil"
 	"zgo.at/utils/stringutil"
 	"zgo.at/zdb"
 	"zgo.at/zhttp"
@@ -65,12 +68,14 @@ func TestBackendCount(t *testing.T) {
 			Path:      "/foo.html",
 			Ref:       "example.com",
 			RefScheme: ztest.SP("h"),
+			Channel:   "other",
 		}},
 
 		{"str ref", url.Values{"p": {"/foo.html"}, "r": {"example"}}, nil, 200, goatcounter.Hit{
 			Path:      "/foo.html",
 			Ref:       "example",
 			RefScheme: ztest.SP("o"),
+			Channel:   "other",
 		}},
 
 		{"ref params", url.Values{"p": {"/foo.html"}, "r": {"https://example.com?p=x"}}, nil, 200, goatcounter.Hit{
@@ -78,6 +83,7 @@ func TestBackendCount(t *testing.T) {
 			Ref:       "example.com",
 			RefParams: ztest.SP("p=x"),
 			RefScheme: ztest.SP("h"),
+			Channel:   "other",
 		}},
 
 		{"full", url.Values{"p": {"/foo.html"}, "t": {"XX"}, "r": {"https://example.com?p=x"}, "s": {"40,50,1"}}, nil, 200, goatcounter.Hit{
@@ -87,17 +93,31 @@ func TestBackendCount(t *testing.T) {
 			RefParams: ztest.SP("p=x"),
 			RefScheme: ztest.SP("h"),
 			Size:      zdb.Floats{40, 50, 1},
+			Channel:   "other",
 		}},
 
 		{"campaign", url.Values{"p": {"/foo.html"}, "q": {"ref=XXX"}}, nil, 200, goatcounter.Hit{
 			Path:      "/foo.html",
 			Ref:       "XXX",
 			RefScheme: ztest.SP("c"),
+			Channel:   "campaign",
 		}},
 		{"campaign_override", url.Values{"p": {"/foo.html?ref=AAA"}, "q": {"ref=XXX"}}, nil, 200, goatcounter.Hit{
 			Path:      "/foo.html",
 			Ref:       "XXX",
 			RefScheme: ztest.SP("c"),
+			Channel:   "campaign",
+		}},
+		{"utm", url.Values{"p": {"/foo.html"}, "q": {"utm_source=news&utm_medium=email&utm_campaign=sale&utm_content=top&utm_term=x"}}, nil, 200, goatcounter.Hit{
+			Path:        "/foo.html",
+			Ref:         "sale",
+			RefScheme:   ztest.SP("c"),
+			UTMSource:   "news",
+			UTMMedium:   "email",
+			UTMCampaign: "sale",
+			UTMContent:  "top",
+			UTMTerm:     "x",
+			Channel:     "email",
 		}},
 
 		{"bot", url.Values{"p": {"/a"}, "b": {"150"}}, nil, 200, goatcounter.Hit{
@@ -114,6 +134,25 @@ func TestBackendCount(t *testing.T) {
 
 		{"bot", url.Values{"p": {"/a"}, "b": {"100"}}, nil, 400, goatcounter.Hit{}},
 
+		{"language", url.Values{"p": {"/a"}}, func(r *http.Request) {
+			r.Header.Set("Accept-Language", "nl;q=0.7,pt-br,pt;q=0.9,*;q=0.5")
+		}, 200, goatcounter.Hit{
+			Path:     "/a",
+			Language: "pt-BR",
+		}},
+		{"language script", url.Values{"p": {"/a"}}, func(r *http.Request) {
+			r.Header.Set("Accept-Language", "zh-Hant-TW")
+		}, 200, goatcounter.Hit{
+			Path:     "/a",
+			Language: "zh-TW",
+		}},
+
+		{"last visit", url.Values{"p": {"/a"}, "lv": {"7d"}}, nil, 200, goatcounter.Hit{
+			Path:      "/a",
+			LastVisit: "7d",
+		}},
+		{"last visit invalid", url.Values{"p": {"/a"}, "lv": {"8d"}}, nil, 400, goatcounter.Hit{}},
+
 		{"post", url.Values{"p": {"/foo.html"}}, func(r *http.Request) {
 			r.Method = "POST"
 		}, 200, goatcounter.Hit{
@@ -175,6 +214,9 @@ func TestBackendCount(t *testing.T) {
 			if tt.hit.Browser == "" {
 				tt.hit.Browser = "GoatCounter test runner/1.0"
 			}
+			if tt.hit.Channel == "" {
+				tt.hit.Channel = "direct"
+			}
 			h.CreatedAt = h.CreatedAt.In(time.UTC)
 			if d := ztest.Diff(h.String(), tt.hit.String()); d != "" {
 				t.Error(d)
@@ -316,6 +358,50 @@ func TestBackendCountSessions(t *testing.T) {
 	checkSess(append(hits1, hits2...), want)
 }
 
+func TestBackendCountBeacon(t *testing.T) {
+	goatcounter.Now = func() time.Time { return time.Date(2019, 6, 18, 14, 42, 0, 0, time.UTC) }
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	ctx, site := gctest.Site(ctx, t, goatcounter.Site{
+		CreatedAt: time.Date(2019, 01, 01, 0, 0, 0, 0, time.UTC),
+	})
+
+	send := func(query url.Values, wantCode int) {
+		r, rr := newTest(ctx, "POST", "/count?"+query.Encode(), nil)
+		r.Host = site.Code + "." + cfg.Domain
+		newBackend(zdb.MustGet(ctx)).ServeHTTP(rr, r)
+		if h := rr.Header().Get("X-Goatcounter"); h != "" {
+			t.Logf("X-Goatcounter: %s", h)
+		}
+		ztest.Code(t, rr, wantCode)
+	}
+
+	// No session yet: ignored.
+	send(url.Values{"p": {"/a"}, "tp": {"5"}}, 202)
+	if b := goatcounter.Memstore.Beacons(ctx); len(b) != 0 {
+		t.Fatalf("beacons without session: %#v", b)
+	}
+
+	send(url.Values{"p": {"/a"}}, 200)
+	_, err := goatcounter.Memstore.Persist(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send(url.Values{"p": {"/a"}, "tp": {"100000"}}, 400)
+	send(url.Values{"p": {"/a/"}, "tp": {"5"}, "sd": {"60"}}, 200)
+
+	b := goatcounter.Memstore.Beacons(ctx)
+	if len(b) != 1 {
+		t.Fatalf("len(beacons) = %d: %#v", len(b), b)
+	}
+	got := fmt.Sprintf("%s %d %d", b[0].Path, b[0].TimeOnPage, *b[0].Scroll)
+	if want := "/a 5 50"; got != want {
+		t.Errorf("\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
 func TestBackendIndex(t *testing.T) {
 	tests := []handlerTest{
 		{
@@ -325,6 +411,293 @@ func TestBackendIndex(t *testing.T) {
 			wantCode: 200,
 			wantBody: "<strong>No data received</strong>",
 		},
+		{
+			name:     "compare",
+			router:   newBackend,
+			path:     "/?compare=year",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `<option value="year" selected>same period last year</option>`,
+		},
+		{
+			name:     "compare-pages",
+			router:   newBackend,
+			path:     "/pages?compare=custom&compare-start=2019-08-01&compare-end=2019-08-07",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `"total_change":"0%"`,
+		},
+		{
+			name: "compare-pages-changes",
+			setup: func(ctx context.Context, t *testing.T) {
+				_, err := zdb.MustGet(ctx).ExecContext(ctx,
+					`update sites set created_at='2019-01-01 00:00:00' where id=1`)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+				lastWeek := now.Add(-7 * 24 * time.Hour)
+				s1, s2, s3 := int64(1), int64(2), int64(3)
+				gctest.StoreHits(ctx, t, []goatcounter.Hit{
+					{Site: 1, Session: &s1, CreatedAt: lastWeek, Path: "/a"},
+					{Site: 1, Session: &s2, CreatedAt: lastWeek, Path: "/a"},
+					{Site: 1, Session: &s3, CreatedAt: now, Path: "/a"},
+					{Site: 1, Session: &s3, CreatedAt: now, Path: "/b"},
+				}...)
+			},
+			router:   newBackend,
+			path:     "/pages?period-start=2019-08-25&period-end=2019-08-31&compare=previous",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `"changes":[{"count":1,"prev":0,"diff":1,"change":"new","class":"change-up"},` +
+				`{"count":1,"prev":2,"diff":-1,"change":"-50%","class":"change-down"}]`,
+		},
+		{
+			name:     "compare-invalid",
+			router:   newBackend,
+			path:     "/pages?compare=nope",
+			auth:     true,
+			wantCode: 400,
+			wantBody: `Invalid compare mode`,
+		},
+		{
+			name:     "group",
+			router:   newBackend,
+			path:     "/?group=month",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `<div class="pages-list pages-list-daily pages-list-month">`,
+		},
+		{
+			name:     "group-invalid",
+			router:   newBackend,
+			path:     "/pages?group=year",
+			auth:     true,
+			wantCode: 400,
+			wantBody: `Invalid group`,
+		},
+		{
+			name:     "heatmap",
+			router:   newBackend,
+			path:     "/heatmap?path=/a",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `table class=\"heatmap\"`,
+		},
+		{
+			name: "annotation",
+			setup: func(ctx context.Context, t *testing.T) {
+				_, err := zdb.MustGet(ctx).ExecContext(ctx,
+					`update sites set created_at='2019-01-01 00:00:00' where id=1`)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+				gctest.StoreHits(ctx, t, goatcounter.Hit{Site: 1, Path: "/a", CreatedAt: now})
+				a := goatcounter.Annotation{Day: now, Text: "Deploy <v2>"}
+				err = a.Insert(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			router:   newBackend,
+			path:     "/pages?period-start=2019-08-31&period-end=2019-08-31&daily=true",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `data-a=\"Deploy \u0026lt;v2\u0026gt;\"`,
+		},
+		{
+			name: "segment",
+			setup: func(ctx context.Context, t *testing.T) {
+				_, err := zdb.MustGet(ctx).ExecContext(ctx,
+					`update sites set created_at='2019-01-01 00:00:00' where id=1`)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+				gctest.StoreHits(ctx, t,
+					goatcounter.Hit{Site: 1, Path: "/from-de", Location: "DE", CreatedAt: now},
+					goatcounter.Hit{Site: 1, Path: "/from-nl", Location: "NL", CreatedAt: now})
+			},
+			router:   newBackend,
+			path:     "/pages?period-start=2019-08-31&period-end=2019-08-31&segment-location=DE",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `"paths":["/from-de"]`,
+		},
+		{
+			name: "segment index",
+			setup: func(ctx context.Context, t *testing.T) {
+				_, err := zdb.MustGet(ctx).ExecContext(ctx,
+					`update sites set created_at='2019-01-01 00:00:00' where id=1`)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gctest.StoreHits(ctx, t, goatcounter.Hit{Site: 1, Path: "/a", Location: "DE",
+					CreatedAt: time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)})
+			},
+			router:   newBackend,
+			path:     "/?period-start=2019-08-31&period-end=2019-08-31&segment-location=DE&segment-size=phone",
+			auth:     true,
+			wantCode: 200,
+			wantBody: "Showing only visits where location is DE, screen size is “Phones”.",
+		},
+		{
+			name: "segment hidden panels",
+			setup: func(ctx context.Context, t *testing.T) {
+				_, err := zdb.MustGet(ctx).ExecContext(ctx,
+					`update sites set created_at='2019-01-01 00:00:00' where id=1`)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gctest.StoreHits(ctx, t, goatcounter.Hit{Site: 1, Path: "/a", Location: "DE",
+					CreatedAt: time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)})
+			},
+			router:   newBackend,
+			path:     "/?period-start=2019-08-31&period-end=2019-08-31&segment-location=DE",
+			auth:     true,
+			wantCode: 200,
+			wantBody: "page speed panels are hidden, as they can’t be filtered on a segment.",
+		},
+		{
+			name: "segment period",
+			setup: func(ctx context.Context, t *testing.T) {
+				_, err := zdb.MustGet(ctx).ExecContext(ctx,
+					`update sites set created_at='2019-01-01 00:00:00' where id=1`)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			router:   newBackend,
+			path:     "/pages?period-start=2019-01-01&period-end=2019-08-31&segment-location=DE",
+			auth:     true,
+			wantCode: 400,
+			wantBody: "a segment can only be used for periods up to 92 days",
+		},
+		{
+			name: "content groups",
+			setup: func(ctx context.Context, t *testing.T) {
+				_, err := zdb.MustGet(ctx).ExecContext(ctx,
+					`update sites set created_at='2019-01-01 00:00:00' where id=1`)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gctest.StoreHits(ctx, t, goatcounter.Hit{Site: 1, Path: "/blog/1",
+					CreatedAt: time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)})
+			},
+			router:   newBackend,
+			path:     "/?period-start=2019-08-31&period-end=2019-08-31",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `title="Show the paths in this group">/blog/</a>`,
+		},
+		{
+			name: "search",
+			setup: func(ctx context.Context, t *testing.T) {
+				site := goatcounter.MustGetSite(ctx)
+				site.Settings.SearchPage = "/search?q="
+				_, err := zdb.MustGet(ctx).ExecContext(ctx,
+					`update sites set settings=$1, created_at='2019-01-01 00:00:00' where id=1`, site.Settings)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gctest.StoreHits(ctx, t, goatcounter.Hit{Site: 1, Path: "/search?q=Goat+Counter",
+					CreatedAt: time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)})
+			},
+			router:   newBackend,
+			path:     "/?period-start=2019-08-31&period-end=2019-08-31",
+			auth:     true,
+			wantCode: 200,
+			wantBody: "<td>goat counter</td>",
+		},
+		{
+			name: "broken pages",
+			setup: func(ctx context.Context, t *testing.T) {
+				_, err := zdb.MustGet(ctx).ExecContext(ctx,
+					`update sites set created_at='2019-01-01 00:00:00' where id=1`)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gctest.StoreHits(ctx, t, goatcounter.Hit{Site: 1, Path: "/old-page", Status: 404,
+					Ref: "https://example.com/links", CreatedAt: time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)})
+			},
+			router:   newBackend,
+			path:     "/?period-start=2019-08-31&period-end=2019-08-31",
+			auth:     true,
+			wantCode: 200,
+			wantBody: "<td>/old-page</td>",
+		},
+		{
+			name: "trending",
+			setup: func(ctx context.Context, t *testing.T) {
+				_, err := zdb.MustGet(ctx).ExecContext(ctx, `insert into trending
+					(site, kind, name, count, baseline, zscore, updated_at)
+					values (1, 'path', '/spike', 30, 1.5, 12.5, '2019-06-18 14:00:00')`)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			router:   newBackend,
+			auth:     true,
+			wantCode: 200,
+			wantBody: "<strong>/spike</strong>: 30 pageviews",
+		},
+		{
+			name: "experiment",
+			setup: func(ctx context.Context, t *testing.T) {
+				e := goatcounter.Experiment{Name: "button", Variants: []string{"blue", "green"}, Goal: "/signup"}
+				err := e.Insert(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s1, s2 := int64(1), int64(2)
+				now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+				gctest.StoreHits(ctx, t, []goatcounter.Hit{
+					{Site: 1, Path: "/", Experiment: "button", Variant: "blue", Session: &s1, CreatedAt: now},
+					{Site: 1, Path: "/", Experiment: "button", Variant: "green", Session: &s2, CreatedAt: now},
+					{Site: 1, Path: "/signup", Session: &s2, CreatedAt: now},
+				}...)
+			},
+			router:   newBackend,
+			path:     "/experiments/1",
+			auth:     true,
+			wantCode: 200,
+			wantBody: "<td>2019-08-31</td>",
+		},
+		{
+			name:     "experiment not found",
+			router:   newBackend,
+			path:     "/experiments/42",
+			auth:     true,
+			wantCode: 404,
+		},
+		{
+			name:     "filter invalid",
+			router:   newBackend,
+			path:     "/pages?filter=%22/about",
+			auth:     true,
+			wantCode: 400,
+			wantBody: "unterminated quote",
+		},
+		{
+			name:     "filter invalid index",
+			router:   newBackend,
+			path:     "/?filter=~[",
+			auth:     true,
+			wantCode: 200,
+			wantBody: "invalid regular expression",
+		},
+		{
+			name:     "segment invalid",
+			router:   newBackend,
+			path:     "/pages?segment-size=huge",
+			auth:     true,
+			wantCode: 400,
+			wantBody: "segment-size",
+		},
 	}
 
 	for _, tt := range tests {
@@ -369,6 +742,67 @@ func TestBackendTpl(t *testing.T) {
 			wantCode: 200,
 			wantBody: "Are you sure you want to remove the site",
 		},
+
+		{
+			setup: func(ctx context.Context, t *testing.T) {
+				a := goatcounter.Alert{Kind: goatcounter.AlertGoal, Threshold: 5, Goal: "/signup"}
+				err := a.Insert(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			router:   newBackend,
+			path:     "/settings",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `<td>Goal &#34;/signup&#34; reached at least 5 times</td>`,
+		},
+		{
+			setup: func(ctx context.Context, t *testing.T) {
+				w := goatcounter.Webhook{URL: "https://example.com/hook", Events: []string{goatcounter.WebhookSettings}}
+				err := w.Insert(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = goatcounter.TriggerWebhooks(ctx, goatcounter.WebhookSettings, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			router:   newBackend,
+			path:     "/settings",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `<td>pending</td>`,
+		},
+		{
+			router:   newBackend,
+			path:     "/sitemap",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `enctype="multipart/form-data"`,
+		},
+		{
+			setup: func(ctx context.Context, t *testing.T) {
+				db := zdb.MustGet(ctx)
+				_, err := db.ExecContext(ctx, `update sites set created_at='2019-08-01 00:00:00' where id=1`)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = db.ExecContext(ctx, `insert into vitals_stats
+					(site, day, path, name, count, hist) values
+					(1, '2019-08-31', '/asd', 'lcp', 1, '1'),
+					(1, '2019-08-31', '/zxc', 'ttfb', 1, '1')`)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			router:   newBackend,
+			path:     "/refs?showrefs=/asd&period-start=2019-08-31&period-end=2019-08-31",
+			auth:     true,
+			wantCode: 200,
+			wantBody: `Largest contentful paint`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -411,6 +845,254 @@ func TestBackendPurge(t *testing.T) {
 	}
 }
 
+func TestBackendAnnotation(t *testing.T) {
+	tests := []handlerTest{
+		{
+			router:       newBackend,
+			path:         "/annotations",
+			body:         map[string]string{"day": "2020-05-01", "text": "Deploy", "url": "https://example.com"},
+			method:       "POST",
+			auth:         true,
+			wantCode:     200,
+			wantBody:     `"text":"Deploy","url":"https://example.com"`,
+			wantFormCode: 303,
+		},
+	}
+
+	for _, tt := range tests {
+		runTest(t, tt, func(t *testing.T, rr *httptest.ResponseRecorder, r *http.Request) {
+			var a goatcounter.Annotations
+			err := a.List(r.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(a) != 1 || a[0].Day.Format("2006-01-02") != "2020-05-01" {
+				t.Fatalf("wrong annotations:\n%#v", a)
+			}
+		})
+	}
+}
+
+func TestBackendExperiment(t *testing.T) {
+	tests := []handlerTest{
+		{
+			router:       newBackend,
+			path:         "/experiments",
+			body:         map[string]string{"name": "button", "variants": "blue, green", "goal": "/signup"},
+			method:       "POST",
+			auth:         true,
+			wantCode:     200,
+			wantBody:     `"name":"button","variants":"blue,green","goal":"/signup"`,
+			wantFormCode: 303,
+		},
+	}
+
+	for _, tt := range tests {
+		runTest(t, tt, func(t *testing.T, rr *httptest.ResponseRecorder, r *http.Request) {
+			var e goatcounter.Experiments
+			err := e.List(r.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(e) != 1 || e[0].Variants.String() != "blue, green" {
+				t.Fatalf("wrong experiments:\n%#v", e)
+			}
+		})
+	}
+}
+
+func TestBackendAlert(t *testing.T) {
+	tests := []handlerTest{
+		{
+			router:       newBackend,
+			path:         "/alerts",
+			body:         map[string]string{"kind": "spike", "threshold": "3"},
+			method:       "POST",
+			auth:         true,
+			wantFormCode: 303,
+		},
+	}
+
+	for _, tt := range tests {
+		runTest(t, tt, func(t *testing.T, rr *httptest.ResponseRecorder, r *http.Request) {
+			var a goatcounter.Alerts
+			err := a.List(r.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(a) != 1 || a[0].String() != "Traffic spike: pageviews at least 3× the usual" {
+				t.Fatalf("wrong alerts:\n%#v", a)
+			}
+		})
+	}
+}
+
+func TestBackendWebhook(t *testing.T) {
+	tests := []handlerTest{
+		{
+			router:       newBackend,
+			path:         "/webhooks",
+			body:         map[string]string{"url": "https://example.com/hook", "events": "alert"},
+			method:       "POST",
+			auth:         true,
+			wantFormCode: 303,
+		},
+	}
+
+	for _, tt := range tests {
+		runTest(t, tt, func(t *testing.T, rr *httptest.ResponseRecorder, r *http.Request) {
+			var w goatcounter.Webhooks
+			err := w.List(r.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(w) != 1 || w[0].URL != "https://example.com/hook" ||
+				len(w[0].Events) != 1 || w[0].Events[0] != "alert" || w[0].Secret == "" {
+				t.Fatalf("wrong webhooks:\n%#v", w)
+			}
+		})
+	}
+}
+
+func TestBackendSettingsWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*goatcounter.SiteSettings)
+		wantLen int
+	}{
+		{"unchanged", func(*goatcounter.SiteSettings) {}, 0},
+		{"changed", func(s *goatcounter.SiteSettings) { s.Public = true }, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, clean := gctest.DB(t)
+			defer clean()
+
+			hook := goatcounter.Webhook{URL: "https://example.com/hook",
+				Events: []string{goatcounter.WebhookSettings}}
+			err := hook.Insert(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// "test" is a reserved code, so the site wouldn't validate. Store
+			// it once so the settings have the defaults.
+			_, err = zdb.MustGet(ctx).ExecContext(ctx, `update sites set code='testsettings' where id=1`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var site goatcounter.Site
+			err = site.ByID(ctx, 1)
+			if err == nil {
+				err = site.Update(ctx)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			settings := site.Settings
+			tt.change(&settings)
+			body := jsonutil.MustMarshal(map[string]interface{}{
+				"settings": settings,
+				"user":     map[string]string{"email": "test@example.com"},
+			})
+
+			r, rr := newTest(ctx, "POST", "/save-settings", bytes.NewReader(body))
+			r.Host = "testsettings.example.com"
+			login(t, rr, r, 1)
+			newBackend(zdb.MustGet(ctx)).ServeHTTP(rr, r)
+			ztest.Code(t, rr, 303)
+
+			var d goatcounter.WebhookDeliveries
+			err = d.List(ctx, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(d) != tt.wantLen {
+				t.Errorf("len(d) = %d; want %d\n%s", len(d), tt.wantLen, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestBackendSitemap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>
+			<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+				<url><loc>https://example.com/asd</loc></url>
+				<url><loc>https://example.com/forgotten</loc></url>
+			</urlset>`)
+	}))
+	defer srv.Close()
+
+	tests := []handlerTest{
+		{
+			name:         "private",
+			router:       newBackend,
+			path:         "/sitemap",
+			body:         map[string]string{"url": srv.URL + "/sitemap.xml"},
+			method:       "POST",
+			auth:         true,
+			wantCode:     200,
+			wantBody:     "sitemap: could not fetch",
+			wantFormCode: 200,
+			wantFormBody: "sitemap: could not fetch",
+		},
+		{
+			name: "private mirror",
+			setup: func(ctx context.Context, t *testing.T) {
+				cfg.SitemapPrivate = true
+				gctest.StoreHits(ctx, t, goatcounter.Hit{Site: 1, Path: "/asd",
+					CreatedAt: time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)})
+			},
+			router: newBackend,
+			path:   "/sitemap",
+			body: map[string]string{"url": srv.URL + "/sitemap.xml",
+				"period-start": "2019-08-31", "period-end": "2019-08-31"},
+			method:       "POST",
+			auth:         true,
+			wantCode:     200,
+			wantBody:     "<tr><td>0</td><td>/forgotten</td></tr>",
+			wantFormCode: 200,
+			wantFormBody: "<tr><td>0</td><td>/forgotten</td></tr>",
+		},
+		{
+			name: "fetch",
+			setup: func(ctx context.Context, t *testing.T) {
+				cfg.SitemapPrivate = false
+				goatcounter.PublicIP = func(net.IP) bool { return true }
+				now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+				gctest.StoreHits(ctx, t, []goatcounter.Hit{
+					{Site: 1, Path: "/asd", CreatedAt: now},
+					{Site: 1, Path: "/orphan", CreatedAt: now},
+				}...)
+			},
+			router: newBackend,
+			path:   "/sitemap",
+			body: map[string]string{"url": srv.URL + "/sitemap.xml",
+				"period-start": "2019-08-31", "period-end": "2019-08-31"},
+			method:       "POST",
+			auth:         true,
+			wantCode:     200,
+			wantBody:     "<tr><td>0</td><td>/forgotten</td></tr>",
+			wantFormCode: 200,
+			wantFormBody: "<tr><td>1</td><td>/orphan</td></tr>",
+		},
+	}
+
+	defer func(f func(net.IP) bool) { goatcounter.PublicIP = f }(goatcounter.PublicIP)
+	defer func(b bool) { cfg.SitemapPrivate = b }(cfg.SitemapPrivate)
+	for _, tt := range tests {
+		runTest(t, tt, nil)
+	}
+}
+
 func TestBackendBarChart(t *testing.T) {
 	id := tz.MustNew("", "Asia/Makassar").Loc()
 	hi := tz.MustNew("", "Pacific/Honolulu").Loc()
@@ -741,7 +1423,7 @@ func TestBackendBarChart(t *testing.T) {
 			return
 		}
 
-		c := doc.Find(".chart.chart-bar")
+		c := doc.Find(".count-list-pages .chart.chart-bar")
 		if c.Length() != 1 {
 			t.Fatalf("c.Length: %d", c.Length())
 		}
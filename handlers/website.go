@@ -171,7 +171,8 @@ func (h website) doSignup(w http.ResponseWriter, r *http.Request) error {
 	defer tx.Rollback()
 
 	// Create site.
-	tz, err := tz.New(geo(r.RemoteAddr), args.Timezone)
+	loc, _, _ := geo(r.RemoteAddr)
+	tz, err := tz.New(loc, args.Timezone)
 	if err != nil {
 		zlog.FieldsRequest(r).Fields(zlog.F{
 			"timezone": args.Timezone,
@@ -0,0 +1,94 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"time"
+
+	"zgo.at/goatcounter/errors"
+	"zgo.at/utils/jsonutil"
+	"zgo.at/zdb"
+)
+
+// Heatmap is the number of pageviews for every hour of every day of the week,
+// in the site's timezone.
+type Heatmap struct {
+	Hours [7][24]int // Indexed by time.Weekday, so Sunday is 0.
+	Max   int
+	Total int
+}
+
+// List the heatmap for the given time period; if path is empty it lists the
+// pageviews for the entire site, excluding events.
+func (h *Heatmap) List(ctx context.Context, start, end time.Time, path string) error {
+	site := MustGetSite(ctx)
+
+	query := `/* Heatmap.List */
+		select day, stats from hit_stats
+		where site=$1 and day >= $2 and day <= $3 `
+	args := []interface{}{site.ID, start.Format("2006-01-02"), end.Format("2006-01-02")}
+	if path == "" {
+		query += ` and event=0 `
+	} else {
+		query += ` and path=$4 `
+		args = append(args, path)
+	}
+
+	var st []struct {
+		Day   time.Time `db:"day"`
+		Stats []byte    `db:"stats"`
+	}
+	err := zdb.MustGet(ctx).SelectContext(ctx, &st, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "Heatmap.List")
+	}
+
+	// Add up all paths per day, and fill in blank days so the offset can be
+	// applied.
+	perDay := make(map[string][]int)
+	for _, s := range st {
+		var x []int
+		jsonutil.MustUnmarshal(s.Stats, &x)
+
+		d := s.Day.Format("2006-01-02")
+		if _, ok := perDay[d]; !ok {
+			perDay[d] = make([]int, 24)
+		}
+		for i := range x {
+			perDay[d][i] += x[i]
+		}
+	}
+
+	var (
+		stats  []Stat
+		endFmt = end.Format("2006-01-02")
+	)
+	for day := start; day.Format("2006-01-02") <= endFmt; day = day.Add(24 * time.Hour) {
+		d := day.Format("2006-01-02")
+		hourly, ok := perDay[d]
+		if !ok {
+			hourly = make([]int, 24)
+		}
+		stats = append(stats, Stat{Day: d, Hourly: hourly, HourlyUnique: make([]int, 24)})
+	}
+
+	*h = Heatmap{}
+	for _, s := range applyOffset(offsetHours(site.Settings.Timezone.Offset()), stats) {
+		day, err := time.Parse("2006-01-02", s.Day)
+		if err != nil {
+			return errors.Wrap(err, "Heatmap.List")
+		}
+		wd := day.Weekday()
+		for hour, n := range s.Hourly {
+			h.Hours[wd][hour] += n
+			h.Total += n
+			if h.Hours[wd][hour] > h.Max {
+				h.Max = h.Hours[wd][hour]
+			}
+		}
+	}
+	return nil
+}
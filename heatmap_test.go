@@ -0,0 +1,59 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+	"zgo.at/tz"
+)
+
+func TestHeatmap(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	site := MustGetSite(ctx)
+	site.Settings.Timezone = tz.MustNew("", "Asia/Makassar") // UTC+8
+
+	gctest.StoreHits(ctx, t, []Hit{
+		// Saturday 22:42 and Sunday 04:00 in UTC+8.
+		{Site: site.ID, Path: "/a", CreatedAt: time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)},
+		{Site: site.ID, Path: "/a", CreatedAt: time.Date(2019, 8, 31, 14, 50, 0, 0, time.UTC)},
+		{Site: site.ID, Path: "/b", CreatedAt: time.Date(2019, 8, 31, 20, 0, 0, 0, time.UTC)},
+		{Site: site.ID, Path: "/e", Event: true, CreatedAt: time.Date(2019, 8, 31, 20, 0, 0, 0, time.UTC)},
+	}...)
+
+	loc := site.Settings.Timezone.Loc()
+	start := time.Date(2019, 8, 31, 0, 0, 0, 0, loc).UTC()
+	end := time.Date(2019, 9, 1, 23, 59, 59, 0, loc).UTC()
+
+	tests := []struct {
+		path, want string
+	}{
+		{"", "total=3 max=2 sat22=2 sun4=1"},
+		{"/a", "total=2 max=2 sat22=2 sun4=0"},
+		{"/e", "total=1 max=1 sat22=0 sun4=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var h Heatmap
+			err := h.List(ctx, start, end, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := fmt.Sprintf("total=%d max=%d sat22=%d sun4=%d", h.Total, h.Max,
+				h.Hours[time.Saturday][22], h.Hours[time.Sunday][4])
+			if got != tt.want {
+				t.Errorf("\ngot:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ import (
 
 	"github.com/jmoiron/sqlx"
 	"zgo.at/goatcounter/errors"
+	"zgo.at/guru"
 	"zgo.at/utils/intutil"
 	"zgo.at/utils/jsonutil"
 	"zgo.at/utils/syncutil"
@@ -49,16 +50,31 @@ type Hit struct {
 	Query string     `db:"-" json:"q,omitempty"`
 	Bot   int        `db:"bot" json:"b,omitempty"`
 
+	Experiment string `db:"experiment" json:"x,omitempty"` // Experiment name.
+	Variant    string `db:"variant" json:"xv,omitempty"`   // Experiment variant the visitor saw.
+	SearchTerm string `db:"search_term" json:"-"`          // Term from the site's search page.
+	Status     int    `db:"status" json:"st,omitempty"`    // HTTP status for error pages; 0 for normal pages.
+
 	RefParams   *string   `db:"ref_params" json:"-"`
 	RefOriginal *string   `db:"ref_original" json:"-"`
 	RefScheme   *string   `db:"ref_scheme" json:"-"`
 	Browser     string    `db:"browser" json:"-"`
-	Location    string    `db:"location" json:"-"`
+	Location    string    `db:"location" json:"-"` // ISO-3166-1 country code.
+	Region      string    `db:"region" json:"-"`   // ISO-3166-2 region code, if the GeoIP database has regions.
+	Language    string    `db:"language" json:"-"`
+	UTMSource   string    `db:"utm_source" json:"-"`
+	UTMMedium   string    `db:"utm_medium" json:"-"`
+	UTMCampaign string    `db:"utm_campaign" json:"-"`
+	UTMContent  string    `db:"utm_content" json:"-"`
+	UTMTerm     string    `db:"utm_term" json:"-"`
+	Channel     string    `db:"channel" json:"-"`
+	LastVisit   string    `db:"last_visit" json:"lv,omitempty"`
 	FirstVisit  zdb.Bool  `db:"first_visit" json:"-"`
 	CreatedAt   time.Time `db:"created_at" json:"-"`
 
-	RefURL *url.URL `db:"-" json:"-"`   // Parsed Ref
-	Random string   `db:"-" json:"rnd"` // Browser cache buster, as they don't always listen to Cache-Control
+	RefURL     *url.URL `db:"-" json:"-"`   // Parsed Ref
+	RegionName string   `db:"-" json:"-"`   // Region name from the GeoIP database, if any.
+	Random     string   `db:"-" json:"rnd"` // Browser cache buster, as they don't always listen to Cache-Control
 }
 
 var groups = map[string]string{
@@ -231,6 +247,15 @@ func (h *Hit) cleanPath(ctx context.Context) {
 		}
 	}
 
+	// Record the term from the site search page, so that all searches are
+	// counted as one path.
+	if path, param := splitSearchPage(MustGetSite(ctx).Settings.SearchPage); path != "" && u.Path == path {
+		if _, ok := q[param]; ok {
+			h.SearchTerm = normalizeSearchTerm(q.Get(param))
+			q.Del(param)
+		}
+	}
+
 	u.RawQuery = q.Encode()
 	h.Path = u.String()
 }
@@ -267,6 +292,15 @@ func (h Hit) String() string {
 	fmt.Fprintf(t, "Browser\t%q\n", h.Browser)
 	fmt.Fprintf(t, "Size\t%q\n", h.Size)
 	fmt.Fprintf(t, "Location\t%q\n", h.Location)
+	fmt.Fprintf(t, "Region\t%q\n", h.Region)
+	fmt.Fprintf(t, "Language\t%q\n", h.Language)
+	fmt.Fprintf(t, "UTMSource\t%q\n", h.UTMSource)
+	fmt.Fprintf(t, "UTMMedium\t%q\n", h.UTMMedium)
+	fmt.Fprintf(t, "UTMCampaign\t%q\n", h.UTMCampaign)
+	fmt.Fprintf(t, "UTMContent\t%q\n", h.UTMContent)
+	fmt.Fprintf(t, "UTMTerm\t%q\n", h.UTMTerm)
+	fmt.Fprintf(t, "Channel\t%q\n", h.Channel)
+	fmt.Fprintf(t, "LastVisit\t%q\n", h.LastVisit)
 	fmt.Fprintf(t, "Bot\t%d\n", h.Bot)
 	fmt.Fprintf(t, "CreatedAt\t%s\n", h.CreatedAt)
 	t.Flush()
@@ -295,6 +329,14 @@ func (h *Hit) Defaults(ctx context.Context) {
 		}
 		q := u.Query()
 
+		// Always store the UTM parameters, independent of the campaign
+		// setting which only affects the referrer.
+		h.UTMSource = q.Get("utm_source")
+		h.UTMMedium = q.Get("utm_medium")
+		h.UTMCampaign = q.Get("utm_campaign")
+		h.UTMContent = q.Get("utm_content")
+		h.UTMTerm = q.Get("utm_term")
+
 		for _, c := range site.Settings.Campaigns {
 			if _, ok := q[c]; ok {
 				h.Ref = q.Get(c)
@@ -327,6 +369,7 @@ func (h *Hit) Defaults(ctx context.Context) {
 	if !h.Event {
 		h.Path = "/" + strings.Trim(h.Path, "/")
 	}
+	h.Channel = RefChannel(site, h.Ref, h.RefScheme, h.UTMMedium)
 }
 
 // Validate the object.
@@ -345,6 +388,23 @@ func (h *Hit) Validate(ctx context.Context) error {
 	v.Len("title", h.Title, 0, 1024)
 	v.Len("ref", h.Ref, 0, 2048)
 	v.Len("browser", h.Browser, 0, 512)
+	v.Len("utm_source", h.UTMSource, 0, 512)
+	v.Len("utm_medium", h.UTMMedium, 0, 512)
+	v.Len("utm_campaign", h.UTMCampaign, 0, 512)
+	v.Len("utm_content", h.UTMContent, 0, 512)
+	v.Len("utm_term", h.UTMTerm, 0, 512)
+	if h.LastVisit != "" {
+		v.Include("last_visit", h.LastVisit, LastVisits)
+	}
+	v.Len("experiment", h.Experiment, 0, 250)
+	v.Len("variant", h.Variant, 0, 250)
+	v.Len("search_term", h.SearchTerm, 0, 250)
+	if h.Status != 0 {
+		v.Range("status", int64(h.Status), 400, 599)
+	}
+	if (h.Experiment == "") != (h.Variant == "") {
+		v.Append("variant", "experiment and variant must both be set")
+	}
 
 	return v.ErrorOrNil()
 }
@@ -391,9 +451,17 @@ func (h *Hits) Purge(ctx context.Context, path string) error {
 			return errors.Wrap(err, "Hits.Purge")
 		}
 
+		for _, t := range []string{"hit_stats", "time_stats", "scroll_stats", "vitals_stats", "path_titles", "broken_stats"} {
+			_, err = tx.ExecContext(ctx,
+				`delete from `+t+` where site=$1 and lower(path) like lower($2)`,
+				site, path)
+			if err != nil {
+				return errors.Wrap(err, "Hits.Purge")
+			}
+		}
 		_, err = tx.ExecContext(ctx,
-			`delete from hit_stats where site=$1 and lower(path) like lower($2)`,
-			site, path)
+			`delete from trending where site=$1 and kind=$2 and lower(name) like lower($3)`,
+			site, TrendPath, path)
 		if err != nil {
 			return errors.Wrap(err, "Hits.Purge")
 		}
@@ -421,6 +489,8 @@ type Stat struct {
 	HourlyUnique []int
 	Daily        int
 	DailyUnique  int
+	Compare      *Stat        `json:",omitempty"` // Same day in the period we're comparing to.
+	Annotations  []Annotation `json:",omitempty"`
 }
 
 type HitStat struct {
@@ -433,6 +503,9 @@ type HitStat struct {
 	Title       string   `db:"title"`
 	RefScheme   *string  `db:"ref_scheme"`
 	Stats       []Stat
+	TimeOnPage  *TimeStat
+	ScrollDepth ScrollStat
+	Change      *Change `json:",omitempty"` // Change in visits, if comparing to another period.
 }
 
 type HitStats []HitStat
@@ -448,8 +521,13 @@ func (h *HitStats) List(ctx context.Context, start, end time.Time, filter string
 	site := MustGetSite(ctx)
 	l := zlog.Module("HitStats.List")
 
-	if filter != "" {
-		filter = "%" + strings.ToLower(filter) + "%"
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return 0, 0, 0, 0, false, err
+	}
+	where, whereArgs, err := f.where(ctx, start, end)
+	if err != nil {
+		return 0, 0, 0, 0, false, err
 	}
 
 	// Get total number of hits in the selected time range.
@@ -463,31 +541,7 @@ func (h *HitStats) List(ctx context.Context, start, end time.Time, filter string
 		defer zlog.Recover()
 		defer wg.Done()
 
-		// TODO: can also use first_visit; not sure what would make the most
-		// sense:
-		// 1. first_visit will list only people who visted for the first time
-		// 2. distinct session lists people who visited at all (first visit in
-		//    timerange)
-		query := `/* HitStats.List: get count */
-			select count(id) as t,
-			count(distinct session) as u
-			from hits where
-				site=$1 and
-				bot=0 and
-				created_at >= $2 and
-				created_at <= $3 `
-		args := []interface{}{site.ID, start, end}
-		if filter != "" {
-			query += ` and (lower(path) like $4 or lower(title) like $4) `
-			args = append(args, filter)
-		}
-
-		var t struct {
-			T int
-			U int
-		}
-		totalErr = db.GetContext(ctx, &t, query, args...)
-		total, totalUnique = t.T, t.U
+		total, totalUnique, totalErr = hitTotals(ctx, start, end, where, whereArgs)
 		//l = l.Since("get total")
 	}()
 
@@ -502,13 +556,14 @@ func (h *HitStats) List(ctx context.Context, start, end time.Time, filter string
 			where
 				site=? and
 				bot=0 and
+				status=0 and
 				created_at >= ? and
 				created_at <= ? `
 		args := []interface{}{site.ID, start, end}
 
-		if filter != "" {
-			query += ` and (lower(path) like ? or lower(title) like ?) `
-			args = append(args, filter, filter)
+		if where != "" {
+			query += ` and ` + where
+			args = append(args, whereArgs...)
 		}
 
 		// Quite a bit faster to not check path.
@@ -540,29 +595,22 @@ func (h *HitStats) List(ctx context.Context, start, end time.Time, filter string
 	}
 
 	// Add stats and title.
-	var st []struct {
-		Path        string    `db:"path"`
-		Title       string    `db:"title"`
-		Event       zdb.Bool  `db:"event"`
-		Day         time.Time `db:"day"`
-		Stats       []byte    `db:"stats"`
-		StatsUnique []byte    `db:"stats_unique"`
-	}
+	var st []hitStatRow
 	{
 		query := `/* HitStats.List: get stats */
-			select path, event, title, day, stats, stats_unique
+			select path, event, title, day, stats, stats_unique, hll
 			from hit_stats
 			where
-				site=$1 and
-				day >= $2 and
-				day <= $3 `
+				site=? and
+				day >= ? and
+				day <= ? `
 		args := []interface{}{site.ID, start.Format("2006-01-02"), end.Format("2006-01-02")}
-		if filter != "" {
-			query += ` and (lower(path) like $4 or lower(title) like $4) `
-			args = append(args, filter)
+		if where != "" {
+			query += ` and ` + where
+			args = append(args, whereArgs...)
 		}
 		query += ` order by day asc`
-		err := db.SelectContext(ctx, &st, query, args...)
+		err := db.SelectContext(ctx, &st, db.Rebind(query), args...)
 		if err != nil {
 			return 0, 0, 0, 0, false, errors.Wrap(err, "HitStats.List")
 		}
@@ -570,100 +618,102 @@ func (h *HitStats) List(ctx context.Context, start, end time.Time, filter string
 	}
 
 	hh := *h
+	hh.addStats(st, start, end, site.Settings.Timezone.Offset())
+	l = l.Since("add hit_stats")
 
-	// Add the hit_stats.
-	{
+	// Add the time on page and scroll depth.
+	if len(hh) > 0 {
+		paths := make([]string, 0, len(hh))
 		for i := range hh {
-			for _, s := range st {
-				if s.Path == hh[i].Path && s.Event == hh[i].Event {
-					var x, y []int
-					jsonutil.MustUnmarshal(s.Stats, &x)
-					jsonutil.MustUnmarshal(s.StatsUnique, &y)
-					hh[i].Title = s.Title
-					hh[i].Event = s.Event
-					hh[i].Stats = append(hh[i].Stats, Stat{
-						Day:          s.Day.Format("2006-01-02"),
-						Hourly:       x,
-						HourlyUnique: y,
-					})
-				}
+			if !hh[i].Event {
+				paths = append(paths, hh[i].Path)
 			}
 		}
-		l = l.Since("add hit_stats")
-	}
 
-	// Fill in blank days.
-	{
-		endFmt := end.Format("2006-01-02")
-		for i := range hh {
-			var (
-				day     = start.Add(-24 * time.Hour)
-				newStat []Stat
-				j       int
-			)
-
-			for {
-				day = day.Add(24 * time.Hour)
-				dayFmt := day.Format("2006-01-02")
-
-				if len(hh[i].Stats)-1 >= j && dayFmt == hh[i].Stats[j].Day {
-					newStat = append(newStat, hh[i].Stats[j])
-					j++
-				} else {
-					newStat = append(newStat, Stat{Day: dayFmt, Hourly: allDays, HourlyUnique: allDays})
-				}
-				if dayFmt == endFmt {
-					break
-				}
+		var ts []struct {
+			TimeStat
+			Path string `db:"path"`
+		}
+		if len(paths) > 0 {
+			query, args, err := sqlx.In(`/* HitStats.List: get time_stats */
+				select path, count, total, hist
+				from time_stats
+				where
+					site=? and
+					event=0 and
+					day >= ? and
+					day <= ? and
+					path in (?)`,
+				site.ID, start.Format("2006-01-02"), end.Format("2006-01-02"), paths)
+			if err != nil {
+				return 0, 0, 0, 0, false, errors.Wrap(err, "HitStats.List")
+			}
+			err = db.SelectContext(ctx, &ts, db.Rebind(query), args...)
+			if err != nil {
+				return 0, 0, 0, 0, false, errors.Wrap(err, "HitStats.List")
 			}
-
-			hh[i].Stats = newStat
 		}
-		l = l.Since("fill blanks")
-	}
 
-	// Apply TZ offset.
-	{
-		offset := site.Settings.Timezone.Offset()
-		if offset%60 != 0 {
-			offset += 30
+		var ss []struct {
+			Path  string `db:"path"`
+			Depth int    `db:"depth"`
+			Count int    `db:"count"`
 		}
-		offset /= 60
-
-		for i := range hh {
-			hh[i].Stats = applyOffset(offset, hh[i].Stats)
+		if len(paths) > 0 {
+			query, args, err := sqlx.In(`/* HitStats.List: get scroll_stats */
+				select path, depth, sum(count) as count
+				from scroll_stats
+				where
+					site=? and
+					event=0 and
+					day >= ? and
+					day <= ? and
+					path in (?)
+				group by path, depth`,
+				site.ID, start.Format("2006-01-02"), end.Format("2006-01-02"), paths)
+			if err != nil {
+				return 0, 0, 0, 0, false, errors.Wrap(err, "HitStats.List")
+			}
+			err = db.SelectContext(ctx, &ss, db.Rebind(query), args...)
+			if err != nil {
+				return 0, 0, 0, 0, false, errors.Wrap(err, "HitStats.List")
+			}
 		}
-		l = l.Since("tz")
-	}
 
-	// Add total and max.
-	var totalDisplay, totalUniqueDisplay int
-	{
 		for i := range hh {
-			for j := range hh[i].Stats {
-				for k := range hh[i].Stats[j].Hourly {
-					hh[i].Stats[j].Daily += hh[i].Stats[j].Hourly[k]
-					hh[i].Stats[j].DailyUnique += hh[i].Stats[j].HourlyUnique[k]
-
-					if hh[i].Stats[j].Hourly[k] > hh[i].Max {
-						hh[i].Max = hh[i].Stats[j].Hourly[k]
+			if hh[i].Event {
+				continue
+			}
+			for _, t := range ts {
+				if t.Path == hh[i].Path {
+					if hh[i].TimeOnPage == nil {
+						hh[i].TimeOnPage = &TimeStat{}
 					}
+					hh[i].TimeOnPage.Add(t.TimeStat)
 				}
-				if hh[i].Stats[j].Daily > hh[i].DailyMax {
-					hh[i].DailyMax = hh[i].Stats[j].Daily
+			}
+			for _, d := range ss {
+				if d.Path == hh[i].Path {
+					if hh[i].ScrollDepth == nil {
+						hh[i].ScrollDepth = make(ScrollStat, len(ScrollDepths))
+					}
+					for j, b := range ScrollDepths {
+						if b == d.Depth {
+							hh[i].ScrollDepth[j] += d.Count
+						}
+					}
 				}
-				hh[i].Count += hh[i].Stats[j].Daily
-				hh[i].CountUnique += hh[i].Stats[j].DailyUnique
 			}
+		}
+		l = l.Since("add time_stats and scroll_stats")
+	}
 
+	// Add total.
+	var totalDisplay, totalUniqueDisplay int
+	{
+		for i := range hh {
 			totalDisplay += hh[i].Count
 			totalUniqueDisplay += hh[i].CountUnique
-			if hh[i].Max < 10 {
-				hh[i].Max = 10
-			}
-			if hh[i].DailyMax < 10 {
-				hh[i].DailyMax = 10
-			}
 		}
 
 		// We sort in SQL, but this is not always 100% correct after applying
@@ -688,6 +738,154 @@ func (h *HitStats) List(ctx context.Context, start, end time.Time, filter string
 	return total, totalUnique, totalDisplay, totalUniqueDisplay, more, nil
 }
 
+// hitTotals gets the total number of pageviews and visits in the time range.
+//
+// The where is the condition from Filter.where().
+func hitTotals(ctx context.Context, start, end time.Time, where string, whereArgs []interface{}) (int, int, error) {
+	// TODO: can also use first_visit; not sure what would make the most
+	// sense:
+	// 1. first_visit will list only people who visted for the first time
+	// 2. distinct session lists people who visited at all (first visit in
+	//    timerange)
+	query := `/* HitStats.List: get count */
+		select count(id) as t,
+		count(distinct session) as u
+		from hits where
+			site=? and
+			bot=0 and
+			status=0 and
+			created_at >= ? and
+			created_at <= ? `
+	args := []interface{}{MustGetSite(ctx).ID, start, end}
+	if where != "" {
+		query += ` and ` + where
+		args = append(args, whereArgs...)
+	}
+
+	var t struct {
+		T int
+		U int
+	}
+	db := zdb.MustGet(ctx)
+	err := db.GetContext(ctx, &t, db.Rebind(query), args...)
+	return t.T, t.U, err
+}
+
+type hitStatRow struct {
+	Path        string    `db:"path"`
+	Title       string    `db:"title"`
+	Event       zdb.Bool  `db:"event"`
+	Day         time.Time `db:"day"`
+	Stats       []byte    `db:"stats"`
+	StatsUnique []byte    `db:"stats_unique"`
+	HLL         *HLL      `db:"hll"`
+}
+
+// addStats adds the hit_stats rows to the paths, fills in blank days, applies
+// the TZ offset (in minutes), and sets the counts and max.
+func (h HitStats) addStats(st []hitStatRow, start, end time.Time, offset int) {
+	// Add the hit_stats, and merge the HLL sketches to get the unique visitors
+	// for the entire period. This is nil if one of the days doesn't have a
+	// sketch.
+	unique := make([]*HLL, len(h))
+	for i := range h {
+		unique[i] = &HLL{}
+		for _, s := range st {
+			if s.Path == h[i].Path && s.Event == h[i].Event {
+				if s.HLL == nil {
+					unique[i] = nil
+				} else if unique[i] != nil {
+					unique[i].Merge(*s.HLL)
+				}
+
+				var x, y []int
+				jsonutil.MustUnmarshal(s.Stats, &x)
+				jsonutil.MustUnmarshal(s.StatsUnique, &y)
+				h[i].Title = s.Title
+				h[i].Event = s.Event
+				h[i].Stats = append(h[i].Stats, Stat{
+					Day:          s.Day.Format("2006-01-02"),
+					Hourly:       x,
+					HourlyUnique: y,
+				})
+			}
+		}
+	}
+
+	// Fill in blank days.
+	endFmt := end.Format("2006-01-02")
+	for i := range h {
+		var (
+			day     = start.Add(-24 * time.Hour)
+			newStat []Stat
+			j       int
+		)
+
+		for {
+			day = day.Add(24 * time.Hour)
+			dayFmt := day.Format("2006-01-02")
+
+			if len(h[i].Stats)-1 >= j && dayFmt == h[i].Stats[j].Day {
+				newStat = append(newStat, h[i].Stats[j])
+				j++
+			} else {
+				newStat = append(newStat, Stat{Day: dayFmt, Hourly: allDays, HourlyUnique: allDays})
+			}
+			if dayFmt == endFmt {
+				break
+			}
+		}
+
+		h[i].Stats = newStat
+	}
+
+	// Apply TZ offset.
+	offset = offsetHours(offset)
+	for i := range h {
+		h[i].Stats = applyOffset(offset, h[i].Stats)
+	}
+
+	// Add total and max.
+	for i := range h {
+		for j := range h[i].Stats {
+			for k := range h[i].Stats[j].Hourly {
+				h[i].Stats[j].Daily += h[i].Stats[j].Hourly[k]
+				h[i].Stats[j].DailyUnique += h[i].Stats[j].HourlyUnique[k]
+
+				if h[i].Stats[j].Hourly[k] > h[i].Max {
+					h[i].Max = h[i].Stats[j].Hourly[k]
+				}
+			}
+			if h[i].Stats[j].Daily > h[i].DailyMax {
+				h[i].DailyMax = h[i].Stats[j].Daily
+			}
+			h[i].Count += h[i].Stats[j].Daily
+			h[i].CountUnique += h[i].Stats[j].DailyUnique
+		}
+		if unique[i] != nil {
+			h[i].CountUnique = unique[i].Count()
+			if h[i].CountUnique > h[i].Count {
+				h[i].CountUnique = h[i].Count
+			}
+		}
+
+		if h[i].Max < 10 {
+			h[i].Max = 10
+		}
+		if h[i].DailyMax < 10 {
+			h[i].DailyMax = 10
+		}
+	}
+}
+
+// offsetHours gets the TZ offset in whole hours from the offset in minutes.
+func offsetHours(offset int) int {
+	if offset%60 != 0 {
+		offset += 30
+	}
+	return offset / 60
+}
+
 // The database stores everything in UTC, so we need to apply
 // the offset for HitStats.List()
 //
@@ -765,7 +963,8 @@ func (h *HitStats) ListRefs(ctx context.Context, path string, start, end time.Ti
 	// meanwhile, and it still gets the first N rows, which is more expensive
 	// than it needs to be. It's "good enough" for now, though.
 	//
-	// TODO: count_unqiue is off here
+	// The unique count is the number of distinct sessions, which is what the
+	// HLL sketches in the *_stats tables estimate for the other lists.
 	err := zdb.MustGet(ctx).SelectContext(ctx, h, `/* HitStats.ListRefs */
 		select
 			ref as path,
@@ -816,9 +1015,10 @@ func (h *HitStats) ListPathsLike(ctx context.Context, path string) error {
 }
 
 type Stats []struct {
-	Name        string `db:"name"`
-	Count       int    `db:"count"`
-	CountUnique int    `db:"count_unique"`
+	Name        string  `db:"name"`
+	Count       int     `db:"count"`
+	CountUnique int     `db:"count_unique"`
+	Change      *Change `db:"-" json:",omitempty"` // Change in visits, if comparing to another period.
 }
 
 // ByRef lists all paths by reference.
@@ -875,6 +1075,23 @@ func (h *Stats) ListRefs(ctx context.Context, start, end time.Time, limit, offse
 		return 0, false, errors.Wrap(err, "Stats.ListRefs")
 	}
 
+	if len(*h) > 0 {
+		refs := make([]string, 0, len(*h))
+		for _, r := range *h {
+			refs = append(refs, r.Name)
+		}
+		query, uargs, err := sqlx.In(`/* Stats.ListRefs: unique */
+			select ref as name, hll from ref_stats`+where+` and ref in (?)`,
+			append(args, refs)...)
+		if err != nil {
+			return 0, false, errors.Wrap(err, "Stats.ListRefs")
+		}
+		err = h.setUnique(ctx, db.Rebind(query), uargs...)
+		if err != nil {
+			return 0, false, errors.Wrap(err, "Stats.ListRefs")
+		}
+	}
+
 	// TODO: unique totals
 	var total int
 	err = db.GetContext(ctx, &total,
@@ -910,6 +1127,13 @@ func (h *Stats) ListBrowsers(ctx context.Context, start, end time.Time) (int, er
 	if err != nil {
 		return 0, errors.Wrap(err, "Stats.ListBrowsers browsers")
 	}
+	err = h.setUnique(ctx, `/* Stats.ListBrowsers: unique */
+		select browser as name, hll from browser_stats
+		where site=$1 and day >= $2 and day <= $3
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListBrowsers browsers")
+	}
 
 	var total int
 	for _, b := range *h {
@@ -934,6 +1158,229 @@ func (h *Stats) ListBrowser(ctx context.Context, browser string, start, end time
 	if err != nil {
 		return 0, errors.Wrap(err, "Stats.ListBrowser")
 	}
+	err = h.setUnique(ctx, `/* Stats.ListBrowser: unique */
+		select browser || ' ' || version as name, hll from browser_stats
+		where site=$1 and day >= $2 and day <= $3 and lower(browser)=lower($4)
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"), browser)
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListBrowser")
+	}
+
+	var total int
+	for _, b := range *h {
+		total += b.Count
+	}
+	return total, nil
+}
+
+// ListSystems lists all operating system statistics for the given time
+// period.
+func (h *Stats) ListSystems(ctx context.Context, start, end time.Time) (int, error) {
+	err := zdb.MustGet(ctx).SelectContext(ctx, h, `/* Stats.ListSystems */
+		select
+			system as name,
+			sum(count) as count,
+			sum(count_unique) as count_unique
+		from system_stats
+		where site=$1 and day >= $2 and day <= $3
+		group by system
+		order by count desc, name
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListSystems")
+	}
+
+	var total int
+	for _, b := range *h {
+		total += b.Count
+	}
+	return total, nil
+}
+
+// ListSystem lists all the versions for one operating system.
+func (h *Stats) ListSystem(ctx context.Context, system string, start, end time.Time) (int, error) {
+	err := zdb.MustGet(ctx).SelectContext(ctx, h, `/* Stats.ListSystem */
+		select
+			system || ' ' || version as name,
+			sum(count) as count,
+			sum(count_unique) as count_unique
+		from system_stats
+		where site=$1 and day >= $2 and day <= $3 and lower(system)=lower($4)
+		group by system, version
+		order by count desc, name
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"), system)
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListSystem")
+	}
+
+	var total int
+	hh := *h
+	for i := range hh {
+		hh[i].Name = strings.TrimSpace(hh[i].Name) // No version.
+		total += hh[i].Count
+	}
+	return total, nil
+}
+
+// ListDevices lists all device type statistics for the given time period.
+func (h *Stats) ListDevices(ctx context.Context, start, end time.Time) (int, error) {
+	err := zdb.MustGet(ctx).SelectContext(ctx, h, `/* Stats.ListDevices */
+		select
+			device as name,
+			sum(count) as count,
+			sum(count_unique) as count_unique
+		from system_stats
+		where site=$1 and day >= $2 and day <= $3
+		group by device
+		order by count desc, name
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListDevices")
+	}
+
+	var total int
+	for _, b := range *h {
+		total += b.Count
+	}
+	return total, nil
+}
+
+// ListDevice lists all the operating systems for one device type.
+func (h *Stats) ListDevice(ctx context.Context, device string, start, end time.Time) (int, error) {
+	err := zdb.MustGet(ctx).SelectContext(ctx, h, `/* Stats.ListDevice */
+		select
+			system as name,
+			sum(count) as count,
+			sum(count_unique) as count_unique
+		from system_stats
+		where site=$1 and day >= $2 and day <= $3 and lower(device)=lower($4)
+		group by system
+		order by count desc, name
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"), device)
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListDevice")
+	}
+
+	var total int
+	for _, b := range *h {
+		total += b.Count
+	}
+	return total, nil
+}
+
+// ListLanguages lists all language statistics for the given time period.
+func (h *Stats) ListLanguages(ctx context.Context, start, end time.Time) (int, error) {
+	err := zdb.MustGet(ctx).SelectContext(ctx, h, `/* Stats.ListLanguages */
+		select
+			language as name,
+			sum(count) as count,
+			sum(count_unique) as count_unique
+		from language_stats
+		where site=$1 and day >= $2 and day <= $3
+		group by language
+		order by count desc, name
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListLanguages")
+	}
+
+	var total int
+	hh := *h
+	for i := range hh {
+		hh[i].Name = LanguageName(hh[i].Name)
+		total += hh[i].Count
+	}
+	return total, nil
+}
+
+// ListLanguage lists all the regional variants for one language.
+func (h *Stats) ListLanguage(ctx context.Context, language string, start, end time.Time) (int, error) {
+	err := zdb.MustGet(ctx).SelectContext(ctx, h, `/* Stats.ListLanguage */
+		select
+			coalesce(iso_3166_1.name, region) as name,
+			sum(count) as count,
+			sum(count_unique) as count_unique
+		from language_stats
+		left join iso_3166_1 on iso_3166_1.alpha2=region and region != ''
+		where site=$1 and day >= $2 and day <= $3 and language=$4
+		group by region, iso_3166_1.name
+		order by count desc, name
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"),
+		LanguageCode(language))
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListLanguage")
+	}
+
+	var total int
+	hh := *h
+	for i := range hh {
+		if hh[i].Name == "" { // No region.
+			hh[i].Name = language
+		} else {
+			hh[i].Name = language + " (" + hh[i].Name + ")"
+		}
+		total += hh[i].Count
+	}
+	return total, nil
+}
+
+// CampaignPivots are the columns campaign stats can be grouped by, and the
+// column to show when drilling down.
+var CampaignPivots = map[string]string{
+	"source":   "campaign",
+	"medium":   "source",
+	"campaign": "source",
+}
+
+// ListCampaigns lists all campaign statistics for the given time period,
+// grouped by pivot (one of CampaignPivots).
+func (h *Stats) ListCampaigns(ctx context.Context, pivot string, start, end time.Time) (int, error) {
+	if _, ok := CampaignPivots[pivot]; !ok {
+		return 0, guru.Errorf(400, "Stats.ListCampaigns: invalid pivot: %q", pivot)
+	}
+
+	err := zdb.MustGet(ctx).SelectContext(ctx, h, `/* Stats.ListCampaigns */
+		select
+			`+pivot+` as name,
+			sum(count) as count,
+			sum(count_unique) as count_unique
+		from campaign_stats
+		where site=$1 and day >= $2 and day <= $3
+		group by `+pivot+`
+		order by count desc, name
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListCampaigns")
+	}
+
+	var total int
+	for _, b := range *h {
+		total += b.Count
+	}
+	return total, nil
+}
+
+// ListCampaign lists the campaign statistics for one value of pivot, grouped
+// by the drill-down column from CampaignPivots.
+func (h *Stats) ListCampaign(ctx context.Context, pivot, name string, start, end time.Time) (int, error) {
+	detail, ok := CampaignPivots[pivot]
+	if !ok {
+		return 0, guru.Errorf(400, "Stats.ListCampaign: invalid pivot: %q", pivot)
+	}
+
+	err := zdb.MustGet(ctx).SelectContext(ctx, h, `/* Stats.ListCampaign */
+		select
+			`+detail+` as name,
+			sum(count) as count,
+			sum(count_unique) as count_unique
+		from campaign_stats
+		where site=$1 and day >= $2 and day <= $3 and `+pivot+`=$4
+		group by `+detail+`
+		order by count desc, name
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"), name)
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListCampaign")
+	}
 
 	var total int
 	for _, b := range *h {
@@ -971,12 +1418,12 @@ func (h *Stats) ListSizes(ctx context.Context, start, end time.Time) (int, error
 	// TODO: ideally I'd like to make a line chart in the future, in which case
 	// this should no longer be needed.
 	ns := Stats{
-		{sizePhones, 0, 0},
-		{sizeLargePhones, 0, 0},
-		{sizeTablets, 0, 0},
-		{sizeDesktop, 0, 0},
-		{sizeDesktopHD, 0, 0},
-		{sizeUnknown, 0, 0},
+		{sizePhones, 0, 0, nil},
+		{sizeLargePhones, 0, 0, nil},
+		{sizeTablets, 0, 0, nil},
+		{sizeDesktop, 0, 0, nil},
+		{sizeDesktopHD, 0, 0, nil},
+		{sizeUnknown, 0, 0, nil},
 	}
 
 	hh := *h
@@ -985,26 +1432,9 @@ func (h *Stats) ListSizes(ctx context.Context, start, end time.Time) (int, error
 		count += hh[i].Count
 
 		x, _ := strconv.ParseInt(hh[i].Name, 10, 16)
-		switch {
-		case x == 0:
-			ns[5].Count += hh[i].Count
-			ns[5].CountUnique += hh[i].CountUnique
-		case x <= 384:
-			ns[0].Count += hh[i].Count
-			ns[0].CountUnique += hh[i].CountUnique
-		case x <= 1024:
-			ns[1].Count += hh[i].Count
-			ns[1].CountUnique += hh[i].CountUnique
-		case x <= 1440:
-			ns[2].Count += hh[i].Count
-			ns[2].CountUnique += hh[i].CountUnique
-		case x <= 1920:
-			ns[3].Count += hh[i].Count
-			ns[3].CountUnique += hh[i].CountUnique
-		default:
-			ns[4].Count += hh[i].Count
-			ns[4].CountUnique += hh[i].CountUnique
-		}
+		g := sizeGroup(int(x))
+		ns[g].Count += hh[i].Count
+		ns[g].CountUnique += hh[i].CountUnique
 	}
 	*h = ns
 
@@ -1059,10 +1489,11 @@ func (h *Stats) ListSize(ctx context.Context, name string, start, end time.Time)
 	for width, count := range grouped {
 		total += count
 		ns = append(ns, struct {
-			Name        string `db:"name"`
-			Count       int    `db:"count"`
-			CountUnique int    `db:"count_unique"`
-		}{width, count, groupedUnique[width]})
+			Name        string  `db:"name"`
+			Count       int     `db:"count"`
+			CountUnique int     `db:"count_unique"`
+			Change      *Change `db:"-" json:",omitempty"`
+		}{width, count, groupedUnique[width], nil})
 	}
 	sort.Slice(ns, func(i int, j int) bool { return ns[i].Count > ns[j].Count })
 	*h = ns
@@ -1081,16 +1512,89 @@ func (h *Stats) ListLocations(ctx context.Context, start, end time.Time) (int, e
 		join iso_3166_1 on iso_3166_1.alpha2=location
 		where site=$1 and day >= $2 and day <= $3
 		group by location, iso_3166_1.name
-		order by count desc
+		order by count desc, name
 	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
 	if err != nil {
 		return 0, errors.Wrap(err, "Stats.ListLocations")
 	}
+	err = h.setUnique(ctx, `/* Stats.ListLocations: unique */
+		select iso_3166_1.name as name, hll from location_stats
+		join iso_3166_1 on iso_3166_1.alpha2=location
+		where site=$1 and day >= $2 and day <= $3
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListLocations")
+	}
+
+	var total int
+	for _, b := range *h {
+		total += b.Count
+	}
+
+	return total, nil
+}
+
+// ListLocation lists all the regions for one country.
+func (h *Stats) ListLocation(ctx context.Context, country string, start, end time.Time) (int, error) {
+	err := zdb.MustGet(ctx).SelectContext(ctx, h, `/* Stats.ListLocation */
+		select
+			coalesce(iso_3166_2.name, region) as name,
+			sum(count) as count,
+			sum(count_unique) as count_unique
+		from location_stats
+		join iso_3166_1 on iso_3166_1.alpha2=location
+		left join iso_3166_2 on iso_3166_2.alpha2=region
+		where site=$1 and day >= $2 and day <= $3 and iso_3166_1.name=$4
+		group by region, iso_3166_2.name
+		order by count desc, name
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"), country)
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListLocation")
+	}
+	err = h.setUnique(ctx, `/* Stats.ListLocation: unique */
+		select coalesce(iso_3166_2.name, region) as name, hll from location_stats
+		join iso_3166_1 on iso_3166_1.alpha2=location
+		left join iso_3166_2 on iso_3166_2.alpha2=region
+		where site=$1 and day >= $2 and day <= $3 and iso_3166_1.name=$4
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"), country)
+	if err != nil {
+		return 0, errors.Wrap(err, "Stats.ListLocation")
+	}
 
 	var total int
 	for _, b := range *h {
 		total += b.Count
 	}
+	return total, nil
+}
+
+// ListSessionDurations lists the session durations for the given time period,
+// grouped by the TimeBuckets.
+//
+// Every session is a unique visitor, so Count and CountUnique are identical.
+func (h *Stats) ListSessionDurations(ctx context.Context, start, end time.Time) (TimeStat, error) {
+	var st []TimeStat
+	err := zdb.MustGet(ctx).SelectContext(ctx, &st, `/* Stats.ListSessionDurations */
+		select count, total, hist
+		from session_stats
+		where site=$1 and day >= $2 and day <= $3
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return TimeStat{}, errors.Wrap(err, "Stats.ListSessionDurations")
+	}
+
+	var total TimeStat
+	for _, s := range st {
+		total.Add(s)
+	}
+
+	ns := make(Stats, len(total.Hist))
+	for i, n := range total.Hist {
+		ns[i].Name = TimeBucketName(i)
+		ns[i].Count = int(n)
+		ns[i].CountUnique = int(n)
+	}
+	*h = ns
 
 	return total, nil
 }
@@ -284,6 +284,73 @@ func TestHitDefaultsPath(t *testing.T) {
 	}
 }
 
+func TestHitDefaultsSearch(t *testing.T) {
+	tests := []struct {
+		in, wantPath, wantTerm string
+	}{
+		{"/search?q=Foo++Bar", "/search", "foo bar"},
+		{"/search?q=foo&page=2", "/search?page=2", "foo"},
+		{"/search?q=", "/search", ""},
+		{"/search", "/search", ""},
+		{"/search/x?q=foo", "/search/x?q=foo", ""},
+		{"/other?q=foo", "/other?q=foo", ""},
+
+		// Truncated without splitting the multi-byte "é".
+		{"/search?q=a" + strings.Repeat("é", 200), "/search", "a" + strings.Repeat("é", 124)},
+	}
+
+	ctx := goatcounter.WithSite(context.Background(), &goatcounter.Site{ID: 1,
+		Settings: goatcounter.SiteSettings{SearchPage: "/search?q="}})
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			h := goatcounter.Hit{Path: tt.in}
+			h.Defaults(ctx)
+
+			if h.Path != tt.wantPath || h.SearchTerm != tt.wantTerm {
+				t.Fatalf("\nout:  %q %q\nwant: %q %q", h.Path, h.SearchTerm, tt.wantPath, tt.wantTerm)
+			}
+		})
+	}
+}
+
+func TestHitDefaultsChannel(t *testing.T) {
+	tests := []struct {
+		ref, query, want string
+	}{
+		{"", "", "direct"},
+		{"https://www.google.co.nz/search?q=x", "", "search"},
+		{"https://duckduckgo.com", "", "search"},
+		{"https://news.ycombinator.com", "", "email"}, // Site rule for the "Hacker News" group.
+		{"https://lobste.rs", "", "social"},
+		{"https://old.reddit.com/r/programming", "", "social"},
+		{"https://mail.google.com", "", "email"},
+		{"https://example.com/page", "", "internal"},
+		{"https://www.example.com/page", "", "internal"},
+		{"https://arp242.net", "", "other"},
+		{"https://blog.arp242.net", "", "social"}, // Site rule.
+		{"https://lobste.rs", "ref=xx", "campaign"},
+		{"", "utm_source=news&utm_medium=email&utm_campaign=x", "email"},
+	}
+
+	site := goatcounter.Site{ID: 1, LinkDomain: "example.com"}
+	site.Settings.Campaigns = []string{"utm_campaign", "ref"}
+	site.Settings.ChannelRules = []string{"blog.arp242.net=social", "Hacker News=email"}
+	ctx := goatcounter.WithSite(context.Background(), &site)
+
+	for _, tt := range tests {
+		t.Run(tt.ref+"?"+tt.query, func(t *testing.T) {
+			h := goatcounter.Hit{Ref: tt.ref, Query: tt.query}
+			h.RefURL, _ = url.Parse(tt.ref)
+			h.Defaults(ctx)
+
+			if h.Channel != tt.want {
+				t.Errorf("\nout:  %q\nwant: %q", h.Channel, tt.want)
+			}
+		})
+	}
+}
+
 func CmpString(out, want *string) bool {
 	if out == nil && want == nil {
 		return true
@@ -0,0 +1,251 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+)
+
+// Number of bits used for the register index; this gives 4096 registers and a
+// standard error of about 1.6%.
+const (
+	hllPrecision = 12
+	hllRegisters = 1 << hllPrecision
+)
+
+// Encoding of the HLL in the database.
+const (
+	hllSparse = 0x01 // Sorted list of 2-byte register index + 1-byte value.
+	hllDense  = 0x02 // All registers, 1 byte each.
+)
+
+// HLL is a HyperLogLog sketch to estimate the number of unique sessions.
+//
+// The daily counts in the *_stats tables can't be added together to get the
+// number of unique visitors for a longer period, since the same session may
+// appear on multiple days. The sketches for every day can be merged though,
+// giving a fairly accurate estimate of the unique visitors for any range.
+//
+// Small sketches are stored as a sparse list of the registers that are set,
+// which is converted to all registers once that becomes smaller.
+type HLL struct {
+	sparse map[uint16]uint8
+	dense  []uint8
+}
+
+// AddSession adds a session ID to the sketch.
+func (h *HLL) AddSession(id int64) { h.add(fmix64(uint64(id))) }
+
+func (h *HLL) add(x uint64) {
+	idx := uint16(x >> (64 - hllPrecision))
+	rho := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	h.set(idx, rho)
+}
+
+func (h *HLL) set(idx uint16, rho uint8) {
+	if h.dense != nil {
+		if rho > h.dense[idx] {
+			h.dense[idx] = rho
+		}
+		return
+	}
+
+	if h.sparse == nil {
+		h.sparse = make(map[uint16]uint8)
+	}
+	if rho > h.sparse[idx] {
+		h.sparse[idx] = rho
+	}
+	if len(h.sparse)*3 >= hllRegisters {
+		h.dense = make([]uint8, hllRegisters)
+		for i, r := range h.sparse {
+			h.dense[i] = r
+		}
+		h.sparse = nil
+	}
+}
+
+// Merge the other sketch in to this one.
+func (h *HLL) Merge(o HLL) {
+	if o.dense != nil {
+		for i, r := range o.dense {
+			if r > 0 {
+				h.set(uint16(i), r)
+			}
+		}
+		return
+	}
+	for i, r := range o.sparse {
+		h.set(i, r)
+	}
+}
+
+// Count gets the estimated number of unique sessions.
+func (h HLL) Count() int {
+	var (
+		sum  float64
+		zero int
+	)
+	for i := 0; i < hllRegisters; i++ {
+		var r uint8
+		if h.dense != nil {
+			r = h.dense[i]
+		} else {
+			r = h.sparse[uint16(i)]
+		}
+		if r == 0 {
+			zero++
+		}
+		sum += 1 / float64(uint64(1)<<r)
+	}
+
+	m := float64(hllRegisters)
+	est := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if est <= 2.5*m && zero > 0 { // Linear counting is better for small numbers.
+		est = m * math.Log(m/float64(zero))
+	}
+	return int(math.Round(est))
+}
+
+// Value implements the SQL Value function to determine what to store in the DB.
+func (h HLL) Value() (driver.Value, error) {
+	if h.dense != nil {
+		return append([]byte{hllDense}, h.dense...), nil
+	}
+
+	idx := make([]int, 0, len(h.sparse))
+	for i := range h.sparse {
+		idx = append(idx, int(i))
+	}
+	sort.Ints(idx)
+
+	b := make([]byte, 1, 1+len(idx)*3)
+	b[0] = hllSparse
+	for _, i := range idx {
+		b = append(b, byte(i>>8), byte(i), h.sparse[uint16(i)])
+	}
+	return b, nil
+}
+
+// Scan converts the data returned from the DB into the struct.
+func (h *HLL) Scan(v interface{}) error {
+	var b []byte
+	switch vv := v.(type) {
+	case []byte:
+		b = vv
+	case string:
+		b = []byte(vv)
+	default:
+		return fmt.Errorf("HLL.Scan: unsupported type: %T", v)
+	}
+
+	*h = HLL{}
+	if len(b) == 0 {
+		return nil
+	}
+
+	switch b[0] {
+	case hllDense:
+		if len(b) != hllRegisters+1 {
+			return fmt.Errorf("HLL.Scan: wrong length for dense encoding: %d", len(b))
+		}
+		h.dense = make([]uint8, hllRegisters)
+		copy(h.dense, b[1:])
+	case hllSparse:
+		if (len(b)-1)%3 != 0 {
+			return fmt.Errorf("HLL.Scan: wrong length for sparse encoding: %d", len(b))
+		}
+		for i := 1; i < len(b); i += 3 {
+			idx := binary.BigEndian.Uint16(b[i:])
+			if idx >= hllRegisters {
+				return fmt.Errorf("HLL.Scan: register out of range: %d", idx)
+			}
+			h.set(idx, b[i+2])
+		}
+	default:
+		return fmt.Errorf("HLL.Scan: unknown encoding: %x", b[0])
+	}
+	return nil
+}
+
+// fmix64 is the MurmurHash3 finalizer; the session IDs are sequential, and
+// this makes sure all bits are well distributed.
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+type hllRow struct {
+	Name string `db:"name"`
+	HLL  *HLL   `db:"hll"`
+}
+
+// uniqueSessions merges the HLL sketches per name.
+//
+// Names are missing from the returned map if any of the rows doesn't have a
+// sketch (i.e. it was stored before we started storing them), in which case the
+// summed count_unique should be used.
+func uniqueSessions(rows []hllRow) map[string]int {
+	var (
+		merged  = make(map[string]*HLL)
+		missing = make(map[string]struct{})
+	)
+	for _, r := range rows {
+		if r.HLL == nil {
+			missing[r.Name] = struct{}{}
+			continue
+		}
+		m, ok := merged[r.Name]
+		if !ok {
+			m = &HLL{}
+			merged[r.Name] = m
+		}
+		m.Merge(*r.HLL)
+	}
+
+	counts := make(map[string]int, len(merged))
+	for name, m := range merged {
+		if _, ok := missing[name]; !ok {
+			counts[name] = m.Count()
+		}
+	}
+	return counts
+}
+
+// setUnique sets CountUnique from the merged HLL sketches; the query should
+// select the name and hll columns.
+//
+// The estimate is never more than the number of pageviews.
+func (h Stats) setUnique(ctx context.Context, query string, args ...interface{}) error {
+	var rows []hllRow
+	err := zdb.MustGet(ctx).SelectContext(ctx, &rows, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "Stats.setUnique")
+	}
+
+	u := uniqueSessions(rows)
+	for i := range h {
+		if c, ok := u[h[i].Name]; ok {
+			if c > h[i].Count {
+				c = h[i].Count
+			}
+			h[i].CountUnique = c
+		}
+	}
+	return nil
+}
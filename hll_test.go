@@ -0,0 +1,94 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	. "zgo.at/goatcounter"
+	"zgo.at/ztest"
+)
+
+func TestHLL(t *testing.T) {
+	tests := []int{0, 1, 2, 10, 100, 1000, 5000, 100000}
+
+	for _, n := range tests {
+		t.Run(fmt.Sprintf("%d", n), func(t *testing.T) {
+			var h HLL
+			for i := 1; i <= n; i++ {
+				h.AddSession(int64(i))
+				h.AddSession(int64(i)) // Duplicates shouldn't matter.
+			}
+
+			// Round-trip through the DB encoding.
+			v, err := h.Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var h2 HLL
+			err = h2.Scan(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := h2.Count()
+			if n <= 10 && got != n {
+				t.Errorf("want exactly %d, got %d", n, got)
+			}
+			if e := math.Abs(float64(got-n)) / float64(n); n > 0 && e > 0.05 {
+				t.Errorf("error too large: want %d, got %d (%.1f%%)", n, got, e*100)
+			}
+		})
+	}
+}
+
+func TestHLLMerge(t *testing.T) {
+	// Three "days" with overlapping sessions: 1-600, 400-1000, 900-3000.
+	var days [3]HLL
+	for i := 1; i <= 600; i++ {
+		days[0].AddSession(int64(i))
+	}
+	for i := 400; i <= 1000; i++ {
+		days[1].AddSession(int64(i))
+	}
+	for i := 900; i <= 3000; i++ {
+		days[2].AddSession(int64(i))
+	}
+
+	var merged HLL
+	for _, d := range days {
+		merged.Merge(d)
+	}
+	if got := merged.Count(); math.Abs(float64(got-3000))/3000 > 0.05 {
+		t.Errorf("want 3000, got %d", got)
+	}
+}
+
+func TestHLLScan(t *testing.T) {
+	tests := []struct {
+		in      interface{}
+		wantErr string
+	}{
+		{[]byte{}, ""},
+		{[]byte{0x01, 0x00, 0x01, 0x05}, ""},
+		{[]byte{0x01, 0x00, 0x01}, "wrong length"},
+		{[]byte{0x01, 0x10, 0x00, 0x05}, "out of range"},
+		{[]byte{0x02, 0x00}, "wrong length"},
+		{[]byte{0x42}, "unknown encoding"},
+		{42, "unsupported type"},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			var h HLL
+			err := h.Scan(tt.in)
+			if !ztest.ErrorContains(err, tt.wantErr) {
+				t.Errorf("wrong error\nout:  %v\nwant: %s", err, tt.wantErr)
+			}
+		})
+	}
+}
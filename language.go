@@ -0,0 +1,161 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ParseAcceptLanguage gets the primary language from an Accept-Language
+// header, as a language tag with an optional region (e.g. "en-US", "nl").
+//
+// Script and variant subtags are dropped, and an empty string is returned if
+// there is no usable language.
+func ParseAcceptLanguage(header string) string {
+	var (
+		best  string
+		bestQ = -1.0
+	)
+	for _, l := range strings.Split(header, ",") {
+		l = strings.TrimSpace(l)
+		q := 1.0
+		if i := strings.Index(l, ";"); i > -1 {
+			p := strings.TrimSpace(l[i+1:])
+			l = strings.TrimSpace(l[:i])
+			if strings.HasPrefix(p, "q=") {
+				var err error
+				q, err = strconv.ParseFloat(p[2:], 64)
+				if err != nil {
+					continue
+				}
+			}
+		}
+
+		tag := normalizeLanguage(l)
+		if tag != "" && q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return best
+}
+
+// normalizeLanguage normalizes a BCP 47 language tag to language-REGION.
+func normalizeLanguage(tag string) string {
+	sub := strings.FieldsFunc(tag, func(r rune) bool { return r == '-' || r == '_' })
+	if len(sub) == 0 {
+		return ""
+	}
+
+	lang := strings.ToLower(sub[0])
+	if len(lang) < 2 || len(lang) > 3 || !isAlpha(lang) {
+		return "" // Also catches "*".
+	}
+
+	for _, s := range sub[1:] {
+		switch {
+		case len(s) == 2 && isAlpha(s):
+			return lang + "-" + strings.ToUpper(s)
+		case len(s) == 3 && isDigit(s): // UN M.49, e.g. es-419
+			return lang + "-" + s
+		case len(s) == 4 && isAlpha(s): // Script.
+			continue
+		default:
+			return lang
+		}
+	}
+	return lang
+}
+
+func isAlpha(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// LanguageName gets the English name for a language code, or the code itself
+// if it's not known.
+func LanguageName(code string) string {
+	if n, ok := languages[code]; ok {
+		return n
+	}
+	return code
+}
+
+// LanguageCode gets the language code for a name as returned by
+// LanguageName().
+func LanguageCode(name string) string {
+	for c, n := range languages {
+		if strings.EqualFold(n, name) {
+			return c
+		}
+	}
+	return strings.ToLower(name)
+}
+
+// ISO 639-1 languages; the names are shortened a bit where it makes sense.
+var languages = map[string]string{
+	"aa": "Afar", "ab": "Abkhazian", "ae": "Avestan", "af": "Afrikaans",
+	"ak": "Akan", "am": "Amharic", "an": "Aragonese", "ar": "Arabic",
+	"as": "Assamese", "av": "Avaric", "ay": "Aymara", "az": "Azerbaijani",
+	"ba": "Bashkir", "be": "Belarusian", "bg": "Bulgarian", "bh": "Bihari",
+	"bi": "Bislama", "bm": "Bambara", "bn": "Bengali", "bo": "Tibetan",
+	"br": "Breton", "bs": "Bosnian", "ca": "Catalan", "ce": "Chechen",
+	"ch": "Chamorro", "co": "Corsican", "cr": "Cree", "cs": "Czech",
+	"cu": "Church Slavic", "cv": "Chuvash", "cy": "Welsh", "da": "Danish",
+	"de": "German", "dv": "Divehi", "dz": "Dzongkha", "ee": "Ewe",
+	"el": "Greek", "en": "English", "eo": "Esperanto", "es": "Spanish",
+	"et": "Estonian", "eu": "Basque", "fa": "Persian", "ff": "Fulah",
+	"fi": "Finnish", "fj": "Fijian", "fo": "Faroese", "fr": "French",
+	"fy": "Western Frisian", "ga": "Irish", "gd": "Scottish Gaelic", "gl": "Galician",
+	"gn": "Guarani", "gu": "Gujarati", "gv": "Manx", "ha": "Hausa",
+	"he": "Hebrew", "hi": "Hindi", "ho": "Hiri Motu", "hr": "Croatian",
+	"ht": "Haitian", "hu": "Hungarian", "hy": "Armenian", "hz": "Herero",
+	"ia": "Interlingua", "id": "Indonesian", "ie": "Interlingue", "ig": "Igbo",
+	"ii": "Sichuan Yi", "ik": "Inupiaq", "io": "Ido", "is": "Icelandic",
+	"it": "Italian", "iu": "Inuktitut", "ja": "Japanese", "jv": "Javanese",
+	"ka": "Georgian", "kg": "Kongo", "ki": "Kikuyu", "kj": "Kuanyama",
+	"kk": "Kazakh", "kl": "Kalaallisut", "km": "Khmer", "kn": "Kannada",
+	"ko": "Korean", "kr": "Kanuri", "ks": "Kashmiri", "ku": "Kurdish",
+	"kv": "Komi", "kw": "Cornish", "ky": "Kyrgyz", "la": "Latin",
+	"lb": "Luxembourgish", "lg": "Ganda", "li": "Limburgish", "ln": "Lingala",
+	"lo": "Lao", "lt": "Lithuanian", "lu": "Luba-Katanga", "lv": "Latvian",
+	"mg": "Malagasy", "mh": "Marshallese", "mi": "Maori", "mk": "Macedonian",
+	"ml": "Malayalam", "mn": "Mongolian", "mr": "Marathi", "ms": "Malay",
+	"mt": "Maltese", "my": "Burmese", "na": "Nauru", "nb": "Norwegian Bokmål",
+	"nd": "North Ndebele", "ne": "Nepali", "ng": "Ndonga", "nl": "Dutch",
+	"nn": "Norwegian Nynorsk", "no": "Norwegian", "nr": "South Ndebele", "nv": "Navajo",
+	"ny": "Chichewa", "oc": "Occitan", "oj": "Ojibwa", "om": "Oromo",
+	"or": "Oriya", "os": "Ossetian", "pa": "Punjabi", "pi": "Pali",
+	"pl": "Polish", "ps": "Pashto", "pt": "Portuguese", "qu": "Quechua",
+	"rm": "Romansh", "rn": "Rundi", "ro": "Romanian", "ru": "Russian",
+	"rw": "Kinyarwanda", "sa": "Sanskrit", "sc": "Sardinian", "sd": "Sindhi",
+	"se": "Northern Sami", "sg": "Sango", "si": "Sinhala", "sk": "Slovak",
+	"sl": "Slovenian", "sm": "Samoan", "sn": "Shona", "so": "Somali",
+	"sq": "Albanian", "sr": "Serbian", "ss": "Swati", "st": "Southern Sotho",
+	"su": "Sundanese", "sv": "Swedish", "sw": "Swahili", "ta": "Tamil",
+	"te": "Telugu", "tg": "Tajik", "th": "Thai", "ti": "Tigrinya",
+	"tk": "Turkmen", "tl": "Tagalog", "tn": "Tswana", "to": "Tongan",
+	"tr": "Turkish", "ts": "Tsonga", "tt": "Tatar", "tw": "Twi",
+	"ty": "Tahitian", "ug": "Uyghur", "uk": "Ukrainian", "ur": "Urdu",
+	"uz": "Uzbek", "ve": "Venda", "vi": "Vietnamese", "vo": "Volapük",
+	"wa": "Walloon", "wo": "Wolof", "xh": "Xhosa", "yi": "Yiddish",
+	"yo": "Yoruba", "za": "Zhuang", "zh": "Chinese", "zu": "Zulu",
+
+	// Some common ISO 639-2/3 codes without a two-letter code.
+	"fil": "Filipino", "haw": "Hawaiian", "yue": "Cantonese",
+}
@@ -16,7 +16,8 @@ import (
 
 type ms struct {
 	sync.RWMutex
-	hits []Hit
+	hits    []Hit
+	beacons []Beacon
 }
 
 var Memstore = ms{}
@@ -27,6 +28,12 @@ func (m *ms) Append(hits ...Hit) {
 	m.Unlock()
 }
 
+func (m *ms) AppendBeacon(beacons ...Beacon) {
+	m.Lock()
+	m.beacons = append(m.beacons, beacons...)
+	m.Unlock()
+}
+
 func (m *ms) Len() int {
 	m.Lock()
 	l := len(m.hits)
@@ -51,8 +58,9 @@ func (m *ms) Persist(ctx context.Context) ([]Hit, error) {
 
 	ins := bulk.NewInsert(ctx, "hits", []string{"site", "path", "ref",
 		"ref_params", "ref_original", "ref_scheme", "browser", "size",
-		"location", "created_at", "bot", "title", "event", "session",
-		"first_visit"})
+		"location", "region", "language", "utm_source", "utm_medium", "utm_campaign",
+		"utm_content", "utm_term", "channel", "last_visit", "created_at", "bot", "title",
+		"event", "session", "first_visit", "experiment", "variant", "search_term", "status"})
 	for i, h := range hits {
 		// Ignore spammers.
 		h.RefURL, _ = url.Parse(h.Ref)
@@ -88,10 +96,50 @@ func (m *ms) Persist(ctx context.Context) ([]Hit, error) {
 		hits[i] = h
 
 		ins.Values(h.Site, h.Path, h.Ref, h.RefParams, h.RefOriginal,
-			h.RefScheme, h.Browser, h.Size, h.Location,
-			h.CreatedAt.Format(zdb.Date), h.Bot, h.Title, h.Event, h.Session,
-			h.FirstVisit)
+			h.RefScheme, h.Browser, h.Size, h.Location, h.Region, h.Language,
+			h.UTMSource, h.UTMMedium, h.UTMCampaign, h.UTMContent, h.UTMTerm,
+			h.Channel, h.LastVisit, h.CreatedAt.Format(zdb.Date), h.Bot, h.Title, h.Event, h.Session,
+			h.FirstVisit, h.Experiment, h.Variant, h.SearchTerm, h.Status)
 	}
 
 	return hits, ins.Finish()
 }
+
+// Beacons gets all beacons and clears the list.
+//
+// Beacons aren't stored as-is, so unlike Persist() this doesn't write anything
+// to the database; it just runs Defaults() and Validate(), skipping invalid
+// ones.
+func (m *ms) Beacons(ctx context.Context) []Beacon {
+	m.Lock()
+	beacons := m.beacons
+	m.beacons = []Beacon{}
+	m.Unlock()
+
+	sites := make(map[int64]*Site)
+	l := zlog.Module("memstore")
+
+	valid := make([]Beacon, 0, len(beacons))
+	for _, b := range beacons {
+		site, ok := sites[b.Site]
+		if !ok {
+			site = new(Site)
+			err := site.ByID(ctx, b.Site)
+			if err != nil {
+				l.Field("beacon", b).Error(err)
+				continue
+			}
+			sites[b.Site] = site
+		}
+		ctx = WithSite(ctx, site)
+
+		b.Defaults(ctx)
+		err := b.Validate(ctx)
+		if err != nil {
+			l.Field("beacon", b).Error(err)
+			continue
+		}
+		valid = append(valid, b)
+	}
+	return valid
+}
@@ -421,6 +421,394 @@ commit;
 	alter table sites drop column name;
 	insert into version values ('2020-05-17-1-rm-user-name');
 commit;
+`),
+	"db/migrate/pgsql/2020-05-20-1-time_stats.sql": []byte(`begin;
+	create table time_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		event          integer        default 0,
+		path           varchar        not null,
+		count          int            not null,
+		total          int            not null,
+		hist           varchar        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "time_stats#site#day" on time_stats(site, day);
+
+	create table session_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		count          int            not null,
+		total          int            not null,
+		hist           varchar        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "session_stats#site#day" on session_stats(site, day);
+
+	insert into version values ('2020-05-20-1-time_stats');
+commit;
+`),
+	"db/migrate/pgsql/2020-05-21-1-scroll_stats.sql": []byte(`begin;
+	create table scroll_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		event          integer        default 0,
+		path           varchar        not null,
+		depth          int            not null,
+		count          int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "scroll_stats#site#day" on scroll_stats(site, day);
+
+	insert into version values ('2020-05-21-1-scroll_stats');
+commit;
+`),
+	"db/migrate/pgsql/2020-05-22-1-vitals_stats.sql": []byte(`begin;
+	create table vitals_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		path           varchar        not null,
+		name           varchar        not null,
+		count          int            not null,
+		hist           varchar        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "vitals_stats#site#day" on vitals_stats(site, day);
+
+	insert into version values ('2020-05-22-1-vitals_stats');
+commit;
+`),
+	"db/migrate/pgsql/2020-05-23-1-system_stats.sql": []byte(`begin;
+	create table system_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		event          integer        default 0,
+		system         varchar        not null,
+		version        varchar        not null,
+		device         varchar        not null,
+		count          int            not null,
+		count_unique   int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "system_stats#site#day"        on system_stats(site, day);
+	create index "system_stats#site#day#system" on system_stats(site, day, system);
+
+	insert into version values ('2020-05-23-1-system_stats');
+commit;
+`),
+	"db/migrate/pgsql/2020-05-24-1-language.sql": []byte(`begin;
+	alter table hits add column language varchar not null default '';
+
+	create table language_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		event          integer        default 0,
+		language       varchar        not null,
+		region         varchar        not null,
+		count          int            not null,
+		count_unique   int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "language_stats#site#day"          on language_stats(site, day);
+	create index "language_stats#site#day#language" on language_stats(site, day, language);
+
+	insert into version values ('2020-05-24-1-language');
+commit;
+`),
+	"db/migrate/pgsql/2020-05-25-1-regions.sql": []byte(`begin;
+	alter table location_stats add column region varchar not null default '';
+
+	-- Filled from the GeoIP database as regions are seen.
+	create table iso_3166_2 (
+		name   varchar        not null,
+		alpha2 varchar        not null
+	);
+	create unique index "iso_3166_2#alpha2" on iso_3166_2(alpha2);
+
+	insert into version values ('2020-05-25-1-regions');
+commit;
+`),
+	"db/migrate/pgsql/2020-05-26-1-campaign_stats.sql": []byte(`begin;
+	alter table hits add column utm_source varchar not null default '';
+	alter table hits add column utm_medium varchar not null default '';
+	alter table hits add column utm_campaign varchar not null default '';
+	alter table hits add column utm_content varchar not null default '';
+	alter table hits add column utm_term varchar not null default '';
+
+	create table campaign_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		event          integer        default 0,
+		source         varchar        not null,
+		medium         varchar        not null,
+		campaign       varchar        not null,
+		count          int            not null,
+		count_unique   int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "campaign_stats#site#day" on campaign_stats(site, day);
+
+	insert into version values ('2020-05-26-1-campaign_stats');
+commit;
+`),
+	"db/migrate/pgsql/2020-05-27-1-channel.sql": []byte(`begin;
+	alter table hits add column channel varchar not null default '';
+	alter table ref_stats add column channel varchar not null default '';
+
+	-- Other channels need a "goatcounter reindex".
+	update ref_stats set channel='direct' where ref='';
+
+	insert into version values ('2020-05-27-1-channel');
+commit;
+`),
+	"db/migrate/pgsql/2020-05-28-1-visitor_stats.sql": []byte(`begin;
+	alter table hits add column last_visit varchar not null default '';
+
+	create table visitor_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		last_visit     varchar        not null,
+		count          int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "visitor_stats#site#day" on visitor_stats(site, day);
+
+	insert into version values ('2020-05-28-1-visitor_stats');
+commit;
+`),
+	"db/migrate/pgsql/2020-05-29-1-hll.sql": []byte(`begin;
+	alter table hit_stats      add column hll bytea null;
+	alter table ref_stats      add column hll bytea null;
+	alter table browser_stats  add column hll bytea null;
+	alter table location_stats add column hll bytea null;
+
+	-- Existing rows need a "goatcounter reindex" to get correct unique counts
+	-- for ranges longer than a day.
+
+	insert into version values ('2020-05-29-1-hll');
+commit;
+`),
+	"db/migrate/pgsql/2020-05-30-1-annotations.sql": []byte(`begin;
+	create table annotations (
+		id             serial         primary key,
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		text           varchar        not null                 check(length(text) > 0),
+		url            varchar        null,
+
+		created_at     timestamp      not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "annotations#site#day" on annotations(site, day);
+
+	insert into version values ('2020-05-30-1-annotations');
+commit;
+`),
+	"db/migrate/pgsql/2020-05-31-1-path_titles.sql": []byte(`begin;
+	create table path_titles (
+		site           integer        not null                 check(site > 0),
+
+		path           varchar        not null,
+		title          varchar        not null,
+		first_seen     date           not null,
+		last_seen      date           not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "path_titles#site#path#title" on path_titles(site, path, title);
+
+	insert into version values ('2020-05-31-1-path_titles');
+commit;
+`),
+	"db/migrate/pgsql/2020-06-01-1-experiments.sql": []byte(`begin;
+	alter table hits add column experiment varchar not null default '';
+	alter table hits add column variant varchar not null default '';
+
+	create table experiments (
+		id             serial         primary key,
+		site           integer        not null                 check(site > 0),
+
+		name           varchar        not null                 check(length(name) > 0),
+		variants       varchar        not null,
+		goal           varchar        not null,
+		goal_event     integer        not null default 0,
+
+		created_at     timestamp      not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "experiments#site#name" on experiments(site, name);
+
+	create table experiment_sessions (
+		site           integer        not null                 check(site > 0),
+		experiment     integer        not null,
+		session        integer        not null,
+
+		variant        varchar        not null,
+		day            date           not null,
+		converted      date           null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict,
+		foreign key (experiment) references experiments(id) on delete restrict on update restrict
+	);
+	create unique index "experiment_sessions#site#experiment#session" on experiment_sessions(site, experiment, session);
+
+	insert into version values ('2020-06-01-1-experiments');
+commit;
+`),
+	"db/migrate/pgsql/2020-06-02-1-search_stats.sql": []byte(`begin;
+	alter table hits add column search_term varchar not null default '';
+
+	create table search_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		term           varchar        not null,
+		count          integer        not null,
+		no_pageview    integer        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "search_stats#site#day#term" on search_stats(site, day, term);
+
+	insert into version values ('2020-06-02-1-search_stats');
+commit;
+`),
+	"db/migrate/pgsql/2020-06-03-1-broken_stats.sql": []byte(`begin;
+	alter table hits add column status integer not null default 0;
+
+	create table broken_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null,
+		path           varchar        not null,
+		status         integer        not null,
+		ref            varchar        not null,
+		count          integer        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "broken_stats#site#day#path#status#ref" on broken_stats(site, day, path, status, ref);
+
+	insert into version values ('2020-06-03-1-broken_stats');
+commit;
+`),
+	"db/migrate/pgsql/2020-06-04-1-trending.sql": []byte(`begin;
+	create table trending (
+		site           integer        not null                 check(site > 0),
+
+		kind           varchar        not null                 check(kind in ('path', 'ref')),
+		name           varchar        not null,
+		count          integer        not null,
+		baseline       float          not null,
+		zscore         float          not null,
+		updated_at     timestamp      not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "trending#site#kind#name" on trending(site, kind, name);
+
+	insert into version values ('2020-06-04-1-trending');
+commit;
+`),
+	"db/migrate/pgsql/2020-06-05-1-alerts.sql": []byte(`begin;
+	create table alerts (
+		id             serial         primary key,
+		site           integer        not null                 check(site > 0),
+
+		kind           varchar        not null                 check(kind in ('spike', 'drop', 'no_hits', 'new_ref', 'goal')),
+		threshold      integer        not null                 check(threshold > 0),
+		goal           varchar        not null default '',
+		cooldown       integer        not null default 24,
+		last_sent      timestamp      null,
+
+		created_at     timestamp      not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "alerts#site" on alerts(site);
+
+	create table alert_history (
+		id             serial         primary key,
+		site           integer        not null                 check(site > 0),
+		alert          integer        not null,
+
+		message        varchar        not null,
+		sent_at        timestamp      not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "alert_history#site#sent_at" on alert_history(site, sent_at);
+
+	insert into version values ('2020-06-05-1-alerts');
+commit;
+`),
+	"db/migrate/pgsql/2020-06-06-1-webhooks.sql": []byte(`begin;
+	create table webhooks (
+		id             serial         primary key,
+		site           integer        not null                 check(site > 0),
+
+		url            varchar        not null,
+		secret         varchar        not null,
+		events         varchar        not null,
+		last_summary   date           null,
+
+		created_at     timestamp      not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "webhooks#site" on webhooks(site);
+
+	create table webhook_deliveries (
+		id             serial         primary key,
+		site           integer        not null                 check(site > 0),
+		webhook        integer        not null,
+
+		event          varchar        not null,
+		payload        varchar        not null,
+		state          varchar        not null default 'pending' check(state in ('pending', 'delivered', 'failed')),
+		attempts       integer        not null default 0,
+		response_code  integer        not null default 0,
+		error          varchar        not null default '',
+		next_attempt   timestamp      not null,
+
+		created_at     timestamp      not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict,
+		foreign key (webhook) references webhooks(id) on delete restrict on update restrict
+	);
+	create index "webhook_deliveries#state#next_attempt" on webhook_deliveries(state, next_attempt);
+	create index "webhook_deliveries#site#created_at"    on webhook_deliveries(site, created_at);
+
+	insert into version values ('2020-06-06-1-webhooks');
+commit;
+`),
+	"db/migrate/pgsql/2020-06-07-1-hits_region.sql": []byte(`begin;
+	alter table hits add column region varchar not null default '';
+
+	-- The region code was stored in the location column.
+	update hits set region=location, location=substr(location, 1, 2) where location like '__-%';
+
+	insert into version values ('2020-06-07-1-hits_region');
+commit;
 `),
 }
 
@@ -917,48 +1305,436 @@ commit;
 	insert into version values ('2020-05-17-1-rm-user-name');
 commit;
 `),
-}
+	"db/migrate/sqlite/2020-05-20-1-time_stats.sql": []byte(`begin;
+	create table time_stats (
+		site           integer        not null                 check(site > 0),
 
-var Public = map[string][]byte{
-	"public/all.min.css": []byte(`
-/* FILE: ./aside.css */
-aside {
-  hyphens: auto;
-}
-aside {
-  position: absolute;
-  left: -15em;
-  width: 14em;
-  text-align: right;
-  font-size: .9em;
-}
-@media (max-width: 83em) {
-  aside {
-    position: static;
-    width: auto;
-    text-align: left;
-    background-color: #f7f7f7;
-    padding: .4em 2em;
-    border: 1px solid #aaa;
-    hyphens: none;
-  }
-}
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		event          integer        default 0,
+		path           varchar        not null,
+		count          int            not null,
+		total          int            not null,
+		hist           varchar        not null,
 
-/* FILE: ./base.css */
-@font-face {
-	font-family: 'Lato';
-	font-style: normal;
-	font-weight: 400;
-	font-display: fallback;
-	src: local('Lato'), local('Lato Regular'),
-		url('/fonts/latolatin.woff2') format('woff2'),
-		url('./fonts/latolatin.woff2') format('woff2');
-}
-@font-face {
-	font-family: 'Lato';
-	font-style: normal;
-	font-weight: 700;
-	font-display: fallback;
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "time_stats#site#day" on time_stats(site, day);
+
+	create table session_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		count          int            not null,
+		total          int            not null,
+		hist           varchar        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "session_stats#site#day" on session_stats(site, day);
+
+	insert into version values ('2020-05-20-1-time_stats');
+commit;
+`),
+	"db/migrate/sqlite/2020-05-21-1-scroll_stats.sql": []byte(`begin;
+	create table scroll_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		event          integer        default 0,
+		path           varchar        not null,
+		depth          int            not null,
+		count          int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "scroll_stats#site#day" on scroll_stats(site, day);
+
+	insert into version values ('2020-05-21-1-scroll_stats');
+commit;
+`),
+	"db/migrate/sqlite/2020-05-22-1-vitals_stats.sql": []byte(`begin;
+	create table vitals_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		path           varchar        not null,
+		name           varchar        not null,
+		count          int            not null,
+		hist           varchar        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "vitals_stats#site#day" on vitals_stats(site, day);
+
+	insert into version values ('2020-05-22-1-vitals_stats');
+commit;
+`),
+	"db/migrate/sqlite/2020-05-23-1-system_stats.sql": []byte(`begin;
+	create table system_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		event          integer        default 0,
+		system         varchar        not null,
+		version        varchar        not null,
+		device         varchar        not null,
+		count          int            not null,
+		count_unique   int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "system_stats#site#day"        on system_stats(site, day);
+	create index "system_stats#site#day#system" on system_stats(site, day, system);
+
+	insert into version values ('2020-05-23-1-system_stats');
+commit;
+`),
+	"db/migrate/sqlite/2020-05-24-1-language.sql": []byte(`begin;
+	alter table hits add column language varchar not null default '';
+
+	create table language_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		event          integer        default 0,
+		language       varchar        not null,
+		region         varchar        not null,
+		count          int            not null,
+		count_unique   int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "language_stats#site#day"          on language_stats(site, day);
+	create index "language_stats#site#day#language" on language_stats(site, day, language);
+
+	insert into version values ('2020-05-24-1-language');
+commit;
+`),
+	"db/migrate/sqlite/2020-05-25-1-regions.sql": []byte(`begin;
+	alter table location_stats add column region varchar not null default '';
+
+	-- Filled from the GeoIP database as regions are seen.
+	create table iso_3166_2 (
+		name   varchar        not null,
+		alpha2 varchar        not null
+	);
+	create unique index "iso_3166_2#alpha2" on iso_3166_2(alpha2);
+
+	insert into version values ('2020-05-25-1-regions');
+commit;
+`),
+	"db/migrate/sqlite/2020-05-26-1-campaign_stats.sql": []byte(`begin;
+	alter table hits add column utm_source varchar not null default '';
+	alter table hits add column utm_medium varchar not null default '';
+	alter table hits add column utm_campaign varchar not null default '';
+	alter table hits add column utm_content varchar not null default '';
+	alter table hits add column utm_term varchar not null default '';
+
+	create table campaign_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		event          integer        default 0,
+		source         varchar        not null,
+		medium         varchar        not null,
+		campaign       varchar        not null,
+		count          int            not null,
+		count_unique   int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "campaign_stats#site#day" on campaign_stats(site, day);
+
+	insert into version values ('2020-05-26-1-campaign_stats');
+commit;
+`),
+	"db/migrate/sqlite/2020-05-27-1-channel.sql": []byte(`begin;
+	alter table hits add column channel varchar not null default '';
+	alter table ref_stats add column channel varchar not null default '';
+
+	-- Other channels need a "goatcounter reindex".
+	update ref_stats set channel='direct' where ref='';
+
+	insert into version values ('2020-05-27-1-channel');
+commit;
+`),
+	"db/migrate/sqlite/2020-05-28-1-visitor_stats.sql": []byte(`begin;
+	alter table hits add column last_visit varchar not null default '';
+
+	create table visitor_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		last_visit     varchar        not null,
+		count          int            not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "visitor_stats#site#day" on visitor_stats(site, day);
+
+	insert into version values ('2020-05-28-1-visitor_stats');
+commit;
+`),
+	"db/migrate/sqlite/2020-05-29-1-hll.sql": []byte(`begin;
+	alter table hit_stats      add column hll blob null;
+	alter table ref_stats      add column hll blob null;
+	alter table browser_stats  add column hll blob null;
+	alter table location_stats add column hll blob null;
+
+	-- Existing rows need a "goatcounter reindex" to get correct unique counts
+	-- for ranges longer than a day.
+
+	insert into version values ('2020-05-29-1-hll');
+commit;
+`),
+	"db/migrate/sqlite/2020-05-30-1-annotations.sql": []byte(`begin;
+	create table annotations (
+		id             integer        primary key autoincrement,
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		text           varchar        not null                 check(length(text) > 0),
+		url            varchar        null,
+
+		created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "annotations#site#day" on annotations(site, day);
+
+	insert into version values ('2020-05-30-1-annotations');
+commit;
+`),
+	"db/migrate/sqlite/2020-05-31-1-path_titles.sql": []byte(`begin;
+	create table path_titles (
+		site           integer        not null                 check(site > 0),
+
+		path           varchar        not null,
+		title          varchar        not null,
+		first_seen     date           not null                 check(first_seen = strftime('%Y-%m-%d', first_seen)),
+		last_seen      date           not null                 check(last_seen = strftime('%Y-%m-%d', last_seen)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "path_titles#site#path#title" on path_titles(site, path, title);
+
+	insert into version values ('2020-05-31-1-path_titles');
+commit;
+`),
+	"db/migrate/sqlite/2020-06-01-1-experiments.sql": []byte(`begin;
+	alter table hits add column experiment varchar not null default '';
+	alter table hits add column variant varchar not null default '';
+
+	create table experiments (
+		id             integer        primary key autoincrement,
+		site           integer        not null                 check(site > 0),
+
+		name           varchar        not null                 check(length(name) > 0),
+		variants       varchar        not null,
+		goal           varchar        not null,
+		goal_event     int            not null default 0,
+
+		created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "experiments#site#name" on experiments(site, name);
+
+	create table experiment_sessions (
+		site           integer        not null                 check(site > 0),
+		experiment     integer        not null,
+		session        integer        not null,
+
+		variant        varchar        not null,
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		converted      date           null                     check(converted = strftime('%Y-%m-%d', converted)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict,
+		foreign key (experiment) references experiments(id) on delete restrict on update restrict
+	);
+	create unique index "experiment_sessions#site#experiment#session" on experiment_sessions(site, experiment, session);
+
+	insert into version values ('2020-06-01-1-experiments');
+commit;
+`),
+	"db/migrate/sqlite/2020-06-02-1-search_stats.sql": []byte(`begin;
+	alter table hits add column search_term varchar not null default '';
+
+	create table search_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		term           varchar        not null,
+		count          integer        not null,
+		no_pageview    integer        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "search_stats#site#day#term" on search_stats(site, day, term);
+
+	insert into version values ('2020-06-02-1-search_stats');
+commit;
+`),
+	"db/migrate/sqlite/2020-06-03-1-broken_stats.sql": []byte(`begin;
+	alter table hits add column status integer not null default 0;
+
+	create table broken_stats (
+		site           integer        not null                 check(site > 0),
+
+		day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+		path           varchar        not null,
+		status         integer        not null,
+		ref            varchar        not null,
+		count          integer        not null,
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "broken_stats#site#day#path#status#ref" on broken_stats(site, day, path, status, ref);
+
+	insert into version values ('2020-06-03-1-broken_stats');
+commit;
+`),
+	"db/migrate/sqlite/2020-06-04-1-trending.sql": []byte(`begin;
+	create table trending (
+		site           integer        not null                 check(site > 0),
+
+		kind           varchar        not null                 check(kind in ('path', 'ref')),
+		name           varchar        not null,
+		count          integer        not null,
+		baseline       float          not null,
+		zscore         float          not null,
+		updated_at     timestamp      not null                 check(updated_at = strftime('%Y-%m-%d %H:%M:%S', updated_at)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create unique index "trending#site#kind#name" on trending(site, kind, name);
+
+	insert into version values ('2020-06-04-1-trending');
+commit;
+`),
+	"db/migrate/sqlite/2020-06-05-1-alerts.sql": []byte(`begin;
+	create table alerts (
+		id             integer        primary key autoincrement,
+		site           integer        not null                 check(site > 0),
+
+		kind           varchar        not null                 check(kind in ('spike', 'drop', 'no_hits', 'new_ref', 'goal')),
+		threshold      integer        not null                 check(threshold > 0),
+		goal           varchar        not null default '',
+		cooldown       integer        not null default 24,
+		last_sent      timestamp      null                     check(last_sent = strftime('%Y-%m-%d %H:%M:%S', last_sent)),
+
+		created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "alerts#site" on alerts(site);
+
+	create table alert_history (
+		id             integer        primary key autoincrement,
+		site           integer        not null                 check(site > 0),
+		alert          integer        not null,
+
+		message        varchar        not null,
+		sent_at        timestamp      not null                 check(sent_at = strftime('%Y-%m-%d %H:%M:%S', sent_at)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "alert_history#site#sent_at" on alert_history(site, sent_at);
+
+	insert into version values ('2020-06-05-1-alerts');
+commit;
+`),
+	"db/migrate/sqlite/2020-06-06-1-webhooks.sql": []byte(`begin;
+	create table webhooks (
+		id             integer        primary key autoincrement,
+		site           integer        not null                 check(site > 0),
+
+		url            varchar        not null,
+		secret         varchar        not null,
+		events         varchar        not null,
+		last_summary   date           null                     check(last_summary = strftime('%Y-%m-%d', last_summary)),
+
+		created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict
+	);
+	create index "webhooks#site" on webhooks(site);
+
+	create table webhook_deliveries (
+		id             integer        primary key autoincrement,
+		site           integer        not null                 check(site > 0),
+		webhook        integer        not null,
+
+		event          varchar        not null,
+		payload        varchar        not null,
+		state          varchar        not null default 'pending' check(state in ('pending', 'delivered', 'failed')),
+		attempts       integer        not null default 0,
+		response_code  integer        not null default 0,
+		error          varchar        not null default '',
+		next_attempt   timestamp      not null                 check(next_attempt = strftime('%Y-%m-%d %H:%M:%S', next_attempt)),
+
+		created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+		foreign key (site) references sites(id) on delete restrict on update restrict,
+		foreign key (webhook) references webhooks(id) on delete restrict on update restrict
+	);
+	create index "webhook_deliveries#state#next_attempt" on webhook_deliveries(state, next_attempt);
+	create index "webhook_deliveries#site#created_at"    on webhook_deliveries(site, created_at);
+
+	insert into version values ('2020-06-06-1-webhooks');
+commit;
+`),
+	"db/migrate/sqlite/2020-06-07-1-hits_region.sql": []byte(`begin;
+	alter table hits add column region varchar not null default '';
+
+	-- The region code was stored in the location column.
+	update hits set region=location, location=substr(location, 1, 2) where location like '__-%';
+
+	insert into version values ('2020-06-07-1-hits_region');
+commit;
+`),
+}
+
+var Public = map[string][]byte{
+	"public/all.min.css": []byte(`
+/* FILE: ./aside.css */
+aside {
+  hyphens: auto;
+}
+aside {
+  position: absolute;
+  left: -15em;
+  width: 14em;
+  text-align: right;
+  font-size: .9em;
+}
+@media (max-width: 83em) {
+  aside {
+    position: static;
+    width: auto;
+    text-align: left;
+    background-color: #f7f7f7;
+    padding: .4em 2em;
+    border: 1px solid #aaa;
+    hyphens: none;
+  }
+}
+
+/* FILE: ./base.css */
+@font-face {
+	font-family: 'Lato';
+	font-style: normal;
+	font-weight: 400;
+	font-display: fallback;
+	src: local('Lato'), local('Lato Regular'),
+		url('/fonts/latolatin.woff2') format('woff2'),
+		url('./fonts/latolatin.woff2') format('woff2');
+}
+@font-face {
+	font-family: 'Lato';
+	font-style: normal;
+	font-weight: 700;
+	font-display: fallback;
 	src: local('Lato Bold'), local('Lato Bold'),
 		url('/fonts/latolatin-bold.woff2') format('woff2'),
 		url('./fonts/latolatin-bold.woff2') format('woff2');
@@ -1427,6 +2203,9 @@ h1 a:after, h2 a:after, h3 a:after, h4 a:after, h5 a:after, h6 a:after {
 			s: [window.screen.width, window.screen.height, (window.devicePixelRatio || 1)],
 			b: is_bot(),
 			q: location.search,
+			x:  (vars.experiment === undefined ? goatcounter.experiment : vars.experiment),
+			xv: (vars.variant    === undefined ? goatcounter.variant    : vars.variant),
+			st: (vars.status     === undefined ? goatcounter.status     : vars.status),
 		}
 
 		var rcb, pcb, tcb  // Save callbacks to apply later.
@@ -1480,14 +2259,143 @@ h1 a:after, h2 a:after, h3 a:after, h4 a:after, h5 a:after, h6 a:after {
 		return '?' + p.join('&')
 	}
 
-	// Count a hit.
-	window.goatcounter.count = function(vars) {
-		if ('visibilityState' in document && document.visibilityState === 'prerender')
-			return
-		if (location !== parent.location)  // Frame
-			return
-		if (!goatcounter.allow_local && location.hostname.match(/(localhost$|^127\.|^10\.|^172\.(1[6-9]|2[0-9]|3[0-1])\.|^192\.168\.)/))
-			return
+	// Get how long ago the previous visit was, as a coarse bucket. Only the day
+	// of the last visit is stored, and this returns null if we already counted
+	// a pageview today so every visitor is reported just once per day.
+	var last_visit = function() {
+		try {
+			var k     = 'goatcounter-last-visit',
+			    today = Math.floor(Date.now() / 864e5),
+			    last  = parseInt(localStorage.getItem(k), 10)
+			if (last === today)
+				return null
+			localStorage.setItem(k, today)
+		} catch (e) {  // localStorage disabled.
+			return null
+		}
+
+		if (isNaN(last))
+			return 'new'
+		var d = today - last
+		return d <= 1 ? '1d' : d <= 7 ? '7d' : d <= 30 ? '30d' : 'older'
+	}
+
+	// The pageview we're measuring the time on page and scroll depth for; this
+	// is reported with a beacon every time the page is hidden. Only the time
+	// the page is visible is counted: start is null while it's hidden, and
+	// visible is the time from previous visible intervals. last has the values
+	// sent with the last beacon.
+	var page = null
+
+	// Get how far the page is scrolled, in percent.
+	var scroll_depth = function() {
+		var d = document.documentElement,
+		    h = Math.max(d.scrollHeight, document.body ? document.body.scrollHeight : 0)
+		if (h <= window.innerHeight)  // Not scrollable.
+			return 100
+		return Math.min(100, Math.round((window.pageYOffset + window.innerHeight) / h * 100))
+	}
+
+	// Core Web Vitals for the initial page load, if enabled; these are only sent
+	// for the first page as they don't apply to navigation in SPAs. INP and CLS
+	// keep changing until the page is unloaded.
+	var vitals = null
+	var observe_vitals = function() {
+		if (!window.PerformanceObserver)
+			return
+		var v = vitals = {}
+
+		var observe = function(type, opts, cb) {
+			try {
+				var o = new PerformanceObserver(function(list) { list.getEntries().forEach(cb) })
+				opts.type = type
+				opts.buffered = true
+				o.observe(opts)
+			} catch (e) {}  // Type not supported.
+		}
+
+		var cls = 0
+		observe('largest-contentful-paint', {}, function(e) { v.lcp = Math.round(e.startTime) })
+		observe('layout-shift', {}, function(e) {
+			if (!e.hadRecentInput)
+				cls += e.value
+			v.cls = Math.round(cls * 1000)
+		})
+		observe('event', {durationThreshold: 40}, function(e) {
+			if (e.interactionId)
+				v.inp = Math.max(v.inp || 0, Math.round(e.duration))
+		})
+	}
+
+	// Add the navigation timing and Core Web Vitals to the beacon data.
+	var add_vitals = function(data, v) {
+		for (var k in v)
+			data[k] = v[k]
+
+		var n = window.performance && performance.getEntriesByType && performance.getEntriesByType('navigation')[0]
+		if (n) {
+			data.ttfb = Math.round(n.responseStart)
+			if (n.loadEventEnd > 0)
+				data.ld = Math.round(n.loadEventEnd)
+		}
+	}
+
+	// Send the beacon for the current page, if any, and stop measuring it if
+	// done is set.
+	//
+	// Every beacon reports the visible time so far, and the scroll depth and
+	// vitals if they changed since the last beacon. The values from the last
+	// beacon are sent too (prefixed with a "p") so they're replaced when the
+	// visitor returns to the page, rather than counting the page twice. A time
+	// of 0 isn't recorded, so that's never sent as the previous time.
+	var send_beacon = function(done) {
+		if (!page || !navigator.sendBeacon)
+			return
+
+		var p = page
+		if (done === true)
+			page = null
+		if (p.start !== null) {
+			p.visible += Date.now() - p.start
+			p.start = null
+		}
+
+		var tp      = Math.round(p.visible / 1000),
+		    data    = {p: p.path, tp: tp},
+		    changed = tp > 0 && tp !== p.last.tp,
+		    cur     = {}
+		if (p.last.tp !== undefined)
+			data.ptp = p.last.tp
+		if (goatcounter.scroll_depth)
+			cur.sd = Math.floor(p.scroll / 25) * 25
+		if (p.vitals)
+			add_vitals(cur, p.vitals)
+		for (var k in cur) {
+			if (cur[k] === p.last[k])
+				continue
+			changed = true
+			data[k] = cur[k]
+			if (p.last[k] !== undefined)
+				data['p' + k] = p.last[k]
+			p.last[k] = cur[k]
+		}
+		if (!changed)
+			return
+		if (tp > 0)
+			p.last.tp = tp
+
+		data.rnd = Math.random().toString(36).substr(2, 5)
+		navigator.sendBeacon(p.endpoint + to_params(data))
+	}
+
+	// Count a hit.
+	window.goatcounter.count = function(vars) {
+		if ('visibilityState' in document && document.visibilityState === 'prerender')
+			return
+		if (location !== parent.location)  // Frame
+			return
+		if (!goatcounter.allow_local && location.hostname.match(/(localhost$|^127\.|^10\.|^172\.(1[6-9]|2[0-9]|3[0-1])\.|^192\.168\.)/))
+			return
 
 		var script   = document.querySelector('script[data-goatcounter]'),
 		    endpoint = (window.goatcounter.endpoint || window.counter)  // counter is for compat; don't use.
@@ -1498,6 +2406,8 @@ h1 a:after, h2 a:after, h3 a:after, h4 a:after, h5 a:after, h6 a:after {
 		if (data.p === null)  // null from user callback.
 			return
 
+		if (goatcounter.returning && !data.e)
+			data.lv = last_visit()
 		data.rnd = Math.random().toString(36).substr(2, 5)  // Browsers don't always listen to Cache-Control.
 
 		var img = document.createElement('img'),
@@ -1510,6 +2420,13 @@ h1 a:after, h2 a:after, h3 a:after, h4 a:after, h5 a:after, h6 a:after {
 		setTimeout(rm, 3000)  // In case the onload isn't triggered.
 		img.addEventListener('load', rm, false)
 		document.body.appendChild(img)
+
+		if (!data.e && !goatcounter.no_beacon) {
+			send_beacon(true)  // Previous page in SPAs.
+			page = {endpoint: endpoint, path: data.p, start: Date.now(), visible: 0,
+			        last: {}, scroll: scroll_depth(), vitals: vitals}
+			vitals = null
+		}
 	}
 
 	// Get a query parameter.
@@ -1543,6 +2460,25 @@ h1 a:after, h2 a:after, h3 a:after, h4 a:after, h5 a:after, h6 a:after {
 		})
 	}
 
+	// Send the beacon as soon as the page is hidden, as there's no guarantee
+	// we'll get an unload event on mobile. The visitor may come back to the
+	// page, so keep measuring it.
+	document.addEventListener('visibilitychange', function() {
+		if (!page)
+			return
+		if (document.visibilityState === 'hidden')
+			send_beacon(false)
+		else if (document.visibilityState === 'visible' && page.start === null)
+			page.start = Date.now()
+	}, false)
+	window.addEventListener('pagehide', function() { send_beacon(true) }, false)
+	if (goatcounter.web_vitals)
+		observe_vitals()
+	window.addEventListener('scroll', function() {
+		if (page && goatcounter.scroll_depth)
+			page.scroll = Math.max(page.scroll, scroll_depth())
+	}, {passive: true})
+
 	if (!goatcounter.no_onload) {
 		var go = function() {
 			goatcounter.count()
@@ -11789,7 +12725,7 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 		;[report_errors, period_select, load_refs, tooltip, paginate_paths,
 			paginate_refs, hchart_detail, settings_tabs, paginate_locations,
 			billing_subscribe, setup_datepicker, filter_paths, add_ip, fill_tz,
-			paginate_toprefs, draw_chart,
+			paginate_toprefs, draw_chart, campaign_pivot, heatmap_path,
 		].forEach(function(f) { f.call() })
 	});
 
@@ -11837,6 +12773,10 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 			$(chart).find('>div').each(function(i, bar) {
 				var h = bar.style.height
 				bar.style.height = '100%'
+				if (bar.dataset.c)
+					$('<div class="compare"></div>').css('height', bar.dataset.c).appendTo(bar)
+				if (bar.dataset.a)
+					$('<div class="annotation"></div>').appendTo(bar)
 				if (bar.className === 'f')
 					return
 				else if (h === '')
@@ -11858,6 +12798,17 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 		})
 	}
 
+	// Load the heatmap for a single path.
+	var heatmap_path = function() {
+		$('.heatmap-path').on('change', function(e) {
+			jQuery.ajax({
+				url:     '/heatmap',
+				data:    append_period({path: $(this).val().trim()}),
+				success: function(data) { $('.heatmap-wrap').html(data.html) },
+			})
+		})
+	}
+
 	// Add current IP address to ignore_ips.
 	var add_ip = function() {
 		$('#add-ip').on('click', function(e) {
@@ -11920,7 +12871,17 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 				jQuery.ajax({
 					url:     '/pages',
 					data:    append_period({filter: filter}),
-					success: function(data) { update_pages(data, true); },
+					global:  false,  // Don't report syntax errors in the filter.
+					success: function(data) {
+						$('#filter-paths').removeClass('invalid');
+						update_pages(data, true);
+					},
+					error: function(xhr) {
+						if (xhr.status !== 400)
+							return;
+						$('#filter-paths').addClass('invalid').attr('title',
+							(xhr.responseJSON || {}).error || 'Invalid filter');
+					},
 				});
 			}, 300);
 		});
@@ -11976,6 +12937,9 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 			td.text(format_int(data.total_display));
 			tu.text(format_int(data.total_unique));
 			ud.text(format_int(data.total_unique_display));
+			if (data.total_change)
+				$('.pages-list .total-change').text(data.total_change).
+					removeClass('change-up change-down change-none').addClass(data.total_change_class);
 		}
 		else {
 			td.text(format_int(parseInt(td.text().replace(/[^0-9]/, ''), 10) + data.total_display));
@@ -11987,10 +12951,21 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 
 	// Highlight a filter pattern in the path and title.
 	var highlight_filter = function(s) {
-		if (s === '')
+		// Only highlight the plain terms; not negated terms, regular
+		// expressions, or referrers.
+		var terms = [];
+		s.split(/\s+/).forEach(function(t) {
+			if (t === '' || t[0] === '-' || t[0] === '~' || t.indexOf('ref:') === 0)
+				return;
+			t = t.replace(/^(path|title):/, '').replace(/["*]/g, '');
+			if (t !== '')
+				terms.push(quote_re(t));
+		});
+		if (terms.length === 0)
 			return;
+
 		$('.pages-list .count-list-pages > tbody').find('.rlink, .page-title:not(.no-title)').each(function(_, elem) {
-			elem.innerHTML = elem.innerHTML.replace(new RegExp('' + quote_re(s) + '', 'gi'), '<b>$&</b>');
+			elem.innerHTML = elem.innerHTML.replace(new RegExp(terms.join('|'), 'gi'), '<b>$&</b>');
 		});
 	};
 
@@ -12004,12 +12979,18 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 		// They also don't really look all that great. Especially the Firefox
 		// one looks pretty fucked.
 		if (is_mobile()) {
-			return $('#period-start, #period-end').
+			return $('#period-start, #period-end, #compare-start, #compare-end, #annotation-day').
 				attr('type', 'date').
 				css('width', 'auto');  // Make sure there's room for UI chrome.
 		}
 		new Pikaday({field: $('#period-start')[0], toString: format_date_ymd, parse: get_date, firstDay: SETTINGS.sunday_starts_week ? 0 : 1});
 		new Pikaday({field: $('#period-end')[0],   toString: format_date_ymd, parse: get_date, firstDay: SETTINGS.sunday_starts_week ? 0 : 1});
+		if ($('#compare-start').length) {
+			new Pikaday({field: $('#compare-start')[0], toString: format_date_ymd, parse: get_date, firstDay: SETTINGS.sunday_starts_week ? 0 : 1});
+			new Pikaday({field: $('#compare-end')[0],   toString: format_date_ymd, parse: get_date, firstDay: SETTINGS.sunday_starts_week ? 0 : 1});
+		}
+		if ($('#annotation-day').length)
+			new Pikaday({field: $('#annotation-day')[0], toString: format_date_ymd, parse: get_date, firstDay: SETTINGS.sunday_starts_week ? 0 : 1});
 	};
 
 	// Subscribe with Stripe.
@@ -12096,6 +13077,27 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 		});
 	};
 
+	// Change the grouping of the campaign chart.
+	var campaign_pivot = function() {
+		$('.campaign-chart .campaign-pivot a').on('click', function(e) {
+			e.preventDefault();
+
+			var link  = $(this),
+				pivot = link.attr('data-pivot'),
+				bar   = $('.campaign-chart .chart-hbar:first');
+			jQuery.ajax({
+				url:  '/campaigns',
+				data: append_period({pivot: pivot}),
+				success: function(data) {
+					bar.parent().find('.hbar-detail').remove();
+					bar.removeClass('hbar-open').attr('data-detail', '/campaign?pivot=' + pivot).html(data.html);
+					link.parent().find('a').removeClass('active');
+					link.addClass('active');
+				},
+			});
+		});
+	};
+
 	// Set up the tabbed navigation in the settings.
 	var settings_tabs = function() {
 		var nav = $('.tab-nav');
@@ -12211,7 +13213,19 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 			$(this).closest('form').trigger('submit')
 		})
 
+		$('#group').on('change', function(e) {
+			$(this).closest('form').trigger('submit')
+		})
+
+		$('#compare').on('change', function(e) {
+			if (this.value === 'custom')
+				return $('.compare-custom').css('display', 'inline')
+			$(this).closest('form').trigger('submit')
+		})
+
 		$('.period-form-select').on('click', 'button', function(e) {
+			if (this.type === 'submit')  // "Go" for the custom compare range.
+				return
 			e.preventDefault();
 
 			var start = new Date(), end = new Date();
@@ -12352,15 +13366,24 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 			// Reformat the title in the chart.
 			if (t.is('div') && t.closest('.chart-bar').length > 0) {
 				if ($('.pages-list').hasClass('pages-list-daily')) {
-					var [day, views, unique] = title.split('|')
-					title = ` + "`" + `${format_date(day)}` + "`" + `
+					var [day, views, unique, prev] = title.split('|')
+					if ($('.pages-list').hasClass('pages-list-week'))
+						title = ` + "`" + `Week of ${format_date(day)}` + "`" + `
+					else if ($('.pages-list').hasClass('pages-list-month'))
+						title = ` + "`" + `${months[get_date(day).getMonth()]} ${get_date(day).getFullYear()}` + "`" + `
+					else
+						title = ` + "`" + `${format_date(day)}` + "`" + `
 				}
 				else {
-					var [day, start, end, views, unique] = title.split('|')
+					var [day, start, end, views, unique, prev] = title.split('|')
 					title = ` + "`" + `${format_date(day)} ${un24(start)} – ${un24(end)}` + "`" + `
 				}
 
 				title += !views ? ', future' : ` + "`" + `, ${unique} visits; <span class="views">${views} pageviews</span>` + "`" + `
+				if (prev !== undefined)
+					title += ` + "`" + `<br>Compared to: <span class="views">${prev} pageviews</span>` + "`" + `
+				if (t[0].dataset.a)
+					title += '<br>' + t[0].dataset.a.split('\n').map((a) => ` + "`" + `<span class="annotation">${escape_html(a)}</span>` + "`" + `).join('<br>')
 			}
 			t.attr('data-title', title).removeAttr('title')
 
@@ -12402,6 +13425,12 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 		history.pushState(null, '', join_query(params));
 	}
 
+	// Escape HTML special characters.
+	var escape_html = function(s) {
+		return s.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').
+			replace(/"/g, '&quot;').replace(/'/g, '&#x27;');
+	};
+
 	// Convert "23:45" to "11:45 pm".
 	var un24 = function(t) {
 		if (SETTINGS.twenty_four_hours)
@@ -12484,6 +13513,17 @@ http://nicolasgallagher.com/micro-clearfix-hack/
 		data = data || {};
 		data['period-start'] = $('#period-start').val();
 		data['period-end']   = $('#period-end').val();
+		if ($('#group').length)
+			data['group'] = $('#group').val();
+		if ($('#compare').val()) {
+			data['compare']       = $('#compare').val();
+			data['compare-start'] = $('#compare-start').val();
+			data['compare-end']   = $('#compare-end').val();
+		}
+		$('.period-form-segment').find('input, select').each(function(_, e) {
+			if ($(e).val())
+				data[e.name] = $(e).val();
+		});
 		return data;
 	};
 
@@ -12815,6 +13855,9 @@ form .err  { color: red; display: block; }
 .period-form-date input[type="text"]     { width: 9em; text-align: center; }
 .period-form-date input[type="checkbox"] { vertical-align: middle; }
 .period-form-move            { display: flex; justify-content: space-between; padding: .2em; }
+.period-form-segment         { padding: .2em; }
+.period-form-segment input[type="text"]  { width: 8em; text-align: left; }
+.period-form-segment p       { margin: .2em 0 0 0; }
 
 @media (max-width: 62.5rem) {
 	.period-form-select          { display: block; }
@@ -12905,6 +13948,20 @@ form .err  { color: red; display: block; }
 	width: 100%;
 }
 .chart-bar > .f         { background-color: #eee; }
+.chart-bar > div > .compare { border-top: 2px solid #e69500; }
+.chart-bar > div > .annotation {
+	top: 0;
+	width: 0;
+	border-left: 2px dashed #0a6ebd;
+}
+#tooltip .annotation { color: #0a6ebd; }
+
+/* Change compared to another period. */
+.change             { font-style: normal; font-size: .9em; white-space: nowrap; }
+.change-up          { color: #2a8a2a; }
+.change-down        { color: #c00; }
+.change-none        { color: #999; }
+.chart-hbar .change { position: absolute; top: 0; right: 0; }
 
 #tooltip {
 	position: absolute;
@@ -12955,6 +14012,28 @@ table.auto { width: auto; }
 	.browser-charts > div { width: auto; }
 }
 
+table.vitals               { width: auto; }
+table.vitals th            { text-align: right; }
+table.vitals td + td       { text-align: right; min-width: 5em; }
+table.vitals td.vital-good { color: #1f7a1f; }
+table.vitals td.vital-poor { color: #b30000; }
+
+table.heatmap                { width: 100%; table-layout: fixed; border-collapse: separate; border-spacing: 1px; }
+table.heatmap th             { font-weight: normal; font-size: .8em; text-align: left; padding: 0 .2em; }
+table.heatmap tbody th       { width: 3em; }
+table.heatmap td             { height: 1.2em; padding: 0; }
+.heatmap-path                { margin-bottom: .5em; }
+
+table.daily-bars                { width: 100%; }
+table.daily-bars td             { vertical-align: middle; }
+table.daily-bars td:first-child { white-space: nowrap; }
+table.daily-bars td + td        { text-align: right; width: 5em; }
+table.daily-bars td + td + td   { width: auto; }
+table.daily-bars .chart-bar     { height: 40px; }
+
+.campaign-pivot          { margin: 0 0 .5em 0; }
+.campaign-pivot a.active { font-weight: bold; color: #252525; text-decoration: none; }
+
 .chart-hbar a, .chart-hbar > p {
 	position: relative;
 	margin: 0;
@@ -13066,6 +14145,7 @@ header.h2 { border-bottom: 1px solid #252525; padding-bottom: .2em; margin: 1em
 .header-pages input#filter-paths,
 .header-pages select#display { padding: .2em; margin-right: 1em; }
 .header-pages input.value { background-color: yellow; }
+.header-pages input.invalid { background-color: #fdd; }
 
 @media (max-width: 30rem) {
 	.header-pages input#filter-paths { max-width: 10em; }
@@ -13079,6 +14159,34 @@ h3 + h4 { margin-top: .3em; }
 /* Grey out "pageviews" out when put next to visitors */
 .views          { color: #999; }
 #tooltip .views { color: #bbb; }
+
+.title-history            { margin-bottom: .5em; }
+.title-history ul         { margin: 0; padding-left: 1.5em; }
+.title-history li span    { color: #666; font-size: .9em; margin-left: .5em; }
+.page-vitals              { margin-bottom: .5em; }
+
+.experiment-results th, .experiment-results td { text-align: left; padding-right: 1em; }
+
+.search-terms    { width: 100%; }
+.search-terms th { text-align: left; }
+.search-terms td { word-break: break-all; }
+
+.broken-pages    { width: 100%; }
+.broken-pages th { text-align: left; }
+.broken-pages td { word-break: break-all; vertical-align: top; }
+
+.sitemap-form input[type="text"]   { width: 20em; }
+.sitemap-form #period-start,
+.sitemap-form #period-end          { width: 8em; }
+.sitemap-report td                 { word-break: break-all; }
+
+.trending            { border: 1px solid #f4b942; background-color: #fff8e6; padding: .5em 1em; margin-bottom: 1em; }
+.trending h2         { margin-top: 0; }
+.trending ul         { margin: 0; }
+.trending strong     { word-break: break-all; }
+
+.alert-history td:last-child { white-space: pre-line; }
+.webhook-deliveries td:last-child { word-break: break-word; }
 `),
 }
 
@@ -13154,6 +14262,19 @@ create table hits (
 	browser        varchar        not null,
 	size           varchar        not null default '',
 	location       varchar        not null default '',
+	region         varchar        not null default '',
+	language       varchar        not null default '',
+	utm_source     varchar        not null default '',
+	utm_medium     varchar        not null default '',
+	utm_campaign   varchar        not null default '',
+	utm_content    varchar        not null default '',
+	utm_term       varchar        not null default '',
+	channel        varchar        not null default '',
+	last_visit     varchar        not null default '',
+	experiment     varchar        not null default '',
+	variant        varchar        not null default '',
+	search_term    varchar        not null default '',
+	status         integer        not null default 0,
 	first_visit    integer        default 0,
 
 	created_at     timestamp      not null
@@ -13194,6 +14315,7 @@ create table hit_stats (
 	title          varchar        not null default '',
 	stats          varchar        not null,
 	stats_unique   varchar        not null,
+	hll            bytea          null,
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
@@ -13208,39 +14330,107 @@ create table browser_stats (
 	version        varchar        not null,
 	count          int            not null,
 	count_unique   int            not null,
+	hll            bytea          null,
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
 create index "browser_stats#site#day"         on browser_stats(site, day);
 create index "browser_stats#site#day#browser" on browser_stats(site, day, browser);
 
+create table system_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null,
+	event          integer        default 0,
+	system         varchar        not null,
+	version        varchar        not null,
+	device         varchar        not null,
+	count          int            not null,
+	count_unique   int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "system_stats#site#day"        on system_stats(site, day);
+create index "system_stats#site#day#system" on system_stats(site, day, system);
+
+create table language_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null,
+	event          integer        default 0,
+	language       varchar        not null,
+	region         varchar        not null,
+	count          int            not null,
+	count_unique   int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "language_stats#site#day"          on language_stats(site, day);
+create index "language_stats#site#day#language" on language_stats(site, day, language);
+
 create table location_stats (
 	site           integer        not null                 check(site > 0),
 
 	day            date           not null,
 	event          integer        default 0,
 	location       varchar        not null,
+	region         varchar        not null default '',
 	count          int            not null,
 	count_unique   int            not null,
+	hll            bytea          null,
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
 create index "location_stats#site#day"          on location_stats(site, day);
 create index "location_stats#site#day#location" on location_stats(site, day, location);
 
+create table iso_3166_2 (
+	name   varchar        not null,
+	alpha2 varchar        not null
+);
+create unique index "iso_3166_2#alpha2" on iso_3166_2(alpha2);
+
 create table ref_stats (
 	site           integer        not null                 check(site > 0),
 
 	day            date           not null,
 	event          integer        default 0,
 	ref            varchar        not null,
+	channel        varchar        not null default '',
 	count          int            not null,
 	count_unique   int            not null,
+	hll            bytea          null,
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
 create index "ref_stats#site#day" on ref_stats(site, day);
 
+create table campaign_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null,
+	event          integer        default 0,
+	source         varchar        not null,
+	medium         varchar        not null,
+	campaign       varchar        not null,
+	count          int            not null,
+	count_unique   int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "campaign_stats#site#day" on campaign_stats(site, day);
+
+create table visitor_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null,
+	last_visit     varchar        not null,
+	count          int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "visitor_stats#site#day" on visitor_stats(site, day);
+
 create table size_stats (
 	site           integer        not null                 check(site > 0),
 
@@ -13255,6 +14445,216 @@ create table size_stats (
 create index "size_stats#site#day"       on size_stats(site, day);
 create index "size_stats#site#day#width" on size_stats(site, day, width);
 
+create table time_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null,
+	event          integer        default 0,
+	path           varchar        not null,
+	count          int            not null,
+	total          int            not null,
+	hist           varchar        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "time_stats#site#day" on time_stats(site, day);
+
+create table session_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null,
+	count          int            not null,
+	total          int            not null,
+	hist           varchar        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "session_stats#site#day" on session_stats(site, day);
+
+create table scroll_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null,
+	event          integer        default 0,
+	path           varchar        not null,
+	depth          int            not null,
+	count          int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "scroll_stats#site#day" on scroll_stats(site, day);
+
+create table vitals_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null,
+	path           varchar        not null,
+	name           varchar        not null,
+	count          int            not null,
+	hist           varchar        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "vitals_stats#site#day" on vitals_stats(site, day);
+
+create table annotations (
+	id             serial         primary key,
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null,
+	text           varchar        not null                 check(length(text) > 0),
+	url            varchar        null,
+
+	created_at     timestamp      not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "annotations#site#day" on annotations(site, day);
+
+create table path_titles (
+	site           integer        not null                 check(site > 0),
+
+	path           varchar        not null,
+	title          varchar        not null,
+	first_seen     date           not null,
+	last_seen      date           not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create unique index "path_titles#site#path#title" on path_titles(site, path, title);
+
+create table experiments (
+	id             serial         primary key,
+	site           integer        not null                 check(site > 0),
+
+	name           varchar        not null                 check(length(name) > 0),
+	variants       varchar        not null,
+	goal           varchar        not null,
+	goal_event     integer        not null default 0,
+
+	created_at     timestamp      not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create unique index "experiments#site#name" on experiments(site, name);
+
+create table experiment_sessions (
+	site           integer        not null                 check(site > 0),
+	experiment     integer        not null,
+	session        integer        not null,
+
+	variant        varchar        not null,
+	day            date           not null,
+	converted      date           null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict,
+	foreign key (experiment) references experiments(id) on delete restrict on update restrict
+);
+create unique index "experiment_sessions#site#experiment#session" on experiment_sessions(site, experiment, session);
+
+create table search_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null,
+	term           varchar        not null,
+	count          integer        not null,
+	no_pageview    integer        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create unique index "search_stats#site#day#term" on search_stats(site, day, term);
+
+create table broken_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null,
+	path           varchar        not null,
+	status         integer        not null,
+	ref            varchar        not null,
+	count          integer        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create unique index "broken_stats#site#day#path#status#ref" on broken_stats(site, day, path, status, ref);
+
+create table trending (
+	site           integer        not null                 check(site > 0),
+
+	kind           varchar        not null                 check(kind in ('path', 'ref')),
+	name           varchar        not null,
+	count          integer        not null,
+	baseline       float          not null,
+	zscore         float          not null,
+	updated_at     timestamp      not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create unique index "trending#site#kind#name" on trending(site, kind, name);
+
+create table alerts (
+	id             serial         primary key,
+	site           integer        not null                 check(site > 0),
+
+	kind           varchar        not null                 check(kind in ('spike', 'drop', 'no_hits', 'new_ref', 'goal')),
+	threshold      integer        not null                 check(threshold > 0),
+	goal           varchar        not null default '',
+	cooldown       integer        not null default 24,
+	last_sent      timestamp      null,
+
+	created_at     timestamp      not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "alerts#site" on alerts(site);
+
+create table alert_history (
+	id             serial         primary key,
+	site           integer        not null                 check(site > 0),
+	alert          integer        not null,
+
+	message        varchar        not null,
+	sent_at        timestamp      not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "alert_history#site#sent_at" on alert_history(site, sent_at);
+
+create table webhooks (
+	id             serial         primary key,
+	site           integer        not null                 check(site > 0),
+
+	url            varchar        not null,
+	secret         varchar        not null,
+	events         varchar        not null,
+	last_summary   date           null,
+
+	created_at     timestamp      not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "webhooks#site" on webhooks(site);
+
+create table webhook_deliveries (
+	id             serial         primary key,
+	site           integer        not null                 check(site > 0),
+	webhook        integer        not null,
+
+	event          varchar        not null,
+	payload        varchar        not null,
+	state          varchar        not null default 'pending' check(state in ('pending', 'delivered', 'failed')),
+	attempts       integer        not null default 0,
+	response_code  integer        not null default 0,
+	error          varchar        not null default '',
+	next_attempt   timestamp      not null,
+
+	created_at     timestamp      not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict,
+	foreign key (webhook) references webhooks(id) on delete restrict on update restrict
+);
+create index "webhook_deliveries#state#next_attempt" on webhook_deliveries(state, next_attempt);
+create index "webhook_deliveries#site#created_at"    on webhook_deliveries(site, created_at);
+
 create table iso_3166_1 (
 	name   varchar,
 	alpha2 varchar
@@ -13607,7 +15007,27 @@ insert into version values
 	('2020-04-22-1-campaigns'),
 	('2020-04-27-1-usage-flags'),
 	('2020-05-13-1-unique-path'),
-	('2020-05-17-1-rm-user-name');
+	('2020-05-17-1-rm-user-name'),
+	('2020-05-20-1-time_stats'),
+	('2020-05-21-1-scroll_stats'),
+	('2020-05-22-1-vitals_stats'),
+	('2020-05-23-1-system_stats'),
+	('2020-05-24-1-language'),
+	('2020-05-25-1-regions'),
+	('2020-05-26-1-campaign_stats'),
+	('2020-05-27-1-channel'),
+	('2020-05-28-1-visitor_stats'),
+	('2020-05-29-1-hll'),
+	('2020-05-30-1-annotations'),
+	('2020-05-31-1-path_titles'),
+	('2020-06-01-1-experiments'),
+	('2020-06-02-1-search_stats'),
+	('2020-06-03-1-broken_stats'),
+	('2020-06-04-1-trending'),
+	('2020-06-05-1-alerts'),
+	('2020-06-06-1-webhooks'),
+	('2020-06-07-1-hits_region'),
+	('2020-06-08-1-content_groups_lines');
 
 -- vim:ft=sql
 `)
@@ -13671,106 +15091,398 @@ create table hits (
 	browser        varchar        not null,
 	size           varchar        not null default '',
 	location       varchar        not null default '',
+	region         varchar        not null default '',
+	language       varchar        not null default '',
+	utm_source     varchar        not null default '',
+	utm_medium     varchar        not null default '',
+	utm_campaign   varchar        not null default '',
+	utm_content    varchar        not null default '',
+	utm_term       varchar        not null default '',
+	channel        varchar        not null default '',
+	last_visit     varchar        not null default '',
+	experiment     varchar        not null default '',
+	variant        varchar        not null default '',
+	search_term    varchar        not null default '',
+	status         integer        not null default 0,
 	first_visit    int            default 0,
 
-	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at))
+	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at))
+);
+create index "hits#site#bot#created_at"      on hits(site, bot, created_at);
+create index "hits#site#bot#path#created_at" on hits(site, bot, lower(path), created_at);
+
+create table sessions (
+	id             integer        primary key autoincrement,
+	site           integer        not null                 check(site > 0),
+	hash           blob           null,
+	created_at     timestamp      not null,
+	last_seen      timestamp      not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create unique index "sessions#site#hash" on sessions(site, hash);
+
+create table session_paths (
+	session        integer        not null,
+	path           varchar        not null,
+
+	foreign key (session) references sessions(id) on delete cascade on update cascade
+);
+
+create table session_salts (
+	previous    int        not null,
+	salt        varchar    not null,
+	created_at  timestamp  not null
+);
+
+create table hit_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	path           varchar        not null,
+	title          varchar        not null default '',
+	stats          varchar        not null,
+	stats_unique   varchar        not null,
+	hll            blob           null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "hit_stats#site#day" on hit_stats(site, day);
+
+create table browser_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	browser        varchar        not null,
+	version        varchar        not null,
+	count          int            not null,
+	count_unique   int            not null,
+	hll            blob           null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "browser_stats#site#day"         on browser_stats(site, day);
+create index "browser_stats#site#day#browser" on browser_stats(site, day, browser);
+
+create table system_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	system         varchar        not null,
+	version        varchar        not null,
+	device         varchar        not null,
+	count          int            not null,
+	count_unique   int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "system_stats#site#day"        on system_stats(site, day);
+create index "system_stats#site#day#system" on system_stats(site, day, system);
+
+create table language_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	language       varchar        not null,
+	region         varchar        not null,
+	count          int            not null,
+	count_unique   int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "language_stats#site#day"          on language_stats(site, day);
+create index "language_stats#site#day#language" on language_stats(site, day, language);
+
+create table location_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	location       varchar        not null,
+	region         varchar        not null default '',
+	count          int            not null,
+	count_unique   int            not null,
+	hll            blob           null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "location_stats#site#day"          on location_stats(site, day);
+create index "location_stats#site#day#location" on location_stats(site, day, location);
+
+create table iso_3166_2 (
+	name   varchar        not null,
+	alpha2 varchar        not null
+);
+create unique index "iso_3166_2#alpha2" on iso_3166_2(alpha2);
+
+create table ref_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	ref            varchar        not null,
+	channel        varchar        not null default '',
+	count          int            not null,
+	count_unique   int            not null,
+	hll            blob           null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "ref_stats#site#day" on ref_stats(site, day);
+
+create table campaign_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	source         varchar        not null,
+	medium         varchar        not null,
+	campaign       varchar        not null,
+	count          int            not null,
+	count_unique   int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "campaign_stats#site#day" on campaign_stats(site, day);
+
+create table visitor_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	last_visit     varchar        not null,
+	count          int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "visitor_stats#site#day" on visitor_stats(site, day);
+
+create table size_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	width          int            not null,
+	count          int            not null,
+	count_unique   int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "size_stats#site#day"       on size_stats(site, day);
+create index "size_stats#site#day#width" on size_stats(site, day, width);
+
+create table time_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	path           varchar        not null,
+	count          int            not null,
+	total          int            not null,
+	hist           varchar        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "time_stats#site#day" on time_stats(site, day);
+
+create table session_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	count          int            not null,
+	total          int            not null,
+	hist           varchar        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "session_stats#site#day" on session_stats(site, day);
+
+create table scroll_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	event          integer        default 0,
+	path           varchar        not null,
+	depth          int            not null,
+	count          int            not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "scroll_stats#site#day" on scroll_stats(site, day);
+
+create table vitals_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	path           varchar        not null,
+	name           varchar        not null,
+	count          int            not null,
+	hist           varchar        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "vitals_stats#site#day" on vitals_stats(site, day);
+
+create table annotations (
+	id             integer        primary key autoincrement,
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	text           varchar        not null                 check(length(text) > 0),
+	url            varchar        null,
+
+	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
+);
+create index "annotations#site#day" on annotations(site, day);
+
+create table path_titles (
+	site           integer        not null                 check(site > 0),
+
+	path           varchar        not null,
+	title          varchar        not null,
+	first_seen     date           not null                 check(first_seen = strftime('%Y-%m-%d', first_seen)),
+	last_seen      date           not null                 check(last_seen = strftime('%Y-%m-%d', last_seen)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
 );
-create index "hits#site#bot#created_at"      on hits(site, bot, created_at);
-create index "hits#site#bot#path#created_at" on hits(site, bot, lower(path), created_at);
+create unique index "path_titles#site#path#title" on path_titles(site, path, title);
 
-create table sessions (
+create table experiments (
 	id             integer        primary key autoincrement,
 	site           integer        not null                 check(site > 0),
-	hash           blob           null,
-	created_at     timestamp      not null,
-	last_seen      timestamp      not null,
+
+	name           varchar        not null                 check(length(name) > 0),
+	variants       varchar        not null,
+	goal           varchar        not null,
+	goal_event     int            not null default 0,
+
+	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
-create unique index "sessions#site#hash" on sessions(site, hash);
+create unique index "experiments#site#name" on experiments(site, name);
 
-create table session_paths (
+create table experiment_sessions (
+	site           integer        not null                 check(site > 0),
+	experiment     integer        not null,
 	session        integer        not null,
-	path           varchar        not null,
 
-	foreign key (session) references sessions(id) on delete cascade on update cascade
+	variant        varchar        not null,
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	converted      date           null                     check(converted = strftime('%Y-%m-%d', converted)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict,
+	foreign key (experiment) references experiments(id) on delete restrict on update restrict
 );
+create unique index "experiment_sessions#site#experiment#session" on experiment_sessions(site, experiment, session);
 
-create table session_salts (
-	previous    int        not null,
-	salt        varchar    not null,
-	created_at  timestamp  not null
+create table search_stats (
+	site           integer        not null                 check(site > 0),
+
+	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
+	term           varchar        not null,
+	count          integer        not null,
+	no_pageview    integer        not null,
+
+	foreign key (site) references sites(id) on delete restrict on update restrict
 );
+create unique index "search_stats#site#day#term" on search_stats(site, day, term);
 
-create table hit_stats (
+create table broken_stats (
 	site           integer        not null                 check(site > 0),
 
 	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
-	event          integer        default 0,
 	path           varchar        not null,
-	title          varchar        not null default '',
-	stats          varchar        not null,
-	stats_unique   varchar        not null,
+	status         integer        not null,
+	ref            varchar        not null,
+	count          integer        not null,
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
-create index "hit_stats#site#day" on hit_stats(site, day);
+create unique index "broken_stats#site#day#path#status#ref" on broken_stats(site, day, path, status, ref);
 
-create table browser_stats (
+create table trending (
 	site           integer        not null                 check(site > 0),
 
-	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
-	event          integer        default 0,
-	browser        varchar        not null,
-	version        varchar        not null,
-	count          int            not null,
-	count_unique   int            not null,
+	kind           varchar        not null                 check(kind in ('path', 'ref')),
+	name           varchar        not null,
+	count          integer        not null,
+	baseline       float          not null,
+	zscore         float          not null,
+	updated_at     timestamp      not null                 check(updated_at = strftime('%Y-%m-%d %H:%M:%S', updated_at)),
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
-create index "browser_stats#site#day"         on browser_stats(site, day);
-create index "browser_stats#site#day#browser" on browser_stats(site, day, browser);
+create unique index "trending#site#kind#name" on trending(site, kind, name);
 
-create table location_stats (
+create table alerts (
+	id             integer        primary key autoincrement,
 	site           integer        not null                 check(site > 0),
 
-	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
-	event          integer        default 0,
-	location       varchar        not null,
-	count          int            not null,
-	count_unique   int            not null,
+	kind           varchar        not null                 check(kind in ('spike', 'drop', 'no_hits', 'new_ref', 'goal')),
+	threshold      integer        not null                 check(threshold > 0),
+	goal           varchar        not null default '',
+	cooldown       integer        not null default 24,
+	last_sent      timestamp      null                     check(last_sent = strftime('%Y-%m-%d %H:%M:%S', last_sent)),
+
+	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
-create index "location_stats#site#day"          on location_stats(site, day);
-create index "location_stats#site#day#location" on location_stats(site, day, location);
+create index "alerts#site" on alerts(site);
 
-create table ref_stats (
+create table alert_history (
+	id             integer        primary key autoincrement,
 	site           integer        not null                 check(site > 0),
+	alert          integer        not null,
 
-	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
-	event          integer        default 0,
-	ref            varchar        not null,
-	count          int            not null,
-	count_unique   int            not null,
+	message        varchar        not null,
+	sent_at        timestamp      not null                 check(sent_at = strftime('%Y-%m-%d %H:%M:%S', sent_at)),
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
-create index "ref_stats#site#day" on ref_stats(site, day);
+create index "alert_history#site#sent_at" on alert_history(site, sent_at);
 
-create table size_stats (
+create table webhooks (
+	id             integer        primary key autoincrement,
 	site           integer        not null                 check(site > 0),
 
-	day            date           not null                 check(day = strftime('%Y-%m-%d', day)),
-	event          integer        default 0,
-	width          int            not null,
-	count          int            not null,
-	count_unique   int            not null,
+	url            varchar        not null,
+	secret         varchar        not null,
+	events         varchar        not null,
+	last_summary   date           null                     check(last_summary = strftime('%Y-%m-%d', last_summary)),
+
+	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
 
 	foreign key (site) references sites(id) on delete restrict on update restrict
 );
-create index "size_stats#site#day"       on size_stats(site, day);
-create index "size_stats#site#day#width" on size_stats(site, day, width);
+create index "webhooks#site" on webhooks(site);
+
+create table webhook_deliveries (
+	id             integer        primary key autoincrement,
+	site           integer        not null                 check(site > 0),
+	webhook        integer        not null,
+
+	event          varchar        not null,
+	payload        varchar        not null,
+	state          varchar        not null default 'pending' check(state in ('pending', 'delivered', 'failed')),
+	attempts       integer        not null default 0,
+	response_code  integer        not null default 0,
+	error          varchar        not null default '',
+	next_attempt   timestamp      not null                 check(next_attempt = strftime('%Y-%m-%d %H:%M:%S', next_attempt)),
+
+	created_at     timestamp      not null                 check(created_at = strftime('%Y-%m-%d %H:%M:%S', created_at)),
+
+	foreign key (site) references sites(id) on delete restrict on update restrict,
+	foreign key (webhook) references webhooks(id) on delete restrict on update restrict
+);
+create index "webhook_deliveries#state#next_attempt" on webhook_deliveries(state, next_attempt);
+create index "webhook_deliveries#site#created_at"    on webhook_deliveries(site, created_at);
 
 create table iso_3166_1 (
 	name   varchar,
@@ -14114,7 +15826,27 @@ insert into version values
 	('2020-04-27-1-usage-flags'),
 	('2020-04-28-1-fix'),
 	('2020-05-13-1-unique-path'),
-	('2020-05-17-1-rm-user-name');
+	('2020-05-17-1-rm-user-name'),
+	('2020-05-20-1-time_stats'),
+	('2020-05-21-1-scroll_stats'),
+	('2020-05-22-1-vitals_stats'),
+	('2020-05-23-1-system_stats'),
+	('2020-05-24-1-language'),
+	('2020-05-25-1-regions'),
+	('2020-05-26-1-campaign_stats'),
+	('2020-05-27-1-channel'),
+	('2020-05-28-1-visitor_stats'),
+	('2020-05-29-1-hll'),
+	('2020-05-30-1-annotations'),
+	('2020-05-31-1-path_titles'),
+	('2020-06-01-1-experiments'),
+	('2020-06-02-1-search_stats'),
+	('2020-06-03-1-broken_stats'),
+	('2020-06-04-1-trending'),
+	('2020-06-05-1-alerts'),
+	('2020-06-06-1-webhooks'),
+	('2020-06-07-1-hits_region'),
+	('2020-06-08-1-content_groups_lines');
 `)
 var Templates = map[string][]byte{
 	"tpl/_backend_bottom.gohtml": []byte(`	</div> {{- /* .page */}}
@@ -14171,12 +15903,15 @@ var Templates = map[string][]byte{
 		<td>
 			<span title="Visits">{{nformat $h.CountUnique $.Site}}</span><br>
 			<span title="Pageviews" class="views">{{nformat $h.Count $.Site}}</span><br>
+			{{if $h.Change}}<em class="change {{$h.Change.Class}}" title="{{nformat $h.Change.Prev $.Site}} visits in the comparison period">{{$h.Change.Percentage}}</em>{{end}}
 		</td>
 		<td class="hide-mobile">
 			<a class="rlink" title="{{$h.Path}}" href="?showrefs={{$h.Path}}&period-start={{tformat $.Site $.PeriodStart ""}}&period-end={{tformat $.Site $.PeriodEnd ""}}#{{$h.Path}}">{{$h.Path}}</a><br>
 			<small class="page-title {{if not $h.Title}}no-title{{end}}">{{if $h.Title}}{{$h.Title}}{{else}}<em>(no title)</em>{{end}}</small>
 			{{if $h.Event}}<sup class="label-event">event</sup>{{end}}
 			{{if and $.Site.LinkDomain (not $h.Event)}}<sup><a class="go" target="_blank" rel="noopener" href="https://{{$.Site.LinkDomain}}{{$h.Path}}">go</a></sup>{{end}}
+			{{if $h.TimeOnPage}}<br><small class="time-on-page" title="Time on page">{{$h.TimeOnPage}}</small>{{end}}
+			{{if $h.ScrollDepth}}<br><small class="scroll-depth" title="Percentage of visitors who scrolled to at least this depth">Scrolled to {{$h.ScrollDepth}}</small>{{end}}
 		</td>
 		<td>
 			<div class="show-mobile">
@@ -14195,7 +15930,7 @@ var Templates = map[string][]byte{
 				{{bar_chart $.Context .Stats $max $.Daily}}
 			</div>
 			<div class="refs">{{if and $.Refs (eq $.ShowRefs $h.Path)}}
-				{{template "_backend_refs.gohtml" map "Refs" $.Refs "Site" $.Site}}
+				{{template "_backend_refs.gohtml" map "Refs" $.Refs "Titles" $.Titles "Site" $.Site}}
 				{{if $.MoreRefs}}<a href="#_", class="load-more-refs">Show more</a>{{end}}
 			{{end}}</div>
 		</td>
@@ -14204,7 +15939,21 @@ var Templates = map[string][]byte{
 	<tr><td colspan="3"><em>Nothing to display</em></td></tr>
 {{- end}}
 `),
-	"tpl/_backend_refs.gohtml": []byte(`<table class="count-list count-list-refs"><tbody>
+	"tpl/_backend_refs.gohtml": []byte(`{{if gt (len .Titles) 1}}
+<div class="title-history">
+	<strong>Titles</strong>
+	<ul>{{range $t := .Titles}}
+		<li>{{$t.Title}} <span>{{$t.FirstSeen.Format $.Site.Settings.DateFormat}} – {{$t.LastSeen.Format $.Site.Settings.DateFormat}}</span></li>
+	{{end}}</ul>
+</div>
+{{end}}
+{{if .Vitals}}
+<div class="page-vitals">
+	<strong>Page speed</strong>
+	{{template "_backend_vitals.gohtml" .}}
+</div>
+{{end}}
+<table class="count-list count-list-refs"><tbody>
 {{range $r := .Refs}}
 	<tr>
 		<td><span title="Visits">{{nformat $r.CountUnique $.Site}}</span></td>
@@ -14323,11 +16072,13 @@ referrer.</p>
 
 <pre><code>script-src  https://{{.CountDomain}}
 img-src     {{.Site.URL}}/count
+connect-src {{.Site.URL}}/count
 </code></pre>
 
 <p>The <code>script-src</code> is needed to load the <code>count.js</code> script, and the <code>img-src</code> is
 needed to send pageviews to GoatCounter (which are loaded with a “tracking
-pixel”).</p>
+pixel”). The <code>connect-src</code> is needed to send the time spent on the page when
+it’s closed.</p>
 
 <h2 id="customizing">Customizing <a href="#customizing"></a></h2>
 <p>Customisation is done with the <code>window.goatcounter</code> object; the following keys
@@ -14351,6 +16102,22 @@ are supported:</p>
       <td style="text-align: left"><code>no_events</code></td>
       <td style="text-align: left">Don’t bind click events.</td>
     </tr>
+    <tr>
+      <td style="text-align: left"><code>no_beacon</code></td>
+      <td style="text-align: left">Don’t send the time spent on the page when the page is closed or hidden.</td>
+    </tr>
+    <tr>
+      <td style="text-align: left"><code>scroll_depth</code></td>
+      <td style="text-align: left">Also send how far the page was scrolled (in steps of 25%) when the page is closed or hidden.</td>
+    </tr>
+    <tr>
+      <td style="text-align: left"><code>web_vitals</code></td>
+      <td style="text-align: left">Also send the page load timings and Core Web Vitals (LCP, CLS, INP) when the page is closed or hidden.</td>
+    </tr>
+    <tr>
+      <td style="text-align: left"><code>returning</code></td>
+      <td style="text-align: left">Store the day of the last visit in <code>localStorage</code> to report new and returning visitors; see the <a href="https://github.com/zgoat/goatcounter/blob/master/docs/sessions.markdown#returning-visitors">sessions documentation</a>.</td>
+    </tr>
     <tr>
       <td style="text-align: left"><code>allow_local</code></td>
       <td style="text-align: left">Allow requests from local addresses (<code>localhost</code>, <code>192.168.0.0</code>, etc.) for testing the integration locally.</td>
@@ -14673,7 +16440,7 @@ middleware. It supports the following query parameters:</p>
   <li><code>t</code> → <code>title</code></li>
   <li><code>r</code> → <code>referrer</code></li>
   <li><code>s</code> → screen size, as <code>x,y,scaling</code>.</li>
-  <li><code>q</code> → Query parameters, for getting the campaign.</li>
+  <li><code>q</code> → Query parameters, for getting the campaign and <code>utm_*</code> parameters.</li>
   <li><code>b</code> → hint if this should be considered a bot; should be one of the
       <a href="https://github.com/zgoat/isbot/blob/master/isbot.go#L28"><code>JSBot*</code> constants from isbot</a>; note the backend may override
       this if it detects a bot using another method.</li>
@@ -14682,7 +16449,7 @@ middleware. It supports the following query parameters:</p>
 </ul>
 
 <p>The <code>User-Agent</code> header and remote address are used for the browser and
-location.</p>
+location, and the <code>Accept-Language</code> header for the language.</p>
 
 <p>Calling it from the middleware will probably result in more bot requests, as
 mentioned in the previous section.</p>
@@ -14816,6 +16583,18 @@ want to modify that in JavaScript; you can use <code>goatcounter.endpoint</code>
 
 	<div class="page">
 	{{- if .Flash}}<div class="flash flash-{{.Flash.Level}}">{{.Flash.Message}}</div>{{end -}}
+`),
+	"tpl/_backend_vitals.gohtml": []byte(`<table class="vitals">
+	<thead><tr><th></th><th>p50</th><th>p75</th><th>p95</th></tr></thead>
+	<tbody>{{range $v := .Vitals}}
+		<tr>
+			<td title="{{nformat $v.Count $.Site}} measurements">{{$v.Vital.Label}}</td>
+			<td class="{{if $v.IsGood 50}}vital-good{{else}}vital-poor{{end}}">{{$v.FormatPercentile 50}}</td>
+			<td class="{{if $v.IsGood 75}}vital-good{{else}}vital-poor{{end}}">{{$v.FormatPercentile 75}}</td>
+			<td class="{{if $v.IsGood 95}}vital-good{{else}}vital-poor{{end}}">{{$v.FormatPercentile 95}}</td>
+		</tr>
+	{{end}}</tbody>
+</table>
 `),
 	"tpl/_bottom.gohtml": []byte(`		<script crossorigin="anonymous" src="{{.Static}}/imgzoom.js?v={{.Version}}"></script>
 		<script crossorigin="anonymous" src="{{.Static}}/script.js?v={{.Version}}"></script>
@@ -14988,12 +16767,36 @@ Martin
 					<button class="link" name="period" value="week-cur">week</button> ·
 					<button class="link" name="period" value="month-cur">month</button>
 				</span>
+				<span>
+					<label for="compare">Compare to</label>
+					<select id="compare" name="compare">
+						<option value="">nothing</option>
+						<option value="previous" {{if eq .Compare "previous"}}selected{{end}}>previous period</option>
+						<option value="year" {{if eq .Compare "year"}}selected{{end}}>same period last year</option>
+						<option value="custom" {{if eq .Compare "custom"}}selected{{end}}>custom range</option>
+					</select>
+					<span class="compare-custom" {{if ne .Compare "custom"}}style="display: none"{{end}}>
+						<input type="text" autocomplete="off" title="Start of date range to compare to" id="compare-start" name="compare-start"
+							value="{{if .Compare}}{{tformat .Site .CompareStart ""}}{{end}}">–{{- "" -}}
+						<input type="text" autocomplete="off" title="End of date range to compare to" id="compare-end" name="compare-end"
+							value="{{if .Compare}}{{tformat .Site .CompareEnd ""}}{{end}}">{{- "" -}}
+						<button type="submit">Go</button>
+					</span>
+				</span>
 				<span>
 					{{if .ForcedDaily}}
 						<label title="Cannot use the hourly view for a time range of more than 90 days"><input type="checkbox" name="daily" checked disabled> View by day</label>
 					{{else}}
 						<label><input type="checkbox" name="daily" {{if .Daily}}checked{{end}}> View by day</label>
 					{{end}}
+					·
+					<label for="group">Group by</label>
+					<select id="group" name="group">
+						<option value="" title="Group by week for periods of a year or longer">auto</option>
+						<option value="day" {{if eq .GroupParam "day"}}selected{{end}}>none</option>
+						<option value="week" {{if eq .GroupParam "week"}}selected{{end}}>week</option>
+						<option value="month" {{if eq .GroupParam "month"}}selected{{end}}>month</option>
+					</select>
 				</span>
 			</span>
 		</div>
@@ -15011,9 +16814,53 @@ Martin
 				forward →
 			</div>
 		</div>
+
+		<div class="period-form-segment">
+			<span title="Only show visits that match all of these">Segment</span>
+			<input type="text" autocomplete="off" name="segment-path" value="{{.Segment.Path}}" placeholder="Path or title"
+				title="Path or title contains this; matched case-insensitive">
+			<input type="text" autocomplete="off" name="segment-ref" value="{{.Segment.Ref}}" placeholder="Referrer"
+				title="Referrer contains this, e.g. “reddit”; matched case-insensitive">
+			<input type="text" autocomplete="off" name="segment-browser" value="{{.Segment.Browser}}" placeholder="Browser"
+				title="Browser name, e.g. “Firefox”">
+			<input type="text" autocomplete="off" name="segment-location" value="{{.Segment.Location}}" placeholder="Location"
+				title="Country code such as “DE”, or region code such as “US-CA”">
+			<select name="segment-size" title="Screen size">
+				<option value="">any size</option>
+				<option value="phone" {{if eq .Segment.Size "phone"}}selected{{end}}>phones</option>
+				<option value="largephone" {{if eq .Segment.Size "largephone"}}selected{{end}}>large phones, small tablets</option>
+				<option value="tablet" {{if eq .Segment.Size "tablet"}}selected{{end}}>tablets and small laptops</option>
+				<option value="desktop" {{if eq .Segment.Size "desktop"}}selected{{end}}>computer monitors</option>
+				<option value="desktophd" {{if eq .Segment.Size "desktophd"}}selected{{end}}>computer monitors larger than HD</option>
+				<option value="unknown" {{if eq .Segment.Size "unknown"}}selected{{end}}>unknown</option>
+			</select>
+			<select name="segment-event">
+				<option value="">pageviews and events</option>
+				<option value="false" {{if eq .Segment.Event "false"}}selected{{end}}>only pageviews</option>
+				<option value="true" {{if eq .Segment.Event "true"}}selected{{end}}>only events</option>
+			</select>
+			<button type="submit">Filter</button>
+			{{if not .Segment.IsZero}}
+				<a href="?period-start={{tformat .Site .PeriodStart ""}}&amp;period-end={{tformat .Site .PeriodEnd ""}}">clear</a>
+				<p>Showing only visits where {{.Segment}}.</p>
+				<p class="segment-hidden">The languages, campaigns, channels, content groups,
+					site searches, broken pages, returning visitors, session duration, and
+					page speed panels are hidden, as they can’t be filtered on a segment.</p>
+			{{end}}
+		</div>
 	</div>
 
-	<div class="pages-list {{if .Daily}}pages-list-daily{{end}}">
+	{{if .Trends}}<div class="trending">
+		<h2>Trending now</h2>
+		<p>Getting many more pageviews in the last 24 hours than in the four weeks before.</p>
+		<ul>{{range $t := .Trends}}
+			<li>{{if eq $t.Kind "ref"}}Referrer{{else}}Path{{end}}
+				<strong>{{$t.Name}}</strong>: {{nformat $t.Count $.Site}} pageviews,
+				{{printf "%.0f" $t.Factor}}× the usual {{printf "%.1f" $t.Baseline}} a day</li>
+		{{end}}</ul>
+	</div>{{end}}
+
+	<div class="pages-list {{if .Daily}}pages-list-daily{{end}} {{if .Group}}pages-list-{{.Group}}{{end}}">
 		<header class="h2 header-pages">
 			<h2>Paths</h2>
 			<span class="totals">
@@ -15024,10 +16871,15 @@ Martin
 					<span class="total-display">{{nformat .TotalHitsDisplay $.Site}}</span> out of
 					<span class="total-hits">{{nformat .TotalHits $.Site}}</span> pageviews
 				</span>
+				{{if .TotalChange}}
+					<em class="change total-change {{.TotalChange.Class}}"
+						title="Change in visits compared to {{tformat .Site .CompareStart ""}}–{{tformat .Site .CompareEnd ""}}"
+					>{{.TotalChange.Percentage}}</em>
+				{{end}}
 			</span>
 			<input autocomplete="off" name="filter" value="{{.Filter}}" id="filter-paths" placeholder="Filter paths"
 				{{if .Filter}}class="value"{{end}}
-				title="Filter the list of paths; matched case-insensitive on path and title">
+				title="Filter the list of paths; matched case-insensitive on path and title.&#10;&#10;Separate multiple terms with a space to match any of them; e.g.&#10;  -/admin             exclude paths containing /admin&#10;  &quot;/about&quot;            exact match&#10;  /blog/*             * matches anything&#10;  ~^/blog/[0-9]+$     regular expression&#10;  title:, path:, ref: only match the title, path, or referrer">
 		</header>
 
 		<table class="count-list count-list-pages">
@@ -15035,7 +16887,7 @@ Martin
 		</table>
 
 		<a href="#_" class="load-more" {{if not .MorePages}}style="display: none"{{end}}
-			data-href="/pages?period-start={{tformat $.Site $.PeriodStart ""}}&period-end={{tformat $.Site $.PeriodEnd ""}}&daily={{.Daily}}&filter={{.Filter}}&exclude={{range $h := .Pages}}{{$h.Path}},{{end}}"
+			data-href="/pages?period-start={{tformat $.Site $.PeriodStart ""}}&period-end={{tformat $.Site $.PeriodEnd ""}}&daily={{.Daily}}&group={{.GroupParam}}{{if .Compare}}&compare={{.Compare}}&compare-start={{tformat $.Site $.CompareStart ""}}&compare-end={{tformat $.Site $.CompareEnd ""}}{{end}}&filter={{.Filter}}{{if not .Segment.IsZero}}&segment-path={{.Segment.Path}}&segment-ref={{.Segment.Ref}}&segment-browser={{.Segment.Browser}}&segment-location={{.Segment.Location}}&segment-size={{.Segment.Size}}&segment-event={{.Segment.Event}}{{end}}&exclude={{range $h := .Pages}}{{$h.Path}},{{end}}"
 		>Show more</a>
 	</div>
 </form>
@@ -15047,7 +16899,7 @@ Martin
 			<em>Nothing to display</em>
 		{{else}}
 			<div class="hchart-wrap">
-				<div class="chart-hbar" data-detail="/browsers">{{horizontal_chart .Context .Browsers .TotalBrowsers 0 .1 true true}}</div>
+				<div class="chart-hbar" data-detail="/browsers">{{horizontal_chart .Context .Browsers .TotalBrowsers 0 .1 .Segment.IsZero true}}</div>
 			</div>
 		{{end}}
 	</div>
@@ -15057,18 +16909,48 @@ Martin
 			<em>Nothing to display</em>
 		{{else}}
 			<div class="hchart-wrap">
-				<div class="chart-hbar" data-detail="/sizes">{{horizontal_chart .Context .SizeStat .TotalSize 0 0 true false}}</div>
+				<div class="chart-hbar" data-detail="/sizes">{{horizontal_chart .Context .SizeStat .TotalSize 0 0 .Segment.IsZero false}}</div>
 			</div>
 			<p><small>The screen sizes are an indication and influenced by DPI and zoom levels.</small></p>
 		{{end}}
 	</div>
+	<div>
+		<h2>Systems</h2>
+		{{if eq .TotalSystems 0}}
+			<em>Nothing to display</em>
+		{{else}}
+			<div class="hchart-wrap">
+				<div class="chart-hbar" data-detail="/systems">{{horizontal_chart .Context .Systems .TotalSystems 0 .1 .Segment.IsZero true}}</div>
+			</div>
+		{{end}}
+	</div>
+	<div>
+		<h2>Devices</h2>
+		{{if eq .TotalDevices 0}}
+			<em>Nothing to display</em>
+		{{else}}
+			<div class="hchart-wrap">
+				<div class="chart-hbar" data-detail="/devices">{{horizontal_chart .Context .Devices .TotalDevices 0 0 .Segment.IsZero false}}</div>
+			</div>
+		{{end}}
+	</div>
+	{{if .Segment.IsZero}}<div>
+		<h2>Languages</h2>
+		{{if eq .TotalLanguages 0}}
+			<em>Nothing to display</em>
+		{{else}}
+			<div class="hchart-wrap">
+				<div class="chart-hbar" data-detail="/languages">{{horizontal_chart .Context .Languages .TotalLanguages 0 .1 true true}}</div>
+			</div>
+		{{end}}
+	</div>{{end}}
 	<div class="location-chart">
 		<h2>Locations{{if before_loc .Site.CreatedAt}}{{end}}</h2>
 		{{if eq .TotalHits 0}}
 			<em>Nothing to display</em>
 		{{else}}
 			<div class="hchart-wrap">
-				<div class="chart-hbar">{{horizontal_chart .Context .LocationStat .TotalLocation 0 3 false true}}</div>
+				<div class="chart-hbar" data-detail="/regions">{{horizontal_chart .Context .LocationStat .TotalLocation 0 3 (and .GeoRegions .Segment.IsZero) true}}</div>
 			</div>
 			{{if .ShowMoreLocations}}<a href="#" class="show-all">Show all</a>{{end}}
 		{{end}}
@@ -15079,11 +16961,176 @@ Martin
 			<em>Nothing to display</em>
 		{{else}}
 			<div class="hchart-wrap">
-				<div class="chart-hbar" data-detail="/pages-by-ref">{{horizontal_chart .Context .TopRefs .TotalTopRefs 0 0 true false}}</div>
+				<div class="chart-hbar" data-detail="/pages-by-ref">{{horizontal_chart .Context .TopRefs .TotalTopRefs 0 0 .Segment.IsZero false}}</div>
 			</div>
 			{{if .ShowMoreRefs}}<a href="#" class="show-more">Show more</a>{{end}}
 		{{end}}
 	</div>
+	{{if .Segment.IsZero}}<div class="channel-chart">
+		<h2>Channels</h2>
+		{{if eq .TotalChannels 0}}
+			<em>Nothing to display</em>
+		{{else}}
+			<table class="daily-bars">
+				{{range $c := .Channels}}
+					<tr>
+						<td>{{$c.Label}}</td>
+						<td title="Pageviews">{{nformat $c.Count $.Site}}<br>
+							<small>{{$c.Percentage $.TotalChannels}}</small></td>
+						<td>
+							<div class="chart chart-bar">
+								<span class="top max" title="Y-axis scale">{{nformat $c.Max $.Site}}</span>
+								<span class="half"></span>
+								{{bar_chart $.Context $c.Stats $c.Max true}}
+							</div>
+						</td>
+					</tr>
+				{{end}}
+			</table>
+		{{end}}
+	</div>
+	<div class="content-group-chart">
+		<h2>Content groups</h2>
+		{{if eq .TotalContentGroups 0}}
+			<em>Nothing to display</em>
+		{{else}}
+			<table class="daily-bars">
+				{{range $g := .ContentGroups}}
+					<tr>
+						<td><a href="?period-start={{tformat $.Site $.PeriodStart ""}}&amp;period-end={{tformat $.Site $.PeriodEnd ""}}&amp;filter={{$g.Filter}}"
+							title="Show the paths in this group">{{$g.Name}}</a></td>
+						<td title="{{nformat $g.CountUnique $.Site}} visits; {{nformat $g.Count $.Site}} pageviews">{{nformat $g.Count $.Site}}<br>
+							<small>{{$g.Percentage $.TotalContentGroups}}</small></td>
+						<td>
+							<div class="chart chart-bar">
+								<span class="top max" title="Y-axis scale">{{nformat $g.Max $.Site}}</span>
+								<span class="half"></span>
+								{{bar_chart $.Context $g.Stats $g.Max true}}
+							</div>
+						</td>
+					</tr>
+				{{end}}
+			</table>
+			<p><small>{{if .Site.Settings.ContentGroups}}Groups are defined in the
+				<a href="/settings#tab-setting">settings</a>.{{else}}Pageviews per
+				top-level directory; define your own groups in the
+				<a href="/settings#tab-setting">settings</a>.{{end}}</small></p>
+		{{end}}
+	</div>
+	<div class="campaign-chart">
+		<h2>Campaigns</h2>
+		{{if eq .TotalCampaigns 0}}
+			<em>Nothing to display</em>
+		{{else}}
+			<p class="campaign-pivot">Group by
+				<a href="#" data-pivot="source" class="active">source</a> ·
+				<a href="#" data-pivot="medium">medium</a> ·
+				<a href="#" data-pivot="campaign">campaign</a></p>
+			<div class="hchart-wrap">
+				<div class="chart-hbar" data-detail="/campaign?pivot=source">{{horizontal_chart .Context .Campaigns .TotalCampaigns 0 0 true true}}</div>
+			</div>
+		{{end}}
+	</div>
+	{{if .Site.Settings.SearchPage}}<div class="search-chart">
+		<h2>Site search</h2>
+		{{if eq .TotalSearches 0}}
+			<em>Nothing to display</em>
+		{{else}}
+			<table class="search-terms">
+				<thead><tr><th>Term</th><th>Searches</th><th title="Searches that weren't followed by a pageview">No pageview</th></tr></thead>
+				<tbody>{{range $s := .Searches}}
+					<tr>
+						<td>{{$s.Term}}</td>
+						<td>{{nformat $s.Count $.Site}}</td>
+						<td>{{nformat $s.NoPageview $.Site}}</td>
+					</tr>
+				{{end}}</tbody>
+			</table>
+			<p><small>{{nformat .TotalSearches .Site}} searches on <code>{{.Site.Settings.SearchPage}}</code>.
+				Searches without a pageview afterwards may indicate
+				something people can't find.</small></p>
+		{{end}}
+	</div>{{end}}
+	<div class="broken-chart">
+		<h2>Broken pages</h2>
+		{{if eq .TotalBroken 0}}
+			<em>Nothing to display</em>
+		{{else}}
+			<table class="broken-pages">
+				<thead><tr><th>Path</th><th>Status</th><th>Views</th><th>Referrers</th></tr></thead>
+				<tbody>{{range $b := .Broken}}
+					<tr>
+						<td>{{$b.Path}}</td>
+						<td>{{$b.Status}}</td>
+						<td>{{nformat $b.Count $.Site}}</td>
+						<td>{{range $r := $b.Refs}}
+							{{if $r.Ref}}{{$r.Ref}}{{else}}<em>(no referrer)</em>{{end}} ({{nformat $r.Count $.Site}})<br>
+						{{end}}</td>
+					</tr>
+				{{end}}</tbody>
+			</table>
+		{{end}}
+		<p><small>Pages sent with a <code>status</code>; see the <a href="/code#error-pages">site code</a>.</small></p>
+	</div>
+	<div>
+		<h2>Session duration</h2>
+		{{if eq .SessionTime.Count 0}}
+			<em>Nothing to display</em>
+		{{else}}
+			<div class="hchart-wrap">
+				<div class="chart-hbar">{{horizontal_chart .Context .SessionStat .SessionTime.Count 0 0 false false}}</div>
+			</div>
+			<p><small>{{.SessionTime}}. Sessions are recorded an hour after the last pageview.</small></p>
+		{{end}}
+	</div>
+	<div class="visitor-chart">
+		<h2>Returning visitors</h2>
+		{{if eq .TotalVisitors 0}}
+			<em>Nothing to display</em>
+		{{else}}
+			<table class="daily-bars">
+				{{range $v := .Visitors}}
+					<tr>
+						<td>{{$v.Label}}</td>
+						<td title="Visitors">{{nformat $v.Count $.Site}}<br>
+							<small>{{$v.Percentage $.TotalVisitors}}</small></td>
+						<td>
+							<div class="chart chart-bar">
+								<span class="top max" title="Y-axis scale">{{nformat $v.Max $.Site}}</span>
+								<span class="half"></span>
+								{{bar_chart $.Context $v.Stats $v.Max true}}
+							</div>
+						</td>
+					</tr>
+				{{end}}
+			</table>
+			<p><small>{{.Visitors.Returning}} of visitors returned; every visitor is counted once per day.</small></p>
+		{{end}}
+		<p><small>Only collected if <code>returning</code> is enabled in the <a href="/code">site code</a>.</small></p>
+	</div>{{end}}
+	<div class="heatmap-chart">
+		<h2>Traffic by hour</h2>
+		{{if eq .Heatmap.Total 0}}
+			<em>Nothing to display</em>
+		{{else}}
+			{{if .Segment.IsZero}}
+				<input class="heatmap-path" list="heatmap-paths" placeholder="All paths" autocomplete="off"
+					title="Show the traffic for a single path">
+				<datalist id="heatmap-paths">{{range $h := .Pages}}{{if not $h.Event}}<option value="{{$h.Path}}">{{end}}{{end}}</datalist>
+			{{end}}
+			<div class="heatmap-wrap">{{heatmap_chart .Context .Heatmap}}</div>
+			<p><small>Pageviews for every hour of the week, in your site's timezone.</small></p>
+		{{end}}
+	</div>
+	{{if .Segment.IsZero}}<div class="vitals-chart">
+		<h2>Page speed</h2>
+		{{if not .Vitals}}
+			<em>Nothing to display</em>
+		{{else}}
+			{{template "_backend_vitals.gohtml" .}}
+		{{end}}
+		<p><small>Only collected if <code>web_vitals</code> is enabled in the <a href="/code">site code</a>.</small></p>
+	</div>{{end}}
 </div>
 
 {{- template "_backend_bottom.gohtml" . }}
@@ -15198,6 +17245,59 @@ closing <code>&lt;/body&gt;</code> tag (but anywhere, such as in the
 <code>&lt;head&gt;</code> will work):</p>
 {{template "_backend_sitecode.gohtml" .}}
 
+{{template "_backend_bottom.gohtml" .}}
+`),
+	"tpl/backend_experiment.gohtml": []byte(`{{template "_backend_top.gohtml" .}}
+
+<h1>Experiment ‘{{.Experiment.Name}}’</h1>
+<p>Goal: {{if .Experiment.GoalEvent}}event{{else}}path{{end}} <code>{{.Experiment.Goal}}</code>.
+	Every session is counted once, for the first variant it saw; conversions
+	are counted on the day the session saw the variant.</p>
+
+<table class="experiment-results">
+	<thead><tr>
+		<th>Variant</th><th>Sessions</th><th>Conversions</th><th>Rate</th>
+		<th>95% interval</th><th>Change</th><th>p-value</th><th></th>
+	</tr></thead>
+	<tbody>
+		{{range $v := .Results}}<tr>
+			<td>{{$v.Name}}{{if $v.Control}} <em>(control)</em>{{end}}</td>
+			<td>{{nformat $v.Exposures $.Site}}</td>
+			<td>{{nformat $v.Conversions $.Site}}</td>
+			<td>{{printf "%.2f" $v.Rate}}%</td>
+			<td>{{printf "%.2f" (index $v.Interval 0)}}% – {{printf "%.2f" (index $v.Interval 1)}}%</td>
+			{{if $v.Control}}<td></td><td></td><td></td>{{else}}
+				<td>{{printf "%+.1f" $v.Change}}%</td>
+				<td>{{printf "%.3f" $v.PValue}}</td>
+				<td>{{if $v.Significant}}<strong>significant</strong>{{else}}not significant{{end}}</td>
+			{{end}}
+		</tr>{{end}}
+	</tbody>
+</table>
+<p>The p-value is from a two-proportion z-test against the control; a
+	difference is significant if it's below 0.05. Don't stop an experiment as
+	soon as it becomes significant: decide on the number of sessions in advance.</p>
+
+{{with $first := index .Results 0}}{{if $first.Days}}
+<h2>By day</h2>
+<table class="experiment-results">
+	<thead><tr>
+		<th>Day</th>
+		{{range $v := $.Results}}<th>{{$v.Name}}</th>{{end}}
+	</tr></thead>
+	<tbody>
+		{{range $i, $d := $first.Days}}<tr>
+			<td>{{$d.Day}}</td>
+			{{range $v := $.Results}}{{with $vd := index $v.Days $i}}
+				<td>{{nformat $vd.Conversions $.Site}} / {{nformat $vd.Exposures $.Site}}</td>
+			{{end}}{{end}}
+		</tr>{{end}}
+	</tbody>
+</table>
+{{end}}{{end}}
+
+<p><a href="/settings#tab-experiments">Back to the experiments</a></p>
+
 {{template "_backend_bottom.gohtml" .}}
 `),
 	"tpl/backend_purge.gohtml": []byte(`{{template "_backend_top.gohtml" .}}
@@ -15374,10 +17474,45 @@ closing <code>&lt;/body&gt;</code> tag (but anywhere, such as in the
 				<span>
 					List of parameters to count as ‘campaigns’; if set then the
 					value will be set as the referrer, overriding any Referer
-					header.{{/* <a href="/code#campaigns">Details</a>.
+					header. The <code>utm_*</code> parameters are always
+					recorded for the campaigns overview.{{/* <a href="/code#campaigns">Details</a>.
 					Comma-separated; first match takes precedence.*/}}
 				</span>
 
+				<label>Channel rules</label>
+				<input type="text" name="settings.channel_rules" value="{{.Site.Settings.ChannelRules}}"
+					placeholder="news.example.com=social, intranet.example.com=internal">
+				{{validate "site.settings.channel_rules" .Validate}}
+				<span>
+					Extra rules to classify referrers in channels, as a
+					comma-separated list of <code>host=channel</code>; a host
+					also matches all subdomains. The channel is one of
+					direct, search, social, email, campaign, internal, or
+					other. This only applies to new pageviews.
+				</span>
+
+				<label>Search page</label>
+				<input type="text" name="settings.search_page" value="{{.Site.Settings.SearchPage}}"
+					placeholder="/search?q=">
+				{{validate "site.settings.search_page" .Validate}}
+				<span>
+					Path and query parameter of your site's search page; the
+					search term is removed from the path and the terms people
+					searched for are shown on the dashboard.
+				</span>
+
+				<label>Content groups</label>
+				<textarea name="settings.content_groups" rows="4"
+					placeholder="Blog=/blog/*&#10;Docs=path:/docs/* title:~^Docs">{{.Site.Settings.ContentGroups}}</textarea>
+				{{validate "site.settings.content_groups" .Validate}}
+				<span>
+					Groups of pages to show on the dashboard, one
+					<code>name=filter</code> per line; the filter uses the same
+					syntax as filtering the paths on the dashboard, and can
+					contain commas. Pages are grouped by their top-level
+					directory if this is empty.
+				</span>
+
 			</fieldset>
 
 			<div class="flex-break"></div>
@@ -15430,6 +17565,179 @@ closing <code>&lt;/body&gt;</code> tag (but anywhere, such as in the
 	</div>
 {{end}}
 
+<div>
+	<h2 id="annotations">Annotations</h2>
+	<p>Annotations are displayed as a marker on the charts for that day; for
+		example to note a deploy or the start of a campaign.</p>
+
+	<table class="auto">
+		<thead><tr><th>Date</th><th>Text</th><th>URL</th><th></th></tr></thead>
+		<tbody>
+			{{range $a := .Annotations}}<tr>
+				<td>{{$a.Day.Format "2006-01-02"}}</td>
+				<td>{{$a.Text}}</td>
+				<td>{{if $a.URL}}<a href="{{$a.URL}}" target="_blank" rel="noopener">{{$a.URL}}</a>{{end}}</td>
+				<td><form method="post" action="/annotations/{{$a.ID}}/delete">
+					<input type="hidden" name="csrf" value="{{$.User.CSRFToken}}">
+					<button type="submit" class="link">delete</button>
+				</form></td>
+			</tr>{{else}}
+				<tr><td colspan="4"><em>No annotations yet.</em></td></tr>
+			{{end}}
+	</tbody></table>
+
+	<form method="post" action="/annotations">
+		<input type="hidden" name="csrf" value="{{.User.CSRFToken}}">
+		<input type="text" name="day" id="annotation-day" placeholder="YYYY-MM-DD" autocomplete="off" required>
+		<input type="text" name="text" placeholder="Text" maxlength="250" required>
+		<input type="text" name="url" placeholder="URL (optional)">
+		<button type="submit">Add</button>
+	</form>
+</div>
+
+<div>
+	<h2 id="experiments">Experiments</h2>
+	<p>Experiments compare how many sessions reach a goal for every variant of a
+		page; see the <a href="/code#experiments">site code documentation</a>
+		for sending the variant a visitor saw. The first variant is the control
+		the other variants are compared to.</p>
+
+	<table class="auto">
+		<thead><tr><th>Name</th><th>Variants</th><th>Goal</th><th></th><th></th></tr></thead>
+		<tbody>
+			{{range $e := .Experiments}}<tr>
+				<td><a href="/experiments/{{$e.ID}}">{{$e.Name}}</a></td>
+				<td>{{$e.Variants}}</td>
+				<td>{{if $e.GoalEvent}}event {{end}}<code>{{$e.Goal}}</code></td>
+				<td><a href="/experiments/{{$e.ID}}">results</a></td>
+				<td><form method="post" action="/experiments/{{$e.ID}}/delete">
+					<input type="hidden" name="csrf" value="{{$.User.CSRFToken}}">
+					<button type="submit" class="link">delete</button>
+				</form></td>
+			</tr>{{else}}
+				<tr><td colspan="5"><em>No experiments yet.</em></td></tr>
+			{{end}}
+	</tbody></table>
+
+	<form method="post" action="/experiments">
+		<input type="hidden" name="csrf" value="{{.User.CSRFToken}}">
+		<input type="text" name="name" placeholder="Name" maxlength="250" required>
+		<input type="text" name="variants" placeholder="Variants, comma-separated" required>
+		<input type="text" name="goal" placeholder="Goal path or event" required>
+		<label>{{checkbox false "goal_event"}} Goal is an event</label>
+		<button type="submit">Add</button>
+	</form>
+</div>
+
+<div>
+	<h2 id="alerts">Alerts</h2>
+	<p>Get an email when the traffic changes. Spikes, drops, new referrers, and
+		goals look at the last 24 hours; spikes and drops are compared to the
+		average a day in the four weeks before that, and are only sent for sites
+		with at least 10 pageviews a day. An alert isn’t sent again until the
+		cooldown has passed.</p>
+
+	<table class="auto">
+		<thead><tr><th>Alert</th><th>Cooldown</th><th>Last sent</th><th></th></tr></thead>
+		<tbody>
+			{{range $a := .Alerts}}<tr>
+				<td>{{$a}}</td>
+				<td>{{$a.Cooldown}} hours</td>
+				<td>{{if $a.LastSent}}{{tformat $.Site $a.LastSent.UTC "2006-01-02 15:04"}}{{else}}<em>never</em>{{end}}</td>
+				<td><form method="post" action="/alerts/{{$a.ID}}/delete">
+					<input type="hidden" name="csrf" value="{{$.User.CSRFToken}}">
+					<button type="submit" class="link">delete</button>
+				</form></td>
+			</tr>{{else}}
+				<tr><td colspan="4"><em>No alerts yet.</em></td></tr>
+			{{end}}
+	</tbody></table>
+
+	<form method="post" action="/alerts">
+		<input type="hidden" name="csrf" value="{{.User.CSRFToken}}">
+		<select name="kind">
+			{{range $k := .AlertKinds}}<option value="{{index $k 0}}">{{index $k 1}}</option>{{end}}
+		</select>
+		<input type="number" name="threshold" placeholder="N" min="1" required>
+		<input type="text" name="goal" placeholder="Goal path or event (for goals)">
+		<input type="number" name="cooldown" placeholder="Cooldown (hours)" min="1" max="720">
+		<button type="submit">Add</button>
+	</form>
+
+	{{if .AlertHistory}}
+		<h3>Recently sent</h3>
+		<table class="auto alert-history">
+			<thead><tr><th>Sent</th><th>Message</th></tr></thead>
+			<tbody>{{range $h := .AlertHistory}}
+				<tr><td>{{tformat $.Site $h.SentAt "2006-01-02 15:04"}}</td><td>{{$h.Message}}</td></tr>
+			{{end}}</tbody>
+		</table>
+	{{end}}
+</div>
+
+<div>
+	<h2 id="webhooks">Webhooks</h2>
+	<p>POST a JSON payload to a URL when something happens, for example to send
+		messages to a chat or incident tool. Failed deliveries are retried with
+		an increasing delay for about two hours.</p>
+
+	<table class="auto">
+		<thead><tr><th>URL</th><th>Events</th><th>Secret</th><th></th></tr></thead>
+		<tbody>
+			{{range $w := .Webhooks}}<tr>
+				<td>{{$w.URL}}</td>
+				<td>{{range $i, $e := $w.Events}}{{if $i}}, {{end}}{{$e}}{{end}}</td>
+				<td><code>{{$w.Secret}}</code></td>
+				<td><form method="post" action="/webhooks/{{$w.ID}}/delete">
+					<input type="hidden" name="csrf" value="{{$.User.CSRFToken}}">
+					<button type="submit" class="link">delete</button>
+				</form></td>
+			</tr>{{else}}
+				<tr><td colspan="4"><em>No webhooks yet.</em></td></tr>
+			{{end}}
+	</tbody></table>
+
+	<form method="post" action="/webhooks">
+		<input type="hidden" name="csrf" value="{{.User.CSRFToken}}">
+		<input type="url" name="url" placeholder="https://example.com/hook" required>
+		{{range $e := .WebhookEvents}}
+			<label><input type="checkbox" name="events" value="{{index $e 0}}"> {{index $e 1}}</label>
+		{{end}}
+		<button type="submit">Add</button>
+	</form>
+
+	<p>The payload is a JSON object with the <code>event</code>, the
+		<code>site</code> URL, the <code>created_at</code> time, and the event’s
+		<code>data</code>. The event is also in the <code>X-Goatcounter-Event</code>
+		header. The <code>X-Goatcounter-Signature</code> header is
+		<code>sha256=</code> followed by the hex-encoded HMAC-SHA256 of the
+		request body, using the webhook’s secret as the key.</p>
+
+	{{if .Deliveries}}
+		<h3>Recent deliveries</h3>
+		<table class="auto webhook-deliveries">
+			<thead><tr><th>Created</th><th>Event</th><th>URL</th><th>State</th><th>Attempts</th><th>Response</th></tr></thead>
+			<tbody>{{range $d := .Deliveries}}
+				<tr>
+					<td>{{tformat $.Site $d.CreatedAt "2006-01-02 15:04"}}</td>
+					<td>{{$d.Event}}</td>
+					<td>{{$d.URL}}</td>
+					<td>{{$d.State}}</td>
+					<td>{{$d.Attempts}}</td>
+					<td>{{if $d.ResponseCode}}{{$d.ResponseCode}}{{else}}{{$d.Error}}{{end}}</td>
+				</tr>
+			{{end}}</tbody>
+		</table>
+	{{end}}
+</div>
+
+<div>
+	<h2 id="sitemap">Sitemap report</h2>
+	<p>Compare your <code>sitemap.xml</code> against the pageviews to find pages
+		nobody visits, and paths that get views but aren’t in the sitemap.</p>
+	<p><a href="/sitemap">Create a sitemap report</a></p>
+</div>
+
 <div>
 	<h2 id="purge">Purge</h2>
 	<p>Remove all instances of a page.</p>
@@ -15548,6 +17856,69 @@ closing <code>&lt;/body&gt;</code> tag (but anywhere, such as in the
 	</div>
 {{end}}
 
+{{template "_backend_bottom.gohtml" .}}
+`),
+	"tpl/backend_sitemap.gohtml": []byte(`{{template "_backend_top.gohtml" .}}
+
+<h1>Sitemap report</h1>
+<p>Compare the pages in your <code>sitemap.xml</code> against the pageviews, to
+	find pages that get few or no views and paths that get views but aren’t in
+	the sitemap. Sitemap indexes aren’t supported; use one of the sitemaps it
+	lists instead.</p>
+
+<form method="post" action="/sitemap" enctype="multipart/form-data" class="vertical sitemap-form">
+	<input type="hidden" name="csrf" value="{{.User.CSRFToken}}">
+
+	<label for="sitemap">Upload sitemap</label>
+	<input type="file" name="sitemap" id="sitemap" accept=".xml,.gz,application/xml,text/xml">
+
+	<label for="url">Or URL to sitemap</label>
+	<input type="text" name="url" id="url" value="{{.URL}}" placeholder="https://example.com/sitemap.xml">
+	{{if .Private}}
+		<span class="help">The URL can be on a public address or on a local or internal mirror.</span>
+	{{else}}
+		<span class="help">The URL must be publicly accessible; upload the file for
+			sitemaps on a local or internal mirror, or start GoatCounter with
+			<code>-sitemap-private</code> when self-hosting.</span>
+	{{end}}
+
+	<label for="period-start">Period</label>
+	<span><input type="text" name="period-start" id="period-start" value="{{.PeriodStart}}" placeholder="YYYY-MM-DD" autocomplete="off" required>–{{- "" -}}
+		<input type="text" name="period-end" id="period-end" value="{{.PeriodEnd}}" placeholder="YYYY-MM-DD" autocomplete="off" required></span>
+
+	<label for="threshold">List pages with at most this many views</label>
+	<input type="number" name="threshold" id="threshold" value="{{.Threshold}}" min="0">
+
+	<button type="submit">Compare</button>
+</form>
+
+{{if .Error}}
+	<div class="flash flash-e">{{.Error}}</div>
+{{else if .Report}}
+	<h2>Unvisited pages</h2>
+	<p>{{nformat (len .Report.Unvisited) $.Site}} of {{nformat .Report.Listed $.Site}} pages in the
+		sitemap have {{if eq .Threshold 0}}no views{{else}}{{.Threshold}} or fewer views{{end}}.</p>
+	{{if .Report.Unvisited}}
+		<table class="auto sitemap-report">
+			<thead><tr><th>Views</th><th>Path</th></tr></thead>
+			<tbody>{{range $p := .Report.Unvisited}}
+				<tr><td>{{nformat $p.Count $.Site}}</td><td>{{$p.Path}}</td></tr>
+			{{end}}</tbody>
+		</table>
+	{{end}}
+
+	<h2>Not in sitemap</h2>
+	<p>{{nformat (len .Report.NotListed) $.Site}} paths received views but aren’t in the sitemap.</p>
+	{{if .Report.NotListed}}
+		<table class="auto sitemap-report">
+			<thead><tr><th>Views</th><th>Path</th></tr></thead>
+			<tbody>{{range $p := .Report.NotListed}}
+				<tr><td>{{nformat $p.Count $.Site}}</td><td>{{$p.Path}}</td></tr>
+			{{end}}</tbody>
+		</table>
+	{{end}}
+{{end}}
+
 {{template "_backend_bottom.gohtml" .}}
 `),
 	"tpl/backend_updates.gohtml": []byte(`{{template "_backend_top.gohtml" .}}
@@ -15730,6 +18101,17 @@ processed by Stripe (you will need a Credit Card).</p>
 </form>
 
 {{template "_bottom.gohtml" .}}
+`),
+	"tpl/email_alert.gotxt": []byte(`Hi there,
+
+Your GoatCounter alert “{{.Alert}}” for {{.Site.URL}} was triggered:
+
+{{.Message}}
+
+You won’t get this alert again for the next {{.Alert.Cooldown}} hours. You can
+change or remove your alerts at {{.Site.URL}}/settings#tab-alerts
+
+{{template "_email_bottom.gotxt" .}}
 `),
 	"tpl/email_export_done.gotxt": []byte(`Hi there,
 
@@ -16285,7 +18667,8 @@ advice specific to your situation.</p>
 	<li><code>Referer</code> header.</li>
 	<li><code>User-Agent</code> header.</li>
 	<li>Screen size.</li>
-	<li>Country name based on IP address.</li>
+	<li>Country name (and region, if enabled) based on IP address.</li>
+	<li>Primary language from the <code>Accept-Language</code> header.</li>
 	<li>A hash of the IP address, User-Agent, and random number.</li>
 </ul>
 
@@ -16293,7 +18676,10 @@ advice specific to your situation.</p>
 address, User-Agent, and a random number (“salt”) is stored for
 4 hours at the most to identify a browsing session.</p>
 
-<p>There is no information stored in the browser with e.g. cookies.</p>
+<p>There is no information stored in the browser with e.g. cookies, unless the
+site enabled returning visitor statistics; in that case only the day of the
+last visit is stored in the browser’s <code>localStorage</code>, and how long
+ago that was (e.g. “within a week”) is sent once a day.</p>
 
 <p>Also see the <a href="/gdpr">GDPR consent notices</a>.</p>
 
@@ -0,0 +1,31 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"time"
+
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+)
+
+// PathTitle is a title a path had, with the first and last day it was seen.
+type PathTitle struct {
+	Title     string    `db:"title" json:"title"`
+	FirstSeen time.Time `db:"first_seen" json:"first_seen"`
+	LastSeen  time.Time `db:"last_seen" json:"last_seen"`
+}
+
+type PathTitles []PathTitle
+
+// List all titles the path had, most recently seen first.
+func (t *PathTitles) List(ctx context.Context, path string) error {
+	return errors.Wrap(zdb.MustGet(ctx).SelectContext(ctx, t, `/* PathTitles.List */
+		select title, first_seen, last_seen from path_titles
+		where site=$1 and path=$2
+		order by last_seen desc, first_seen desc`,
+		MustGetSite(ctx).ID, path), "PathTitles.List")
+}
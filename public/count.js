@@ -17,6 +17,9 @@
 			s: [window.screen.width, window.screen.height, (window.devicePixelRatio || 1)],
 			b: is_bot(),
 			q: location.search,
+			x:  (vars.experiment === undefined ? goatcounter.experiment : vars.experiment),
+			xv: (vars.variant    === undefined ? goatcounter.variant    : vars.variant),
+			st: (vars.status     === undefined ? goatcounter.status     : vars.status),
 		}
 
 		var rcb, pcb, tcb  // Save callbacks to apply later.
@@ -70,6 +73,135 @@
 		return '?' + p.join('&')
 	}
 
+	// Get how long ago the previous visit was, as a coarse bucket. Only the day
+	// of the last visit is stored, and this returns null if we already counted
+	// a pageview today so every visitor is reported just once per day.
+	var last_visit = function() {
+		try {
+			var k     = 'goatcounter-last-visit',
+			    today = Math.floor(Date.now() / 864e5),
+			    last  = parseInt(localStorage.getItem(k), 10)
+			if (last === today)
+				return null
+			localStorage.setItem(k, today)
+		} catch (e) {  // localStorage disabled.
+			return null
+		}
+
+		if (isNaN(last))
+			return 'new'
+		var d = today - last
+		return d <= 1 ? '1d' : d <= 7 ? '7d' : d <= 30 ? '30d' : 'older'
+	}
+
+	// The pageview we're measuring the time on page and scroll depth for; this
+	// is reported with a beacon every time the page is hidden. Only the time
+	// the page is visible is counted: start is null while it's hidden, and
+	// visible is the time from previous visible intervals. last has the values
+	// sent with the last beacon.
+	var page = null
+
+	// Get how far the page is scrolled, in percent.
+	var scroll_depth = function() {
+		var d = document.documentElement,
+		    h = Math.max(d.scrollHeight, document.body ? document.body.scrollHeight : 0)
+		if (h <= window.innerHeight)  // Not scrollable.
+			return 100
+		return Math.min(100, Math.round((window.pageYOffset + window.innerHeight) / h * 100))
+	}
+
+	// Core Web Vitals for the initial page load, if enabled; these are only sent
+	// for the first page as they don't apply to navigation in SPAs. INP and CLS
+	// keep changing until the page is unloaded.
+	var vitals = null
+	var observe_vitals = function() {
+		if (!window.PerformanceObserver)
+			return
+		var v = vitals = {}
+
+		var observe = function(type, opts, cb) {
+			try {
+				var o = new PerformanceObserver(function(list) { list.getEntries().forEach(cb) })
+				opts.type = type
+				opts.buffered = true
+				o.observe(opts)
+			} catch (e) {}  // Type not supported.
+		}
+
+		var cls = 0
+		observe('largest-contentful-paint', {}, function(e) { v.lcp = Math.round(e.startTime) })
+		observe('layout-shift', {}, function(e) {
+			if (!e.hadRecentInput)
+				cls += e.value
+			v.cls = Math.round(cls * 1000)
+		})
+		observe('event', {durationThreshold: 40}, function(e) {
+			if (e.interactionId)
+				v.inp = Math.max(v.inp || 0, Math.round(e.duration))
+		})
+	}
+
+	// Add the navigation timing and Core Web Vitals to the beacon data.
+	var add_vitals = function(data, v) {
+		for (var k in v)
+			data[k] = v[k]
+
+		var n = window.performance && performance.getEntriesByType && performance.getEntriesByType('navigation')[0]
+		if (n) {
+			data.ttfb = Math.round(n.responseStart)
+			if (n.loadEventEnd > 0)
+				data.ld = Math.round(n.loadEventEnd)
+		}
+	}
+
+	// Send the beacon for the current page, if any, and stop measuring it if
+	// done is set.
+	//
+	// Every beacon reports the visible time so far, and the scroll depth and
+	// vitals if they changed since the last beacon. The values from the last
+	// beacon are sent too (prefixed with a "p") so they're replaced when the
+	// visitor returns to the page, rather than counting the page twice. A time
+	// of 0 isn't recorded, so that's never sent as the previous time.
+	var send_beacon = function(done) {
+		if (!page || !navigator.sendBeacon)
+			return
+
+		var p = page
+		if (done === true)
+			page = null
+		if (p.start !== null) {
+			p.visible += Date.now() - p.start
+			p.start = null
+		}
+
+		var tp      = Math.round(p.visible / 1000),
+		    data    = {p: p.path, tp: tp},
+		    changed = tp > 0 && tp !== p.last.tp,
+		    cur     = {}
+		if (p.last.tp !== undefined)
+			data.ptp = p.last.tp
+		if (goatcounter.scroll_depth)
+			cur.sd = Math.floor(p.scroll / 25) * 25
+		if (p.vitals)
+			add_vitals(cur, p.vitals)
+		for (var k in cur) {
+			if (cur[k] === p.last[k])
+				continue
+			changed = true
+			data[k] = cur[k]
+			if (p.last[k] !== undefined)
+				data['p' + k] = p.last[k]
+			p.last[k] = cur[k]
+		}
+		if (!changed)
+			return
+		if (tp > 0)
+			p.last.tp = tp
+
+		data.rnd = Math.random().toString(36).substr(2, 5)
+		navigator.sendBeacon(p.endpoint + to_params(data))
+	}
+
 	// Count a hit.
 	window.goatcounter.count = function(vars) {
 		if ('visibilityState' in document && document.visibilityState === 'prerender')
@@ -88,6 +220,8 @@
 		if (data.p === null)  // null from user callback.
 			return
 
+		if (goatcounter.returning && !data.e)
+			data.lv = last_visit()
 		data.rnd = Math.random().toString(36).substr(2, 5)  // Browsers don't always listen to Cache-Control.
 
 		var img = document.createElement('img'),
@@ -100,6 +234,13 @@
 		setTimeout(rm, 3000)  // In case the onload isn't triggered.
 		img.addEventListener('load', rm, false)
 		document.body.appendChild(img)
+
+		if (!data.e && !goatcounter.no_beacon) {
+			send_beacon(true)  // Previous page in SPAs.
+			page = {endpoint: endpoint, path: data.p, start: Date.now(), visible: 0,
+			        last: {}, scroll: scroll_depth(), vitals: vitals}
+			vitals = null
+		}
 	}
 
 	// Get a query parameter.
@@ -133,6 +274,25 @@
 		})
 	}
 
+	// Send the beacon as soon as the page is hidden, as there's no guarantee
+	// we'll get an unload event on mobile. The visitor may come back to the
+	// page, so keep measuring it.
+	document.addEventListener('visibilitychange', function() {
+		if (!page)
+			return
+		if (document.visibilityState === 'hidden')
+			send_beacon(false)
+		else if (document.visibilityState === 'visible' && page.start === null)
+			page.start = Date.now()
+	}, false)
+	window.addEventListener('pagehide', function() { send_beacon(true) }, false)
+	if (goatcounter.web_vitals)
+		observe_vitals()
+	window.addEventListener('scroll', function() {
+		if (page && goatcounter.scroll_depth)
+			page.scroll = Math.max(page.scroll, scroll_depth())
+	}, {passive: true})
+
 	if (!goatcounter.no_onload) {
 		var go = function() {
 			goatcounter.count()
@@ -17,7 +17,7 @@
 		;[report_errors, period_select, load_refs, tooltip, paginate_paths,
 			paginate_refs, hchart_detail, settings_tabs, paginate_locations,
 			billing_subscribe, setup_datepicker, filter_paths, add_ip, fill_tz,
-			paginate_toprefs, draw_chart,
+			paginate_toprefs, draw_chart, campaign_pivot, heatmap_path,
 		].forEach(function(f) { f.call() })
 	});
 
@@ -65,6 +65,10 @@
 			$(chart).find('>div').each(function(i, bar) {
 				var h = bar.style.height
 				bar.style.height = '100%'
+				if (bar.dataset.c)
+					$('<div class="compare"></div>').css('height', bar.dataset.c).appendTo(bar)
+				if (bar.dataset.a)
+					$('<div class="annotation"></div>').appendTo(bar)
 				if (bar.className === 'f')
 					return
 				else if (h === '')
@@ -86,6 +90,17 @@
 		})
 	}
 
+	// Load the heatmap for a single path.
+	var heatmap_path = function() {
+		$('.heatmap-path').on('change', function(e) {
+			jQuery.ajax({
+				url:     '/heatmap',
+				data:    append_period({path: $(this).val().trim()}),
+				success: function(data) { $('.heatmap-wrap').html(data.html) },
+			})
+		})
+	}
+
 	// Add current IP address to ignore_ips.
 	var add_ip = function() {
 		$('#add-ip').on('click', function(e) {
@@ -148,7 +163,17 @@
 				jQuery.ajax({
 					url:     '/pages',
 					data:    append_period({filter: filter}),
-					success: function(data) { update_pages(data, true); },
+					global:  false,  // Don't report syntax errors in the filter.
+					success: function(data) {
+						$('#filter-paths').removeClass('invalid');
+						update_pages(data, true);
+					},
+					error: function(xhr) {
+						if (xhr.status !== 400)
+							return;
+						$('#filter-paths').addClass('invalid').attr('title',
+							(xhr.responseJSON || {}).error || 'Invalid filter');
+					},
 				});
 			}, 300);
 		});
@@ -204,6 +229,9 @@
 			td.text(format_int(data.total_display));
 			tu.text(format_int(data.total_unique));
 			ud.text(format_int(data.total_unique_display));
+			if (data.total_change)
+				$('.pages-list .total-change').text(data.total_change).
+					removeClass('change-up change-down change-none').addClass(data.total_change_class);
 		}
 		else {
 			td.text(format_int(parseInt(td.text().replace(/[^0-9]/, ''), 10) + data.total_display));
@@ -215,10 +243,21 @@
 
 	// Highlight a filter pattern in the path and title.
 	var highlight_filter = function(s) {
-		if (s === '')
+		// Only highlight the plain terms; not negated terms, regular
+		// expressions, or referrers.
+		var terms = [];
+		s.split(/\s+/).forEach(function(t) {
+			if (t === '' || t[0] === '-' || t[0] === '~' || t.indexOf('ref:') === 0)
+				return;
+			t = t.replace(/^(path|title):/, '').replace(/["*]/g, '');
+			if (t !== '')
+				terms.push(quote_re(t));
+		});
+		if (terms.length === 0)
 			return;
+
 		$('.pages-list .count-list-pages > tbody').find('.rlink, .page-title:not(.no-title)').each(function(_, elem) {
-			elem.innerHTML = elem.innerHTML.replace(new RegExp('' + quote_re(s) + '', 'gi'), '<b>$&</b>');
+			elem.innerHTML = elem.innerHTML.replace(new RegExp(terms.join('|'), 'gi'), '<b>$&</b>');
 		});
 	};
 
@@ -232,12 +271,18 @@
 		// They also don't really look all that great. Especially the Firefox
 		// one looks pretty fucked.
 		if (is_mobile()) {
-			return $('#period-start, #period-end').
+			return $('#period-start, #period-end, #compare-start, #compare-end, #annotation-day').
 				attr('type', 'date').
 				css('width', 'auto');  // Make sure there's room for UI chrome.
 		}
 		new Pikaday({field: $('#period-start')[0], toString: format_date_ymd, parse: get_date, firstDay: SETTINGS.sunday_starts_week ? 0 : 1});
 		new Pikaday({field: $('#period-end')[0],   toString: format_date_ymd, parse: get_date, firstDay: SETTINGS.sunday_starts_week ? 0 : 1});
+		if ($('#compare-start').length) {
+			new Pikaday({field: $('#compare-start')[0], toString: format_date_ymd, parse: get_date, firstDay: SETTINGS.sunday_starts_week ? 0 : 1});
+			new Pikaday({field: $('#compare-end')[0],   toString: format_date_ymd, parse: get_date, firstDay: SETTINGS.sunday_starts_week ? 0 : 1});
+		}
+		if ($('#annotation-day').length)
+			new Pikaday({field: $('#annotation-day')[0], toString: format_date_ymd, parse: get_date, firstDay: SETTINGS.sunday_starts_week ? 0 : 1});
 	};
 
 	// Subscribe with Stripe.
@@ -324,6 +369,27 @@
 		});
 	};
 
+	// Change the grouping of the campaign chart.
+	var campaign_pivot = function() {
+		$('.campaign-chart .campaign-pivot a').on('click', function(e) {
+			e.preventDefault();
+
+			var link  = $(this),
+				pivot = link.attr('data-pivot'),
+				bar   = $('.campaign-chart .chart-hbar:first');
+			jQuery.ajax({
+				url:  '/campaigns',
+				data: append_period({pivot: pivot}),
+				success: function(data) {
+					bar.parent().find('.hbar-detail').remove();
+					bar.removeClass('hbar-open').attr('data-detail', '/campaign?pivot=' + pivot).html(data.html);
+					link.parent().find('a').removeClass('active');
+					link.addClass('active');
+				},
+			});
+		});
+	};
+
 	// Set up the tabbed navigation in the settings.
 	var settings_tabs = function() {
 		var nav = $('.tab-nav');
@@ -439,7 +505,19 @@
 			$(this).closest('form').trigger('submit')
 		})
 
+		$('#group').on('change', function(e) {
+			$(this).closest('form').trigger('submit')
+		})
+
+		$('#compare').on('change', function(e) {
+			if (this.value === 'custom')
+				return $('.compare-custom').css('display', 'inline')
+			$(this).closest('form').trigger('submit')
+		})
+
 		$('.period-form-select').on('click', 'button', function(e) {
+			if (this.type === 'submit')  // "Go" for the custom compare range.
+				return
 			e.preventDefault();
 
 			var start = new Date(), end = new Date();
@@ -580,15 +658,24 @@
 			// Reformat the title in the chart.
 			if (t.is('div') && t.closest('.chart-bar').length > 0) {
 				if ($('.pages-list').hasClass('pages-list-daily')) {
-					var [day, views, unique] = title.split('|')
-					title = `${format_date(day)}`
+					var [day, views, unique, prev] = title.split('|')
+					if ($('.pages-list').hasClass('pages-list-week'))
+						title = `Week of ${format_date(day)}`
+					else if ($('.pages-list').hasClass('pages-list-month'))
+						title = `${months[get_date(day).getMonth()]} ${get_date(day).getFullYear()}`
+					else
+						title = `${format_date(day)}`
 				}
 				else {
-					var [day, start, end, views, unique] = title.split('|')
+					var [day, start, end, views, unique, prev] = title.split('|')
 					title = `${format_date(day)} ${un24(start)} – ${un24(end)}`
 				}
 
 				title += !views ? ', future' : `, ${unique} visits; <span class="views">${views} pageviews</span>`
+				if (prev !== undefined)
+					title += `<br>Compared to: <span class="views">${prev} pageviews</span>`
+				if (t[0].dataset.a)
+					title += '<br>' + t[0].dataset.a.split('\n').map((a) => `<span class="annotation">${escape_html(a)}</span>`).join('<br>')
 			}
 			t.attr('data-title', title).removeAttr('title')
 
@@ -630,6 +717,12 @@
 		history.pushState(null, '', join_query(params));
 	}
 
+	// Escape HTML special characters.
+	var escape_html = function(s) {
+		return s.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;').
+			replace(/"/g, '&quot;').replace(/'/g, '&#x27;');
+	};
+
 	// Convert "23:45" to "11:45 pm".
 	var un24 = function(t) {
 		if (SETTINGS.twenty_four_hours)
@@ -712,6 +805,17 @@
 		data = data || {};
 		data['period-start'] = $('#period-start').val();
 		data['period-end']   = $('#period-end').val();
+		if ($('#group').length)
+			data['group'] = $('#group').val();
+		if ($('#compare').val()) {
+			data['compare']       = $('#compare').val();
+			data['compare-start'] = $('#compare-start').val();
+			data['compare-end']   = $('#compare-end').val();
+		}
+		$('.period-form-segment').find('input, select').each(function(_, e) {
+			if ($(e).val())
+				data[e.name] = $(e).val();
+		});
 		return data;
 	};
 
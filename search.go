@@ -0,0 +1,94 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+)
+
+// splitSearchPage splits the search page setting in the form "/search?q=" in
+// the path and query parameter. Both are empty if it's not in this form.
+func splitSearchPage(s string) (string, string) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || !strings.HasPrefix(u.Path, "/") || u.Host != "" {
+		return "", ""
+	}
+	q := u.Query()
+	if len(q) != 1 {
+		return "", ""
+	}
+	for k := range q {
+		if k == "" {
+			return "", ""
+		}
+		return u.Path, k
+	}
+	return "", ""
+}
+
+// normalizeSearchTerm lower-cases the search term and collapses whitespace, so
+// that "Foo  bar" and "foo bar " are counted as the same term.
+//
+// Long terms are truncated to 250 bytes, without splitting a multi-byte
+// character.
+func normalizeSearchTerm(t string) string {
+	t = strings.Join(strings.Fields(strings.ToLower(t)), " ")
+	if len(t) > 250 {
+		i := 250
+		for i > 0 && !utf8.RuneStart(t[i]) {
+			i--
+		}
+		t = t[:i]
+	}
+	return t
+}
+
+// SearchStat is the number of times a term was searched for on the site's
+// search page.
+type SearchStat struct {
+	Term  string `db:"term"`
+	Count int    `db:"count"`
+
+	// Number of searches after which the visitor didn't view another page.
+	NoPageview int `db:"no_pageview"`
+}
+
+type SearchStats []SearchStat
+
+// List the most popular search terms for the given period. The returned int
+// is the total number of searches.
+func (s *SearchStats) List(ctx context.Context, start, end time.Time, limit int) (int, error) {
+	db := zdb.MustGet(ctx)
+	site := MustGetSite(ctx)
+
+	var total int
+	err := db.GetContext(ctx, &total, `/* SearchStats.List: total */
+		select coalesce(sum(count), 0) from search_stats
+		where site=$1 and day >= $2 and day <= $3`,
+		site.ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, errors.Wrap(err, "SearchStats.List")
+	}
+
+	err = db.SelectContext(ctx, s, `/* SearchStats.List */
+		select
+			term,
+			sum(count) as count,
+			sum(no_pageview) as no_pageview
+		from search_stats
+		where site=$1 and day >= $2 and day <= $3
+		group by term
+		order by count desc, term
+		limit $4`,
+		site.ID, start.Format("2006-01-02"), end.Format("2006-01-02"), limit)
+	return total, errors.Wrap(err, "SearchStats.List")
+}
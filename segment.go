@@ -0,0 +1,605 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zgo.at/goatcounter/cfg"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/guru"
+	"zgo.at/utils/intutil"
+	"zgo.at/utils/jsonutil"
+	"zgo.at/zdb"
+	"zgo.at/zvalidate"
+)
+
+// Segment filters the entire dashboard on a combination of dimensions, e.g.
+// "visitors from Germany on phones who came from Reddit".
+//
+// The *_stats tables are aggregated per dimension, so these can't be combined;
+// if a segment is active the stats are calculated from the hits table instead.
+type Segment struct {
+	Path     string // Path or title contains this, case-insensitive.
+	Ref      string // Referrer contains this, case-insensitive.
+	Browser  string // Browser name, e.g. "Firefox".
+	Location string // ISO-3166-1 country or ISO-3166-2 region code.
+	Size     string // One of SizeClasses.
+	Event    string // "true" for only events, "false" for only pageviews.
+}
+
+// Screen size classes, in the same order as the groups in Stats.ListSizes().
+var SizeClasses = []string{"phone", "largephone", "tablet", "desktop", "desktophd", "unknown"}
+
+var sizeNames = []string{sizePhones, sizeLargePhones, sizeTablets, sizeDesktop,
+	sizeDesktopHD, sizeUnknown}
+
+// sizeGroup gets the index in SizeClasses for the screen width.
+func sizeGroup(width int) int {
+	switch {
+	case width == 0:
+		return 5
+	case width <= 384:
+		return 0
+	case width <= 1024:
+		return 1
+	case width <= 1440:
+		return 2
+	case width <= 1920:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// Dimensions for Stats.ListSegment().
+const (
+	DimensionBrowsers  = "browsers"
+	DimensionSystems   = "systems"
+	DimensionDevices   = "devices"
+	DimensionSizes     = "sizes"
+	DimensionLocations = "locations"
+	DimensionRefs      = "refs"
+)
+
+// IsZero reports if no filters are set.
+func (s Segment) IsZero() bool { return s == Segment{} }
+
+// Validate the segment.
+func (s Segment) Validate() error {
+	v := zvalidate.New()
+
+	if s.Size != "" {
+		v.Include("segment-size", s.Size, SizeClasses)
+	}
+	if s.Event != "" {
+		v.Include("segment-event", s.Event, []string{"true", "false"})
+	}
+	if s.Location != "" {
+		l := strings.Split(s.Location, "-")
+		if len(l[0]) != 2 || len(l) > 2 {
+			v.Append("segment-location", "must be a country code such as “DE” or a region code such as “US-CA”")
+		}
+	}
+
+	return v.ErrorOrNil()
+}
+
+// String gets a description of the segment.
+func (s Segment) String() string {
+	var d []string
+	if s.Path != "" {
+		d = append(d, fmt.Sprintf("path or title contains “%s”", s.Path))
+	}
+	if s.Ref != "" {
+		d = append(d, fmt.Sprintf("referrer contains “%s”", s.Ref))
+	}
+	if s.Browser != "" {
+		d = append(d, fmt.Sprintf("browser is %s", s.Browser))
+	}
+	if s.Location != "" {
+		d = append(d, fmt.Sprintf("location is %s", strings.ToUpper(s.Location)))
+	}
+	if s.Size != "" {
+		for i, c := range SizeClasses {
+			if c == s.Size {
+				d = append(d, fmt.Sprintf("screen size is “%s”", sizeNames[i]))
+			}
+		}
+	}
+	switch s.Event {
+	case "true":
+		d = append(d, "only events")
+	case "false":
+		d = append(d, "only pageviews")
+	}
+	return strings.Join(d, ", ")
+}
+
+// SegmentMaxDays is the longest period a segment can be used for, as segments
+// are calculated from the hits table rather than the *_stats tables.
+const SegmentMaxDays = 92
+
+// CheckPeriod reports an error if the period is too long to use a segment.
+func (s Segment) CheckPeriod(start, end time.Time) error {
+	if end.Sub(start) > SegmentMaxDays*24*time.Hour {
+		return guru.Errorf(400, "a segment can only be used for periods up to %d days", SegmentMaxDays)
+	}
+	return nil
+}
+
+// where gets the SQL condition for the hits in the segment, with ?
+// placeholders.
+//
+// The browser and screen size can't be filtered in SQL, as they need to be
+// parsed from the User-Agent and size; group() takes care of that.
+func (s Segment) where(ctx context.Context, start, end time.Time) (string, []interface{}, error) {
+	err := s.CheckPeriod(start, end)
+	if err != nil {
+		return "", nil, err
+	}
+
+	where := `site=? and bot=0 and created_at >= ? and created_at <= ?`
+	args := []interface{}{MustGetSite(ctx).ID, start, end}
+
+	if s.Path != "" {
+		p := "%" + escapeLike(strings.ToLower(s.Path)) + "%"
+		where += ` and (lower(path) like ? escape '\' or lower(title) like ? escape '\')`
+		args = append(args, p, p)
+	}
+	if s.Ref != "" {
+		where += ` and lower(ref) like ? escape '\'`
+		args = append(args, "%"+escapeLike(strings.ToLower(s.Ref))+"%")
+	}
+	if s.Location != "" {
+		if l := strings.ToUpper(s.Location); strings.Contains(l, "-") {
+			where += ` and region=?`
+			args = append(args, l)
+		} else {
+			where += ` and location=?`
+			args = append(args, l)
+		}
+	}
+	if s.Event != "" {
+		where += ` and event=?`
+		args = append(args, zdb.Bool(s.Event == "true"))
+	}
+	return where, args, nil
+}
+
+// segmentRow is a group of hits in a segment.
+type segmentRow struct {
+	Name        string   `db:"name"`
+	Event       zdb.Bool `db:"event"`
+	Hour        string   `db:"hour"` // As "2006-01-02 15", in UTC.
+	Title       string   `db:"title"`
+	Browser     string   `db:"browser"`
+	Size        string   `db:"size"`
+	Count       int      `db:"count"`
+	First       int      `db:"first"`        // Hits with first_visit set.
+	Sessions    int      `db:"sessions"`     // Number of distinct sessions.
+	WithSession int      `db:"with_session"` // Hits with a session.
+}
+
+// unique gets the number of unique visitors in the same way as the *_stats
+// tables: the number of sessions, or the number of first visits if there are
+// hits without a session.
+func (r segmentRow) unique() int {
+	if r.WithSession < r.Count {
+		return r.First
+	}
+	if r.Sessions > r.Count {
+		return r.Count
+	}
+	return r.Sessions
+}
+
+func (r *segmentRow) add(o segmentRow) {
+	r.Count += o.Count
+	r.First += o.First
+	r.Sessions += o.Sessions
+	r.WithSession += o.WithSession
+	if o.Title != "" {
+		r.Title = o.Title
+	}
+}
+
+// hourColumn is the created_at column truncated to the hour.
+func hourColumn() string {
+	if cfg.PgSQL {
+		return `to_char(created_at, 'YYYY-MM-DD HH24')`
+	}
+	return `strftime('%Y-%m-%d %H', created_at)`
+}
+
+// group gets the hits in the segment grouped by the given columns, which
+// should be aliased to one of the segmentRow fields. The condition is added to
+// the segment's condition.
+//
+// Rows are also grouped by the browser and screen size if the segment filters
+// on that, so they can be filtered here. The sessions in these rows are
+// counted per browser and size, which is accurate for the browser as it's part
+// of the session, and a close enough estimate for the size.
+func (s Segment) group(
+	ctx context.Context, start, end time.Time,
+	cond string, condArgs []interface{}, cols ...string,
+) ([]segmentRow, error) {
+	where, args, err := s.where(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if cond != "" {
+		where += " and " + cond
+		args = append(args, condArgs...)
+	}
+
+	if s.Browser != "" {
+		cols = append(cols, "browser")
+	}
+	if s.Size != "" {
+		cols = append(cols, "size")
+	}
+	var sel, group string
+	for i, c := range cols {
+		sel += c + ", "
+		group += strconv.Itoa(i+1) + ", "
+	}
+
+	query := `/* Segment.group */
+		select ` + sel + `
+			coalesce(max(title), '')         as title,
+			count(*)                         as count,
+			coalesce(sum(first_visit), 0)    as first,
+			count(distinct session)          as sessions,
+			count(session)                   as with_session
+		from hits
+		where ` + where
+	if group != "" {
+		query += ` group by ` + strings.TrimSuffix(group, ", ")
+	}
+
+	db := zdb.MustGet(ctx)
+	var rows []segmentRow
+	err = db.SelectContext(ctx, &rows, db.Rebind(query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Segment.group")
+	}
+
+	if s.Browser == "" && s.Size == "" {
+		return rows, nil
+	}
+	filtered := rows[:0]
+	for _, r := range rows {
+		if s.Browser != "" {
+			if b, _ := ParseBrowser(r.Browser); !strings.EqualFold(b, s.Browser) {
+				continue
+			}
+		}
+		if s.Size != "" && SizeClasses[sizeGroup(sizeWidth(r.Size))] != s.Size {
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+	return filtered, nil
+}
+
+// sizeWidth gets the screen width from the size column.
+func sizeWidth(size string) int {
+	if i := strings.IndexByte(size, ','); i > -1 {
+		size = size[:i]
+	}
+	w, _ := strconv.ParseFloat(size, 64)
+	return int(w)
+}
+
+// ListSegment lists the top paths for the hits in a segment, the return values
+// are the same as for List().
+func (h *HitStats) ListSegment(
+	ctx context.Context, seg Segment, start, end time.Time, filter string, exclude []string,
+) (int, int, int, int, bool, error) {
+	site := MustGetSite(ctx)
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return 0, 0, 0, 0, false, err
+	}
+	where, args, err := f.where(ctx, start, end)
+	if err != nil {
+		return 0, 0, 0, 0, false, err
+	}
+	// Error pages are listed separately.
+	if where == "" {
+		where = "status=0"
+	} else {
+		where = "status=0 and " + where
+	}
+
+	totals, err := seg.group(ctx, start, end, where, args)
+	if err != nil {
+		return 0, 0, 0, 0, false, err
+	}
+	var total, totalUnique int
+	for _, t := range totals {
+		total += t.Count
+		totalUnique += t.unique()
+	}
+
+	rows, err := seg.group(ctx, start, end, where, args, "path as name", "event")
+	if err != nil {
+		return 0, 0, 0, 0, false, err
+	}
+	var (
+		groups = make(map[string]*segmentRow)
+		order  []string
+	)
+	for _, r := range rows {
+		k := fmt.Sprintf("%s%t", r.Name, r.Event)
+		g, ok := groups[k]
+		if !ok {
+			groups[k] = &segmentRow{Name: r.Name, Event: r.Event}
+			g = groups[k]
+			order = append(order, k)
+		}
+		g.add(r)
+	}
+
+	// Same order as List(): by first visits, and then by path.
+	excl := make(map[string]struct{}, len(exclude))
+	for _, e := range exclude {
+		excl[e] = struct{}{}
+	}
+	sorted := make([]*segmentRow, 0, len(groups))
+	for _, k := range order {
+		if _, ok := excl[groups[k].Name]; !ok {
+			sorted = append(sorted, groups[k])
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].First == sorted[j].First {
+			return sorted[i].Name > sorted[j].Name
+		}
+		return sorted[i].First > sorted[j].First
+	})
+
+	var more bool
+	limit := int(intutil.NonZero(int64(site.Settings.Limits.Page), 10))
+	if len(sorted) > limit {
+		sorted, more = sorted[:limit], true
+	}
+
+	*h = make(HitStats, 0, len(sorted))
+	if len(sorted) == 0 {
+		return total, totalUnique, 0, 0, more, nil
+	}
+	paths := make([]interface{}, 0, len(sorted))
+	for _, g := range sorted {
+		*h = append(*h, HitStat{Path: g.Name, Event: g.Event})
+		paths = append(paths, g.Name)
+	}
+
+	// Create the rows as they would be in hit_stats.
+	hourly, err := seg.group(ctx, start, end,
+		where+" and path in ("+strings.TrimSuffix(strings.Repeat("?, ", len(paths)), ", ")+")",
+		append(append([]interface{}{}, args...), paths...),
+		"path as name", "event", hourColumn()+" as hour")
+	if err != nil {
+		return 0, 0, 0, 0, false, err
+	}
+	var (
+		st    []hitStatRow
+		index = make(map[string]int)
+		count = make(map[int][]int)
+		uniq  = make(map[int][]int)
+	)
+	for _, r := range hourly {
+		k := fmt.Sprintf("%s%t", r.Name, r.Event)
+		if _, ok := groups[k]; !ok {
+			continue
+		}
+		t, err := time.Parse("2006-01-02 15", r.Hour)
+		if err != nil {
+			return 0, 0, 0, 0, false, errors.Wrap(err, "HitStats.ListSegment")
+		}
+
+		day := t.Format("2006-01-02")
+		i, ok := index[day+k]
+		if !ok {
+			d, _ := time.Parse("2006-01-02", day)
+			st = append(st, hitStatRow{Path: r.Name, Event: r.Event, Day: d})
+			i = len(st) - 1
+			index[day+k] = i
+			count[i], uniq[i] = make([]int, 24), make([]int, 24)
+		}
+
+		if r.Title != "" {
+			st[i].Title = r.Title
+		}
+		count[i][t.Hour()] += r.Count
+		uniq[i][t.Hour()] += r.First
+	}
+	for i := range st {
+		st[i].Stats = jsonutil.MustMarshal(count[i])
+		st[i].StatsUnique = jsonutil.MustMarshal(uniq[i])
+	}
+	sort.SliceStable(st, func(i, j int) bool { return st[i].Day.Before(st[j].Day) })
+
+	hh := *h
+	hh.addStats(st, start, end, site.Settings.Timezone.Offset())
+
+	var totalDisplay, totalUniqueDisplay int
+	for i := range hh {
+		hh[i].CountUnique = groups[fmt.Sprintf("%s%t", hh[i].Path, hh[i].Event)].unique()
+		totalDisplay += hh[i].Count
+		totalUniqueDisplay += hh[i].CountUnique
+	}
+	sort.SliceStable(hh, func(i, j int) bool { return hh[i].CountUnique > hh[j].CountUnique })
+
+	return total, totalUnique, totalDisplay, totalUniqueDisplay, more, nil
+}
+
+// ListSegment lists the stats for one of the Dimension* constants for the
+// hits in a segment.
+//
+// The returned int is the total number of pageviews; the bool reports if there
+// are more rows after limit. A limit of 0 means no limit.
+func (h *Stats) ListSegment(
+	ctx context.Context, seg Segment, start, end time.Time, dimension string, limit, offset int,
+) (int, bool, error) {
+	site := MustGetSite(ctx)
+
+	var (
+		col  string
+		name func(string) (string, bool)
+	)
+	switch dimension {
+	case DimensionBrowsers:
+		col = "browser"
+		name = func(ua string) (string, bool) {
+			b, _ := ParseBrowser(ua)
+			return b, b != ""
+		}
+	case DimensionSystems:
+		col = "browser"
+		name = func(ua string) (string, bool) {
+			s, _, _ := ParseSystem(ua)
+			return s, s != ""
+		}
+	case DimensionDevices:
+		col = "browser"
+		name = func(ua string) (string, bool) {
+			s, _, d := ParseSystem(ua)
+			return d, s != ""
+		}
+	case DimensionSizes:
+		col = "size"
+		name = func(size string) (string, bool) { return sizeNames[sizeGroup(sizeWidth(size))], true }
+	case DimensionLocations:
+		col = "location"
+		var countries []struct {
+			Name   string `db:"name"`
+			Alpha2 string `db:"alpha2"`
+		}
+		err := zdb.MustGet(ctx).SelectContext(ctx, &countries,
+			`select name, alpha2 from iso_3166_1`)
+		if err != nil {
+			return 0, false, errors.Wrap(err, "Stats.ListSegment")
+		}
+		names := make(map[string]string, len(countries))
+		for _, c := range countries {
+			names[c.Alpha2] = c.Name
+		}
+		name = func(l string) (string, bool) {
+			if i := strings.Index(l, "-"); i > -1 {
+				l = l[:i]
+			}
+			n, ok := names[l]
+			return n, ok
+		}
+	case DimensionRefs:
+		col = "ref"
+		name = func(ref string) (string, bool) {
+			return ref, site.LinkDomain == "" || !strings.HasPrefix(ref, site.LinkDomain)
+		}
+	default:
+		return 0, false, fmt.Errorf("Stats.ListSegment: invalid dimension: %q", dimension)
+	}
+
+	rows, err := seg.group(ctx, start, end, "", nil, col+" as name")
+	if err != nil {
+		return 0, false, err
+	}
+
+	var (
+		order  []string
+		groups = make(map[string]*segmentRow)
+		total  int
+	)
+	if dimension == DimensionSizes { // Always list all sizes, like ListSizes().
+		order = append(order, sizeNames...)
+	}
+	for _, r := range rows {
+		n, ok := name(r.Name)
+		if !ok {
+			continue
+		}
+		g, ok := groups[n]
+		if !ok {
+			groups[n] = &segmentRow{Name: n}
+			g = groups[n]
+			if dimension != DimensionSizes {
+				order = append(order, n)
+			}
+		}
+		g.add(r)
+		total += r.Count
+	}
+
+	count := func(n string) int {
+		if g, ok := groups[n]; ok {
+			return g.Count
+		}
+		return 0
+	}
+	if dimension != DimensionSizes {
+		sort.SliceStable(order, func(i, j int) bool {
+			if count(order[i]) == count(order[j]) {
+				return order[i] < order[j]
+			}
+			return count(order[i]) > count(order[j])
+		})
+	}
+
+	var more bool
+	if offset > len(order) {
+		offset = len(order)
+	}
+	order = order[offset:]
+	if limit > 0 && len(order) > limit {
+		order, more = order[:limit], true
+	}
+
+	*h = make(Stats, 0, len(order))
+	for _, n := range order {
+		var u int
+		if g, ok := groups[n]; ok {
+			u = g.unique()
+		}
+		*h = append(*h, Stats{{n, count(n), u, nil}}...)
+	}
+	return total, more, nil
+}
+
+// ListSegment lists the heatmap for the hits in a segment; events are only
+// included if the segment is for events.
+func (h *Heatmap) ListSegment(ctx context.Context, seg Segment, start, end time.Time) error {
+	var cond string
+	if seg.Event != "true" {
+		cond = "event=0"
+	}
+	rows, err := seg.group(ctx, start, end, cond, nil, hourColumn()+" as hour")
+	if err != nil {
+		return err
+	}
+
+	loc := MustGetSite(ctx).Settings.Timezone.Loc()
+	*h = Heatmap{}
+	for _, r := range rows {
+		t, err := time.Parse("2006-01-02 15", r.Hour)
+		if err != nil {
+			return errors.Wrap(err, "Heatmap.ListSegment")
+		}
+		t = t.In(loc)
+		h.Hours[t.Weekday()][t.Hour()] += r.Count
+		h.Total += r.Count
+		if h.Hours[t.Weekday()][t.Hour()] > h.Max {
+			h.Max = h.Hours[t.Weekday()][t.Hour()]
+		}
+	}
+	return nil
+}
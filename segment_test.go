@@ -0,0 +1,181 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	. "zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+	"zgo.at/zdb"
+)
+
+const (
+	uaFirefox = "Mozilla/5.0 (X11; Linux x86_64; rv:68.0) Gecko/20100101 Firefox/68.0"
+	uaChrome  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/79.0.3945.117 Safari/537.36"
+)
+
+func TestSegment(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	s1, s2, s3 := int64(1), int64(2), int64(3)
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	gctest.StoreHits(ctx, t, []Hit{
+		{Path: "/a", Browser: uaFirefox, Size: zdb.Floats{400}, Location: "DE",
+			Ref: "https://www.reddit.com/r/golang", Session: &s1, FirstVisit: true, CreatedAt: now},
+		{Path: "/a", Browser: uaChrome, Size: zdb.Floats{1000}, Location: "DE",
+			Ref: "https://www.google.com", Session: &s2, FirstVisit: true, CreatedAt: now},
+		{Path: "/b", Browser: uaFirefox, Size: zdb.Floats{300}, Location: "US", Region: "US-CA",
+			Ref: "https://old.reddit.com", Session: &s3, FirstVisit: true, CreatedAt: now.Add(time.Hour)},
+		{Path: "/e", Event: true, Browser: uaFirefox, Size: zdb.Floats{400}, Location: "DE",
+			Session: &s1, CreatedAt: now.Add(2 * time.Hour)},
+	}...)
+
+	start := time.Date(2019, 8, 31, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2019, 8, 31, 23, 59, 59, 0, time.UTC)
+
+	t.Run("filter", func(t *testing.T) {
+		tests := []struct {
+			seg  Segment
+			want string
+		}{
+			{Segment{}, "4 /a /b /e"},
+			{Segment{Location: "de", Browser: "firefox", Size: "largephone"}, "2 /a /e"},
+			{Segment{Location: "DE", Browser: "Firefox", Size: "largephone", Event: "false"}, "1 /a"},
+			{Segment{Location: "US"}, "1 /b"},
+			{Segment{Location: "us-ca"}, "1 /b"},
+			{Segment{Location: "US-NY"}, "0"},
+			{Segment{Ref: "REDDIT"}, "2 /a /b"},
+			{Segment{Event: "true"}, "1 /e"},
+			{Segment{Path: "/B"}, "1 /b"},
+			{Segment{Size: "unknown"}, "0"},
+
+			// Not wildcards.
+			{Segment{Path: "%"}, "0"},
+			{Segment{Path: "_"}, "0"},
+			{Segment{Ref: "%"}, "0"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.seg.String(), func(t *testing.T) {
+				var pages HitStats
+				total, _, _, _, _, err := pages.ListSegment(ctx, tt.seg, start, end, "", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []string{fmt.Sprintf("%d", total)}
+				for _, p := range pages {
+					got = append(got, p.Path)
+				}
+				sort.Strings(got[1:])
+				if g := strings.Join(got, " "); g != tt.want {
+					t.Errorf("\ngot:  %s\nwant: %s", g, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("period", func(t *testing.T) {
+		var pages HitStats
+		_, _, _, _, _, err := pages.ListSegment(ctx, Segment{Location: "DE"},
+			start.Add(-SegmentMaxDays*24*time.Hour), end, "", nil)
+		if err == nil || !strings.Contains(err.Error(), "can only be used for periods up to") {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		tests := []struct {
+			dim, want string
+		}{
+			{DimensionBrowsers, "total=2 Firefox 2/2"},
+			{DimensionSystems, "total=2 Linux 2/2"},
+			{DimensionLocations, "total=2 Germany 1/1 United States 1/1"},
+			{DimensionSizes, "total=2 Phones 1/1 Large phones, small tablets 1/1 " +
+				"Tablets and small laptops 0/0 Computer monitors 0/0 Computer monitors larger than HD 0/0 (unknown) 0/0"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.dim, func(t *testing.T) {
+				var stats Stats
+				total, _, err := stats.ListSegment(ctx, Segment{Ref: "reddit"}, start, end, tt.dim, 0, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := fmt.Sprintf("total=%d", total)
+				for _, s := range stats {
+					got += fmt.Sprintf(" %s %d/%d", s.Name, s.Count, s.CountUnique)
+				}
+				if got != tt.want {
+					t.Errorf("\ngot:  %s\nwant: %s", got, tt.want)
+				}
+			})
+		}
+
+		var stats Stats
+		_, _, err := stats.ListSegment(ctx, Segment{Ref: "reddit"}, start, end, "nonsense", 0, 0)
+		if err == nil {
+			t.Error("no error for invalid dimension")
+		}
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		var pages HitStats
+		total, totalUnique, totalDisplay, _, more, err := pages.ListSegment(ctx, Segment{Browser: "Firefox"}, start, end, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := fmt.Sprintf("total=%d unique=%d display=%d more=%t", total, totalUnique, totalDisplay, more)
+		for _, p := range pages {
+			got += fmt.Sprintf(" %s %d", p.Path, p.Count)
+		}
+		want := "total=3 unique=2 display=3 more=false /b 1 /a 1 /e 1"
+		if got != want {
+			t.Errorf("\ngot:  %s\nwant: %s", got, want)
+		}
+
+		var h Heatmap
+		err = h.ListSegment(ctx, Segment{Browser: "Firefox"}, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Total != 2 || h.Hours[time.Saturday][14] != 1 || h.Hours[time.Saturday][15] != 1 {
+			t.Errorf("wrong heatmap: %v", h)
+		}
+	})
+}
+
+func TestSegmentValidate(t *testing.T) {
+	tests := []struct {
+		in   Segment
+		want string
+	}{
+		{Segment{}, ""},
+		{Segment{Location: "US-CA", Size: "phone", Event: "true"}, ""},
+		{Segment{Size: "huge"}, "segment-size: must be one of"},
+		{Segment{Event: "yes"}, "segment-event: must be one of"},
+		{Segment{Location: "Germany"}, "segment-location: must be a country code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			err := tt.in.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("\ngot:  %v\nwant: %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -161,6 +161,36 @@ func (s *Session) GetOrCreate(ctx context.Context, path, ua, remoteAddr string)
 	return s.getOrCreate(ctx, path, ua, remoteAddr, 0)
 }
 
+// Seen marks an existing session as seen now, without creating a new one.
+//
+// This is used for the beacons count.js sends when a page is hidden, so that
+// LastSeen includes the time spent on the last page. It reports if a session
+// was found.
+func (s *Session) Seen(ctx context.Context, ua, remoteAddr string) (bool, error) {
+	db := zdb.MustGet(ctx)
+	site := MustGetSite(ctx)
+	curSalt, prevSalt := Salts.Get(ctx)
+
+	for _, salt := range []string{curSalt, prevSalt} {
+		h := sha256.New()
+		h.Write([]byte(fmt.Sprintf("%d%s%s%s", site.ID, ua, remoteAddr, salt)))
+
+		err := db.GetContext(ctx, s, `select * from sessions where site=$1 and hash=$2`, site.ID, h.Sum(nil))
+		if zdb.ErrNoRows(err) {
+			continue
+		}
+		if err != nil {
+			return false, errors.Wrap(err, "Session.Seen")
+		}
+
+		s.LastSeen = Now()
+		_, err = db.ExecContext(ctx, `update sessions set last_seen=$1 where id=$2`,
+			s.LastSeen.Format(zdb.Date), s.ID)
+		return true, errors.Wrap(err, "Session.Seen")
+	}
+	return false, nil
+}
+
 var hashOnce syncutil.Once
 
 func (s *Session) getOrCreate(ctx context.Context, path, ua, remoteAddr string, r int) (firstVisit bool, err error) {
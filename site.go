@@ -42,7 +42,9 @@ var reserved = []string{
 	"chat", "example", "yoursite", "test", "sql",
 }
 
-var statTables = []string{"hit_stats", "browser_stats", "location_stats", "ref_stats", "size_stats"}
+var statTables = []string{"hit_stats", "browser_stats", "system_stats", "location_stats",
+	"language_stats", "ref_stats", "campaign_stats", "size_stats", "visitor_stats",
+	"time_stats", "session_stats", "scroll_stats", "vitals_stats", "experiment_sessions", "search_stats", "broken_stats"}
 
 // Site is a single site which is sending newsletters (i.e. it's a "customer").
 type Site struct {
@@ -72,6 +74,9 @@ type SiteSettings struct {
 	IgnoreIPs        zdb.Strings `json:"ignore_ips"`
 	Timezone         *tz.Zone    `json:"timezone"`
 	Campaigns        zdb.Strings `json:"campaigns"`
+	ChannelRules     zdb.Strings `json:"channel_rules"`
+	ContentGroups    Lines       `json:"content_groups"`
+	SearchPage       string      `json:"search_page"`
 	Limits           struct {
 		Page int `json:"page"`
 		Ref  int `json:"ref"`
@@ -95,6 +100,31 @@ func (ss *SiteSettings) Scan(v interface{}) error {
 	}
 }
 
+// Lines is a list of strings, stored as newline-separated text.
+//
+// This is like zdb.Strings, except that it doesn't split on commas, so the
+// strings can contain them.
+type Lines []string
+
+func (l Lines) String() string { return strings.Join(l, "\n") }
+
+// MarshalText converts the data to a human readable representation.
+func (l Lines) MarshalText() ([]byte, error) { return []byte(l.String()), nil }
+
+// UnmarshalText parses text in to the Go data structure; blank lines are
+// skipped.
+func (l *Lines) UnmarshalText(v []byte) error {
+	lines := []string{}
+	for _, s := range strings.Split(string(v), "\n") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			lines = append(lines, s)
+		}
+	}
+	*l = lines
+	return nil
+}
+
 // Defaults sets fields to default values, unless they're already set.
 func (s *Site) Defaults(ctx context.Context) {
 	// New site: Set default settings.
@@ -158,6 +188,32 @@ func (s *Site) Validate(ctx context.Context) error {
 		}
 	}
 
+	for _, rule := range s.Settings.ChannelRules {
+		host, channel := splitChannelRule(rule)
+		if host == "" {
+			v.Append("settings.channel_rules", fmt.Sprintf("%q is not in the form host=channel", rule))
+			continue
+		}
+		v.Include("settings.channel_rules", channel, Channels)
+	}
+
+	for _, rule := range s.Settings.ContentGroups {
+		name, query := splitContentGroup(rule)
+		if name == "" || query == "" {
+			v.Append("settings.content_groups", fmt.Sprintf("%q is not in the form name=filter", rule))
+			continue
+		}
+		if _, err := ParseFilter(query); err != nil {
+			v.Append("settings.content_groups", fmt.Sprintf("%q: %s", name, err.Error()))
+		}
+	}
+
+	if s.Settings.SearchPage != "" {
+		if p, _ := splitSearchPage(s.Settings.SearchPage); p == "" {
+			v.Append("settings.search_page", "must be a path and a query parameter, such as /search?q=")
+		}
+	}
+
 	v.Domain("link_domain", s.LinkDomain)
 	v.Len("code", s.Code, 2, 50)
 	v.Exclude("code", s.Code, reserved)
@@ -474,7 +530,10 @@ func (s Site) DeleteOlderThan(ctx context.Context, days int) error {
 			}
 		}
 
-		return nil
+		_, err = tx.ExecContext(ctx,
+			`delete from path_titles where site=$1 and last_seen < `+ival,
+			s.ID)
+		return errors.Wrap(err, "Site.DeleteOlderThan: delete path_titles")
 	})
 }
 
@@ -0,0 +1,205 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"zgo.at/goatcounter/cfg"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/guru"
+	"zgo.at/zdb"
+)
+
+// maxSitemapSize is the maximum size of a sitemap; this is the same as the
+// limit in the sitemaps.org protocol.
+const maxSitemapSize = 50 * 1024 * 1024
+
+// ParseSitemap parses a sitemap.xml file, which may be gzip-compressed, and
+// returns the paths of all the listed URLs.
+//
+// Sitemap indexes aren't supported; upload one of the sitemaps it lists
+// instead.
+func ParseSitemap(r io.Reader) ([]string, error) {
+	br := bufio.NewReader(io.LimitReader(r, maxSitemapSize))
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, guru.Errorf(400, "sitemap: %s", err)
+		}
+		defer gz.Close()
+		br = bufio.NewReader(io.LimitReader(gz, maxSitemapSize))
+	}
+
+	var sm struct {
+		XMLName xml.Name
+		URLs    []struct {
+			Loc string `xml:"loc"`
+		} `xml:"url"`
+	}
+	err := xml.NewDecoder(br).Decode(&sm)
+	if err != nil {
+		return nil, guru.Errorf(400, "sitemap: invalid XML: %s", err)
+	}
+	switch sm.XMLName.Local {
+	case "urlset":
+	case "sitemapindex":
+		return nil, guru.New(400, "sitemap: this is a sitemap index; use one of the sitemaps it lists")
+	default:
+		return nil, guru.Errorf(400, "sitemap: unexpected root element <%s>", sm.XMLName.Local)
+	}
+
+	var (
+		paths = make([]string, 0, len(sm.URLs))
+		seen  = make(map[string]struct{}, len(sm.URLs))
+	)
+	for _, u := range sm.URLs {
+		p, err := url.Parse(strings.TrimSpace(u.Loc))
+		if err != nil {
+			continue
+		}
+		path := p.RequestURI()
+		if _, ok := seen[path]; ok {
+			continue
+		}
+		seen[path] = struct{}{}
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil, guru.New(400, "sitemap: no URLs in sitemap")
+	}
+	return paths, nil
+}
+
+var (
+	sitemapClient        = newPublicClient(10 * time.Second)
+	sitemapPrivateClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// FetchSitemap downloads the sitemap at the URL and parses it with
+// ParseSitemap.
+//
+// Only public addresses can be fetched unless cfg.SitemapPrivate is set, and
+// the errors don't include anything from the response, as the URL is user
+// input.
+func FetchSitemap(ctx context.Context, sitemapURL string) ([]string, error) {
+	u, err := url.Parse(strings.TrimSpace(sitemapURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, guru.Errorf(400, "sitemap: not a http or https URL: %q", sitemapURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchSitemap")
+	}
+	client := sitemapClient
+	if cfg.SitemapPrivate {
+		client = sitemapPrivateClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, guru.Errorf(400, "sitemap: could not fetch %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, guru.Errorf(400, "sitemap: could not fetch %s", u)
+	}
+
+	paths, err := ParseSitemap(resp.Body)
+	if err != nil {
+		return nil, guru.Errorf(400, "sitemap: %s is not a valid sitemap", u)
+	}
+	return paths, nil
+}
+
+// SitemapPage is a path with the number of pageviews.
+type SitemapPage struct {
+	Path  string `db:"path"`
+	Count int    `db:"count"`
+}
+
+// SitemapReport compares the paths in a sitemap against the pageviews.
+type SitemapReport struct {
+	Listed int // Number of paths in the sitemap.
+
+	// Paths in the sitemap with threshold or fewer pageviews, with the
+	// fewest pageviews first.
+	Unvisited []SitemapPage
+
+	// Paths with pageviews that aren't in the sitemap, with the most
+	// pageviews first.
+	NotListed []SitemapPage
+}
+
+// Compare the sitemap paths against the pageviews in the given time period.
+//
+// Paths are compared without a trailing slash, so "/about/" in the sitemap
+// matches pageviews for "/about".
+func (s *SitemapReport) Compare(ctx context.Context, paths []string, start, end time.Time, threshold int) error {
+	var hits []SitemapPage
+	err := zdb.MustGet(ctx).SelectContext(ctx, &hits, `/* SitemapReport.Compare */
+		select path, count(*) as count from hits
+		where
+			site=$1 and
+			bot=0 and
+			event=0 and
+			status=0 and
+			created_at >= $2 and
+			created_at <= $3
+		group by path`,
+		MustGetSite(ctx).ID, start, end)
+	if err != nil {
+		return errors.Wrap(err, "SitemapReport.Compare")
+	}
+
+	norm := func(p string) string {
+		if p == "/" {
+			return p
+		}
+		return strings.TrimRight(p, "/")
+	}
+
+	listed := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		listed[norm(p)] = struct{}{}
+	}
+	counts := make(map[string]int, len(hits))
+	for _, h := range hits {
+		counts[norm(h.Path)] += h.Count
+		if _, ok := listed[norm(h.Path)]; !ok {
+			s.NotListed = append(s.NotListed, h)
+		}
+	}
+
+	s.Listed = len(paths)
+	for _, p := range paths {
+		if c := counts[norm(p)]; c <= threshold {
+			s.Unvisited = append(s.Unvisited, SitemapPage{Path: p, Count: c})
+		}
+	}
+
+	sort.SliceStable(s.Unvisited, func(i, j int) bool {
+		if s.Unvisited[i].Count == s.Unvisited[j].Count {
+			return s.Unvisited[i].Path < s.Unvisited[j].Path
+		}
+		return s.Unvisited[i].Count < s.Unvisited[j].Count
+	})
+	sort.SliceStable(s.NotListed, func(i, j int) bool {
+		if s.NotListed[i].Count == s.NotListed[j].Count {
+			return s.NotListed[i].Path < s.NotListed[j].Path
+		}
+		return s.NotListed[i].Count > s.NotListed[j].Count
+	})
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+)
+
+const testSitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>https://example.com/</loc></url>
+	<url><loc>https://example.com/about/</loc><lastmod>2019-08-01</lastmod></url>
+	<url><loc>https://example.com/blog?page=2</loc></url>
+	<url><loc>https://example.com/old</loc></url>
+	<url><loc>https://example.com/old</loc></url>
+</urlset>`
+
+func TestParseSitemap(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte(testSitemap))
+	w.Close()
+
+	tests := []struct {
+		name, in, want, wantErr string
+	}{
+		{"plain", testSitemap, "/ /about/ /blog?page=2 /old", ""},
+		{"gzip", gz.String(), "/ /about/ /blog?page=2 /old", ""},
+		{"index", `<sitemapindex><sitemap><loc>https://example.com/a.xml</loc></sitemap></sitemapindex>`,
+			"", "sitemap index"},
+		{"html", `<html><body>Not found</body></html>`, "", "unexpected root element <html>"},
+		{"empty", `<urlset></urlset>`, "", "no URLs"},
+		{"invalid", `not xml`, "", "invalid XML"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := ParseSitemap(strings.NewReader(tt.in))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("wrong error\nout:  %v\nwant: %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(paths, " "); got != tt.want {
+				t.Errorf("\nout:  %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSitemapReportCompare(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	gctest.StoreHits(ctx, t, []Hit{
+		{Path: "/", CreatedAt: now},
+		{Path: "/", CreatedAt: now},
+		{Path: "/about", CreatedAt: now},
+		{Path: "/unlisted", CreatedAt: now},
+		{Path: "/unlisted", CreatedAt: now},
+		{Path: "/missing", Status: 404, CreatedAt: now},
+		{Path: "click", Event: true, CreatedAt: now},
+		{Path: "/old", CreatedAt: now.Add(-48 * time.Hour)},
+	}...)
+
+	paths, err := ParseSitemap(strings.NewReader(testSitemap))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(pages []SitemapPage) string {
+		var s []string
+		for _, p := range pages {
+			s = append(s, fmt.Sprintf("%s:%d", p.Path, p.Count))
+		}
+		return strings.Join(s, " ")
+	}
+
+	tests := []struct {
+		threshold                int
+		wantUnvisited, wantNotIn string
+	}{
+		{0, "/blog?page=2:0 /old:0", "/unlisted:2"},
+		{1, "/blog?page=2:0 /old:0 /about/:1", "/unlisted:2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d", tt.threshold), func(t *testing.T) {
+			var r SitemapReport
+			err := r.Compare(ctx, paths, now.Add(-time.Hour), now.Add(time.Hour), tt.threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Listed != 4 {
+				t.Errorf("Listed: %d", r.Listed)
+			}
+			if got := list(r.Unvisited); got != tt.wantUnvisited {
+				t.Errorf("Unvisited\nout:  %s\nwant: %s", got, tt.wantUnvisited)
+			}
+			if got := list(r.NotListed); got != tt.wantNotIn {
+				t.Errorf("NotListed\nout:  %s\nwant: %s", got, tt.wantNotIn)
+			}
+		})
+	}
+}
@@ -47,6 +47,7 @@ func init() {
 	// Implemented as function for performance.
 	zhttp.FuncMap["bar_chart"] = BarChart
 	zhttp.FuncMap["horizontal_chart"] = HorizontalChart
+	zhttp.FuncMap["heatmap_chart"] = HeatmapChart
 
 	// Override defaults to take site settings in to account.
 	zhttp.FuncMap["tformat"] = func(s *Site, t time.Time, fmt string) string {
@@ -70,28 +71,30 @@ func BarChart(ctx context.Context, stats []Stat, max int, daily bool) template.H
 	today := now.Format("2006-01-02")
 
 	switch daily {
-	// Daily view.
+	// Daily view; this is also used for the stats grouped per week or month,
+	// where the Day is the first day of the week or month.
 	case true:
 		for _, stat := range stats {
-			if future {
-				b.WriteString(fmt.Sprintf(`<div title="%s" class="f"></div>`, stat.Day))
+			if stat.Day > today {
+				b.WriteString(fmt.Sprintf(`<div%s title="%s" class="f"></div>`,
+					annotationBar(stat.Annotations), stat.Day))
 				continue
 			}
 
-			if stat.Day == today {
-				future = true
-			}
-
 			h := math.Round(float64(stat.Daily) / float64(max) / 0.01)
 			st := ""
 			if h > 0 {
 				hu := math.Round(float64(stat.DailyUnique) / float64(max) / 0.01)
 				st = fmt.Sprintf(` style="height:%.0f%%" data-u="%.0f%%"`, h, hu)
 			}
+			var cmp, cmpTitle string
+			if stat.Compare != nil {
+				cmp, cmpTitle = compareBar(site, stat.Compare.Daily, max)
+			}
 
-			b.WriteString(fmt.Sprintf(`<div%s title="%s|%s|%s"></div>`,
-				st, stat.Day, zhttp.Tnformat(stat.Daily, site.Settings.NumberFormat),
-				zhttp.Tnformat(stat.DailyUnique, site.Settings.NumberFormat)))
+			b.WriteString(fmt.Sprintf(`<div%s%s%s title="%s|%s|%s%s"></div>`,
+				st, cmp, annotationBar(stat.Annotations), stat.Day, zhttp.Tnformat(stat.Daily, site.Settings.NumberFormat),
+				zhttp.Tnformat(stat.DailyUnique, site.Settings.NumberFormat), cmpTitle))
 		}
 
 	// Hourly view.
@@ -118,10 +121,18 @@ func BarChart(ctx context.Context, stats []Stat, max int, daily bool) template.H
 					hu := math.Round(float64(stat.HourlyUnique[shour]) / float64(max) / 0.01)
 					st = fmt.Sprintf(` style="height:%.0f%%" data-u="%.0f%%"`, h, hu)
 				}
-				b.WriteString(fmt.Sprintf(`<div%s title="%s|%[3]d:00|%[3]d:59|%s|%s"></div>`,
-					st, stat.Day, shour,
+				var cmp, cmpTitle, ann string
+				if stat.Compare != nil && shour < len(stat.Compare.Hourly) {
+					cmp, cmpTitle = compareBar(site, stat.Compare.Hourly[shour], max)
+				}
+				if shour == 0 {
+					ann = annotationBar(stat.Annotations)
+				}
+				b.WriteString(fmt.Sprintf(`<div%s%s%s title="%s|%[5]d:00|%[5]d:59|%s|%s%s"></div>`,
+					st, cmp, ann, stat.Day, shour,
 					zhttp.Tnformat(s, site.Settings.NumberFormat),
-					zhttp.Tnformat(stat.HourlyUnique[shour], site.Settings.NumberFormat)))
+					zhttp.Tnformat(stat.HourlyUnique[shour], site.Settings.NumberFormat),
+					cmpTitle))
 			}
 		}
 	}
@@ -129,6 +140,31 @@ func BarChart(ctx context.Context, stats []Stat, max int, daily bool) template.H
 	return template.HTML(b.String())
 }
 
+// compareBar gets the data-c attribute with the height of the comparison line,
+// and the pageviews to add to the title.
+func compareBar(site *Site, count, max int) (string, string) {
+	c := math.Min(100, math.Round(float64(count)/float64(max)/0.01))
+	return fmt.Sprintf(` data-c="%.0f%%"`, c),
+		"|" + zhttp.Tnformat(count, site.Settings.NumberFormat)
+}
+
+// annotationBar gets the data-a attribute with the annotations for a bar; every
+// annotation is on its own line.
+func annotationBar(annotations []Annotation) string {
+	if len(annotations) == 0 {
+		return ""
+	}
+
+	text := make([]string, len(annotations))
+	for i, a := range annotations {
+		text[i] = a.Text
+		if a.URL != nil {
+			text[i] += " (" + *a.URL + ")"
+		}
+	}
+	return fmt.Sprintf(` data-a="%s"`, template.HTMLEscapeString(strings.Join(text, "\n")))
+}
+
 func HorizontalChart(ctx context.Context, stats Stats, total, parentTotal int, cutoff float32, link, other bool) template.HTML {
 	tag := "p"
 	if link {
@@ -159,9 +195,15 @@ func HorizontalChart(ctx context.Context, stats Stats, total, parentTotal int, c
 			template.HTMLEscapeString(browser), perc,
 			zhttp.Tnformat(s.CountUnique, MustGetSite(ctx).Settings.NumberFormat),
 			zhttp.Tnformat(s.Count, MustGetSite(ctx).Settings.NumberFormat))
+		var change string
+		if s.Change != nil {
+			title += fmt.Sprintf(" (%s visits in the comparison period)",
+				zhttp.Tnformat(s.Change.Prev, MustGetSite(ctx).Settings.NumberFormat))
+			change = fmt.Sprintf(` <em class="change %s">%s</em>`, s.Change.Class(), s.Change.Percentage())
+		}
 		b.WriteString(fmt.Sprintf(
-			`<%[4]s href="#_" title="%[1]s"><small>%[2]s</small> <span style="width: %[3]f%%">%.1[3]f%%</span></%[4]s>`,
-			title, template.HTMLEscapeString(browser), perc, tag))
+			`<%[4]s href="#_" title="%[1]s"><small>%[2]s</small> <span style="width: %[3]f%%">%.1[3]f%%</span>%[5]s</%[4]s>`,
+			title, template.HTMLEscapeString(browser), perc, tag, change))
 	}
 
 	// Add "(other)" part.
@@ -173,3 +215,41 @@ func HorizontalChart(ctx context.Context, stats Stats, total, parentTotal int, c
 
 	return template.HTML(b.String())
 }
+
+// HeatmapChart renders the heatmap as a table with a row for every day of the
+// week, and a column for every hour.
+func HeatmapChart(ctx context.Context, h Heatmap) template.HTML {
+	site := MustGetSite(ctx)
+
+	days := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday,
+		time.Thursday, time.Friday, time.Saturday, time.Sunday}
+	if site.Settings.SundayStartsWeek {
+		days = append([]time.Weekday{time.Sunday}, days[:6]...)
+	}
+
+	var b strings.Builder
+	b.WriteString(`<table class="heatmap"><thead><tr><th></th>`)
+	for hour := 0; hour < 24; hour++ {
+		if hour%3 == 0 {
+			b.WriteString(fmt.Sprintf(`<th colspan="3">%d</th>`, hour))
+		}
+	}
+	b.WriteString(`</tr></thead><tbody>`)
+
+	for _, wd := range days {
+		b.WriteString(fmt.Sprintf(`<tr><th>%s</th>`, wd.String()[:3]))
+		for hour, n := range h.Hours[wd] {
+			var o float64
+			if h.Max > 0 {
+				o = float64(n) / float64(h.Max)
+			}
+			b.WriteString(fmt.Sprintf(
+				`<td style="background-color: rgba(154, 21, 164, %.2f)" title="%s %[3]d:00–%[3]d:59: %s pageviews"></td>`,
+				o, wd, hour, zhttp.Tnformat(n, site.Settings.NumberFormat)))
+		}
+		b.WriteString(`</tr>`)
+	}
+
+	b.WriteString(`</tbody></table>`)
+	return template.HTML(b.String())
+}
@@ -0,0 +1,54 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"time"
+
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+)
+
+// Kinds of trends.
+const (
+	TrendPath = "path"
+	TrendRef  = "ref"
+)
+
+// Trend is a path or referrer that received an unusual number of pageviews in
+// the last 24 hours, compared to its own daily pageviews in the four weeks
+// before that.
+//
+// The trends are updated periodically from cron.
+type Trend struct {
+	Site      int64     `db:"site" json:"-"`
+	Kind      string    `db:"kind" json:"kind"`
+	Name      string    `db:"name" json:"name"`
+	Count     int       `db:"count" json:"count"`       // Pageviews in the last 24 hours.
+	Baseline  float64   `db:"baseline" json:"baseline"` // Average pageviews per day.
+	ZScore    float64   `db:"zscore" json:"zscore"`     // Standard scores above the baseline.
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Factor is how many times more pageviews this received than usual.
+func (t Trend) Factor() float64 {
+	if t.Baseline < 1 {
+		return float64(t.Count)
+	}
+	return float64(t.Count) / t.Baseline
+}
+
+type Trends []Trend
+
+// List the trends for this site, with the most unusual first.
+func (t *Trends) List(ctx context.Context, limit int) error {
+	err := zdb.MustGet(ctx).SelectContext(ctx, t, `
+		select * from trending where site=$1
+		order by zscore desc, count desc
+		limit $2`,
+		MustGetSite(ctx).ID, limit)
+	return errors.Wrap(err, "Trends.List")
+}
@@ -0,0 +1,141 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"strings"
+
+	"github.com/mssola/user_agent"
+)
+
+// ParseBrowser gets the browser name and version from the User-Agent header.
+func ParseBrowser(uaHeader string) (string, string) {
+	ua := user_agent.New(uaHeader)
+	browser, version := ua.Browser()
+
+	// A lot of this is wrong, so just skip for now.
+	if browser == "Android" {
+		return "", ""
+	}
+
+	if browser == "Chromium" {
+		browser = "Chrome"
+	}
+
+	// Correct some wrong data.
+	if browser == "Safari" && strings.Count(version, ".") == 3 {
+		browser = "Chrome"
+	}
+	// Note: Safari still shows Chrome and Firefox wrong.
+	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/User-Agent/Firefox
+	// https://developer.chrome.com/multidevice/user-agent#chrome_for_ios_user_agent
+
+	// The "build" and "patch" aren't interesting for us, and "minor" hasn't
+	// been non-0 since 2010.
+	// https://www.chromium.org/developers/version-numbers
+	if browser == "Chrome" || browser == "Opera" {
+		if i := strings.Index(version, "."); i > -1 {
+			version = version[:i]
+		}
+	}
+
+	// Don't include patch version.
+	if browser == "Safari" {
+		v := strings.Split(version, ".")
+		if len(v) > 2 {
+			version = v[0] + "." + v[1]
+		}
+	}
+
+	return browser, version
+}
+
+// ParseSystem gets the operating system, its version, and the device type from
+// the User-Agent header.
+func ParseSystem(uaHeader string) (string, string, string) {
+	ua := user_agent.New(uaHeader)
+	os := ua.OSInfo()
+	system, version := os.Name, os.Version
+
+	platform := ua.Platform()
+	switch {
+	case strings.HasPrefix(platform, "PlayStation"):
+		system, version = "PlayStation", ""
+		if p := strings.Fields(platform); len(p) > 1 {
+			version = p[1]
+		}
+	case strings.HasPrefix(platform, "Nintendo"):
+		system, version = platform, ""
+	case strings.Contains(uaHeader, "Xbox"):
+		system, version = "Xbox", ""
+	case system == "iPhone OS" || platform == "iPad" || platform == "iPod" || platform == "iPod touch":
+		system = "iOS"
+	case system == "Mac OS X":
+		system = "macOS"
+		// Versions before 11 are all "10.x", so include the minor version.
+		if v := strings.Split(version, "."); len(v) > 1 && v[0] == "10" {
+			version = v[0] + "." + v[1]
+		}
+	case strings.HasPrefix(system, "CrOS"):
+		system, version = "Chrome OS", ""
+	case platform == "Web0S":
+		system, version = "webOS", ""
+	}
+
+	// The patch version (and often the minor version) isn't very interesting,
+	// and some systems have the architecture or other junk in there.
+	switch {
+	case system == "Windows" || system == "macOS":
+	case version == "" || version[0] < '0' || version[0] > '9':
+		version = ""
+	default:
+		if i := strings.Index(version, "."); i > -1 {
+			version = version[:i]
+		}
+	}
+
+	if system == "" {
+		return "", "", ""
+	}
+	return system, version, getDevice(uaHeader, ua)
+}
+
+// Device types.
+const (
+	deviceDesktop = "Desktop"
+	deviceMobile  = "Mobile"
+	deviceTablet  = "Tablet"
+	deviceTV      = "TV"
+	deviceConsole = "Console"
+)
+
+// getDevice guesses the device type from the User-Agent header.
+func getDevice(uaHeader string, ua *user_agent.UserAgent) string {
+	l := strings.ToLower(uaHeader)
+	has := func(s ...string) bool {
+		for _, ss := range s {
+			if strings.Contains(l, ss) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case has("playstation", "xbox", "nintendo"):
+		return deviceConsole
+	case has("smart-tv", "smarttv", "googletv", "google tv", "appletv", "apple tv",
+		"android tv", "hbbtv", "netcast", "bravia", "crkey", "roku", "web0s"):
+		return deviceTV
+	case has("ipad", "tablet", "kindle", "silk/", "playbook"):
+		return deviceTablet
+	case has("android") && !has("mobile"):
+		return deviceTablet
+	case ua.Mobile() || has("mobi", "iphone", "ipod", "windows phone"):
+		return deviceMobile
+	default:
+		return deviceDesktop
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+)
+
+// How long ago the previous visit was, as sent by count.js in the lv parameter
+// with the first pageview of the day if "returning" is enabled.
+//
+// Only the day of the last visit is stored in the browser's localStorage, and
+// only these coarse buckets are sent to the server. See
+// docs/sessions.markdown.
+const (
+	LastVisitNew   = "new"   // No previous visit.
+	LastVisitDay   = "1d"    // Yesterday.
+	LastVisitWeek  = "7d"    // 2 to 7 days ago.
+	LastVisitMonth = "30d"   // 8 to 30 days ago.
+	LastVisitOlder = "older" // More than 30 days ago.
+)
+
+// LastVisits is a list of all last visit buckets, in display order.
+var LastVisits = []string{LastVisitNew, LastVisitDay, LastVisitWeek,
+	LastVisitMonth, LastVisitOlder}
+
+// LastVisitLabels are the display names for the last visit buckets.
+var LastVisitLabels = map[string]string{
+	LastVisitNew:   "New visitors",
+	LastVisitDay:   "Returned after a day",
+	LastVisitWeek:  "Returned within a week",
+	LastVisitMonth: "Returned within a month",
+	LastVisitOlder: "Returned after a month",
+}
+
+// VisitorStat is the number of visitors for a single last visit bucket, and the
+// number per day.
+type VisitorStat struct {
+	LastVisit string
+	Count     int
+	Max       int
+	Stats     []Stat
+}
+
+// Label gets the display name.
+func (v VisitorStat) Label() string {
+	if l, ok := LastVisitLabels[v.LastVisit]; ok {
+		return l
+	}
+	return "(unknown)"
+}
+
+// Percentage of the total, formatted for display.
+func (v VisitorStat) Percentage(total int) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.0f%%", float64(v.Count)/float64(total)*100)
+}
+
+type VisitorStats []VisitorStat
+
+// List the new and returning visitors for the given time period, in the same
+// order as LastVisits. Buckets without any visitors are not included.
+//
+// Every visitor is counted at most once per day.
+func (v *VisitorStats) List(ctx context.Context, start, end time.Time) (int, error) {
+	var st []struct {
+		LastVisit string    `db:"last_visit"`
+		Day       time.Time `db:"day"`
+		Count     int       `db:"count"`
+	}
+	err := zdb.MustGet(ctx).SelectContext(ctx, &st, `/* VisitorStats.List */
+		select last_visit, day, sum(count) as count
+		from visitor_stats
+		where site=$1 and day >= $2 and day <= $3
+		group by last_visit, day
+		order by day asc
+	`, MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err != nil {
+		return 0, errors.Wrap(err, "VisitorStats.List")
+	}
+
+	var (
+		total   int
+		grouped = make(map[string]*VisitorStat)
+	)
+	for _, s := range st {
+		g, ok := grouped[s.LastVisit]
+		if !ok {
+			g = &VisitorStat{LastVisit: s.LastVisit, Stats: dailyStats(start, end)}
+			grouped[s.LastVisit] = g
+		}
+
+		g.Count += s.Count
+		total += s.Count
+		if d := addDaily(g.Stats, s.Day, s.Count, s.Count); d > g.Max {
+			g.Max = d
+		}
+	}
+
+	for _, lv := range LastVisits {
+		if g, ok := grouped[lv]; ok {
+			*v = append(*v, *g)
+		}
+	}
+	return total, nil
+}
+
+// Returning gets the percentage of returning visitors, formatted for display.
+func (v VisitorStats) Returning() string {
+	var total, returning int
+	for _, s := range v {
+		total += s.Count
+		if s.LastVisit != LastVisitNew {
+			returning += s.Count
+		}
+	}
+	return VisitorStat{Count: returning}.Percentage(total)
+}
@@ -0,0 +1,181 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"zgo.at/goatcounter/errors"
+	"zgo.at/zdb"
+)
+
+// Vital is a page load or Core Web Vitals metric, as sent by count.js with the
+// beacon if web_vitals is enabled.
+type Vital struct {
+	Name    string // Name in the vitals_stats table and query parameter.
+	Label   string
+	Buckets []int              // Upper bounds of the histogram buckets.
+	Value   func(Beacon) *int  // Get the value from a beacon.
+	Prev    func(Beacon) *int  // Get the value from the previous beacon.
+	Format  func(v int) string // Format a value for display.
+	Max     int                // Maximum valid value.
+	Good    int                // Values up to this are considered "good".
+}
+
+func fmtMillisecond(v int) string {
+	if v < 1000 {
+		return fmt.Sprintf("%dms", v)
+	}
+	return fmt.Sprintf("%.1fs", float64(v)/1000)
+}
+
+var msBuckets = []int{100, 200, 300, 500, 800, 1000, 1500, 2000, 2500, 3000,
+	4000, 5000, 7500, 10000, 20000}
+
+// Vitals is a list of all metrics we collect.
+var Vitals = []Vital{
+	{"ttfb", "Time to first byte", msBuckets,
+		func(b Beacon) *int { return b.TTFB },
+		func(b Beacon) *int { return b.PrevTTFB }, fmtMillisecond, 600000, 800},
+	{"ld", "Page load", msBuckets,
+		func(b Beacon) *int { return b.Load },
+		func(b Beacon) *int { return b.PrevLoad }, fmtMillisecond, 600000, 2500},
+	{"lcp", "Largest contentful paint", msBuckets,
+		func(b Beacon) *int { return b.LCP },
+		func(b Beacon) *int { return b.PrevLCP }, fmtMillisecond, 600000, 2500},
+	{"inp", "Interaction to next paint", []int{50, 100, 200, 300, 500, 750, 1000, 2000, 5000},
+		func(b Beacon) *int { return b.INP },
+		func(b Beacon) *int { return b.PrevINP }, fmtMillisecond, 600000, 200},
+
+	// The CLS is a fractional score, count.js sends it multiplied by 1000.
+	{"cls", "Cumulative layout shift", []int{10, 25, 50, 75, 100, 150, 200, 250, 300, 400, 500, 750, 1000},
+		func(b Beacon) *int { return b.CLS },
+		func(b Beacon) *int { return b.PrevCLS },
+		func(v int) string { return fmt.Sprintf("%.2f", float64(v)/1000) }, 100000, 100},
+}
+
+// GetVital gets a metric by name, or nil if it doesn't exist.
+func GetVital(name string) *Vital {
+	for i := range Vitals {
+		if Vitals[i].Name == name {
+			return &Vitals[i]
+		}
+	}
+	return nil
+}
+
+// VitalStat is the histogram for a single metric.
+type VitalStat struct {
+	Name  string   `db:"name"`
+	Count int      `db:"count"`
+	Hist  zdb.Ints `db:"hist"`
+}
+
+// Vital gets the metric information for this stat.
+func (v VitalStat) Vital() *Vital { return GetVital(v.Name) }
+
+// Record a single value.
+func (v *VitalStat) Record(val int) {
+	if len(v.Hist) == 0 {
+		v.Hist = make(zdb.Ints, len(v.Vital().Buckets)+1)
+	}
+	v.Count++
+	v.Hist[v.bucket(val)]++
+}
+
+// Replace a previously recorded value; this returns false and doesn't change
+// anything if there is no recorded value in the histogram bucket for old.
+func (v *VitalStat) Replace(old, val int) bool {
+	if len(v.Hist) == 0 || v.Hist[v.bucket(old)] == 0 {
+		return false
+	}
+	v.Hist[v.bucket(old)]--
+	v.Hist[v.bucket(val)]++
+	return true
+}
+
+// bucket gets the histogram bucket index for the value.
+func (v VitalStat) bucket(val int) int {
+	buckets := v.Vital().Buckets
+	for i, b := range buckets {
+		if val < b {
+			return i
+		}
+	}
+	return len(buckets)
+}
+
+// Add the values of the other VitalStat to this one.
+func (v *VitalStat) Add(o VitalStat) {
+	if len(v.Hist) == 0 {
+		v.Hist = make(zdb.Ints, len(v.Vital().Buckets)+1)
+	}
+	v.Count += o.Count
+	for i := range o.Hist {
+		if i < len(v.Hist) {
+			v.Hist[i] += o.Hist[i]
+		}
+	}
+}
+
+// Percentile estimates the value for the percentile p.
+func (v VitalStat) Percentile(p int) int {
+	return histPercentile(v.Hist, v.Vital().Buckets, p)
+}
+
+// FormatPercentile formats the value for the percentile p for display.
+func (v VitalStat) FormatPercentile(p int) string {
+	return v.Vital().Format(v.Percentile(p))
+}
+
+// IsGood reports if the value for the percentile p is considered "good".
+func (v VitalStat) IsGood(p int) bool {
+	return v.Percentile(p) <= v.Vital().Good
+}
+
+type VitalStats []VitalStat
+
+// List the metrics for the given time period, in the same order as Vitals.
+//
+// Metrics without any data are not included. If path is not empty only that
+// path is included.
+func (v *VitalStats) List(ctx context.Context, start, end time.Time, path string) error {
+	query := `/* VitalStats.List */
+		select name, count, hist from vitals_stats
+		where site=$1 and day >= $2 and day <= $3`
+	args := []interface{}{MustGetSite(ctx).ID, start.Format("2006-01-02"), end.Format("2006-01-02")}
+	if path != "" {
+		query += ` and lower(path)=lower($4)`
+		args = append(args, path)
+	}
+
+	var st []VitalStat
+	err := zdb.MustGet(ctx).SelectContext(ctx, &st, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "VitalStats.List")
+	}
+
+	grouped := make(map[string]*VitalStat)
+	for _, s := range st {
+		if GetVital(s.Name) == nil { // Removed metric.
+			continue
+		}
+		g, ok := grouped[s.Name]
+		if !ok {
+			g = &VitalStat{Name: s.Name}
+			grouped[s.Name] = g
+		}
+		g.Add(s)
+	}
+
+	for _, vv := range Vitals {
+		if g, ok := grouped[vv.Name]; ok {
+			*v = append(*v, *g)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,417 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"zgo.at/goatcounter/cfg"
+	"zgo.at/goatcounter/errors"
+	"zgo.at/utils/stringutil"
+	"zgo.at/zdb"
+	"zgo.at/zdb/bulk"
+	"zgo.at/zhttp"
+	"zgo.at/zvalidate"
+)
+
+// Webhook events.
+const (
+	WebhookExport   = "export"   // Export is ready to download.
+	WebhookSummary  = "summary"  // Summary of the previous day.
+	WebhookAlert    = "alert"    // Alert was sent.
+	WebhookTopRef   = "top_ref"  // The top referrer changed from the day before.
+	WebhookSettings = "settings" // Site settings were changed.
+)
+
+// WebhookEvents are all the webhook events, with a description.
+var WebhookEvents = [][2]string{
+	{WebhookExport, "Export ready"},
+	{WebhookSummary, "Daily summary"},
+	{WebhookAlert, "Alert sent"},
+	{WebhookTopRef, "New top referrer"},
+	{WebhookSettings, "Settings changed"},
+}
+
+const (
+	// Give up after this many attempts; the delay between attempts doubles
+	// every time, starting at a minute.
+	webhookMaxAttempts = 8
+
+	// Header with the HMAC-SHA256 of the payload, signed with the webhook's
+	// secret.
+	WebhookSignatureHeader = "X-Goatcounter-Signature"
+)
+
+// Webhook is a URL to POST a JSON payload to when an event happens.
+type Webhook struct {
+	ID          int64       `db:"id" json:"id"`
+	Site        int64       `db:"site" json:"-"`
+	URL         string      `db:"url" json:"url"`
+	Secret      string      `db:"secret" json:"secret"`
+	Events      zdb.Strings `db:"events" json:"events"`
+	LastSummary *string     `db:"last_summary" json:"-"`
+	CreatedAt   time.Time   `db:"created_at" json:"created_at"`
+}
+
+// Defaults sets fields to default values, unless they're already set.
+func (w *Webhook) Defaults(ctx context.Context) {
+	if w.Site == 0 {
+		w.Site = MustGetSite(ctx).ID
+	}
+	w.URL = strings.TrimSpace(w.URL)
+	if w.Secret == "" {
+		w.Secret = zhttp.Secret()
+	}
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = Now()
+	}
+	if w.LastSummary == nil {
+		// Start with the summary of the first full day.
+		day := w.CreatedAt.Add(-24 * time.Hour).Format("2006-01-02")
+		w.LastSummary = &day
+	}
+}
+
+// Validate the object.
+func (w *Webhook) Validate(ctx context.Context) error {
+	v := zvalidate.New()
+
+	v.Required("site", w.Site)
+	v.Required("url", w.URL)
+	v.Len("url", w.URL, 0, 2048)
+	if u := v.URL("url", w.URL); u != nil {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			v.Append("url", "must be a http or https URL")
+		}
+		// The delivery checks the resolved address as well, but report the
+		// obvious cases here.
+		if ip := net.ParseIP(u.Hostname()); ip != nil && !PublicIP(ip) {
+			v.Append("url", "must be a public address")
+		}
+	}
+
+	if len(w.Events) == 0 {
+		v.Append("events", "select at least one event")
+	}
+	for _, e := range w.Events {
+		v.Include("events", e, []string{WebhookExport, WebhookSummary,
+			WebhookAlert, WebhookTopRef, WebhookSettings})
+	}
+
+	return v.ErrorOrNil()
+}
+
+// Insert a new row.
+func (w *Webhook) Insert(ctx context.Context) error {
+	if w.ID > 0 {
+		return errors.New("ID > 0")
+	}
+
+	w.Defaults(ctx)
+	err := w.Validate(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := `insert into webhooks (site, url, secret, events, last_summary, created_at)
+		values ($1, $2, $3, $4, $5, $6)`
+	args := []interface{}{w.Site, w.URL, w.Secret, w.Events, w.LastSummary, w.CreatedAt.Format(zdb.Date)}
+	if cfg.PgSQL {
+		err = zdb.MustGet(ctx).GetContext(ctx, &w.ID, query+" returning id", args...)
+		return errors.Wrap(err, "Webhook.Insert")
+	}
+
+	res, err := zdb.MustGet(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return errors.Wrap(err, "Webhook.Insert")
+	}
+	w.ID, err = res.LastInsertId()
+	return errors.Wrap(err, "Webhook.Insert")
+}
+
+// Delete a webhook and its delivery log.
+func (w *Webhook) Delete(ctx context.Context, id int64) error {
+	return zdb.TX(ctx, func(ctx context.Context, tx zdb.DB) error {
+		site := MustGetSite(ctx).ID
+		_, err := tx.ExecContext(ctx,
+			`delete from webhook_deliveries where site=$1 and webhook=$2`, site, id)
+		if err != nil {
+			return errors.Wrap(err, "Webhook.Delete")
+		}
+		_, err = tx.ExecContext(ctx,
+			`delete from webhooks where site=$1 and id=$2`, site, id)
+		return errors.Wrap(err, "Webhook.Delete")
+	})
+}
+
+// Sign the payload with the webhook's secret.
+func (w Webhook) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SummaryDone records that the daily summary for day was queued.
+func (w *Webhook) SummaryDone(ctx context.Context, day string) error {
+	_, err := zdb.MustGet(ctx).ExecContext(ctx,
+		`update webhooks set last_summary=$1 where id=$2`, day, w.ID)
+	if err != nil {
+		return errors.Wrap(err, "Webhook.SummaryDone")
+	}
+	w.LastSummary = &day
+	return nil
+}
+
+// Webhooks is a list of webhooks.
+type Webhooks []Webhook
+
+// List all webhooks for the current site.
+func (w *Webhooks) List(ctx context.Context) error {
+	return errors.Wrap(zdb.MustGet(ctx).SelectContext(ctx, w,
+		`select * from webhooks where site=$1 order by created_at, id`,
+		MustGetSite(ctx).ID), "Webhooks.List")
+}
+
+// ListAll lists the webhooks for all sites.
+func (w *Webhooks) ListAll(ctx context.Context) error {
+	return errors.Wrap(zdb.MustGet(ctx).SelectContext(ctx, w,
+		`select * from webhooks order by site, id`), "Webhooks.ListAll")
+}
+
+// WebhookPayload is the JSON payload that's sent.
+type WebhookPayload struct {
+	Event     string      `json:"event"`
+	Site      string      `json:"site"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// TriggerWebhooks queues a delivery for all webhooks of the current site that
+// subscribe to the event; they're sent from cron.
+func TriggerWebhooks(ctx context.Context, event string, data interface{}) error {
+	site := MustGetSite(ctx)
+
+	var hooks Webhooks
+	err := hooks.List(ctx)
+	if err != nil {
+		return errors.Wrap(err, "TriggerWebhooks")
+	}
+
+	now := Now()
+	payload, err := json.Marshal(WebhookPayload{
+		Event:     event,
+		Site:      site.URL(),
+		CreatedAt: now,
+		Data:      data,
+	})
+	if err != nil {
+		return errors.Wrap(err, "TriggerWebhooks")
+	}
+
+	ins := bulk.NewInsert(ctx, "webhook_deliveries", []string{"site", "webhook",
+		"event", "payload", "next_attempt", "created_at"})
+	for _, w := range hooks {
+		if stringutil.Contains(w.Events, event) {
+			ins.Values(site.ID, w.ID, event, string(payload), now.Format(zdb.Date), now.Format(zdb.Date))
+		}
+	}
+	return errors.Wrap(ins.Finish(), "TriggerWebhooks")
+}
+
+// States for webhook deliveries.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is a payload to send to a webhook, and the result of the
+// last attempt.
+type WebhookDelivery struct {
+	ID           int64     `db:"id" json:"id"`
+	Site         int64     `db:"site" json:"-"`
+	Webhook      int64     `db:"webhook" json:"webhook"`
+	Event        string    `db:"event" json:"event"`
+	Payload      string    `db:"payload" json:"payload"`
+	State        string    `db:"state" json:"state"`
+	Attempts     int       `db:"attempts" json:"attempts"`
+	ResponseCode int       `db:"response_code" json:"response_code"`
+	Error        string    `db:"error" json:"error"`
+	NextAttempt  time.Time `db:"next_attempt" json:"next_attempt"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+
+	URL string `db:"url" json:"url"` // From the webhook.
+}
+
+var webhookClient = newPublicClient(10 * time.Second)
+
+// Deliver the payload to the webhook.
+//
+// The delivery is retried with exponential backoff if the webhook doesn't
+// respond with a 2xx status code, until webhookMaxAttempts is reached. Only the
+// status code is stored; the response body is never read.
+func (d *WebhookDelivery) Deliver(ctx context.Context, w Webhook, now time.Time) error {
+	d.Attempts++
+	d.ResponseCode, d.Error = 0, ""
+
+	err := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL,
+			strings.NewReader(d.Payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "GoatCounter webhook")
+		req.Header.Set("X-Goatcounter-Event", d.Event)
+		req.Header.Set(WebhookSignatureHeader, w.Sign([]byte(d.Payload)))
+
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		d.ResponseCode = resp.StatusCode
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("status code %d", resp.StatusCode)
+		}
+		return nil
+	}()
+
+	switch {
+	case err == nil:
+		d.State = DeliveryDelivered
+	case d.Attempts >= webhookMaxAttempts:
+		d.State = DeliveryFailed
+		d.Error = err.Error()
+	default:
+		d.State = DeliveryPending
+		d.Error = err.Error()
+		d.NextAttempt = now.Add(time.Minute << (d.Attempts - 1))
+	}
+	if len(d.Error) > 1000 {
+		d.Error = d.Error[:1000]
+	}
+
+	_, err = zdb.MustGet(ctx).ExecContext(ctx, `update webhook_deliveries set
+			state=$1, attempts=$2, response_code=$3, error=$4, next_attempt=$5
+		where id=$6`,
+		d.State, d.Attempts, d.ResponseCode, d.Error, d.NextAttempt.Format(zdb.Date), d.ID)
+	return errors.Wrap(err, "WebhookDelivery.Deliver")
+}
+
+// WebhookDeliveries is a list of webhook deliveries.
+type WebhookDeliveries []WebhookDelivery
+
+// ListDue lists the pending deliveries for all sites that should be attempted
+// at now.
+func (d *WebhookDeliveries) ListDue(ctx context.Context, now time.Time) error {
+	return errors.Wrap(zdb.MustGet(ctx).SelectContext(ctx, d, `
+		select webhook_deliveries.*, webhooks.url from webhook_deliveries
+		join webhooks on webhooks.id = webhook_deliveries.webhook
+		where state=$1 and next_attempt <= $2
+		order by webhook_deliveries.id`,
+		DeliveryPending, now.Format(zdb.Date)), "WebhookDeliveries.ListDue")
+}
+
+// List the most recent deliveries for the current site.
+func (d *WebhookDeliveries) List(ctx context.Context, limit int) error {
+	return errors.Wrap(zdb.MustGet(ctx).SelectContext(ctx, d, `
+		select webhook_deliveries.*, webhooks.url from webhook_deliveries
+		join webhooks on webhooks.id = webhook_deliveries.webhook
+		where webhook_deliveries.site=$1
+		order by webhook_deliveries.created_at desc, webhook_deliveries.id desc
+		limit $2`,
+		MustGetSite(ctx).ID, limit), "WebhookDeliveries.List")
+}
+
+// DailySummary is the data for the daily summary webhook.
+type DailySummary struct {
+	Day       string         `json:"day"`
+	Pageviews int            `json:"pageviews"`
+	Visitors  int            `json:"visitors"`
+	Paths     []SummaryCount `json:"paths"`
+	Refs      []SummaryCount `json:"refs"`
+}
+
+// SummaryCount is a path or referrer with the number of pageviews.
+type SummaryCount struct {
+	Name  string `db:"name" json:"name"`
+	Count int    `db:"count" json:"count"`
+}
+
+// Summarize the pageviews for the day.
+func (s *DailySummary) Summarize(ctx context.Context, day time.Time) error {
+	var (
+		db    = zdb.MustGet(ctx)
+		site  = MustGetSite(ctx).ID
+		start = day.Format("2006-01-02") + " 00:00:00"
+		end   = day.Format("2006-01-02") + " 23:59:59"
+	)
+	s.Day = day.Format("2006-01-02")
+
+	var t struct {
+		Pageviews int `db:"pageviews"`
+		Visitors  int `db:"visitors"`
+	}
+	err := db.GetContext(ctx, &t, `/* DailySummary.Summarize: totals */
+		select count(*) as pageviews, coalesce(sum(first_visit), 0) as visitors from hits
+		where site=$1 and bot=0 and event=0 and status=0 and created_at >= $2 and created_at <= $3`,
+		site, start, end)
+	if err != nil {
+		return errors.Wrap(err, "DailySummary.Summarize")
+	}
+	s.Pageviews, s.Visitors = t.Pageviews, t.Visitors
+
+	err = db.SelectContext(ctx, &s.Paths, `/* DailySummary.Summarize: paths */
+		select path as name, count(*) as count from hits
+		where site=$1 and bot=0 and event=0 and status=0 and created_at >= $2 and created_at <= $3
+		group by path
+		order by count desc, path
+		limit 5`,
+		site, start, end)
+	if err != nil {
+		return errors.Wrap(err, "DailySummary.Summarize")
+	}
+
+	s.Refs, err = topRefs(ctx, day, 5)
+	return err
+}
+
+// topRefs gets the referrers with the most pageviews on the day, excluding
+// internal referrers.
+func topRefs(ctx context.Context, day time.Time, limit int) ([]SummaryCount, error) {
+	var refs []SummaryCount
+	err := zdb.MustGet(ctx).SelectContext(ctx, &refs, `/* topRefs */
+		select ref as name, sum(count) as count from ref_stats
+		where site=$1 and event=0 and day=$2 and ref != '' and channel != 'internal'
+		group by ref
+		order by count desc, ref
+		limit $3`,
+		MustGetSite(ctx).ID, day.Format("2006-01-02"), limit)
+	return refs, errors.Wrap(err, "topRefs")
+}
+
+// TopRefChanged gets the referrer with the most pageviews on the day, and
+// reports if it's different from the day before.
+func TopRefChanged(ctx context.Context, day time.Time) (SummaryCount, bool, error) {
+	cur, err := topRefs(ctx, day, 1)
+	if err != nil || len(cur) == 0 {
+		return SummaryCount{}, false, err
+	}
+	prev, err := topRefs(ctx, day.Add(-24*time.Hour), 1)
+	if err != nil {
+		return SummaryCount{}, false, err
+	}
+	return cur[0], len(prev) == 0 || prev[0].Name != cur[0].Name, nil
+}
@@ -0,0 +1,134 @@
+// Copyright © 2019 Martin Tournoij <martin@arp242.net>
+// This file is part of GoatCounter and published under the terms of the EUPL
+// v1.2, which can be found in the LICENSE file or at http://eupl12.zgo.at
+
+package goatcounter_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "zgo.at/goatcounter"
+	"zgo.at/goatcounter/gctest"
+)
+
+func TestWebhookValidate(t *testing.T) {
+	tests := []struct {
+		in      Webhook
+		wantErr string
+	}{
+		{Webhook{Site: 1, URL: "https://example.com/hook", Events: []string{WebhookAlert}}, ""},
+		{Webhook{Site: 1, URL: "", Events: []string{WebhookAlert}}, "url"},
+		{Webhook{Site: 1, URL: "ftp://example.com", Events: []string{WebhookAlert}}, "url"},
+		{Webhook{Site: 1, URL: "http://localhost:8080/hook", Events: []string{WebhookAlert}}, "url"},
+		{Webhook{Site: 1, URL: "http://127.0.0.1/hook", Events: []string{WebhookAlert}}, "must be a public address"},
+		{Webhook{Site: 1, URL: "http://[::1]/hook", Events: []string{WebhookAlert}}, "url"},
+		{Webhook{Site: 1, URL: "http://10.0.0.1/hook", Events: []string{WebhookAlert}}, "must be a public address"},
+		{Webhook{Site: 1, URL: "http://169.254.169.254/latest/meta-data", Events: []string{WebhookAlert}}, "must be a public address"},
+		{Webhook{Site: 1, URL: "https://example.com/hook"}, "events"},
+		{Webhook{Site: 1, URL: "https://example.com/hook", Events: []string{"x"}}, "events"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in.URL, func(t *testing.T) {
+			err := tt.in.Validate(nil)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("wrong error\nout:  %v\nwant: %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookSign(t *testing.T) {
+	w := Webhook{Secret: "key"}
+	out := w.Sign([]byte("The quick brown fox jumps over the lazy dog"))
+	want := "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if out != want {
+		t.Errorf("\nout:  %s\nwant: %s", out, want)
+	}
+}
+
+func TestWebhookDeliver(t *testing.T) {
+	ctx, clean := gctest.DB(t)
+	defer clean()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oh noes", 500)
+	}))
+	defer srv.Close()
+
+	defer func(f func(net.IP) bool) { PublicIP = f }(PublicIP)
+	PublicIP = func(net.IP) bool { return true }
+
+	hook := Webhook{URL: srv.URL, Events: []string{WebhookSettings}}
+	err := hook.Insert(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = TriggerWebhooks(ctx, WebhookSettings, map[string]string{"x": "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2019, 8, 31, 14, 42, 0, 0, time.UTC)
+	var d WebhookDeliveries
+	err = d.ListDue(ctx, Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d) != 1 {
+		t.Fatalf("len(d) = %d", len(d))
+	}
+
+	t.Run("private", func(t *testing.T) {
+		defer func(f func(net.IP) bool) { PublicIP = f }(PublicIP)
+		PublicIP = func(ip net.IP) bool { return !ip.IsLoopback() }
+
+		d := d[0]
+		err := d.Deliver(ctx, hook, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.ResponseCode != 0 || !strings.Contains(d.Error, "is not allowed") {
+			t.Fatalf("%#v", d)
+		}
+	})
+
+	for i := 1; i <= 8; i++ {
+		err := d[0].Deliver(ctx, hook, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wantState := DeliveryPending
+		if i == 8 {
+			wantState = DeliveryFailed
+		}
+		if d[0].State != wantState || d[0].Attempts != i || d[0].ResponseCode != 500 ||
+			d[0].Error != "status code 500" {
+			t.Fatalf("attempt %d: %#v", i, d[0])
+		}
+		if i == 3 && !d[0].NextAttempt.Equal(now.Add(4*time.Minute)) {
+			t.Errorf("wrong next_attempt: %s", d[0].NextAttempt)
+		}
+	}
+
+	var list WebhookDeliveries
+	err = list.List(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].State != DeliveryFailed || list[0].Attempts != 8 || list[0].URL != srv.URL {
+		t.Errorf("wrong delivery log: %#v", list)
+	}
+}